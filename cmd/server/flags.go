@@ -0,0 +1,75 @@
+package main
+
+import (
+	"flag"
+	"os"
+	"time"
+
+	"github.com/passingbreeze-bonfire/perplexity-mcp-golang/internal"
+)
+
+// cliFlags holds command-line settings. Flags that are given override the
+// config file and environment; omitted flags leave those values untouched.
+type cliFlags struct {
+	fs *flag.FlagSet
+
+	configPath string
+	transport  string
+	host       string
+	port       int
+	model      string
+	timeout    time.Duration
+	logLevel   string
+}
+
+func parseFlags(args []string) (*cliFlags, error) {
+	f := newCLIFlags("perplexity-mcp-server")
+	if err := f.fs.Parse(args); err != nil {
+		return nil, err
+	}
+	return f, nil
+}
+
+// newCLIFlags defines the server's flags on a flag set named name, which
+// subcommands may add their own flags to before parsing
+func newCLIFlags(name string) *cliFlags {
+	f := &cliFlags{fs: flag.NewFlagSet(name, flag.ContinueOnError)}
+
+	f.fs.StringVar(&f.configPath, "config", os.Getenv("CONFIG_PATH"), "path to a YAML configuration file (env: CONFIG_PATH)")
+	f.fs.StringVar(&f.transport, "transport", internal.TransportStdio, "transport to serve on: stdio or http (env: MCP_TRANSPORT)")
+	f.fs.StringVar(&f.host, "host", internal.DefaultHTTPHost, "listen host for the http transport (env: MCP_HOST)")
+	f.fs.IntVar(&f.port, "port", internal.DefaultHTTPPort, "listen port for the http transport (env: MCP_PORT)")
+	f.fs.StringVar(&f.model, "model", "sonar", "default Sonar model (env: PERPLEXITY_DEFAULT_MODEL)")
+	f.fs.DurationVar(&f.timeout, "timeout", 30*time.Second, "Perplexity API request timeout (env: REQUEST_TIMEOUT_SECONDS)")
+	f.fs.StringVar(&f.logLevel, "log-level", "info", "log level: debug, info, warn, error (env: LOG_LEVEL)")
+	return f
+}
+
+// set reports whether the flag name was given on the command line
+func (f *cliFlags) set(name string) bool {
+	given := false
+	f.fs.Visit(func(fl *flag.Flag) {
+		given = given || fl.Name == name
+	})
+	return given
+}
+
+// apply overrides config with the flags that were set explicitly
+func (f *cliFlags) apply(config *internal.Config) {
+	f.fs.Visit(func(fl *flag.Flag) {
+		switch fl.Name {
+		case "transport":
+			config.Transport = f.transport
+		case "host":
+			config.Host = f.host
+		case "port":
+			config.Port = f.port
+		case "model":
+			config.DefaultModel = f.model
+		case "timeout":
+			config.RequestTimeout = f.timeout
+		case "log-level":
+			config.LogLevel = f.logLevel
+		}
+	})
+}
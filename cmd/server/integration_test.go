@@ -54,6 +54,7 @@ type TestHelper struct {
 	stdin  io.WriteCloser
 	stdout io.ReadCloser
 	stderr io.ReadCloser
+	reader *bufio.Reader
 	t      *testing.T
 }
 
@@ -61,7 +62,7 @@ func NewTestHelper(t *testing.T) *TestHelper {
 	// Set required environment variable for testing
 	os.Setenv("PERPLEXITY_API_KEY", "test-key-for-integration-tests")
 
-	cmd := exec.Command("go", "run", "./main.go")
+	cmd := exec.Command("go", "run", ".")
 
 	stdin, err := cmd.StdinPipe()
 	require.NoError(t, err)
@@ -77,6 +78,7 @@ func NewTestHelper(t *testing.T) *TestHelper {
 		stdin:  stdin,
 		stdout: stdout,
 		stderr: stderr,
+		reader: bufio.NewReader(stdout),
 		t:      t,
 	}
 }
@@ -127,8 +129,8 @@ func (th *TestHelper) SendRequest(req JSONRPCRequest) {
 }
 
 func (th *TestHelper) ReadResponse() JSONRPCResponse {
-	reader := bufio.NewReader(th.stdout)
-	line, _, err := reader.ReadLine()
+	// Read whole lines; responses such as tools/list exceed bufio's default buffer
+	line, err := th.reader.ReadBytes('\n')
 	require.NoError(th.t, err)
 
 	var resp JSONRPCResponse
@@ -146,8 +148,7 @@ func (th *TestHelper) ReadResponseWithTimeout(timeout time.Duration) (JSONRPCRes
 	errorChan := make(chan error, 1)
 
 	go func() {
-		reader := bufio.NewReader(th.stdout)
-		line, _, err := reader.ReadLine()
+		line, err := th.reader.ReadBytes('\n')
 		if err != nil {
 			errorChan <- err
 			return
@@ -272,17 +273,21 @@ func TestStdioTransportToolsList(t *testing.T) {
 	assert.Equal(t, 2, int(resp.ID.(float64)))
 	assert.Nil(t, resp.Error)
 
-	// Verify we have the perplexity_search tool
+	// Verify we have the registered tools
 	result, ok := resp.Result.(map[string]interface{})
 	require.True(t, ok)
 
 	tools, ok := result["tools"].([]interface{})
 	require.True(t, ok)
-	require.Len(t, tools, 1)
+	require.Len(t, tools, 16)
 
-	tool, ok := tools[0].(map[string]interface{})
-	require.True(t, ok)
-	assert.Equal(t, "perplexity_search", tool["name"])
+	var names []string
+	for _, entry := range tools {
+		tool, ok := entry.(map[string]interface{})
+		require.True(t, ok)
+		names = append(names, tool["name"].(string))
+	}
+	assert.ElementsMatch(t, []string{"perplexity_search", "perplexity_get_section", "perplexity_annotate", "perplexity_check_against", "perplexity_usage", "perplexity_raw", "perplexity_sec_search", "perplexity_news", "perplexity_academic", "perplexity_research_async", "perplexity_job_status", "perplexity_job_result", "perplexity_job_cancel", "perplexity_batch_search", "perplexity_summarize", "perplexity_research_workflow"}, names)
 }
 
 func TestStdioTransportValidRequest(t *testing.T) {
@@ -531,6 +536,114 @@ func TestStdioTransportInvalidToolName(t *testing.T) {
 	assert.NotNil(t, resp.Error)
 }
 
+func TestStdioTransportGetSectionUnknownResult(t *testing.T) {
+	helper := NewTestHelper(t)
+	defer helper.Stop()
+
+	helper.Start()
+
+	// Initialize first
+	initReq := JSONRPCRequest{
+		JSONRPC: "2.0",
+		Method:  "initialize",
+		Params: InitializeParams{
+			ProtocolVersion: "2024-11-05",
+			Capabilities:    map[string]interface{}{},
+			ClientInfo: ClientInfo{
+				Name:    "test-client",
+				Version: "1.0.0",
+			},
+		},
+		ID: 1,
+	}
+
+	helper.SendRequest(initReq)
+	helper.ReadResponseWithTimeout(2 * time.Second)
+
+	// Sections can only be retrieved for results the server has seen
+	req := JSONRPCRequest{
+		JSONRPC: "2.0",
+		Method:  "tools/call",
+		Params: ToolCallParams{
+			Name: "perplexity_get_section",
+			Arguments: map[string]interface{}{
+				"result_id": "unknown-result",
+				"section":   0,
+			},
+		},
+		ID: 2,
+	}
+
+	helper.SendRequest(req)
+
+	resp, err := helper.ReadResponseWithTimeout(5 * time.Second)
+	require.NoError(t, err)
+
+	assert.Equal(t, "2.0", resp.JSONRPC)
+	assert.Equal(t, 2, int(resp.ID.(float64)))
+	assert.NotNil(t, resp.Error)
+}
+
+func TestStdioTransportFeatureManifest(t *testing.T) {
+	helper := NewTestHelper(t)
+	defer helper.Stop()
+
+	helper.Start()
+
+	// Initialize first
+	initReq := JSONRPCRequest{
+		JSONRPC: "2.0",
+		Method:  "initialize",
+		Params: InitializeParams{
+			ProtocolVersion: "2024-11-05",
+			Capabilities:    map[string]interface{}{},
+			ClientInfo: ClientInfo{
+				Name:    "test-client",
+				Version: "1.0.0",
+			},
+		},
+		ID: 1,
+	}
+
+	helper.SendRequest(initReq)
+	helper.ReadResponseWithTimeout(2 * time.Second)
+
+	req := JSONRPCRequest{
+		JSONRPC: "2.0",
+		Method:  "resources/read",
+		Params: map[string]interface{}{
+			"uri": "perplexity://features",
+		},
+		ID: 2,
+	}
+
+	helper.SendRequest(req)
+
+	resp, err := helper.ReadResponseWithTimeout(5 * time.Second)
+	require.NoError(t, err)
+
+	assert.Equal(t, 2, int(resp.ID.(float64)))
+	assert.Nil(t, resp.Error)
+
+	result, ok := resp.Result.(map[string]interface{})
+	require.True(t, ok)
+
+	contents, ok := result["contents"].([]interface{})
+	require.True(t, ok)
+	require.Len(t, contents, 1)
+
+	content, ok := contents[0].(map[string]interface{})
+	require.True(t, ok)
+
+	var manifest struct {
+		Server   string          `json:"server"`
+		Features map[string]bool `json:"features"`
+	}
+	require.NoError(t, json.Unmarshal([]byte(content["text"].(string)), &manifest))
+	assert.Equal(t, "perplexity-mcp-server", manifest.Server)
+	assert.True(t, manifest.Features["sessions"])
+}
+
 func TestStdioTransportInvalidMethodName(t *testing.T) {
 	helper := NewTestHelper(t)
 	defer helper.Stop()
@@ -585,7 +698,7 @@ func TestStdioTransportStderrLogsOnly(t *testing.T) {
 
 	// Check that stderr contains log messages
 	stderrContent := helper.ReadStderr()
-	assert.Contains(t, stderrContent, "[MAIN]") // Should contain main process logs
+	assert.Contains(t, stderrContent, `"component":"main"`) // Should contain structured main process logs
 
 	// Verify that stdout only contains JSON-RPC responses, no log pollution
 	// This is implicitly tested by successful JSON parsing of responses
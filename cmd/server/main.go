@@ -1,57 +1,507 @@
 package main
 
 import (
-	"log"
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"log/slog"
+	"net/http"
 	"os"
+	"os/signal"
+	"syscall"
+	"time"
 
 	"github.com/mark3labs/mcp-go/server"
 	"github.com/passingbreeze-bonfire/perplexity-mcp-golang/internal"
 )
 
+// flushTimeout bounds how long pending error reports are sent for on exit
+const flushTimeout = 10 * time.Second
+
 func main() {
-	// Direct all logging to stderr
-	log.SetOutput(os.Stderr)
-	logger := log.New(os.Stderr, "[MAIN] ", log.LstdFlags|log.Lshortfile)
+	// Subcommands run once without serving MCP
+	if len(os.Args) > 1 {
+		switch os.Args[1] {
+		case "search":
+			os.Exit(runSearch(os.Args[2:]))
+		case "validate":
+			os.Exit(runValidate(os.Args[2:]))
+		}
+	}
+
+	flags, err := parseFlags(os.Args[1:])
+	if err != nil {
+		if errors.Is(err, flag.ErrHelp) {
+			os.Exit(0)
+		}
+		os.Exit(2)
+	}
+
+	// Log structured JSON to stderr, keeping stdout free for the stdio transport.
+	// Its level, format and output are set once the configuration is loaded.
+	level := new(slog.LevelVar)
+	slog.SetDefault(internal.NewLogger(os.Stderr, level, internal.LogFormatJSON))
+	logger := slog.Default().With("component", "main")
 
-	if err := run(logger); err != nil {
-		logger.Printf("error: %v", err)
+	if err := run(logger, level, flags); err != nil {
+		logger.Error("Server stopped", "error", err)
 		os.Exit(1)
 	}
 }
 
-func run(logger *log.Logger) error {
-	logger.Println("Starting Perplexity MCP Server")
+func run(logger *slog.Logger, level *slog.LevelVar, flags *cliFlags) error {
+	logger.Info("Starting Perplexity MCP Server")
 
-	// Load configuration
-	config, err := internal.NewConfig()
+	// Load configuration; command-line flags take precedence over file and environment
+	config, err := internal.LoadConfig(flags.configPath)
 	if err != nil {
 		return err
 	}
+	flags.apply(config)
 
 	if err := config.Validate(); err != nil {
 		return err
 	}
 
-	logger.Printf("Configuration loaded - Model: %s, Timeout: %s",
-		config.DefaultModel, config.RequestTimeout)
+	logLevel, _ := internal.ParseLogLevel(config.LogLevel)
+	level.Set(logLevel)
+
+	// Switch to the rotated log file or syslog as LOG_OUTPUT selects, in the
+	// LOG_FORMAT format; errors stopping the server are still reported on stderr
+	switch config.LogOutput {
+	case internal.LogOutputFile:
+		logFile, err := internal.OpenLogFile(config.LogFile)
+		if err != nil {
+			return err
+		}
+		defer func() { _ = logFile.Close() }()
+		slog.SetDefault(internal.NewLogger(logFile, level, config.LogFormat))
+	case internal.LogOutputSyslog:
+		syslogLogger, conn, err := internal.NewSyslogLogger(config.LogSyslog, level, config.LogFormat)
+		if err != nil {
+			return err
+		}
+		defer func() { _ = conn.Close() }()
+		slog.SetDefault(syslogLogger)
+	default:
+		slog.SetDefault(internal.NewLogger(os.Stderr, level, config.LogFormat))
+	}
+	logger = slog.Default().With("component", "main")
+
+	logger.Info("Configuration loaded", "model", config.DefaultModel, "timeout", config.RequestTimeout.String())
+	live := internal.NewLiveConfig(config)
+
+	// Background tasks stop when the server exits
+	ctx, stopBackground := context.WithCancel(context.Background())
+	defer stopBackground()
+
+	// Resolve the API key, from a secret store when one is configured
+	secrets, apiKey, err := loadAPIKey(ctx, logger, config)
+	if err != nil {
+		return err
+	}
+
+	// Create the search backend; its requests queue once MAX_CONCURRENT_API_CALLS are in flight
+	apiLimiter := internal.NewAPILimiter(live)
+	client, err := newClient(logger, live, apiKey, apiLimiter)
+	if err != nil {
+		return err
+	}
+
+	// Count tool calls per transport and client
+	stats := internal.NewRequestStats()
+
+	// Abort in-flight API requests when the client cancels a call
+	cancellations := internal.NewCancellations(logger)
+	hooks := &server.Hooks{}
+	cancellations.AddHooks(hooks)
+
+	// Let shutdown wait for tool calls in flight
+	drainer := internal.NewDrainer()
+
+	// Limit each HTTP client's call rate and concurrency
+	rateLimiter := internal.NewRateLimiter(live)
+
+	// Token and cost usage, checked against budgets
+	usage := internal.NewUsageTracker()
+
+	// Let clients raise or lower the log level with logging/setLevel
+	hooks.AddAfterSetLevel(internal.SetLevelHook(level, logger))
+
+	serverOptions := []server.ServerOption{
+		server.WithHooks(hooks),
+		server.WithLogging(),
+		// Stored results come and go from the resource list
+		server.WithResourceCapabilities(false, true),
+		// Remaining budgets and rate-limit headroom go on every result, including
+		// the error results RequestIDMiddleware builds
+		server.WithToolHandlerMiddleware(internal.PacingMiddleware(client, live, usage)),
+		// Request IDs come next so every later middleware and log line can use them
+		server.WithToolHandlerMiddleware(internal.RequestIDMiddleware(logger, config.Transport)),
+	}
+
+	// Optionally record every tool call in an append-only audit log, including
+	// calls the middleware below refuses
+	if config.AuditLogPath != "" {
+		audit, err := internal.NewAuditLog(config.AuditLogPath)
+		if err != nil {
+			return err
+		}
+		defer func() {
+			if err := audit.Close(); err != nil {
+				logger.Warn("Failed to close audit log", "error", err)
+			}
+		}()
+		serverOptions = append(serverOptions, server.WithToolHandlerMiddleware(audit.Middleware(config.Transport)))
+		logger.Info("Audit log enabled", "path", config.AuditLogPath)
+	}
+
+	// Optionally report failed tool calls and panics to Sentry, seeing API
+	// failures before RequestIDMiddleware turns them into error results
+	errorTracker, err := internal.NewErrorTracker(config.Sentry)
+	if err != nil {
+		return err
+	}
+	if errorTracker != nil {
+		defer func() {
+			flushCtx, cancel := context.WithTimeout(context.Background(), flushTimeout)
+			defer cancel()
+			errorTracker.Flush(flushCtx)
+		}()
+		serverOptions = append(serverOptions, server.WithToolHandlerMiddleware(errorTracker.Middleware(config.Transport)))
+		logger.Info("Error reporting enabled", "environment", config.Sentry.Environment)
+	}
+
+	serverOptions = append(serverOptions,
+		server.WithToolHandlerMiddleware(cancellations.Middleware()),
+		server.WithToolHandlerMiddleware(drainer.Middleware()),
+		server.WithToolHandlerMiddleware(rateLimiter.Middleware()),
+		// Shed calls early while the API request queue is saturated
+		server.WithToolHandlerMiddleware(apiLimiter.Middleware()),
+		server.WithToolHandlerMiddleware(stats.Middleware(config.Transport)),
+	)
 
-	// Create Perplexity client
-	client, err := internal.NewPerplexityClient(config.PerplexityAPIKey)
+	// Optionally send metrics of every tool call to a StatsD server or Datadog agent
+	statsd, err := internal.NewStatsDMetrics(config.StatsD)
 	if err != nil {
 		return err
 	}
+	if statsd != nil {
+		defer func() { _ = statsd.Close() }()
+		serverOptions = append(serverOptions, server.WithToolHandlerMiddleware(internal.MetricsMiddleware(statsd, config.Transport)))
+		logger.Info("StatsD metrics enabled", "host", config.StatsD.Host, "port", config.StatsD.Port)
+	}
 
 	// Create MCP server
-	mcpServer := server.NewMCPServer("perplexity-mcp-server", "1.0.0")
+	mcpServer := server.NewMCPServer(internal.ServerName, internal.ServerVersion, serverOptions...)
+	mcpServer.AddNotificationHandler("notifications/cancelled", cancellations.HandleCancelled)
 
-	// Register the perplexity search tool
-	searchTool := internal.CreatePerplexitySearchTool(client)
-	searchHandler := internal.PerplexitySearchHandler(client)
-	mcpServer.AddTool(searchTool, searchHandler)
+	// Recent results are kept so follow-up tools can refer to them by ID
+	results := internal.NewResultStore(internal.DefaultResultStoreSize)
+	sessions := internal.NewSessionManager(config.SessionTTL, config.SessionMaxHistory)
+	jobs := internal.NewJobManager(config.JobTTL, config.MaxJobs)
+	jobs.OnFinish(internal.NewWebhookSender(live).Deliver)
+
+	// Optionally persist sessions, results, jobs and daily usage across restarts
+	var interruptedJobs []internal.Job
+	if config.StoragePath != "" {
+		storage, err := internal.OpenStorage(config.StoragePath)
+		if err != nil {
+			return err
+		}
+		defer func() {
+			if err := storage.Close(); err != nil {
+				logger.Warn("Failed to close storage", "error", err)
+			}
+		}()
+
+		results.UseStorage(storage, config.ResultRetention)
+		if err := sessions.UseStorage(storage); err != nil {
+			return fmt.Errorf("failed to restore sessions: %w", err)
+		}
+		if interruptedJobs, err = jobs.UseStorage(storage); err != nil {
+			return fmt.Errorf("failed to restore jobs: %w", err)
+		}
+		if err := usage.UseStorage(storage); err != nil {
+			return fmt.Errorf("failed to restore usage: %w", err)
+		}
+		logger.Info("History persistence enabled", "path", config.StoragePath)
+	}
+
+	// Let clients feature-detect what this deployment supports
+	mcpServer.AddResource(internal.CreateFeaturesResource(), internal.FeaturesResourceHandler(internal.NewFeatureManifest(config)))
+
+	// Expose request statistics and token/cost usage to operators
+	mcpServer.AddResource(internal.CreateStatsResource(), internal.StatsResourceHandler(stats, usage, apiLimiter))
+	mcpServer.AddResource(internal.CreateUsageResource(), internal.UsageResourceHandler(usage))
+
+	// Queue a redacted sample of answers for quality review when enabled
+	sampler := internal.NewQualitySampler(internal.DefaultReviewQueueSize)
+	mcpServer.AddResource(internal.CreateReviewQueueResource(), internal.ReviewQueueResourceHandler(sampler, live))
+
+	// Serve stored results as search:// resources so large answers can be re-read.
+	// Over HTTP the list would show every client's results, so they are read by URI only.
+	mcpServer.AddResourceTemplate(internal.CreateSearchResourceTemplate(), internal.SearchResourceHandler(results, live))
+	mcpServer.AddResourceTemplate(internal.CreateContentPageTemplate(), internal.ContentPageHandler(results, live))
+	if config.Transport != internal.TransportHTTP {
+		internal.ListSearchResources(mcpServer, results, live)
+	}
+
+	// Expose each session's accumulated findings as a notebook resource
+	mcpServer.AddResourceTemplate(internal.CreateNotebookResourceTemplate(), internal.NotebookResourceHandler(sessions, live))
+
+	// Let clients read background research jobs, and finish those a restart interrupted
+	mcpServer.AddResourceTemplate(internal.CreateJobResourceTemplate(), internal.JobResourceHandler(jobs))
+	if len(interruptedJobs) > 0 {
+		logger.Info("Resuming research jobs interrupted by restart", "jobs", len(interruptedJobs))
+		internal.ResumeJobs(ctx, jobs, interruptedJobs, client, live, results, usage)
+	}
 
-	logger.Printf("MCP server configured with 1 tool: perplexity_search")
-	logger.Println("Starting MCP server on stdio")
+	// Offer one-click research workflows built on the tools
+	mcpServer.AddPrompts(internal.ResearchPrompts()...)
 
-	// Serve on stdio - blocks until stdin is closed
-	return server.ServeStdio(mcpServer)
+	// Register the tools enabled in the configuration. Tools are rebuilt on
+	// reload so their schemas advertise the current model allow list.
+	var plugins []internal.PluginTool
+	buildTools := func(config *internal.Config) []server.ServerTool {
+		tools := []server.ServerTool{
+			// Perplexity search
+			{Tool: internal.CreatePerplexitySearchTool(client, config), Handler: internal.PerplexitySearchHandler(client, live, results, sessions, sampler, usage)},
+			// Section retrieval for deep research reports
+			{Tool: internal.CreateGetSectionTool(), Handler: internal.GetSectionHandler(results, live)},
+			// Feedback for rating stored results
+			{Tool: internal.CreateAnnotateTool(), Handler: internal.AnnotateHandler(results, stats)},
+			// Fact-checking a reference document against fresh results
+			{Tool: internal.CreateCheckAgainstTool(config), Handler: internal.CheckAgainstHandler(client, live, results, usage)},
+			// Token and cost usage report
+			{Tool: internal.CreateUsageTool(), Handler: internal.UsageHandler(usage, results)},
+			// Background research for calls that outlast client timeouts
+			{Tool: internal.CreateResearchAsyncTool(config), Handler: internal.ResearchAsyncHandler(client, live, results, jobs, usage)},
+			// Status, results and cancellation of research jobs
+			{Tool: internal.CreateJobStatusTool(), Handler: internal.JobStatusHandler(jobs)},
+			{Tool: internal.CreateJobResultTool(), Handler: internal.JobResultHandler(jobs, live)},
+			{Tool: internal.CreateJobCancelTool(), Handler: internal.JobCancelHandler(jobs)},
+			// Many searches in one call, run in parallel
+			{Tool: internal.CreateBatchSearchTool(config), Handler: internal.BatchSearchHandler(client, live, results, usage)},
+			// Search, then condense the answer into an executive summary
+			{Tool: internal.CreateSummarizeTool(config), Handler: internal.SummarizeHandler(client, live, results, usage)},
+			// Sub-questions searched in parallel and synthesized into a report
+			{Tool: internal.CreateResearchWorkflowTool(config), Handler: internal.ResearchWorkflowHandler(client, live, results, usage)},
+		}
+		// Passthrough to the Perplexity API, whose request format it expects,
+		// and presets of search modes other backends do not have
+		if config.Provider.Type == internal.ProviderPerplexity {
+			tools = append(tools,
+				server.ServerTool{Tool: internal.CreateRawTool(), Handler: internal.RawHandler(client, live, usage)},
+				server.ServerTool{Tool: internal.CreateSECSearchTool(config), Handler: internal.SECSearchHandler(client, live, results, sessions, sampler, usage)},
+				server.ServerTool{Tool: internal.CreateNewsTool(config), Handler: internal.NewsHandler(client, live, results, sessions, sampler, usage)},
+				server.ServerTool{Tool: internal.CreateAcademicTool(config), Handler: internal.AcademicHandler(client, live, results, sessions, sampler, usage)},
+			)
+		}
+		for _, plugin := range plugins {
+			tools = append(tools, server.ServerTool{Tool: plugin.Tool, Handler: internal.PluginHandler(plugin, live)})
+		}
+		return tools
+	}
+
+	// Load tools served by plugin executables; their names must not shadow built-in tools
+	if config.PluginDir != "" {
+		var builtin []string
+		for _, tool := range buildTools(config) {
+			builtin = append(builtin, tool.Tool.Name)
+		}
+		if plugins, err = internal.LoadPlugins(ctx, config.PluginDir, builtin); err != nil {
+			return err
+		}
+		for _, plugin := range plugins {
+			logger.Info("Loaded plugin tool", "tool", plugin.Tool.Name, "path", plugin.Path)
+		}
+	}
+	registerTools(logger, mcpServer, buildTools(config), config)
+
+	// Reload configuration on SIGHUP without dropping sessions
+	go watchReload(ctx, logger, level, flags, live, func(config *internal.Config) {
+		registerTools(logger, mcpServer, buildTools(config), config)
+	})
+
+	// Let operators enable and disable tools through the admin API
+	if config.AdminAddr != "" {
+		var names []string
+		for _, tool := range buildTools(config) {
+			names = append(names, tool.Tool.Name)
+		}
+		internal.PublishExpvars(stats, usage, apiLimiter)
+		admin := internal.AdminHandler(live, names, func(config *internal.Config) {
+			registerTools(logger, mcpServer, buildTools(config), config)
+		})
+		adminServer := startAdmin(logger, config.AdminAddr, admin)
+		defer func() {
+			if err := adminServer.Close(); err != nil {
+				logger.Warn("Failed to close admin API", "error", err)
+			}
+		}()
+	}
+
+	// Pick up rotated keys from the secret store
+	if secrets != nil {
+		go internal.WatchSecret(ctx, secrets, config.SecretRefreshInterval, client, apiKey, logger.With("component", "secrets"))
+	}
+
+	return serve(logger, mcpServer, drainer, live)
+}
+
+// loadAPIKey returns the configured API key, fetched from the secret store
+// when one is configured, and that store
+func loadAPIKey(ctx context.Context, logger *slog.Logger, config *internal.Config) (internal.SecretProvider, string, error) {
+	secrets, err := internal.NewSecretProvider(ctx, config)
+	if err != nil {
+		return nil, "", err
+	}
+	apiKey := config.PerplexityAPIKey
+	if secrets != nil {
+		if apiKey, err = internal.FetchAPIKey(ctx, secrets); err != nil {
+			return nil, "", err
+		}
+		logger.Info("API key loaded", "source", secrets.Source())
+	}
+	return secrets, apiKey, nil
+}
+
+// newClient creates the search backend, Perplexity unless SEARCH_PROVIDER
+// selects another, with its proxy and query filter
+func newClient(logger *slog.Logger, live *internal.LiveConfig, apiKey string, apiLimiter *internal.APILimiter) (internal.SearchProvider, error) {
+	config := live.Get()
+	client, err := internal.NewSearchProvider(config.Provider, apiKey, apiLimiter,
+		internal.WithConnectionPool(config.APIConnectionPool), internal.WithMaxResponseBytes(config.MaxResponseBytes),
+		internal.WithRetryPolicy(config.APIRetryPolicy))
+	if err != nil {
+		return nil, err
+	}
+	if config.Provider.Type != internal.ProviderPerplexity {
+		logger.Info("Using alternative search provider", "provider", config.Provider.Type, "base_url", config.Provider.BaseURL, "model", config.Provider.Model)
+	}
+
+	// Route API requests through PROXY_URL or the standard proxy variables
+	proxyURL, err := client.UseProxy(config.ProxyURL)
+	if err != nil {
+		return nil, err
+	}
+	if proxyURL != nil {
+		logger.Info("Using proxy for API requests", "proxy", proxyURL.Redacted())
+	}
+
+	// Redact or reject requests carrying personal data, per QUERY_FILTER
+	return internal.NewFilteredProvider(client, live), nil
+}
+
+// registerTools replaces the server's tools with those enabled in config
+func registerTools(logger *slog.Logger, mcpServer *server.MCPServer, tools []server.ServerTool, config *internal.Config) {
+	var enabled []server.ServerTool
+	var names []string
+	for _, tool := range tools {
+		if !config.ToolEnabled(tool.Tool.Name) {
+			logger.Info("Tool disabled by configuration", "tool", tool.Tool.Name)
+			continue
+		}
+		enabled = append(enabled, tool)
+		names = append(names, tool.Tool.Name)
+	}
+
+	mcpServer.SetTools(enabled...)
+	logger.Info("MCP server configured", "tools", names)
+}
+
+// startAdmin serves the admin API on addr in the background
+func startAdmin(logger *slog.Logger, addr string, handler http.Handler) *http.Server {
+	adminServer := &http.Server{
+		Addr:              addr,
+		Handler:           handler,
+		ReadHeaderTimeout: 10 * time.Second,
+	}
+	go func() {
+		logger.Info("Starting admin API", "addr", addr)
+		if err := adminServer.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
+			logger.Error("Admin API stopped", "error", err)
+		}
+	}()
+	return adminServer
+}
+
+// serve runs the MCP server on the configured transport until it stops. On
+// SIGINT or SIGTERM the HTTP transport rejects new tool calls and waits for
+// those in flight before closing connections, all within the shutdown timeout
+// of the active configuration.
+func serve(logger *slog.Logger, mcpServer *server.MCPServer, drainer *internal.Drainer, live *internal.LiveConfig) error {
+	config := live.Get()
+	if config.Transport != internal.TransportHTTP {
+		logger.Info("Starting MCP server on stdio")
+
+		// Serve on stdio - blocks until stdin is closed
+		return server.ServeStdio(mcpServer)
+	}
+
+	// Require a bearer token on the MCP endpoint when tokens are configured;
+	// tokens are read on every request so a reload can rotate them
+	mux := http.NewServeMux()
+	mux.Handle("/mcp", internal.RequireBearerToken(func() []string { return live.Get().AuthTokens }, server.NewStreamableHTTPServer(mcpServer,
+		// Identify clients by certificate, token or IP for rate limiting
+		server.WithHTTPContextFunc(internal.HTTPClientIdentity(live)),
+	)))
+	httpServer := &http.Server{
+		Addr:    config.Addr(),
+		Handler: config.HTTPLimits.Handler(mux),
+	}
+	config.HTTPLimits.Apply(httpServer)
+	if len(config.AuthTokens) == 0 && config.TLSClientCAFile == "" {
+		logger.Warn("HTTP transport has no authentication; set MCP_AUTH_TOKEN to require a bearer token")
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	// Serve HTTPS directly when a certificate is configured, reloading it on renewal
+	scheme := "http"
+	if config.TLSCertFile != "" {
+		certs, err := internal.NewCertReloader(config.TLSCertFile, config.TLSKeyFile)
+		if err != nil {
+			return err
+		}
+		httpServer.TLSConfig = certs.TLSConfig()
+		if config.TLSClientCAFile != "" {
+			if err := internal.RequireClientCerts(httpServer.TLSConfig, config.TLSClientCAFile); err != nil {
+				return err
+			}
+			logger.Info("Mutual TLS enabled", "client_ca_file", config.TLSClientCAFile)
+		}
+		go certs.Watch(ctx, config.SecretRefreshInterval, logger)
+		scheme = "https"
+	}
+
+	errCh := make(chan error, 1)
+	go func() {
+		logger.Info("Starting MCP server", "url", scheme+"://"+config.Addr()+"/mcp", "auth", len(config.AuthTokens) > 0)
+		if httpServer.TLSConfig != nil {
+			errCh <- httpServer.ListenAndServeTLS("", "")
+			return
+		}
+		errCh <- httpServer.ListenAndServe()
+	}()
+
+	select {
+	case err := <-errCh:
+		if errors.Is(err, http.ErrServerClosed) {
+			return nil
+		}
+		return err
+	case <-ctx.Done():
+		timeout := live.Get().ShutdownWait()
+		logger.Info("Shutting down HTTP server, draining tool calls in flight", "timeout", timeout)
+		shutdownCtx, cancel := context.WithTimeout(context.Background(), timeout)
+		defer cancel()
+		if active := drainer.Drain(shutdownCtx); active > 0 {
+			logger.Warn("Shutdown timeout reached with tool calls still running", "active", active)
+		}
+		return httpServer.Shutdown(shutdownCtx)
+	}
 }
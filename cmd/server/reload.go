@@ -0,0 +1,57 @@
+package main
+
+import (
+	"context"
+	"log/slog"
+	"os"
+	"os/signal"
+	"syscall"
+
+	"github.com/passingbreeze-bonfire/perplexity-mcp-golang/internal"
+)
+
+// watchReload reloads the configuration each time the process receives SIGHUP
+// until ctx is cancelled. onReload is called with each configuration applied.
+func watchReload(ctx context.Context, logger *slog.Logger, level *slog.LevelVar, flags *cliFlags, live *internal.LiveConfig, onReload func(*internal.Config)) {
+	hup := make(chan os.Signal, 1)
+	signal.Notify(hup, syscall.SIGHUP)
+	defer signal.Stop(hup)
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-hup:
+			logger.Info("Received SIGHUP, reloading configuration")
+			if err := reloadConfig(logger, level, flags, live); err != nil {
+				logger.Error("Configuration reload failed, keeping current settings", "error", err)
+				continue
+			}
+			onReload(live.Get())
+		}
+	}
+}
+
+// reloadConfig re-reads the config file and environment with the same
+// precedence as startup and applies the result if it is valid
+func reloadConfig(logger *slog.Logger, level *slog.LevelVar, flags *cliFlags, live *internal.LiveConfig) error {
+	next, err := internal.LoadConfig(flags.configPath)
+	if err != nil {
+		return err
+	}
+	flags.apply(next)
+
+	ignored, err := live.Reload(next)
+	if err != nil {
+		return err
+	}
+	if len(ignored) > 0 {
+		logger.Warn("Changes require a restart and were not applied", "settings", ignored)
+	}
+
+	config := live.Get()
+	logLevel, _ := internal.ParseLogLevel(config.LogLevel)
+	level.Set(logLevel)
+	logger.Info("Configuration reloaded", "model", config.DefaultModel, "log_level", config.LogLevel)
+	return nil
+}
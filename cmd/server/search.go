@@ -0,0 +1,133 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"os/signal"
+	"strings"
+	"syscall"
+
+	"github.com/mark3labs/mcp-go/mcp"
+	"github.com/passingbreeze-bonfire/perplexity-mcp-golang/internal"
+)
+
+// runSearch runs `search "query" [--model m] [--json|--md]`: one
+// perplexity_search call with the server's configuration, printed to stdout.
+// It returns the exit code: 1 when the search fails, 2 on invalid usage.
+func runSearch(args []string) int {
+	flags := newCLIFlags("search")
+	fs := flags.fs
+	fs.Usage = func() {
+		fmt.Fprintln(fs.Output(), "Usage: perplexity-mcp-server search \"query\" [flags]")
+		fmt.Fprintln(fs.Output(), "\nRuns one search with the server's configuration and prints the answer.")
+		fs.PrintDefaults()
+	}
+	asJSON := fs.Bool("json", false, "print the JSON result of the perplexity_search tool")
+	asMarkdown := fs.Bool("md", false, "print the answer as markdown (default)")
+
+	// Flags may come before or after the query
+	var words []string
+	for {
+		if err := fs.Parse(args); err != nil {
+			if errors.Is(err, flag.ErrHelp) {
+				return 0
+			}
+			return 2
+		}
+		if fs.NArg() == 0 {
+			break
+		}
+		words = append(words, fs.Arg(0))
+		args = fs.Args()[1:]
+	}
+	query := strings.TrimSpace(strings.Join(words, " "))
+	if query == "" || (*asJSON && *asMarkdown) {
+		fs.Usage()
+		return 2
+	}
+
+	if err := search(os.Stdout, flags, query, *asJSON); err != nil {
+		fmt.Fprintln(os.Stderr, "Search failed:", err)
+		return 1
+	}
+	return 0
+}
+
+func search(out io.Writer, flags *cliFlags, query string, asJSON bool) error {
+	config, err := internal.LoadConfig(flags.configPath)
+	if err != nil {
+		return err
+	}
+	flags.apply(config)
+	if err := config.Validate(); err != nil {
+		return err
+	}
+
+	logger := newCLILogger(config, "search")
+
+	// Stop the search on Ctrl-C
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	_, apiKey, err := loadAPIKey(ctx, logger, config)
+	if err != nil {
+		return err
+	}
+	live := internal.NewLiveConfig(config)
+	client, err := newClient(logger, live, apiKey, internal.NewAPILimiter(live))
+	if err != nil {
+		return err
+	}
+
+	// Call the tool itself, so the search gets its defaults, checks and formatting
+	handler := internal.PerplexitySearchHandler(client, live,
+		internal.NewResultStore(internal.DefaultResultStoreSize),
+		internal.NewSessionManager(config.SessionTTL, config.SessionMaxHistory),
+		internal.NewQualitySampler(internal.DefaultReviewQueueSize),
+		internal.NewUsageTracker())
+
+	arguments := map[string]any{"query": query, "output_format": internal.OutputFormatMarkdown}
+	if asJSON {
+		arguments["output_format"] = internal.OutputFormatJSON
+	}
+	// An explicit model also wins over a default model configured for the tool
+	if flags.set("model") {
+		arguments["model"] = flags.model
+	}
+	var request mcp.CallToolRequest
+	request.Params.Name = "perplexity_search"
+	request.Params.Arguments = arguments
+
+	result, err := handler(ctx, request)
+	if result == nil {
+		return err
+	}
+	var texts []string
+	for _, content := range result.Content {
+		if text, ok := content.(mcp.TextContent); ok {
+			texts = append(texts, text.Text)
+		}
+	}
+	if result.IsError {
+		return errors.New(strings.TrimPrefix(strings.Join(texts, "\n"), "Search failed: "))
+	}
+	_, err = fmt.Fprintln(out, strings.Join(texts, "\n\n"))
+	return err
+}
+
+// newCLILogger sets up logging for a subcommand: text on stderr, keeping to
+// warnings and errors unless debug logging is configured
+func newCLILogger(config *internal.Config, component string) *slog.Logger {
+	level := new(slog.LevelVar)
+	level.Set(slog.LevelWarn)
+	if logLevel, _ := internal.ParseLogLevel(config.LogLevel); logLevel == slog.LevelDebug {
+		level.Set(logLevel)
+	}
+	slog.SetDefault(internal.NewLogger(os.Stderr, level, internal.LogFormatText))
+	return slog.Default().With("component", component)
+}
@@ -0,0 +1,110 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"time"
+
+	"github.com/passingbreeze-bonfire/perplexity-mcp-golang/internal"
+)
+
+// runValidate runs `validate [flags] [--ping]`: it loads the configuration
+// the server would start with, reports every problem in it and, with --ping,
+// checks the API key with a minimal search. It returns the exit code: 1 when
+// the configuration is invalid or the ping fails, 2 on invalid usage.
+func runValidate(args []string) int {
+	flags := newCLIFlags("validate")
+	flags.fs.Usage = func() {
+		fmt.Fprintln(flags.fs.Output(), "Usage: perplexity-mcp-server validate [flags]")
+		fmt.Fprintln(flags.fs.Output(), "\nChecks the configuration from the environment, config file and flags.")
+		flags.fs.PrintDefaults()
+	}
+	ping := flags.fs.Bool("ping", false, "also send a minimal search to check the API key and connectivity")
+	if err := flags.fs.Parse(args); err != nil {
+		if errors.Is(err, flag.ErrHelp) {
+			return 0
+		}
+		return 2
+	}
+	if flags.fs.NArg() > 0 {
+		flags.fs.Usage()
+		return 2
+	}
+
+	if !validate(os.Stdout, flags, *ping) {
+		return 1
+	}
+	return 0
+}
+
+// validate prints the problems of the configuration to out and reports
+// whether there were none
+func validate(out io.Writer, flags *cliFlags, ping bool) bool {
+	config, err := internal.LoadConfig(flags.configPath)
+	if err != nil {
+		printProblems(out, []error{err})
+		return false
+	}
+	flags.apply(config)
+
+	if problems := unjoin(config.Validate()); len(problems) > 0 {
+		printProblems(out, problems)
+		return false
+	}
+	fmt.Fprintln(out, "Configuration is valid")
+	if !ping {
+		return true
+	}
+
+	logger := newCLILogger(config, "validate")
+	ctx, cancel := context.WithTimeout(context.Background(), config.RequestTimeout)
+	defer cancel()
+
+	// Resolve the key and send the cheapest search the API accepts
+	start := time.Now()
+	err = func() error {
+		_, apiKey, err := loadAPIKey(ctx, logger, config)
+		if err != nil {
+			return err
+		}
+		live := internal.NewLiveConfig(config)
+		client, err := newClient(logger, live, apiKey, internal.NewAPILimiter(live))
+		if err != nil {
+			return err
+		}
+		_, err = client.Search(ctx, internal.SearchRequest{Query: "ping", Model: config.DefaultModel, MaxTokens: 1})
+		return err
+	}()
+	if err != nil {
+		printProblems(out, []error{fmt.Errorf("API ping failed: %w", err)})
+		return false
+	}
+	fmt.Fprintf(out, "API ping succeeded: %s answered in %s\n", config.DefaultModel, time.Since(start).Round(time.Millisecond))
+	return true
+}
+
+// unjoin splits an error returned by errors.Join into its errors
+func unjoin(err error) []error {
+	if err == nil {
+		return nil
+	}
+	if joined, ok := err.(interface{ Unwrap() []error }); ok {
+		return joined.Unwrap()
+	}
+	return []error{err}
+}
+
+func printProblems(out io.Writer, problems []error) {
+	if len(problems) == 1 {
+		fmt.Fprintln(out, "Configuration has 1 problem:")
+	} else {
+		fmt.Fprintf(out, "Configuration has %d problems:\n", len(problems))
+	}
+	for _, problem := range problems {
+		fmt.Fprintf(out, "  - %s\n", problem)
+	}
+}
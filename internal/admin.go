@@ -0,0 +1,67 @@
+package internal
+
+import (
+	"encoding/json"
+	"expvar"
+	"net/http"
+	"slices"
+)
+
+// AdminToolStatus is one entry of the admin API's tool list
+type AdminToolStatus struct {
+	Name    string `json:"name"`
+	Enabled bool   `json:"enabled"`
+}
+
+// AdminHandler serves the operator API on its own listener:
+//
+//	GET  /tools                 list every tool and whether it is enabled
+//	POST /tools/{name}/enable   register a disabled tool
+//	POST /tools/{name}/disable  unregister a tool
+//	GET  /debug/vars            expvar variables, see PublishExpvars
+//
+// tools names every tool the server can register. onChange is called with the
+// configuration after each change so the server can update its tool list.
+func AdminHandler(live *LiveConfig, tools []string, onChange func(*Config)) http.Handler {
+	mux := http.NewServeMux()
+
+	mux.HandleFunc("GET /tools", func(w http.ResponseWriter, r *http.Request) {
+		writeJSON(w, http.StatusOK, adminToolStatus(live.Get(), tools))
+	})
+
+	setEnabled := func(enabled bool) http.HandlerFunc {
+		return func(w http.ResponseWriter, r *http.Request) {
+			name := r.PathValue("name")
+			if !slices.Contains(tools, name) {
+				writeJSON(w, http.StatusNotFound, map[string]string{"error": "unknown tool: " + name})
+				return
+			}
+			config := live.SetToolEnabled(name, enabled)
+			onChange(config)
+			writeJSON(w, http.StatusOK, adminToolStatus(config, tools))
+		}
+	}
+	mux.HandleFunc("POST /tools/{name}/enable", setEnabled(true))
+	mux.HandleFunc("POST /tools/{name}/disable", setEnabled(false))
+	mux.Handle("GET "+ExpvarPath, expvar.Handler())
+
+	var tokens []string
+	if token := live.Get().AdminToken; token != "" {
+		tokens = append(tokens, token)
+	}
+	return RequireBearerToken(func() []string { return tokens }, mux)
+}
+
+func adminToolStatus(config *Config, tools []string) []AdminToolStatus {
+	status := make([]AdminToolStatus, len(tools))
+	for i, name := range tools {
+		status[i] = AdminToolStatus{Name: name, Enabled: config.ToolEnabled(name)}
+	}
+	return status
+}
+
+func writeJSON(w http.ResponseWriter, status int, body any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	_ = json.NewEncoder(w).Encode(body)
+}
@@ -0,0 +1,179 @@
+package internal
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/mark3labs/mcp-go/mcp"
+)
+
+// Limits on feedback attached to a result
+const (
+	MinAnnotationRating   = 1
+	MaxAnnotationRating   = 5
+	MaxAnnotationNotes    = 5000
+	MaxAnnotationsPerItem = 50
+)
+
+// Annotation is human feedback recorded against a stored search result
+type Annotation struct {
+	Rating             int       `json:"rating,omitempty"`
+	Notes              string    `json:"notes,omitempty"`
+	IncorrectCitations []int     `json:"incorrect_citations,omitempty"`
+	Created            time.Time `json:"created"`
+}
+
+// Validate checks the annotation against the result it is attached to
+func (a *Annotation) Validate(result *SearchResult) error {
+	if a.Rating == 0 && a.Notes == "" && len(a.IncorrectCitations) == 0 {
+		return fmt.Errorf("annotation must include a rating, notes or incorrect citations")
+	}
+	if a.Rating != 0 && (a.Rating < MinAnnotationRating || a.Rating > MaxAnnotationRating) {
+		return fmt.Errorf("rating must be between %d and %d", MinAnnotationRating, MaxAnnotationRating)
+	}
+	if len(a.Notes) > MaxAnnotationNotes {
+		return fmt.Errorf("notes too long (max %d characters)", MaxAnnotationNotes)
+	}
+
+	numbers := make(map[int]bool, len(result.Citations))
+	for _, citation := range result.Citations {
+		numbers[citation.Number] = true
+	}
+	for _, number := range a.IncorrectCitations {
+		if !numbers[number] {
+			return fmt.Errorf("result %s has no citation %d", result.ID, number)
+		}
+	}
+	return nil
+}
+
+// CreateAnnotateTool creates the perplexity_annotate tool for use with mcp-go
+func CreateAnnotateTool() mcp.Tool {
+	return mcp.Tool{
+		Name:        "perplexity_annotate",
+		Description: "Attach human feedback to a previous search result: a 1-5 rating, free-form notes, and the numbers of citations that were incorrect.",
+		InputSchema: mcp.ToolInputSchema{
+			Type: "object",
+			Properties: map[string]any{
+				"result_id": map[string]any{
+					"type":        "string",
+					"description": "The id of a previous perplexity_search result",
+					"minLength":   1,
+				},
+				"rating": map[string]any{
+					"type":        "integer",
+					"description": "Overall quality rating (optional)",
+					"minimum":     MinAnnotationRating,
+					"maximum":     MaxAnnotationRating,
+				},
+				"notes": map[string]any{
+					"type":        "string",
+					"description": "Free-form feedback (optional)",
+					"maxLength":   MaxAnnotationNotes,
+				},
+				"incorrect_citations": map[string]any{
+					"type":        "array",
+					"description": "Numbers of citations that do not support the answer (optional)",
+					"items": map[string]any{
+						"type":    "integer",
+						"minimum": 1,
+					},
+				},
+			},
+			Required: []string{"result_id"},
+		},
+		OutputSchema: annotateOutputSchema(),
+	}
+}
+
+// AnnotateHandler creates the handler function for the perplexity_annotate tool
+func AnnotateHandler(results *ResultStore, stats *RequestStats) func(ctx context.Context, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+	return func(ctx context.Context, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+		content, data, err := annotateResult(results, stats, clientIdentity(ctx), request)
+		if err != nil {
+			return &mcp.CallToolResult{
+				Content: []mcp.Content{
+					mcp.TextContent{
+						Type: "text",
+						Text: fmt.Sprintf("Failed to annotate result: %s", err.Error()),
+					},
+				},
+				IsError: true,
+			}, err
+		}
+
+		return &mcp.CallToolResult{
+			Content: []mcp.Content{
+				mcp.TextContent{
+					Type: "text",
+					Text: content,
+				},
+			},
+			StructuredContent: data,
+			IsError:           false,
+		}, nil
+	}
+}
+
+func annotateResult(results *ResultStore, stats *RequestStats, owner string, request mcp.CallToolRequest) (string, map[string]any, error) {
+	resultID, err := request.RequireString("result_id")
+	if err != nil {
+		return "", nil, fmt.Errorf("result_id must be a string")
+	}
+
+	annotation := Annotation{
+		Notes:   request.GetString("notes", ""),
+		Created: time.Now(),
+	}
+	args := request.GetArguments()
+	if _, exists := args["rating"]; exists {
+		if annotation.Rating, err = request.RequireInt("rating"); err != nil {
+			return "", nil, fmt.Errorf("rating must be an integer")
+		}
+		if annotation.Rating == 0 {
+			return "", nil, fmt.Errorf("rating must be between %d and %d", MinAnnotationRating, MaxAnnotationRating)
+		}
+	}
+	if raw, exists := args["incorrect_citations"]; exists {
+		if annotation.IncorrectCitations, err = parseCitationNumbers(raw); err != nil {
+			return "", nil, err
+		}
+	}
+
+	result, err := results.Annotate(resultID, owner, annotation)
+	if err != nil {
+		return "", nil, err
+	}
+	stats.RecordAnnotation(annotation)
+
+	data := map[string]any{
+		"result_id":   result.ID,
+		"annotations": len(result.Annotations),
+		"annotation":  annotation,
+	}
+	jsonBytes, err := json.MarshalIndent(data, "", "  ")
+	if err != nil {
+		return "", nil, fmt.Errorf("failed to marshal annotation: %w", err)
+	}
+	return string(jsonBytes), data, nil
+}
+
+// parseCitationNumbers converts a JSON array of citation numbers
+func parseCitationNumbers(raw any) ([]int, error) {
+	items, ok := raw.([]any)
+	if !ok {
+		return nil, fmt.Errorf("incorrect_citations must be an array of integers")
+	}
+
+	numbers := make([]int, 0, len(items))
+	for i, item := range items {
+		value, ok := item.(float64)
+		if !ok || value != float64(int(value)) {
+			return nil, fmt.Errorf("incorrect_citations[%d] must be an integer", i)
+		}
+		numbers = append(numbers, int(value))
+	}
+	return numbers, nil
+}
@@ -0,0 +1,123 @@
+package internal
+
+import (
+	"errors"
+	"math"
+	"net/http"
+	"regexp"
+	"strconv"
+	"time"
+
+	"github.com/mark3labs/mcp-go/mcp"
+)
+
+// Types of the structured error returned in _meta.error
+const (
+	APIErrorBadRequest   = "bad_request"
+	APIErrorUnauthorized = "unauthorized"
+	APIErrorRateLimited  = "rate_limited"
+	APIErrorServerError  = "server_error"
+	APIErrorTimeout      = "timeout"
+	APIErrorOther        = "api_error"
+)
+
+// maxAPIErrorFieldLength bounds the API's own error type and code
+const maxAPIErrorFieldLength = 64
+
+// apiErrorFieldPattern matches what is dropped from the API's error type and
+// code, which are identifiers rather than free text
+var apiErrorFieldPattern = regexp.MustCompile(`[^A-Za-z0-9_.:-]+`)
+
+// APIErrorDetails describes a failed Perplexity API call, so clients can react
+// to it programmatically instead of parsing the error text
+type APIErrorDetails struct {
+	Type string `json:"type"`
+	// Status is the HTTP status returned by the API; 0 when this server's own
+	// timeout fired
+	Status    int  `json:"status,omitempty"`
+	Retryable bool `json:"retryable"`
+	// RetryAfterSeconds is the wait the API asked for before a retry
+	RetryAfterSeconds int `json:"retry_after_seconds,omitempty"`
+	// APIType and APICode are the error type and code from the API's response body
+	APIType string `json:"api_type,omitempty"`
+	APICode string `json:"api_code,omitempty"`
+}
+
+// apiErrorDetails describes err if a Perplexity API call failed with it, or
+// returns nil for other errors, such as invalid arguments
+func apiErrorDetails(err error) *APIErrorDetails {
+	var timeoutErr *TimeoutError
+	if errors.As(err, &timeoutErr) {
+		return &APIErrorDetails{Type: APIErrorTimeout, Status: timeoutErr.StatusCode, Retryable: true}
+	}
+	var statusErr *StatusError
+	if !errors.As(err, &statusErr) {
+		return nil
+	}
+
+	details := &APIErrorDetails{
+		Status:  statusErr.StatusCode,
+		APIType: sanitizeAPIErrorField(statusErr.Type),
+		APICode: sanitizeAPIErrorField(statusErr.Code),
+	}
+	switch {
+	case statusErr.StatusCode == http.StatusBadRequest:
+		details.Type = APIErrorBadRequest
+	case statusErr.StatusCode == http.StatusUnauthorized || statusErr.StatusCode == http.StatusForbidden:
+		details.Type = APIErrorUnauthorized
+	case statusErr.StatusCode == http.StatusTooManyRequests:
+		details.Type, details.Retryable = APIErrorRateLimited, true
+	case statusErr.StatusCode >= http.StatusInternalServerError:
+		details.Type, details.Retryable = APIErrorServerError, true
+	default:
+		details.Type = APIErrorOther
+	}
+	if statusErr.RetryAfter > 0 {
+		details.RetryAfterSeconds = int(math.Ceil(statusErr.RetryAfter.Seconds()))
+	}
+	return details
+}
+
+func sanitizeAPIErrorField(value string) string {
+	return truncateRunes(apiErrorFieldPattern.ReplaceAllString(value, ""), maxAPIErrorFieldLength)
+}
+
+// parseRetryAfter reads a Retry-After header, given in seconds or as an HTTP
+// date, and returns 0 when it is absent or malformed
+func parseRetryAfter(value string, now time.Time) time.Duration {
+	if value == "" {
+		return 0
+	}
+	if seconds, err := strconv.Atoi(value); err == nil {
+		return max(time.Duration(seconds)*time.Second, 0)
+	}
+	if date, err := http.ParseTime(value); err == nil {
+		return max(date.Sub(now), 0)
+	}
+	return 0
+}
+
+// apiErrorResult turns a failed API call into a tool error result, so the
+// structured error reaches the client in _meta.error; JSON-RPC errors carry
+// no data. result is the handler's error result, if it returned one.
+func apiErrorResult(result *mcp.CallToolResult, err error, details *APIErrorDetails) *mcp.CallToolResult {
+	if result == nil {
+		result = &mcp.CallToolResult{
+			Content: []mcp.Content{
+				mcp.TextContent{
+					Type: "text",
+					Text: err.Error(),
+				},
+			},
+		}
+	}
+	result.IsError = true
+	if result.Meta == nil {
+		result.Meta = &mcp.Meta{}
+	}
+	if result.Meta.AdditionalFields == nil {
+		result.Meta.AdditionalFields = map[string]any{}
+	}
+	result.Meta.AdditionalFields["error"] = details
+	return result
+}
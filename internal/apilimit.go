@@ -0,0 +1,212 @@
+package internal
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math"
+	"sync"
+	"time"
+
+	"github.com/mark3labs/mcp-go/mcp"
+	"github.com/mark3labs/mcp-go/server"
+)
+
+// ErrServerBusy is returned for tool calls shed because the queue of API
+// requests is full or too slow. The call was not started, so it can be retried.
+var ErrServerBusy = errors.New("server busy")
+
+// upstreamTools are the tools whose calls make API requests and are shed
+// when the queue is saturated; other tools are always served
+var upstreamTools = map[string]bool{
+	"perplexity_search":            true,
+	"perplexity_check_against":     true,
+	"perplexity_raw":               true,
+	"perplexity_sec_search":        true,
+	"perplexity_news":              true,
+	"perplexity_academic":          true,
+	"perplexity_research_async":    true,
+	"perplexity_batch_search":      true,
+	"perplexity_summarize":         true,
+	"perplexity_research_workflow": true,
+}
+
+// APILimiter bounds the API requests in flight across all tool calls. Requests
+// over MaxConcurrentAPICalls wait in a first-in first-out queue instead of
+// opening more connections. The limit is read from the live configuration, so
+// a reload applies to requests that start afterwards; 0 disables it.
+type APILimiter struct {
+	live *LiveConfig
+
+	mu      sync.Mutex
+	active  int
+	waiting []*apiWaiter
+
+	calls     int64
+	queued    int64
+	shed      int64
+	waits     int64
+	totalWait time.Duration
+	maxWait   time.Duration
+}
+
+// apiWaiter is a request queued for a slot; ready is closed when it gets one
+type apiWaiter struct {
+	ready chan struct{}
+	since time.Time
+}
+
+// APICallStats is the snapshot of upstream concurrency exposed in
+// perplexity://stats. Waits count only the calls that had to queue.
+type APICallStats struct {
+	Limit     int     `json:"limit"`
+	InFlight  int     `json:"in_flight"`
+	Waiting   int     `json:"waiting"`
+	Calls     int64   `json:"calls"`
+	Queued    int64   `json:"queued"`
+	Shed      int64   `json:"shed"`
+	AvgWaitMs float64 `json:"avg_wait_ms"`
+	MaxWaitMs float64 `json:"max_wait_ms"`
+}
+
+func NewAPILimiter(live *LiveConfig) *APILimiter {
+	return &APILimiter{live: live}
+}
+
+// Acquire waits for a free slot and returns the function that releases it.
+// It fails with ctx's error if ctx ends while the request is queued.
+func (l *APILimiter) Acquire(ctx context.Context) (func(), error) {
+	l.mu.Lock()
+	l.calls++
+	if len(l.waiting) == 0 && l.hasSlot() {
+		l.active++
+		l.mu.Unlock()
+		return l.release, nil
+	}
+
+	waiter := &apiWaiter{ready: make(chan struct{}), since: time.Now()}
+	l.waiting = append(l.waiting, waiter)
+	l.queued++
+	l.mu.Unlock()
+
+	select {
+	case <-waiter.ready:
+		l.recordWait(time.Since(waiter.since))
+		return l.release, nil
+	case <-ctx.Done():
+		l.mu.Lock()
+		defer l.mu.Unlock()
+		for i, queued := range l.waiting {
+			if queued == waiter {
+				l.waiting = append(l.waiting[:i], l.waiting[i+1:]...)
+				return nil, ctx.Err()
+			}
+		}
+		// The slot was handed over as ctx ended; pass it on
+		l.active--
+		l.dispatch()
+		return nil, ctx.Err()
+	}
+}
+
+// Middleware sheds calls of upstream tools while the queue is saturated,
+// before they do any work, so clients can retry or go elsewhere instead of
+// waiting to time out
+func (l *APILimiter) Middleware() server.ToolHandlerMiddleware {
+	return func(next server.ToolHandlerFunc) server.ToolHandlerFunc {
+		return func(ctx context.Context, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+			if !upstreamTools[request.Params.Name] {
+				return next(ctx, request)
+			}
+			if err := l.shedding(); err != nil {
+				return &mcp.CallToolResult{
+					Content: []mcp.Content{
+						mcp.TextContent{
+							Type: "text",
+							Text: fmt.Sprintf("Call rejected: %s", err.Error()),
+						},
+					},
+					IsError: true,
+				}, err
+			}
+
+			return next(ctx, request)
+		}
+	}
+}
+
+// shedding returns ErrServerBusy if the queue holds API_QUEUE_MAX_DEPTH
+// requests or its oldest request has waited API_QUEUE_SHED_WAIT_SECONDS
+func (l *APILimiter) shedding() error {
+	config := l.live.Get()
+	if config.MaxConcurrentAPICalls <= 0 {
+		return nil
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	var err error
+	if depth := config.APIQueueMaxDepth; depth > 0 && len(l.waiting) >= depth {
+		err = fmt.Errorf("%w: %d API requests queued, retry in a few seconds", ErrServerBusy, len(l.waiting))
+	} else if shedWait := config.APIQueueShedWait; shedWait > 0 && len(l.waiting) > 0 {
+		if waited := time.Since(l.waiting[0].since); waited >= shedWait {
+			err = fmt.Errorf("%w: queued API requests have waited %.0fs, retry in a few seconds", ErrServerBusy, math.Floor(waited.Seconds()))
+		}
+	}
+	if err != nil {
+		l.shed++
+	}
+	return err
+}
+
+func (l *APILimiter) release() {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	l.active--
+	l.dispatch()
+}
+
+// dispatch hands free slots to queued requests in arrival order
+func (l *APILimiter) dispatch() {
+	for len(l.waiting) > 0 && l.hasSlot() {
+		l.active++
+		close(l.waiting[0].ready)
+		l.waiting = l.waiting[1:]
+	}
+}
+
+func (l *APILimiter) hasSlot() bool {
+	limit := l.live.Get().MaxConcurrentAPICalls
+	return limit <= 0 || l.active < limit
+}
+
+func (l *APILimiter) recordWait(wait time.Duration) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	l.waits++
+	l.totalWait += wait
+	l.maxWait = max(l.maxWait, wait)
+}
+
+// Stats returns the current concurrency and queue wait times
+func (l *APILimiter) Stats() APICallStats {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	stats := APICallStats{
+		Limit:     l.live.Get().MaxConcurrentAPICalls,
+		InFlight:  l.active,
+		Waiting:   len(l.waiting),
+		Calls:     l.calls,
+		Queued:    l.queued,
+		Shed:      l.shed,
+		MaxWaitMs: float64(l.maxWait.Microseconds()) / 1000,
+	}
+	if l.waits > 0 {
+		stats.AvgWaitMs = float64(l.totalWait.Microseconds()) / 1000 / float64(l.waits)
+	}
+	return stats
+}
@@ -0,0 +1,127 @@
+package internal
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/mark3labs/mcp-go/mcp"
+	"github.com/stretchr/testify/require"
+)
+
+// waitQueued waits until n requests are queued on limiter
+func waitQueued(t *testing.T, limiter *APILimiter, n int) {
+	t.Helper()
+	require.Eventually(t, func() bool { return limiter.Stats().Waiting == n }, time.Second, time.Millisecond)
+}
+
+func TestAPILimiterServesWaitersInArrivalOrder(t *testing.T) {
+	limiter := NewAPILimiter(NewLiveConfig(&Config{MaxConcurrentAPICalls: 1}))
+	release, err := limiter.Acquire(context.Background())
+	require.NoError(t, err)
+
+	order := make(chan int, 3)
+	for i := range 3 {
+		go func() {
+			release, err := limiter.Acquire(context.Background())
+			if err == nil {
+				order <- i
+				release()
+			}
+		}()
+		waitQueued(t, limiter, i+1)
+	}
+
+	release()
+	for i := range 3 {
+		require.Equal(t, i, <-order)
+	}
+	stats := limiter.Stats()
+	require.Equal(t, int64(4), stats.Calls)
+	require.Equal(t, int64(3), stats.Queued)
+	require.Zero(t, stats.InFlight)
+}
+
+func TestAPILimiterShedsWhenQueueFull(t *testing.T) {
+	limiter := NewAPILimiter(NewLiveConfig(&Config{MaxConcurrentAPICalls: 1, APIQueueMaxDepth: 2}))
+	release, err := limiter.Acquire(context.Background())
+	require.NoError(t, err)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	for i := range 2 {
+		go func() {
+			if release, err := limiter.Acquire(ctx); err == nil {
+				release()
+			}
+		}()
+		waitQueued(t, limiter, i+1)
+	}
+
+	var called []string
+	handler := limiter.Middleware()(func(ctx context.Context, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+		called = append(called, request.Params.Name)
+		return mcp.NewToolResultText("ok"), nil
+	})
+	var request mcp.CallToolRequest
+	request.Params.Name = "perplexity_search"
+	result, err := handler(context.Background(), request)
+	require.ErrorIs(t, err, ErrServerBusy)
+	require.True(t, result.IsError)
+
+	// Tools that make no API requests are still served
+	request.Params.Name = "perplexity_job_status"
+	result, err = handler(context.Background(), request)
+	require.NoError(t, err)
+	require.False(t, result.IsError)
+	require.Equal(t, []string{"perplexity_job_status"}, called)
+	require.Equal(t, int64(1), limiter.Stats().Shed)
+
+	release()
+	require.Eventually(t, func() bool { return limiter.Stats().Waiting == 0 }, time.Second, time.Millisecond)
+	request.Params.Name = "perplexity_search"
+	_, err = handler(context.Background(), request)
+	require.NoError(t, err)
+}
+
+func TestAPILimiterCancelledWaiterFreesItsPlace(t *testing.T) {
+	limiter := NewAPILimiter(NewLiveConfig(&Config{MaxConcurrentAPICalls: 1}))
+	_, err := limiter.Acquire(context.Background())
+	require.NoError(t, err)
+
+	// A waiter cancelled in the queue leaves it without taking a slot
+	ctx, cancel := context.WithCancel(context.Background())
+	errs := make(chan error, 1)
+	go func() {
+		_, err := limiter.Acquire(ctx)
+		errs <- err
+	}()
+	waitQueued(t, limiter, 1)
+	cancel()
+	require.ErrorIs(t, <-errs, context.Canceled)
+	require.Zero(t, limiter.Stats().Waiting)
+	require.Equal(t, 1, limiter.Stats().InFlight)
+
+	// A waiter cancelled as the slot is handed to it passes the slot on
+	ctx, cancel = context.WithCancel(context.Background())
+	go func() {
+		release, err := limiter.Acquire(ctx)
+		if err == nil {
+			release()
+		}
+		errs <- err
+	}()
+	waitQueued(t, limiter, 1)
+	// Release the first slot as release does, cancelling before the waiter wakes
+	limiter.mu.Lock()
+	limiter.active--
+	limiter.dispatch()
+	cancel()
+	limiter.mu.Unlock()
+	<-errs
+	require.Zero(t, limiter.Stats().InFlight)
+
+	next, err := limiter.Acquire(context.Background())
+	require.NoError(t, err)
+	next()
+}
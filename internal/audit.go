@@ -0,0 +1,165 @@
+package internal
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"os"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/mark3labs/mcp-go/mcp"
+	"github.com/mark3labs/mcp-go/server"
+)
+
+// MaxAuditValueLength bounds each string argument and error message in the audit log
+const MaxAuditValueLength = 200
+
+// sensitiveArgumentNames are argument names whose values are never logged
+var sensitiveArgumentNames = []string{"api_key", "apikey", "token", "access_token", "password", "secret", "authorization"}
+
+// AuditEntry is one line of the audit log
+type AuditEntry struct {
+	Time           time.Time      `json:"time"`
+	RequestID      string         `json:"request_id,omitempty"`
+	Transport      string         `json:"transport"`
+	ClientName     string         `json:"client_name"`
+	ClientVersion  string         `json:"client_version"`
+	ClientIdentity string         `json:"client_identity,omitempty"`
+	Tool           string         `json:"tool"`
+	Arguments      map[string]any `json:"arguments,omitempty"`
+	Status         string         `json:"status"`
+	Error          string         `json:"error,omitempty"`
+	Blocked        []string       `json:"blocked,omitempty"`
+	Usage          *Usage         `json:"usage,omitempty"`
+	LatencyMs      int64          `json:"latency_ms"`
+}
+
+// AuditLog appends a JSON line for every tool call to a file. Arguments and
+// errors are redacted with the same rules as the server log and truncated to
+// MaxAuditValueLength.
+type AuditLog struct {
+	mu   sync.Mutex
+	file *os.File
+}
+
+func NewAuditLog(path string) (*AuditLog, error) {
+	file, err := os.OpenFile(path, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0o600)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open audit log: %w", err)
+	}
+	return &AuditLog{file: file}, nil
+}
+
+func (a *AuditLog) Close() error {
+	return a.file.Close()
+}
+
+// Middleware records every tool call served over transport
+func (a *AuditLog) Middleware(transport string) server.ToolHandlerMiddleware {
+	return func(next server.ToolHandlerFunc) server.ToolHandlerFunc {
+		return func(ctx context.Context, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+			start := time.Now()
+			result, err := next(ctx, request)
+
+			key := clientKey(ctx, transport)
+			entry := AuditEntry{
+				Time:           start.UTC(),
+				RequestID:      RequestIDFromContext(ctx),
+				Transport:      transport,
+				ClientName:     key.clientName,
+				ClientVersion:  key.clientVersion,
+				ClientIdentity: clientIdentity(ctx),
+				Tool:           request.Params.Name,
+				Arguments:      redactArguments(request.GetArguments()),
+				Status:         "ok",
+				LatencyMs:      time.Since(start).Milliseconds(),
+			}
+			if err != nil || (result != nil && result.IsError) {
+				entry.Status = "error"
+			}
+			if err != nil {
+				entry.Error = truncateRunes(redactLogText(err.Error()), MaxAuditValueLength)
+			}
+			// Name the patterns of requests the outbound query filter rejected
+			var blocked *QueryBlockedError
+			if errors.As(err, &blocked) {
+				entry.Blocked = blocked.Patterns
+			}
+			if result != nil && result.Meta != nil {
+				if usage, ok := result.Meta.AdditionalFields["usage"].(Usage); ok {
+					entry.Usage = &usage
+				}
+			}
+			a.write(entry)
+
+			return result, err
+		}
+	}
+}
+
+func (a *AuditLog) write(entry AuditEntry) {
+	line, err := json.Marshal(entry)
+	if err != nil {
+		return
+	}
+
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	// An unwritable audit log must not fail the call it describes
+	if _, err := a.file.Write(append(line, '\n')); err != nil {
+		slog.Warn("Failed to write audit log", "error", err)
+	}
+}
+
+// redactArguments copies tool arguments with sensitive fields removed and
+// strings redacted and truncated
+func redactArguments(args map[string]any) map[string]any {
+	if len(args) == 0 {
+		return nil
+	}
+	redacted := make(map[string]any, len(args))
+	for name, value := range args {
+		if isSensitiveArgument(name) {
+			redacted[name] = "[redacted]"
+			continue
+		}
+		redacted[name] = redactValue(value)
+	}
+	return redacted
+}
+
+func redactValue(value any) any {
+	switch v := value.(type) {
+	case string:
+		return truncateRunes(redactLogText(v), MaxAuditValueLength)
+	case map[string]any:
+		return redactArguments(v)
+	case []any:
+		items := make([]any, len(v))
+		for i, item := range v {
+			items[i] = redactValue(item)
+		}
+		return items
+	default:
+		return v
+	}
+}
+
+func isSensitiveArgument(name string) bool {
+	return slices.Contains(sensitiveArgumentNames, strings.ToLower(name))
+}
+
+// truncateRunes shortens s to at most limit runes, marking the cut with an ellipsis
+func truncateRunes(s string, limit int) string {
+	runes := []rune(s)
+	if len(runes) <= limit {
+		return s
+	}
+	return string(runes[:limit]) + "…"
+}
@@ -0,0 +1,41 @@
+package internal
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/mark3labs/mcp-go/mcp"
+	"github.com/stretchr/testify/require"
+)
+
+func TestAuditLogRedactsWithLogRules(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "audit.jsonl")
+	audit, err := NewAuditLog(path)
+	require.NoError(t, err)
+
+	handler := audit.Middleware(TransportStdio)(func(ctx context.Context, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+		return nil, errors.New("lookup of jane@example.com failed at port 443123456")
+	})
+	var request mcp.CallToolRequest
+	request.Params.Name = "perplexity_search"
+	request.Params.Arguments = map[string]any{"query": "contact jane@example.com", "token": "secret"}
+	_, err = handler(context.Background(), request)
+	require.Error(t, err)
+	require.NoError(t, audit.Close())
+
+	line, err := os.ReadFile(path)
+	require.NoError(t, err)
+	var entry AuditEntry
+	require.NoError(t, json.Unmarshal(line, &entry))
+	require.Equal(t, "error", entry.Status)
+	require.Equal(t, redactLogText("lookup of jane@example.com failed at port 443123456"), entry.Error)
+	require.NotContains(t, entry.Error, "jane@example.com")
+	// Numbers stay readable, unlike in the review queue
+	require.Contains(t, entry.Error, "443123456")
+	require.NotContains(t, entry.Arguments["query"], "jane@example.com")
+	require.Equal(t, "[redacted]", entry.Arguments["token"])
+}
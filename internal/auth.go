@@ -0,0 +1,36 @@
+package internal
+
+import (
+	"crypto/subtle"
+	"net/http"
+	"strings"
+)
+
+// RequireBearerToken rejects requests whose Authorization header does not
+// carry one of the tokens returned by tokens as a bearer token with 401
+// Unauthorized. tokens is called on every request, so tokens read from the
+// live configuration follow reloads. With no tokens every request is let through.
+func RequireBearerToken(tokens func() []string, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if tokens := tokens(); len(tokens) > 0 && !validBearerToken(r, tokens) {
+			w.Header().Set("WWW-Authenticate", `Bearer realm="perplexity-mcp-server"`)
+			writeJSON(w, http.StatusUnauthorized, map[string]string{"error": "unauthorized"})
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// validBearerToken compares the request's bearer token with every token in
+// constant time, so neither the match nor its position leaks through timing
+func validBearerToken(r *http.Request, tokens []string) bool {
+	presented, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+	if !ok || presented == "" {
+		return false
+	}
+	valid := 0
+	for _, token := range tokens {
+		valid |= subtle.ConstantTimeCompare([]byte(presented), []byte(token))
+	}
+	return valid == 1
+}
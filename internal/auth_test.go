@@ -0,0 +1,52 @@
+package internal
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestBearerTokensFollowReload(t *testing.T) {
+	start := reloadableConfig(t)
+	start.AuthTokens = []string{"old"}
+	live := NewLiveConfig(start)
+
+	var identity string
+	handler := RequireBearerToken(func() []string { return live.Get().AuthTokens }, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		identity = clientIdentity(HTTPClientIdentity(live)(context.Background(), r))
+	}))
+	status := func(token string) int {
+		r := httptest.NewRequest("POST", "/mcp", nil)
+		r.RemoteAddr = "203.0.113.7:51234"
+		r.Header.Set("Authorization", "Bearer "+token)
+		w := httptest.NewRecorder()
+		identity = ""
+		handler.ServeHTTP(w, r)
+		return w.Code
+	}
+
+	require.Equal(t, http.StatusOK, status("old"))
+	require.True(t, strings.HasPrefix(identity, "token:"), identity)
+	require.Equal(t, http.StatusUnauthorized, status("new"))
+
+	// Rotating replaces the old token for authentication and identities alike
+	next := reloadableConfig(t)
+	next.AuthTokens = []string{"new"}
+	ignored, err := live.Reload(next)
+	require.NoError(t, err)
+	require.Empty(t, ignored)
+	require.Equal(t, http.StatusUnauthorized, status("old"))
+	require.Equal(t, http.StatusOK, status("new"))
+	require.True(t, strings.HasPrefix(identity, "token:"), identity)
+
+	// Removing every token needs a restart
+	ignored, err = live.Reload(reloadableConfig(t))
+	require.NoError(t, err)
+	require.Contains(t, ignored, "auth tokens")
+	require.Equal(t, http.StatusUnauthorized, status("old"))
+	require.Equal(t, http.StatusOK, status("new"))
+}
@@ -0,0 +1,87 @@
+package internal
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/aws/arn"
+	awsconfig "github.com/aws/aws-sdk-go-v2/config"
+	"github.com/aws/aws-sdk-go-v2/service/secretsmanager"
+	"github.com/aws/aws-sdk-go-v2/service/ssm"
+)
+
+// awsSecretKeyField is the JSON field read when a Secrets Manager secret holds key/value pairs
+const awsSecretKeyField = "PERPLEXITY_API_KEY"
+
+// AWSSecretProvider reads the API key from AWS Secrets Manager or SSM Parameter
+// Store, chosen by the service in the ARN. Credentials come from the standard
+// AWS chain (environment, shared config, IRSA, instance role).
+type AWSSecretProvider struct {
+	arn            string
+	secretsManager *secretsmanager.Client
+	ssm            *ssm.Client
+}
+
+func NewAWSSecretProvider(ctx context.Context, secretARN string) (*AWSSecretProvider, error) {
+	parsed, err := arn.Parse(secretARN)
+	if err != nil {
+		return nil, fmt.Errorf("invalid PERPLEXITY_SECRET_ARN: %w", err)
+	}
+
+	cfg, err := awsconfig.LoadDefaultConfig(ctx, awsconfig.WithRegion(parsed.Region))
+	if err != nil {
+		return nil, fmt.Errorf("failed to load AWS configuration: %w", err)
+	}
+
+	p := &AWSSecretProvider{arn: secretARN}
+	switch parsed.Service {
+	case "secretsmanager":
+		p.secretsManager = secretsmanager.NewFromConfig(cfg)
+	case "ssm":
+		if !strings.HasPrefix(parsed.Resource, "parameter/") {
+			return nil, fmt.Errorf("invalid PERPLEXITY_SECRET_ARN: %s is not an SSM parameter", secretARN)
+		}
+		p.ssm = ssm.NewFromConfig(cfg)
+	default:
+		return nil, fmt.Errorf("invalid PERPLEXITY_SECRET_ARN: unsupported service %q", parsed.Service)
+	}
+	return p, nil
+}
+
+// APIKey fetches the current key. A Secrets Manager secret may be a plain string
+// or a JSON object with a PERPLEXITY_API_KEY field.
+func (p *AWSSecretProvider) APIKey(ctx context.Context) (string, error) {
+	if p.ssm != nil {
+		out, err := p.ssm.GetParameter(ctx, &ssm.GetParameterInput{
+			Name:           aws.String(p.arn),
+			WithDecryption: aws.Bool(true),
+		})
+		if err != nil {
+			return "", err
+		}
+		return strings.TrimSpace(aws.ToString(out.Parameter.Value)), nil
+	}
+
+	out, err := p.secretsManager.GetSecretValue(ctx, &secretsmanager.GetSecretValueInput{
+		SecretId: aws.String(p.arn),
+	})
+	if err != nil {
+		return "", err
+	}
+	value := strings.TrimSpace(aws.ToString(out.SecretString))
+	if strings.HasPrefix(value, "{") {
+		var fields map[string]string
+		if err := json.Unmarshal([]byte(value), &fields); err != nil {
+			return "", fmt.Errorf("failed to parse secret JSON: %w", err)
+		}
+		value = strings.TrimSpace(fields[awsSecretKeyField])
+	}
+	return value, nil
+}
+
+func (p *AWSSecretProvider) Source() string {
+	return p.arn
+}
@@ -0,0 +1,304 @@
+package internal
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"sync"
+
+	"github.com/mark3labs/mcp-go/mcp"
+)
+
+// Defaults for perplexity_batch_search
+const (
+	DefaultMaxBatchQueries  = 20
+	DefaultBatchConcurrency = 4
+)
+
+// CreateBatchSearchTool creates the perplexity_batch_search tool, which runs
+// several searches sharing the same options in one call
+func CreateBatchSearchTool(config *Config) mcp.Tool {
+	tool := mcp.Tool{
+		Name:        "perplexity_batch_search",
+		Description: fmt.Sprintf("Run up to %d searches in one call, in parallel, instead of calling perplexity_search once per query. All queries share the other options. Returns one result per query, in order; a query that fails carries its error without failing the others.", config.MaxBatchQueries),
+		InputSchema: mcp.ToolInputSchema{
+			Type: "object",
+			Properties: map[string]any{
+				"queries": map[string]any{
+					"type":        "array",
+					"description": "The search queries to execute",
+					"items": map[string]any{
+						"type":      "string",
+						"minLength": 1,
+						"maxLength": config.MaxQueryLength,
+					},
+					"minItems": 1,
+					"maxItems": config.MaxBatchQueries,
+				},
+				"model": map[string]any{
+					"type":        "string",
+					"description": fmt.Sprintf("The Sonar model to use (optional, defaults to '%s')", config.DefaultModelFor("perplexity_batch_search")),
+					"enum":        config.Models(),
+				},
+				"system_prompt": map[string]any{
+					"type":        "string",
+					"description": "Instructions that steer the tone, language, and formatting of every answer (optional)",
+					"maxLength":   config.MaxQueryLength,
+				},
+				"max_tokens": map[string]any{
+					"type":        "number",
+					"description": "Maximum number of tokens in each response (optional)",
+					"minimum":     1,
+					"maximum":     128000,
+				},
+				"search_mode": map[string]any{
+					"type":        "string",
+					"description": "The search mode to use (optional, defaults to 'web')",
+					"enum":        SearchModes,
+				},
+				"date_range": map[string]any{
+					"type":        "string",
+					"description": "Filter search results by date range (optional)",
+					"enum":        DateRanges,
+				},
+				"sources": map[string]any{
+					"type":        "array",
+					"description": fmt.Sprintf("Limit search to specific domains (optional, max %d)", config.MaxDomainFilters),
+					"items": map[string]any{
+						"type": "string",
+					},
+					"maxItems": config.MaxDomainFilters,
+				},
+				"exclude_sources": map[string]any{
+					"type":        "array",
+					"description": fmt.Sprintf("Domains to leave out of the search (optional; at most %d together with sources)", config.MaxDomainFilters),
+					"items": map[string]any{
+						"type": "string",
+					},
+					"maxItems": config.MaxDomainFilters,
+				},
+				"concurrency": map[string]any{
+					"type":        "integer",
+					"description": fmt.Sprintf("Queries to run at once (optional, defaults to and is capped at %d)", config.BatchConcurrency),
+					"minimum":     1,
+					"maximum":     config.BatchConcurrency,
+				},
+			},
+			Required: []string{"queries"},
+		},
+		OutputSchema: batchSearchOutputSchema(),
+	}
+	relaxModelSchema(&tool, config)
+	return tool
+}
+
+// BatchSearchHandler creates the handler function for the perplexity_batch_search
+// tool. At most BatchConcurrency queries of a call run at once, or fewer if the
+// call asks for it, on top of the server-wide MaxConcurrentAPICalls limit.
+func BatchSearchHandler(client SearchProvider, live *LiveConfig, results *ResultStore, usage *UsageTracker) func(ctx context.Context, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+	return func(ctx context.Context, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+		// Read the configuration once per call so a reload never changes it mid-batch
+		config := live.Get()
+
+		queries, req, err := parseBatchSearchRequest(request, config.MaxBatchQueries)
+		concurrency := config.BatchConcurrency
+		if err == nil {
+			concurrency, err = batchConcurrency(request, config.BatchConcurrency)
+		}
+		if err == nil {
+			config.applyToolDefaults("perplexity_batch_search", req)
+			req.MaxQueryLength = config.MaxQueryLength
+			req.MaxDomainFilters = config.MaxDomainFilters
+			err = config.CheckModel(req.Model)
+		}
+		// Check the shared options once with a stand-in query, so a bad option
+		// fails the call instead of every query
+		if err == nil {
+			probe := *req
+			probe.Query = "-"
+			err = probe.Validate()
+		}
+		if err != nil {
+			return &mcp.CallToolResult{
+				Content: []mcp.Content{
+					mcp.TextContent{
+						Type: "text",
+						Text: fmt.Sprintf("Invalid batch request: %s", err.Error()),
+					},
+				},
+				IsError: true,
+			}, err
+		}
+
+		if _, err := config.Budgets.Check(usage); err != nil {
+			return &mcp.CallToolResult{
+				Content: []mcp.Content{
+					mcp.TextContent{
+						Type: "text",
+						Text: fmt.Sprintf("Batch search failed: %s", err.Error()),
+					},
+				},
+				IsError: true,
+			}, err
+		}
+
+		reqs := make([]SearchRequest, len(queries))
+		for i, query := range queries {
+			reqs[i] = *req
+			reqs[i].Query = query
+		}
+		answers, errs := searchAll(ctx, "perplexity_batch_search", client, config, results, usage, reqs, concurrency, newProgressReporter(ctx, request))
+
+		items := make([]map[string]any, len(queries))
+		failed := 0
+		for i, query := range queries {
+			items[i] = batchItem(i, query, answers[i], &reqs[i], errs[i])
+			if errs[i] != nil {
+				failed++
+			}
+		}
+		budgetWarnings, _ := config.Budgets.Check(usage)
+
+		data := map[string]any{
+			"results":   items,
+			"succeeded": len(items) - failed,
+			"failed":    failed,
+		}
+		jsonBytes, err := json.MarshalIndent(data, "", "  ")
+		if err != nil {
+			return &mcp.CallToolResult{
+				Content: []mcp.Content{
+					mcp.TextContent{
+						Type: "text",
+						Text: fmt.Sprintf("Failed to format result: %s", err.Error()),
+					},
+				},
+				IsError: true,
+			}, err
+		}
+		return &mcp.CallToolResult{
+			Result: mcp.Result{Meta: withBudgetWarnings(resultMeta(config.ModelPrices, nil, answers...), budgetWarnings)},
+			Content: []mcp.Content{
+				mcp.TextContent{
+					Type: "text",
+					Text: string(jsonBytes),
+				},
+			},
+			StructuredContent: data,
+			IsError:           false,
+		}, nil
+	}
+}
+
+// searchAll runs reqs as calls of tool, at most concurrency at once, and
+// returns the answer or error of each in order
+func searchAll(ctx context.Context, tool string, client SearchProvider, config *Config, results *ResultStore, usage *UsageTracker, reqs []SearchRequest, concurrency int, progress *progressReporter) ([]*SearchResult, []error) {
+	answers := make([]*SearchResult, len(reqs))
+	errs := make([]error, len(reqs))
+	slots := make(chan struct{}, concurrency)
+	var (
+		wg   sync.WaitGroup
+		mu   sync.Mutex
+		done int
+	)
+	for i, req := range reqs {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			select {
+			case slots <- struct{}{}:
+				defer func() { <-slots }()
+			case <-ctx.Done():
+				errs[i] = ctx.Err()
+				return
+			}
+
+			answers[i], errs[i] = batchQuery(ctx, tool, client, config, results, usage, req)
+
+			mu.Lock()
+			done++
+			progress.report(fmt.Sprintf("%d/%d queries done", done, len(reqs)))
+			mu.Unlock()
+		}()
+	}
+	wg.Wait()
+	return answers, errs
+}
+
+// batchQuery runs one query of a batch, then stores the answer and records
+// its usage. A query started after a hard budget limit is reached fails.
+func batchQuery(ctx context.Context, tool string, client SearchProvider, config *Config, results *ResultStore, usage *UsageTracker, req SearchRequest) (*SearchResult, error) {
+	if err := req.Validate(); err != nil {
+		return nil, err
+	}
+	if _, err := config.Budgets.Check(usage); err != nil {
+		return nil, err
+	}
+
+	result, err := searchWithModelFallback(ctx, client, config, tool, req, nil)
+	if err != nil {
+		return nil, err
+	}
+	results.PutAnswer(ctx, req, result)
+	usage.Record(config.ModelPrices, tool, "", result)
+	return config.shownResult(result), nil
+}
+
+// batchItem is the entry of one query in a perplexity_batch_search result
+func batchItem(index int, query string, result *SearchResult, req *SearchRequest, err error) map[string]any {
+	item := map[string]any{
+		"index": index,
+		"query": query,
+	}
+	if err != nil {
+		item["error"] = err.Error()
+	} else {
+		item["result"] = searchResultData(result, req)
+	}
+	return item
+}
+
+// parseBatchSearchRequest returns the queries of request and the search
+// request they share, with an empty query
+func parseBatchSearchRequest(request mcp.CallToolRequest, maxQueries int) ([]string, *SearchRequest, error) {
+	queries, err := request.RequireStringSlice("queries")
+	if err != nil {
+		return nil, nil, fmt.Errorf("queries must be an array of strings")
+	}
+	if len(queries) == 0 {
+		return nil, nil, fmt.Errorf("queries must not be empty")
+	}
+	if len(queries) > maxQueries {
+		return nil, nil, fmt.Errorf("too many queries: %d > %d", len(queries), maxQueries)
+	}
+	maxTokens, err := integerArgument(request, "max_tokens")
+	if err != nil {
+		return nil, nil, err
+	}
+
+	req := &SearchRequest{
+		Model:          request.GetString("model", ""),
+		SystemPrompt:   request.GetString("system_prompt", ""),
+		SearchMode:     request.GetString("search_mode", ""),
+		DateRange:      request.GetString("date_range", ""),
+		Sources:        request.GetStringSlice("sources", nil),
+		ExcludeSources: request.GetStringSlice("exclude_sources", nil),
+	}
+	if maxTokens != nil {
+		req.MaxTokens = *maxTokens
+	}
+	return queries, req, nil
+}
+
+// batchConcurrency returns the concurrency argument of request, limit when it
+// is missing and at most limit
+func batchConcurrency(request mcp.CallToolRequest, limit int) (int, error) {
+	concurrency, err := integerArgument(request, "concurrency")
+	if err != nil || concurrency == nil {
+		return limit, err
+	}
+	if *concurrency < 1 {
+		return 0, fmt.Errorf("concurrency must be at least 1")
+	}
+	return min(*concurrency, limit), nil
+}
@@ -0,0 +1,60 @@
+package internal
+
+import (
+	"context"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/mark3labs/mcp-go/mcp"
+	"github.com/stretchr/testify/require"
+)
+
+func TestBatchSearchConcurrencyArgument(t *testing.T) {
+	config := reloadableConfig(t)
+	config.BatchConcurrency = 3
+
+	var inFlight, peak atomic.Int32
+	client := &stubProvider{search: func(ctx context.Context, req SearchRequest) (*SearchResult, error) {
+		n := inFlight.Add(1)
+		defer inFlight.Add(-1)
+		for {
+			if p := peak.Load(); n <= p || peak.CompareAndSwap(p, n) {
+				break
+			}
+		}
+		time.Sleep(20 * time.Millisecond)
+		return &SearchResult{ID: "res_" + req.Query, Model: req.Model, Content: req.Query}, nil
+	}}
+	handler := BatchSearchHandler(client, NewLiveConfig(config), NewResultStore(20), NewUsageTracker())
+
+	for _, tt := range []struct {
+		concurrency any
+		want        int32
+	}{
+		{nil, 3},
+		{1, 1},
+		{2, 2},
+		{10, 3},
+	} {
+		peak.Store(0)
+		var request mcp.CallToolRequest
+		request.Params.Arguments = map[string]any{"queries": []any{"a", "b", "c", "d", "e", "f"}}
+		if tt.concurrency != nil {
+			request.Params.Arguments.(map[string]any)["concurrency"] = tt.concurrency
+		}
+		result, err := handler(context.Background(), request)
+		require.NoError(t, err)
+		require.Equal(t, 6, result.StructuredContent.(map[string]any)["succeeded"])
+		require.Equal(t, tt.want, peak.Load(), "concurrency %v", tt.concurrency)
+	}
+
+	var request mcp.CallToolRequest
+	request.Params.Arguments = map[string]any{"queries": []any{"a"}, "concurrency": 0}
+	result, err := handler(context.Background(), request)
+	require.ErrorContains(t, err, "concurrency must be at least 1")
+	require.True(t, result.IsError)
+
+	tool := CreateBatchSearchTool(config)
+	require.Equal(t, 3, tool.InputSchema.Properties["concurrency"].(map[string]any)["maximum"])
+}
@@ -0,0 +1,160 @@
+package internal
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math"
+	"strings"
+	"time"
+
+	"github.com/mark3labs/mcp-go/mcp"
+	"github.com/mark3labs/mcp-go/server"
+)
+
+// ErrBudgetExceeded is returned for API calls refused because a hard budget
+// limit has been reached. Budgets reset at the start of each UTC day or month.
+var ErrBudgetExceeded = errors.New("budget exceeded")
+
+// BudgetLimit is a soft and hard limit on one quantity; zero disables either
+type BudgetLimit struct {
+	Soft float64
+	Hard float64
+}
+
+// Budgets limits token use and estimated cost per UTC day and month
+type Budgets struct {
+	DailyTokens   BudgetLimit
+	DailyUSD      BudgetLimit
+	MonthlyTokens BudgetLimit
+	MonthlyUSD    BudgetLimit
+}
+
+// budgetCheck is one limit compared against the usage of its period
+type budgetCheck struct {
+	period string
+	name   string
+	limit  BudgetLimit
+	used   float64
+}
+
+func (b Budgets) checks(day, month UsageTotals) []budgetCheck {
+	return []budgetCheck{
+		{"daily", "daily tokens", b.DailyTokens, float64(day.TotalTokens)},
+		{"daily", "daily cost (USD)", b.DailyUSD, day.CostUSD},
+		{"monthly", "monthly tokens", b.MonthlyTokens, float64(month.TotalTokens)},
+		{"monthly", "monthly cost (USD)", b.MonthlyUSD, month.CostUSD},
+	}
+}
+
+// Check returns a warning for each limit usage has reached, and
+// ErrBudgetExceeded when one of them is a hard limit
+func (b Budgets) Check(usage *UsageTracker) ([]string, error) {
+	day, month := usage.CurrentPeriods(time.Now())
+
+	var warnings []string
+	var exceeded error
+	for _, check := range b.checks(day, month) {
+		switch {
+		case check.limit.Hard > 0 && check.used >= check.limit.Hard:
+			message := fmt.Sprintf("%s used %s of the %s hard limit", check.name, formatAmount(check.used), formatAmount(check.limit.Hard))
+			warnings = append(warnings, message+"; further API calls are refused until the period resets")
+			if exceeded == nil {
+				exceeded = fmt.Errorf("%w: %s", ErrBudgetExceeded, message)
+			}
+		case check.limit.Soft > 0 && check.used >= check.limit.Soft:
+			warnings = append(warnings, fmt.Sprintf("%s used %s of the %s soft limit", check.name, formatAmount(check.used), formatAmount(check.limit.Soft)))
+		}
+	}
+	return warnings, exceeded
+}
+
+// Remaining returns the percentage left of the daily and monthly budgets as
+// daily_remaining_percent and monthly_remaining_percent. Each is the least
+// of its period's limits, counting the hard limit or else the soft one.
+// Periods without limits are left out.
+func (b Budgets) Remaining(usage *UsageTracker) map[string]float64 {
+	day, month := usage.CurrentPeriods(time.Now())
+
+	remaining := map[string]float64{}
+	for _, check := range b.checks(day, month) {
+		limit := check.limit.Hard
+		if limit == 0 {
+			limit = check.limit.Soft
+		}
+		if limit == 0 {
+			continue
+		}
+		key := check.period + "_remaining_percent"
+		percent := math.Round(math.Max(0, 1-check.used/limit)*1000) / 10
+		if current, ok := remaining[key]; !ok || percent < current {
+			remaining[key] = percent
+		}
+	}
+	return remaining
+}
+
+// Validate checks that limits are non-negative and soft limits lie below hard ones
+func (b Budgets) Validate() error {
+	for _, check := range b.checks(UsageTotals{}, UsageTotals{}) {
+		if check.limit.Soft < 0 || check.limit.Hard < 0 {
+			return fmt.Errorf("%s budget must not be negative", check.name)
+		}
+		if check.limit.Soft > 0 && check.limit.Hard > 0 && check.limit.Soft > check.limit.Hard {
+			return fmt.Errorf("%s soft budget exceeds its hard budget", check.name)
+		}
+	}
+	return nil
+}
+
+func formatAmount(value float64) string {
+	return strings.TrimSuffix(strings.TrimRight(fmt.Sprintf("%.4f", value), "0"), ".")
+}
+
+// withBudgetWarnings adds soft limit warnings to a result's _meta
+func withBudgetWarnings(meta *mcp.Meta, warnings []string) *mcp.Meta {
+	if len(warnings) == 0 {
+		return meta
+	}
+	if meta == nil {
+		meta = &mcp.Meta{AdditionalFields: map[string]any{}}
+	}
+	meta.AdditionalFields["budget_warnings"] = warnings
+	return meta
+}
+
+// PacingMiddleware adds the remaining budgets as _meta.budget and the last
+// rate-limit headroom reported by the API as _meta.rate_limit to every tool
+// result, so agents can pace themselves before calls are refused. Both come
+// from counters kept in memory.
+func PacingMiddleware(client SearchProvider, live *LiveConfig, usage *UsageTracker) server.ToolHandlerMiddleware {
+	return func(next server.ToolHandlerFunc) server.ToolHandlerFunc {
+		return func(ctx context.Context, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+			result, err := next(ctx, request)
+			if result == nil {
+				return result, err
+			}
+
+			fields := map[string]any{}
+			if remaining := live.Get().Budgets.Remaining(usage); len(remaining) > 0 {
+				fields["budget"] = remaining
+			}
+			if status := client.RateLimitStatus(); status != nil {
+				fields["rate_limit"] = status
+			}
+			if len(fields) == 0 {
+				return result, err
+			}
+			if result.Meta == nil {
+				result.Meta = &mcp.Meta{}
+			}
+			if result.Meta.AdditionalFields == nil {
+				result.Meta.AdditionalFields = map[string]any{}
+			}
+			for key, value := range fields {
+				result.Meta.AdditionalFields[key] = value
+			}
+			return result, err
+		}
+	}
+}
@@ -0,0 +1,125 @@
+package internal
+
+import (
+	"context"
+	"testing"
+
+	"github.com/mark3labs/mcp-go/mcp"
+	"github.com/stretchr/testify/require"
+)
+
+// usageOf returns a tracker that has recorded one call of tokens tokens costing costUSD
+func usageOf(tokens int, costUSD float64) *UsageTracker {
+	usage := NewUsageTracker()
+	prices := map[string]ModelPrice{"sonar": {InputPerMillion: costUSD * 1e6 / float64(tokens)}}
+	usage.Record(prices, "perplexity_search", "", &SearchResult{Model: "sonar", Usage: Usage{PromptTokens: tokens, TotalTokens: tokens}})
+	return usage
+}
+
+func TestBudgetsCheck(t *testing.T) {
+	// 1000 tokens costing $2 today
+	usage := usageOf(1000, 2)
+
+	tests := []struct {
+		name     string
+		budgets  Budgets
+		warnings []string
+		exceeded string
+	}{
+		{name: "no limits"},
+		{
+			name:    "below every limit",
+			budgets: Budgets{DailyTokens: BudgetLimit{Soft: 1500, Hard: 2000}, MonthlyUSD: BudgetLimit{Soft: 5, Hard: 10}},
+		},
+		{
+			name:     "soft limit reached",
+			budgets:  Budgets{DailyTokens: BudgetLimit{Soft: 1000, Hard: 2000}},
+			warnings: []string{"daily tokens used 1000 of the 1000 soft limit"},
+		},
+		{
+			name:     "hard limit reached",
+			budgets:  Budgets{DailyUSD: BudgetLimit{Soft: 1, Hard: 1.5}},
+			warnings: []string{"daily cost (USD) used 2 of the 1.5 hard limit; further API calls are refused until the period resets"},
+			exceeded: "budget exceeded: daily cost (USD) used 2 of the 1.5 hard limit",
+		},
+		{
+			name:     "hard limit without a soft one",
+			budgets:  Budgets{MonthlyTokens: BudgetLimit{Hard: 1000}},
+			warnings: []string{"monthly tokens used 1000 of the 1000 hard limit; further API calls are refused until the period resets"},
+			exceeded: "budget exceeded: monthly tokens used 1000 of the 1000 hard limit",
+		},
+		{
+			name: "several limits, the first hard one reported",
+			budgets: Budgets{
+				DailyTokens:   BudgetLimit{Soft: 500},
+				DailyUSD:      BudgetLimit{Hard: 2},
+				MonthlyTokens: BudgetLimit{Hard: 800},
+				MonthlyUSD:    BudgetLimit{Soft: 0.3333},
+			},
+			warnings: []string{
+				"daily tokens used 1000 of the 500 soft limit",
+				"daily cost (USD) used 2 of the 2 hard limit; further API calls are refused until the period resets",
+				"monthly tokens used 1000 of the 800 hard limit; further API calls are refused until the period resets",
+				"monthly cost (USD) used 2 of the 0.3333 soft limit",
+			},
+			exceeded: "budget exceeded: daily cost (USD) used 2 of the 2 hard limit",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			warnings, err := tt.budgets.Check(usage)
+			require.Equal(t, tt.warnings, warnings)
+			if tt.exceeded == "" {
+				require.NoError(t, err)
+				return
+			}
+			require.ErrorIs(t, err, ErrBudgetExceeded)
+			require.EqualError(t, err, tt.exceeded)
+		})
+	}
+}
+
+func TestBudgetsValidate(t *testing.T) {
+	require.NoError(t, Budgets{}.Validate())
+	require.NoError(t, Budgets{DailyUSD: BudgetLimit{Soft: 5, Hard: 5}, MonthlyTokens: BudgetLimit{Soft: 10}}.Validate())
+	require.EqualError(t, Budgets{MonthlyUSD: BudgetLimit{Hard: -1}}.Validate(), "monthly cost (USD) budget must not be negative")
+	require.EqualError(t, Budgets{DailyTokens: BudgetLimit{Soft: 10, Hard: 5}}.Validate(), "daily tokens soft budget exceeds its hard budget")
+}
+
+func TestBudgetsRemaining(t *testing.T) {
+	usage := usageOf(250, 1)
+
+	budgets := Budgets{
+		DailyTokens:   BudgetLimit{Hard: 1000},
+		DailyUSD:      BudgetLimit{Soft: 2, Hard: 10},
+		MonthlyTokens: BudgetLimit{Soft: 4000},
+	}
+	require.Equal(t, map[string]float64{
+		"daily_remaining_percent":   75,
+		"monthly_remaining_percent": 93.8,
+	}, budgets.Remaining(usage))
+
+	// Spent budgets stay at zero, and periods without limits are left out
+	budgets = Budgets{DailyUSD: BudgetLimit{Hard: 0.5}}
+	require.Equal(t, map[string]float64{"daily_remaining_percent": 0}, budgets.Remaining(usage))
+	require.Empty(t, Budgets{}.Remaining(usage))
+}
+
+func TestPacingMiddlewareAnnotatesEveryResult(t *testing.T) {
+	client := &stubProvider{rateLimit: &RateLimitStatus{Limit: 50, Remaining: 10, RemainingPercent: 20}}
+	live := NewLiveConfig(&Config{Budgets: Budgets{MonthlyUSD: BudgetLimit{Hard: 4}}})
+	middleware := PacingMiddleware(client, live, usageOf(100, 1))
+
+	for _, result := range []*mcp.CallToolResult{
+		mcp.NewToolResultText("answer"),
+		mcp.NewToolResultError("failed"),
+	} {
+		handler := middleware(func(ctx context.Context, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+			return result, nil
+		})
+		annotated, err := handler(context.Background(), mcp.CallToolRequest{})
+		require.NoError(t, err)
+		require.Equal(t, map[string]float64{"monthly_remaining_percent": 75}, annotated.Meta.AdditionalFields["budget"])
+		require.Equal(t, client.rateLimit, annotated.Meta.AdditionalFields["rate_limit"])
+	}
+}
@@ -0,0 +1,83 @@
+package internal
+
+import (
+	"bytes"
+	"io"
+	"sync"
+)
+
+// maxPooledBufferBytes is the largest buffer returned to the pool; larger ones
+// are left to the garbage collector so a rare oversized response doesn't keep
+// its memory alive
+const maxPooledBufferBytes = 4 * 1024 * 1024
+
+// bufferPool recycles the buffers that hold API request and response bodies
+var bufferPool = sync.Pool{
+	New: func() any { return new(bytes.Buffer) },
+}
+
+func getBuffer() *bytes.Buffer {
+	buf := bufferPool.Get().(*bytes.Buffer)
+	buf.Reset()
+	return buf
+}
+
+func putBuffer(buf *bytes.Buffer) {
+	if buf.Cap() <= maxPooledBufferBytes {
+		bufferPool.Put(buf)
+	}
+}
+
+// requestBody is an API request body that can be sent several times, as the
+// HTTP transport does when it retries on a fresh connection. The transport
+// may close a body after the request returns, so a pooled buffer is only
+// recycled once every reader handed out has been closed.
+type requestBody struct {
+	data   []byte
+	pooled *bytes.Buffer
+
+	mu   sync.Mutex
+	open int
+}
+
+// newPooledRequestBody wraps buf, which returns to the pool on release
+func newPooledRequestBody(buf *bytes.Buffer) *requestBody {
+	return &requestBody{data: buf.Bytes(), pooled: buf}
+}
+
+// reader returns a new reader over the body, usable as http.Request.GetBody
+func (b *requestBody) reader() (io.ReadCloser, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.open++
+	return &requestBodyReader{Reader: bytes.NewReader(b.data), body: b}, nil
+}
+
+// release recycles the pooled buffer unless the transport still holds a reader
+func (b *requestBody) release() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if b.pooled != nil && b.open == 0 {
+		putBuffer(b.pooled)
+	}
+	b.pooled = nil
+}
+
+type requestBodyReader struct {
+	*bytes.Reader
+	body   *requestBody
+	closed bool
+}
+
+func (r *requestBodyReader) Close() error {
+	r.body.mu.Lock()
+	defer r.body.mu.Unlock()
+
+	if !r.closed {
+		r.closed = true
+		r.body.open--
+	}
+	return nil
+}
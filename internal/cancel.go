@@ -0,0 +1,112 @@
+package internal
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"sync"
+
+	"github.com/mark3labs/mcp-go/mcp"
+	"github.com/mark3labs/mcp-go/server"
+)
+
+// callIDField carries a call's JSON-RPC ID from the BeforeCallTool hook to the
+// cancellation middleware, which removes it before handlers see the request
+const callIDField = "perplexity/jsonrpc_id"
+
+// Cancellations aborts in-flight tool calls when the client sends
+// notifications/cancelled. Cancelling a call cancels its context, which stops
+// the outbound Perplexity request and the token spend behind it.
+type Cancellations struct {
+	logger *slog.Logger
+
+	mu    sync.Mutex
+	calls map[string]context.CancelFunc
+}
+
+func NewCancellations(logger *slog.Logger) *Cancellations {
+	return &Cancellations{
+		logger: logger,
+		calls:  make(map[string]context.CancelFunc),
+	}
+}
+
+// AddHooks registers the hook that records each tool call's JSON-RPC ID
+func (c *Cancellations) AddHooks(hooks *server.Hooks) {
+	hooks.AddBeforeCallTool(func(ctx context.Context, id any, message *mcp.CallToolRequest) {
+		if message.Params.Meta == nil {
+			message.Params.Meta = &mcp.Meta{}
+		}
+		if message.Params.Meta.AdditionalFields == nil {
+			message.Params.Meta.AdditionalFields = map[string]any{}
+		}
+		message.Params.Meta.AdditionalFields[callIDField] = id
+	})
+}
+
+// Middleware makes every tool call cancellable by its JSON-RPC ID
+func (c *Cancellations) Middleware() server.ToolHandlerMiddleware {
+	return func(next server.ToolHandlerFunc) server.ToolHandlerFunc {
+		return func(ctx context.Context, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+			if request.Params.Meta == nil {
+				return next(ctx, request)
+			}
+			id, ok := request.Params.Meta.AdditionalFields[callIDField]
+			if !ok {
+				return next(ctx, request)
+			}
+			delete(request.Params.Meta.AdditionalFields, callIDField)
+
+			ctx, cancel := context.WithCancel(ctx)
+			key := cancelKey(ctx, id)
+
+			c.mu.Lock()
+			c.calls[key] = cancel
+			c.mu.Unlock()
+
+			defer func() {
+				c.mu.Lock()
+				delete(c.calls, key)
+				c.mu.Unlock()
+				cancel()
+			}()
+
+			return next(ctx, request)
+		}
+	}
+}
+
+// HandleCancelled is the notifications/cancelled handler
+func (c *Cancellations) HandleCancelled(ctx context.Context, notification mcp.JSONRPCNotification) {
+	id, ok := notification.Params.AdditionalFields["requestId"]
+	if !ok {
+		return
+	}
+	key := cancelKey(ctx, id)
+
+	c.mu.Lock()
+	cancel, ok := c.calls[key]
+	c.mu.Unlock()
+
+	// Calls that already finished, or were never tool calls, are ignored
+	if !ok {
+		return
+	}
+	reason, _ := notification.Params.AdditionalFields["reason"].(string)
+	c.logger.Info("Tool call cancelled by client", "jsonrpc_id", fmt.Sprint(id), "reason", reason)
+	cancel()
+}
+
+// cancelKey identifies a call by its client session and JSON-RPC ID, which is
+// only unique within a session
+func cancelKey(ctx context.Context, id any) string {
+	sessionID := ""
+	if session := server.ClientSessionFromContext(ctx); session != nil {
+		sessionID = session.SessionID()
+	}
+	requestID, ok := id.(mcp.RequestId)
+	if !ok {
+		requestID = mcp.NewRequestId(id)
+	}
+	return sessionID + "/" + requestID.String()
+}
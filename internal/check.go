@@ -0,0 +1,295 @@
+package internal
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/mark3labs/mcp-go/mcp"
+)
+
+// MaxReferenceURLLength bounds reference_url for perplexity_check_against
+const MaxReferenceURLLength = 2048
+
+// checkAgainstSystemPrompt asks the model for a fixed three-section layout that
+// parseComparison can split into findings
+const checkAgainstSystemPrompt = `Compare current web search results with the reference provided by the user.
+Respond with exactly three markdown sections titled "## Agrees", "## Contradicts" and "## Adds".
+Agrees lists reference claims the search results confirm, Contradicts lists reference claims the results dispute or show to be outdated, and Adds lists relevant facts missing from the reference.
+Write one finding per bullet point and cite its sources with [n] markers. Write "None" under a section with no findings.`
+
+// Finding is one point of agreement, contradiction, or addition with its supporting citations
+type Finding struct {
+	Statement string     `json:"statement"`
+	Citations []Citation `json:"citations,omitempty"`
+}
+
+// Comparison groups the findings of a reference check
+type Comparison struct {
+	Agrees      []Finding `json:"agrees"`
+	Contradicts []Finding `json:"contradicts"`
+	Adds        []Finding `json:"adds"`
+}
+
+// CreateCheckAgainstTool creates the perplexity_check_against tool for use with mcp-go
+func CreateCheckAgainstTool(config *Config) mcp.Tool {
+	tool := mcp.Tool{
+		Name:        "perplexity_check_against",
+		Description: "Check a reference document against fresh search results and report where the results agree with it, contradict it, or add to it, with citations for every finding. Useful for keeping internal documentation up to date.",
+		InputSchema: mcp.ToolInputSchema{
+			Type: "object",
+			Properties: map[string]any{
+				"query": map[string]any{
+					"type":        "string",
+					"description": "The topic or question to research",
+					"minLength":   1,
+					"maxLength":   config.MaxQueryLength,
+				},
+				"reference_text": map[string]any{
+					"type":        "string",
+					"description": "The reference document text (provide this or reference_url)",
+					"maxLength":   MaxMessageLength,
+				},
+				"reference_url": map[string]any{
+					"type":        "string",
+					"description": "Public URL of the reference document (provide this or reference_text)",
+					"maxLength":   MaxReferenceURLLength,
+				},
+				"model": map[string]any{
+					"type":        "string",
+					"description": fmt.Sprintf("The Sonar model to use (optional, defaults to '%s')", config.DefaultModelFor("perplexity_check_against")),
+					"enum":        config.Models(),
+				},
+				"reasoning_effort": map[string]any{
+					"type":        "string",
+					"description": "How hard sonar-deep-research works on the answer: 'low' is faster and cheaper, 'high' searches and reasons more (optional, ignored by other models)",
+					"enum":        ReasoningEfforts,
+				},
+			},
+			Required: []string{"query"},
+		},
+		OutputSchema: checkAgainstOutputSchema(),
+	}
+	relaxModelSchema(&tool, config)
+	return tool
+}
+
+// CheckAgainstHandler creates the handler function for the perplexity_check_against tool
+func CheckAgainstHandler(client SearchProvider, live *LiveConfig, results *ResultStore, usage *UsageTracker) func(ctx context.Context, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+	return func(ctx context.Context, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+		config := live.Get()
+
+		req, err := parseCheckAgainstRequest(request, config)
+		if err != nil {
+			return checkAgainstError(err), err
+		}
+
+		// Refuse new API calls once a hard budget limit is reached
+		if _, err := config.Budgets.Check(usage); err != nil {
+			return checkAgainstError(err), err
+		}
+
+		// Report progress to clients that asked for it with a progressToken
+		progress := newProgressReporter(ctx, request)
+		result, err := searchWithModelFallback(ctx, client, config, "perplexity_check_against", *req, progress)
+		if err != nil {
+			// Degrade as configured unless the caller itself gave up
+			if ctx.Err() == nil {
+				if degraded := degradedResult(ctx, config, "perplexity_check_against", results, *req, err, func(stale *SearchResult) (string, any, error) {
+					stale = config.shownResult(stale)
+					content, err := formatComparison(stale)
+					return content, comparisonData(stale), err
+				}); degraded != nil {
+					return degraded, nil
+				}
+			}
+			return checkAgainstError(err), err
+		}
+		progress.reportResult(result)
+		results.PutAnswer(ctx, *req, result)
+		usage.Record(config.ModelPrices, "perplexity_check_against", "", result)
+		budgetWarnings, _ := config.Budgets.Check(usage)
+
+		result = config.shownResult(result)
+		content, err := formatComparison(result)
+		if err != nil {
+			return checkAgainstError(err), err
+		}
+
+		return &mcp.CallToolResult{
+			Content: []mcp.Content{
+				mcp.TextContent{
+					Type: "text",
+					Text: content,
+				},
+			},
+			StructuredContent: comparisonData(result),
+			IsError:           false,
+			Result:            mcp.Result{Meta: withBudgetWarnings(resultMeta(config.ModelPrices, result), budgetWarnings)},
+		}, nil
+	}
+}
+
+func checkAgainstError(err error) *mcp.CallToolResult {
+	return &mcp.CallToolResult{
+		Content: []mcp.Content{
+			mcp.TextContent{
+				Type: "text",
+				Text: fmt.Sprintf("Reference check failed: %s", err.Error()),
+			},
+		},
+		IsError: true,
+		Result:  mcp.Result{Meta: errorMeta(err)},
+	}
+}
+
+// formatComparison renders a reference check result as JSON findings
+func formatComparison(result *SearchResult) (string, error) {
+	jsonBytes, err := json.MarshalIndent(comparisonData(result), "", "  ")
+	if err != nil {
+		return "", fmt.Errorf("failed to marshal comparison: %w", err)
+	}
+	return string(jsonBytes), nil
+}
+
+// comparisonData is the JSON result of perplexity_check_against, also returned
+// as structuredContent
+func comparisonData(result *SearchResult) map[string]any {
+	comparison, ok := parseComparison(result)
+	response := map[string]any{
+		"id":           result.ID,
+		"resource_uri": SearchURI(result.ID),
+		"model":        result.Model,
+		"usage":        result.Usage,
+		"created":      result.Created,
+	}
+	if ok {
+		response["comparison"] = comparison
+	} else {
+		// The model ignored the requested layout; return the answer as-is
+		response["content"] = result.Content
+	}
+	if len(result.Citations) > 0 {
+		response["citations"] = result.Citations
+	}
+	if result.Reasoning != "" {
+		response["reasoning"] = result.Reasoning
+	}
+	if result.RequestedModel != "" {
+		response["requested_model"] = result.RequestedModel
+	}
+	if result.Stale {
+		response["stale"] = true
+	}
+	return response
+}
+
+// parseCheckAgainstRequest builds the search request for a reference check. The
+// reference is sent as a prior conversation turn because it may exceed the query limit.
+func parseCheckAgainstRequest(request mcp.CallToolRequest, config *Config) (*SearchRequest, error) {
+	query, err := request.RequireString("query")
+	if err != nil {
+		return nil, fmt.Errorf("query parameter is required and must be a string")
+	}
+	referenceText := strings.TrimSpace(request.GetString("reference_text", ""))
+	referenceURL := strings.TrimSpace(request.GetString("reference_url", ""))
+
+	var reference string
+	switch {
+	case referenceText != "" && referenceURL != "":
+		return nil, fmt.Errorf("provide either reference_text or reference_url, not both")
+	case referenceText != "":
+		reference = "Reference document:\n\n" + referenceText
+	case referenceURL != "":
+		if len(referenceURL) > MaxReferenceURLLength {
+			return nil, fmt.Errorf("reference_url too long: %d > %d", len(referenceURL), MaxReferenceURLLength)
+		}
+		if !strings.HasPrefix(referenceURL, "https://") && !strings.HasPrefix(referenceURL, "http://") {
+			return nil, fmt.Errorf("reference_url must be an http or https URL")
+		}
+		reference = "The reference document is published at " + referenceURL
+	default:
+		return nil, fmt.Errorf("reference_text or reference_url is required")
+	}
+
+	req := &SearchRequest{
+		Query:        query,
+		Model:        request.GetString("model", ""),
+		SystemPrompt: checkAgainstSystemPrompt,
+		ContextMessages: []Message{
+			{Role: "user", Content: reference},
+			{Role: "assistant", Content: "I will compare the reference with current search results."},
+		},
+	}
+	req.ReasoningEffort = request.GetString("reasoning_effort", "")
+	config.applyToolDefaults("perplexity_check_against", req)
+	req.MaxQueryLength = config.MaxQueryLength
+	req.MaxDomainFilters = config.MaxDomainFilters
+	if err := config.CheckModel(req.Model); err != nil {
+		return nil, err
+	}
+	if err := req.Validate(); err != nil {
+		return nil, err
+	}
+	return req, nil
+}
+
+// parseComparison splits an answer in the checkAgainstSystemPrompt layout into
+// findings. It reports false when none of the expected sections are present.
+func parseComparison(result *SearchResult) (Comparison, bool) {
+	comparison := Comparison{Agrees: []Finding{}, Contradicts: []Finding{}, Adds: []Finding{}}
+	found := false
+
+	for _, section := range splitSections(result.Content) {
+		var target *[]Finding
+		switch strings.ToLower(section.Title) {
+		case "agrees":
+			target = &comparison.Agrees
+		case "contradicts":
+			target = &comparison.Contradicts
+		case "adds":
+			target = &comparison.Adds
+		default:
+			continue
+		}
+		found = true
+		*target = append(*target, parseFindings(section.Content, result.Citations)...)
+	}
+
+	return comparison, found
+}
+
+// parseFindings turns the bullet points of a section into findings, resolving
+// their [n] markers against citations
+func parseFindings(content string, citations []Citation) []Finding {
+	byNumber := make(map[int]Citation, len(citations))
+	for _, citation := range citations {
+		byNumber[citation.Number] = citation
+	}
+
+	var findings []Finding
+	for _, line := range strings.Split(content, "\n") {
+		line = strings.TrimSpace(line)
+		if !strings.HasPrefix(line, "- ") && !strings.HasPrefix(line, "* ") {
+			continue
+		}
+		statement := strings.TrimSpace(line[2:])
+		if statement == "" || strings.EqualFold(strings.TrimSuffix(statement, "."), "none") {
+			continue
+		}
+
+		finding := Finding{Statement: statement}
+		seen := make(map[int]bool)
+		for _, m := range citationMarkerPattern.FindAllStringSubmatch(statement, -1) {
+			number, err := strconv.Atoi(m[1])
+			if citation, ok := byNumber[number]; err == nil && ok && !seen[number] {
+				seen[number] = true
+				finding.Citations = append(finding.Citations, citation)
+			}
+		}
+		findings = append(findings, finding)
+	}
+	return findings
+}
@@ -0,0 +1,181 @@
+package internal
+
+import (
+	"net/url"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// trackingParams are query parameters that identify a campaign or click
+// rather than the page, removed when normalizing URLs. Parameters starting
+// with utm_ are removed as well.
+var trackingParams = map[string]bool{
+	"gclid":   true,
+	"dclid":   true,
+	"fbclid":  true,
+	"msclkid": true,
+	"mc_cid":  true,
+	"mc_eid":  true,
+	"_hsenc":  true,
+	"_hsmi":   true,
+}
+
+// canonicalURL strips tracking parameters and the fragment from raw and
+// lowercases its scheme and host, so links to the same page compare equal.
+// URLs that do not parse are returned unchanged.
+func canonicalURL(raw string) string {
+	u, err := url.Parse(strings.TrimSpace(raw))
+	if err != nil || u.Host == "" {
+		return raw
+	}
+	u.Scheme = strings.ToLower(u.Scheme)
+	u.Host = strings.ToLower(u.Host)
+	u.Fragment, u.RawFragment = "", ""
+	if u.Path == "/" {
+		u.Path, u.RawPath = "", ""
+	}
+
+	if u.RawQuery != "" {
+		query := u.Query()
+		tracked := false
+		for key := range query {
+			if trackingParams[strings.ToLower(key)] || strings.HasPrefix(strings.ToLower(key), "utm_") {
+				query.Del(key)
+				tracked = true
+			}
+		}
+		// Re-encoding sorts the parameters, so leave queries without tracking alone
+		if tracked {
+			u.RawQuery = query.Encode()
+		}
+	}
+	return u.String()
+}
+
+// normalizeCitations cleans up the citations and sources of result before it
+// is stored or formatted. URLs are canonicalized, keeping the URL as returned
+// in OriginalURL when it changed. Citations to the same page are merged and
+// renumbered from 1 in order of first appearance, and the [n] markers of the
+// answer are rewritten to match; CitationMap records every number that moved.
+// Duplicate sources are dropped, and citations without a title take the title
+// of a source for the same page. Citations without a number are taken to be
+// numbered by their position.
+func normalizeCitations(result *SearchResult) {
+	titles := make(map[string]string)
+	if len(result.Sources) > 0 {
+		sources := make([]Source, 0, len(result.Sources))
+		seen := make(map[string]bool, len(result.Sources))
+		for _, source := range result.Sources {
+			canonical := canonicalURL(source.URL)
+			if seen[canonical] {
+				continue
+			}
+			seen[canonical] = true
+			source.URL = canonical
+			sources = append(sources, source)
+			if source.Title != "" {
+				titles[canonical] = source.Title
+			}
+		}
+		result.Sources = sources
+	}
+
+	if len(result.Citations) == 0 {
+		return
+	}
+
+	citations := make([]Citation, 0, len(result.Citations))
+	numbers := make(map[string]int, len(result.Citations))
+	renumbered := make(map[int]int)
+	claimed := make(map[int]bool, len(result.Citations))
+	for i, citation := range result.Citations {
+		canonical := canonicalURL(citation.URL)
+		number, seen := numbers[canonical]
+		if !seen {
+			number = len(citations) + 1
+			numbers[canonical] = number
+		}
+		// Unnumbered citations are numbered by position, as in the list form;
+		// a number the API repeated keeps its first mapping
+		original := citation.Number
+		if original == 0 {
+			original = i + 1
+		}
+		if !claimed[original] {
+			claimed[original] = true
+			if original != number {
+				renumbered[original] = number
+			}
+		}
+		if seen {
+			if citations[number-1].Title == "" {
+				citations[number-1].Title = citation.Title
+			}
+			continue
+		}
+
+		if canonical != citation.URL {
+			citation.OriginalURL = citation.URL
+			citation.URL = canonical
+		}
+		if citation.Title == "" {
+			citation.Title = titles[canonical]
+		}
+		citation.Number = number
+		citations = append(citations, citation)
+	}
+	result.Citations = citations
+
+	if len(renumbered) == 0 {
+		return
+	}
+	result.CitationMap = renumbered
+	result.Content = citationMarkerPattern.ReplaceAllStringFunc(result.Content, func(marker string) string {
+		old, err := strconv.Atoi(marker[1 : len(marker)-1])
+		if number, ok := renumbered[old]; err == nil && ok {
+			return "[" + strconv.Itoa(number) + "]"
+		}
+		return marker
+	})
+}
+
+// doiPattern matches a DOI in a URL path, such as doi.org/10.1038/nature12373
+// or a publisher's /doi/10.1145/3290605.3300233 page
+var doiPattern = regexp.MustCompile(`\b10\.\d{4,9}/[^\s?#]+`)
+
+// arXivPattern matches the paper ID in an arxiv.org /abs/ or /pdf/ path, in
+// the current 2301.00001 form or the older hep-th/9901001 form, with an
+// optional version
+var arXivPattern = regexp.MustCompile(`^/(?:abs|pdf)/((?:\d{4}\.\d{4,5}|[a-z-]+(?:\.[A-Z]{2})?/\d{7})(?:v\d+)?)`)
+
+// doiPageSuffixes are path endings publishers add after a DOI for a view of
+// the paper, which are not part of the DOI
+var doiPageSuffixes = []string{".pdf", "/full", "/abstract", "/epdf", "/pdf"}
+
+// identifyPapers returns citations with DOI and ArXivID set from their URLs
+// where the URL contains one
+func identifyPapers(citations []Citation) []Citation {
+	identified := make([]Citation, len(citations))
+	copy(identified, citations)
+	for i := range identified {
+		u, err := url.Parse(identified[i].URL)
+		if err != nil {
+			continue
+		}
+		host := strings.TrimPrefix(u.Hostname(), "www.")
+		if host == "arxiv.org" || host == "export.arxiv.org" {
+			if m := arXivPattern.FindStringSubmatch(u.Path); m != nil {
+				identified[i].ArXivID = m[1]
+			}
+			continue
+		}
+		if doi := doiPattern.FindString(u.Path); doi != "" {
+			for _, suffix := range doiPageSuffixes {
+				doi = strings.TrimSuffix(doi, suffix)
+			}
+			identified[i].DOI = doi
+		}
+	}
+	return identified
+}
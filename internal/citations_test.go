@@ -0,0 +1,112 @@
+package internal
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestNormalizeCitations(t *testing.T) {
+	tests := []struct {
+		name      string
+		content   string
+		citations []Citation
+		want      []Citation
+		wantMap   map[int]int
+		wantText  string
+	}{
+		{
+			name:    "in order",
+			content: "A [1] B [2]",
+			citations: []Citation{
+				{Number: 1, URL: "https://a.example.com/"},
+				{Number: 2, URL: "https://b.example.com"},
+			},
+			want: []Citation{
+				{Number: 1, URL: "https://a.example.com", OriginalURL: "https://a.example.com/"},
+				{Number: 2, URL: "https://b.example.com"},
+			},
+			wantText: "A [1] B [2]",
+		},
+		{
+			name:    "duplicates",
+			content: "A [1] B [2] C [3]",
+			citations: []Citation{
+				{Number: 1, URL: "https://a.example.com/page"},
+				{Number: 2, URL: "https://a.example.com/page?utm_source=x", Title: "A"},
+				{Number: 3, URL: "https://b.example.com"},
+			},
+			want: []Citation{
+				{Number: 1, URL: "https://a.example.com/page", Title: "A"},
+				{Number: 2, URL: "https://b.example.com"},
+			},
+			wantMap:  map[int]int{2: 1, 3: 2},
+			wantText: "A [1] B [1] C [2]",
+		},
+		{
+			name:    "gaps",
+			content: "A [2] B [5]",
+			citations: []Citation{
+				{Number: 2, URL: "https://a.example.com"},
+				{Number: 5, URL: "https://b.example.com"},
+			},
+			want: []Citation{
+				{Number: 1, URL: "https://a.example.com"},
+				{Number: 2, URL: "https://b.example.com"},
+			},
+			wantMap:  map[int]int{2: 1, 5: 2},
+			wantText: "A [1] B [2]",
+		},
+		{
+			name:    "unnumbered",
+			content: "A [1] B [2] C [3]",
+			citations: []Citation{
+				{URL: "https://a.example.com"},
+				{URL: "https://a.example.com"},
+				{URL: "https://b.example.com"},
+			},
+			want: []Citation{
+				{Number: 1, URL: "https://a.example.com"},
+				{Number: 2, URL: "https://b.example.com"},
+			},
+			wantMap:  map[int]int{2: 1, 3: 2},
+			wantText: "A [1] B [1] C [2]",
+		},
+		{
+			name:    "repeated number",
+			content: "A [1] B [2]",
+			citations: []Citation{
+				{Number: 1, URL: "https://a.example.com"},
+				{Number: 1, URL: "https://b.example.com"},
+				{Number: 2, URL: "https://c.example.com"},
+			},
+			want: []Citation{
+				{Number: 1, URL: "https://a.example.com"},
+				{Number: 2, URL: "https://b.example.com"},
+				{Number: 3, URL: "https://c.example.com"},
+			},
+			wantMap:  map[int]int{2: 3},
+			wantText: "A [1] B [3]",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			result := &SearchResult{Content: tt.content, Citations: tt.citations}
+			normalizeCitations(result)
+			require.Equal(t, tt.want, result.Citations)
+			require.Equal(t, tt.wantMap, result.CitationMap)
+			require.Equal(t, tt.wantText, result.Content)
+		})
+	}
+}
+
+func TestNormalizeCitationsTakesSourceTitles(t *testing.T) {
+	result := &SearchResult{
+		Citations: []Citation{{Number: 1, URL: "https://a.example.com/#intro"}},
+		Sources:   []Source{{URL: "https://A.example.com", Title: "A"}, {URL: "https://a.example.com/"}},
+	}
+	normalizeCitations(result)
+	require.Equal(t, []Source{{URL: "https://a.example.com", Title: "A"}}, result.Sources)
+	require.Equal(t, "A", result.Citations[0].Title)
+}
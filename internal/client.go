@@ -5,14 +5,18 @@ import (
 	"context"
 	"crypto/tls"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
-	"log"
+	"log/slog"
+	"math"
 	"net/http"
-	"os"
 	"strconv"
 	"strings"
+	"sync"
 	"time"
+
+	"github.com/mark3labs/mcp-go/mcp"
 )
 
 const (
@@ -20,17 +24,50 @@ const (
 	ChatCompletionsEndpoint = "/chat/completions"
 	DefaultTimeout          = 30 * time.Second
 	DefaultModel            = "sonar"
-	MaxResponseSize         = 10 * 1024 * 1024
+	// DefaultMaxResponseBytes is the largest API response read unless
+	// MAX_RESPONSE_BYTES sets another limit
+	DefaultMaxResponseBytes = 10 * 1024 * 1024
 )
 
 type PerplexityClient struct {
 	httpClient *http.Client
-	apiKey     string
 	baseURL    string
-	logger     *log.Logger
+	logger     *slog.Logger
+
+	apiKeyMu sync.RWMutex
+	apiKey   string
+
+	rateLimitMu sync.RWMutex
+	rateLimit   *RateLimitStatus
+
+	// limiter queues requests over the upstream concurrency limit (nil disables)
+	limiter *APILimiter
+	// maxResponseBytes is the largest response body accepted
+	maxResponseBytes int64
+	// retry selects which rate-limited requests are retried
+	retry RetryPolicy
 }
 
-func NewPerplexityClient(apiKey string) (*PerplexityClient, error) {
+// ClientOption customizes a PerplexityClient at construction
+type ClientOption func(*PerplexityClient)
+
+// WithMaxResponseBytes replaces DefaultMaxResponseBytes as the largest response accepted
+func WithMaxResponseBytes(size int64) ClientOption {
+	return func(c *PerplexityClient) {
+		c.maxResponseBytes = size
+	}
+}
+
+// WithConnectionPool applies pool to the client's transport
+func WithConnectionPool(pool ConnectionPool) ClientOption {
+	return func(c *PerplexityClient) {
+		if transport, ok := c.httpClient.Transport.(*http.Transport); ok {
+			pool.Apply(transport)
+		}
+	}
+}
+
+func NewPerplexityClient(apiKey string, opts ...ClientOption) (*PerplexityClient, error) {
 	if apiKey == "" {
 		return nil, fmt.Errorf("API key is required")
 	}
@@ -42,17 +79,39 @@ func NewPerplexityClient(apiKey string) (*PerplexityClient, error) {
 
 	transport := &http.Transport{
 		TLSClientConfig: tlsConfig,
+		Proxy:           http.ProxyFromEnvironment,
 	}
 
-	return &PerplexityClient{
+	client := &PerplexityClient{
+		// Calls are bounded by their context deadline so the configured request timeout applies
 		httpClient: &http.Client{
 			Transport: transport,
-			Timeout:   DefaultTimeout,
 		},
-		apiKey:  apiKey,
-		baseURL: BaseURL,
-		logger:  log.New(os.Stderr, "[PERPLEXITY] ", log.LstdFlags|log.Lshortfile),
-	}, nil
+		apiKey:           apiKey,
+		baseURL:          BaseURL,
+		logger:           slog.Default().With("component", "perplexity"),
+		maxResponseBytes: DefaultMaxResponseBytes,
+		retry:            RetryPolicy{Retries: DefaultAPIRateLimitRetries, MaxWait: DefaultAPIMaxRetryWait},
+	}
+	for _, opt := range opts {
+		opt(client)
+	}
+	return client, nil
+}
+
+// SetAPIKey replaces the key used for subsequent requests, e.g. after secret rotation
+func (c *PerplexityClient) SetAPIKey(apiKey string) {
+	c.apiKeyMu.Lock()
+	defer c.apiKeyMu.Unlock()
+
+	c.apiKey = apiKey
+}
+
+func (c *PerplexityClient) currentAPIKey() string {
+	c.apiKeyMu.RLock()
+	defer c.apiKeyMu.RUnlock()
+
+	return c.apiKey
 }
 
 func (c *PerplexityClient) Search(ctx context.Context, req SearchRequest) (*SearchResult, error) {
@@ -75,37 +134,66 @@ func (c *PerplexityClient) Search(ctx context.Context, req SearchRequest) (*Sear
 }
 
 func (c *PerplexityClient) searchToAPIRequest(req SearchRequest) APIChatRequest {
+	var messages []APIMessage
+	if strings.TrimSpace(req.SystemPrompt) != "" {
+		messages = append(messages, APIMessage{
+			Role:    "system",
+			Content: req.SystemPrompt,
+		})
+	}
+	for _, msg := range req.ContextMessages {
+		messages = append(messages, APIMessage{
+			Role:    msg.Role,
+			Content: msg.Content,
+		})
+	}
+	messages = append(messages, APIMessage{
+		Role:    "user",
+		Content: req.Query,
+	})
+
 	apiReq := APIChatRequest{
-		Model: req.Model,
-		Messages: []APIMessage{
-			{
-				Role:    "user",
-				Content: req.Query,
-			},
-		},
-		Stream:     false,
-		SearchMode: req.SearchMode,
+		Model:            req.Model,
+		Messages:         messages,
+		Stream:           false,
+		SearchMode:       req.SearchMode,
+		Temperature:      req.Temperature,
+		TopP:             req.TopP,
+		TopK:             req.TopK,
+		FrequencyPenalty: req.FrequencyPenalty,
+		PresencePenalty:  req.PresencePenalty,
 	}
 
 	if req.MaxTokens > 0 {
 		apiReq.MaxTokens = &req.MaxTokens
 	}
 
-	if len(req.Sources) > 0 {
-		apiReq.SearchDomainFilter = req.Sources
+	if req.Model == DeepResearchModel {
+		apiReq.ReasoningEffort = req.ReasoningEffort
+	}
+
+	// Validate has checked the domains already
+	if filter, err := req.domainFilter(); err == nil && len(filter) > 0 {
+		apiReq.SearchDomainFilter = filter
 	}
 
-	// Process options
+	if req.DateRange != "" {
+		apiReq.SearchRecencyFilter = req.DateRange
+	}
+
+	if req.ReturnImages {
+		apiReq.ReturnImages = true
+		// Validate has checked the filters already
+		apiReq.ImageDomainFilter, apiReq.ImageFormatFilter, _ = req.imageFilters()
+	}
+
+	if req.UserLocation != nil {
+		apiReq.WebSearchOptions = &APIWebSearchOptions{UserLocation: req.UserLocation}
+	}
+
+	// Process options; temperature and top_p have moved to their own fields
 	for key, value := range req.Options {
 		switch strings.ToLower(key) {
-		case "temperature":
-			if temp, err := strconv.ParseFloat(value, 64); err == nil && temp >= 0 && temp <= 2.0 {
-				apiReq.Temperature = &temp
-			}
-		case "top_p":
-			if topP, err := strconv.ParseFloat(value, 64); err == nil && topP >= 0 && topP <= 1.0 {
-				apiReq.TopP = &topP
-			}
 		case "disable_search":
 			if disable, err := strconv.ParseBool(value); err == nil {
 				apiReq.DisableSearch = &disable
@@ -118,9 +206,8 @@ func (c *PerplexityClient) searchToAPIRequest(req SearchRequest) APIChatRequest
 
 func (c *PerplexityClient) apiToSearchResult(apiResp APIChatResponse) SearchResult {
 	result := SearchResult{
-		ID:      apiResp.ID,
-		Content: apiResp.GetContent(),
-		Model:   apiResp.Model,
+		ID:    apiResp.ID,
+		Model: apiResp.Model,
 		Usage: Usage{
 			PromptTokens:     apiResp.Usage.PromptTokens,
 			CompletionTokens: apiResp.Usage.CompletionTokens,
@@ -128,17 +215,25 @@ func (c *PerplexityClient) apiToSearchResult(apiResp APIChatResponse) SearchResu
 		},
 		Created: apiResp.GetCreatedTime(),
 	}
+	result.Content, result.Reasoning = splitReasoning(apiResp.GetContent())
 
 	if len(apiResp.Citations) > 0 && string(apiResp.Citations) != "null" {
 		var citations []Citation
 		if err := json.Unmarshal(apiResp.Citations, &citations); err != nil {
+			var citationURLs []string
 			var citationStr string
-			if errStr := json.Unmarshal(apiResp.Citations, &citationStr); errStr == nil {
+			if errURLs := json.Unmarshal(apiResp.Citations, &citationURLs); errURLs == nil {
+				// The API returns citations as a plain list of URLs numbered from 1
+				citations = make([]Citation, len(citationURLs))
+				for i, url := range citationURLs {
+					citations[i] = Citation{Number: i + 1, URL: url}
+				}
+			} else if errStr := json.Unmarshal(apiResp.Citations, &citationStr); errStr == nil {
 				if errStrParse := json.Unmarshal([]byte(citationStr), &citations); errStrParse != nil {
-					c.logger.Printf("Warning: failed to parse citations string: %v", errStrParse)
+					c.logger.Warn("Failed to parse citations string", "error", errStrParse)
 				}
 			} else {
-				c.logger.Printf("Warning: failed to unmarshal citations: %v", err)
+				c.logger.Warn("Failed to unmarshal citations", "error", err)
 			}
 		}
 		result.Citations = citations
@@ -149,74 +244,278 @@ func (c *PerplexityClient) apiToSearchResult(apiResp APIChatResponse) SearchResu
 		copy(result.Sources, apiResp.Sources)
 	}
 
+	result.Sources = append(result.Sources, apiResp.SearchResults...)
+	result.Images = apiResp.Images
+	normalizeCitations(&result)
+
 	return result
 }
 
+// makeRequest sends apiReq and decodes the response. Both bodies are held in
+// pooled buffers, so steady traffic reuses the same memory.
 func (c *PerplexityClient) makeRequest(ctx context.Context, apiReq APIChatRequest) (*APIChatResponse, error) {
+	buf := getBuffer()
+	if err := json.NewEncoder(buf).Encode(apiReq); err != nil {
+		putBuffer(buf)
+		return nil, fmt.Errorf("failed to marshal request: %w", err)
+	}
+	body := newPooledRequestBody(buf)
+	defer body.release()
+
+	var apiResp APIChatResponse
+	err := c.postCompletion(ctx, apiReq.Model, body, func(respBody []byte) error {
+		if err := json.Unmarshal(respBody, &apiResp); err != nil {
+			return fmt.Errorf("failed to parse response: %w", err)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return &apiResp, nil
+}
+
+// RawCompletion sends body to the chat completions endpoint as is and returns
+// the response body unparsed. The caller validates body; model is for logging.
+func (c *PerplexityClient) RawCompletion(ctx context.Context, model string, body []byte) ([]byte, error) {
+	var respBody []byte
+	err := c.postCompletion(ctx, model, &requestBody{data: body}, func(data []byte) error {
+		respBody = bytes.Clone(data)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return respBody, nil
+}
+
+// postCompletion posts body to the chat completions endpoint with the API key
+// and passes the body of a successful response to decode. The response is
+// held in a pooled buffer that decode must not retain.
+func (c *PerplexityClient) postCompletion(ctx context.Context, model string, body *requestBody, decode func([]byte) error) error {
+	limit := "request deadline"
 	if _, hasDeadline := ctx.Deadline(); !hasDeadline {
 		var cancel context.CancelFunc
 		ctx, cancel = context.WithTimeout(ctx, DefaultTimeout)
 		defer cancel()
+		limit = "default request timeout"
 	}
+	deadline, _ := ctx.Deadline()
+	budget := time.Until(deadline).Round(time.Second)
+	timeout := &TimeoutError{Kind: TimeoutKindTool, Limit: limit, Value: budget}
+
+	for attempt := 0; ; attempt++ {
+		err := c.sendCompletion(ctx, model, body, decode, timeout)
+		wait, ok := c.retryWait(err, attempt, deadline)
+		if !ok {
+			return err
+		}
 
-	reqBody, err := json.Marshal(apiReq)
-	if err != nil {
-		return nil, fmt.Errorf("failed to marshal request: %w", err)
+		c.logger.WarnContext(ctx, "API rate limited, retrying", "model", model, "wait", wait, "attempt", attempt+1)
+		sendLogNotification(ctx, mcp.LoggingLevelWarning, fmt.Sprintf("%s rate limited, retrying in %s", model, wait.Round(time.Second)))
+		select {
+		case <-ctx.Done():
+			if ctx.Err() == context.DeadlineExceeded {
+				return timeout
+			}
+			return ctx.Err()
+		case <-time.After(wait):
+		}
+	}
+}
+
+// retryWait returns how long to wait before retrying a request that failed
+// with err, and false when it is not retried: it did not fail with HTTP 429
+// and a wait, the retries are used up, or the wait is too long for the policy
+// or the request's deadline
+func (c *PerplexityClient) retryWait(err error, attempt int, deadline time.Time) (time.Duration, bool) {
+	var statusErr *StatusError
+	if !errors.As(err, &statusErr) || statusErr.StatusCode != http.StatusTooManyRequests {
+		return 0, false
+	}
+	wait := statusErr.RetryAfter
+	if wait <= 0 || attempt >= c.retry.Retries || wait > c.retry.MaxWait {
+		return 0, false
+	}
+	return wait, time.Until(deadline) > wait
+}
+
+// sendCompletion makes one attempt of postCompletion, returning timeout when
+// the request's deadline passes
+func (c *PerplexityClient) sendCompletion(ctx context.Context, model string, body *requestBody, decode func([]byte) error, timeout *TimeoutError) error {
+	// Waiting for a free slot counts against the request's deadline
+	if c.limiter != nil {
+		release, err := c.limiter.Acquire(ctx)
+		if err != nil {
+			if ctx.Err() == context.DeadlineExceeded {
+				return timeout
+			}
+			return err
+		}
+		defer release()
 	}
 
 	url := c.baseURL + ChatCompletionsEndpoint
-	httpReq, err := http.NewRequestWithContext(ctx, http.MethodPost, url, bytes.NewBuffer(reqBody))
+	httpReq, err := http.NewRequestWithContext(ctx, http.MethodPost, url, nil)
 	if err != nil {
-		return nil, fmt.Errorf("failed to create request: %w", err)
+		return fmt.Errorf("failed to create request: %w", err)
 	}
+	httpReq.Body, _ = body.reader()
+	httpReq.GetBody = body.reader
+	httpReq.ContentLength = int64(len(body.data))
 
 	httpReq.Header.Set("Content-Type", "application/json")
-	httpReq.Header.Set("Authorization", "Bearer "+c.apiKey)
+	httpReq.Header.Set("Authorization", "Bearer "+c.currentAPIKey())
 
-	c.logger.Printf("Making API request to %s with model %s", url, apiReq.Model)
+	c.logger.DebugContext(ctx, "Making API request", "url", url, "model", model)
 
 	resp, err := c.httpClient.Do(httpReq)
 	if err != nil {
 		if ctx.Err() == context.DeadlineExceeded {
-			return nil, fmt.Errorf("request timed out")
+			return timeout
 		}
-		return nil, fmt.Errorf("request failed: %w", err)
+		return fmt.Errorf("request failed: %w", err)
 	}
 	defer func() {
 		if err := resp.Body.Close(); err != nil {
-			c.logger.Printf("Warning: failed to close response body: %v", err)
+			c.logger.WarnContext(ctx, "Failed to close response body", "error", err)
 		}
 	}()
 
-	limitedReader := io.LimitReader(resp.Body, MaxResponseSize)
-	respBody, err := io.ReadAll(limitedReader)
-	if err != nil {
-		return nil, fmt.Errorf("failed to read response: %w", err)
+	c.updateRateLimit(resp.Header)
+
+	buf := getBuffer()
+	defer putBuffer(buf)
+
+	// Read one byte past the limit to tell a response at the limit from a larger one
+	if _, err := buf.ReadFrom(io.LimitReader(resp.Body, c.maxResponseBytes+1)); err != nil {
+		if ctx.Err() == context.DeadlineExceeded {
+			return timeout
+		}
+		return fmt.Errorf("failed to read response: %w", err)
 	}
+	tooLarge := int64(buf.Len()) > c.maxResponseBytes
 
 	if resp.StatusCode != http.StatusOK {
-		return nil, c.handleErrorResponse(resp.StatusCode, respBody)
+		// An oversized error body is only read for its message
+		if tooLarge {
+			buf.Truncate(int(c.maxResponseBytes))
+		}
+		return c.handleErrorResponse(ctx, resp.StatusCode, resp.Header, buf.Bytes())
+	}
+	if tooLarge {
+		c.logger.WarnContext(ctx, "API response too large", "model", model, "limit", c.maxResponseBytes)
+		return fmt.Errorf("response exceeds %d bytes (MAX_RESPONSE_BYTES)", c.maxResponseBytes)
 	}
+	return decode(buf.Bytes())
+}
 
-	var apiResp APIChatResponse
-	if err := json.Unmarshal(respBody, &apiResp); err != nil {
-		return nil, fmt.Errorf("failed to parse response: %w", err)
+// RateLimitStatus returns the last rate-limit headroom reported by the API, or nil if none was seen
+func (c *PerplexityClient) RateLimitStatus() *RateLimitStatus {
+	c.rateLimitMu.RLock()
+	defer c.rateLimitMu.RUnlock()
+
+	if c.rateLimit == nil {
+		return nil
 	}
+	status := *c.rateLimit
+	return &status
+}
 
-	return &apiResp, nil
+// updateRateLimit caches rate-limit headers from an API response
+func (c *PerplexityClient) updateRateLimit(header http.Header) {
+	limit, errLimit := strconv.Atoi(firstHeader(header, "X-RateLimit-Limit-Requests", "X-RateLimit-Limit"))
+	remaining, errRemaining := strconv.Atoi(firstHeader(header, "X-RateLimit-Remaining-Requests", "X-RateLimit-Remaining"))
+	if errLimit != nil || errRemaining != nil || limit <= 0 {
+		return
+	}
+
+	c.rateLimitMu.Lock()
+	defer c.rateLimitMu.Unlock()
+
+	c.rateLimit = &RateLimitStatus{
+		Limit:            limit,
+		Remaining:        remaining,
+		RemainingPercent: float64(remaining) / float64(limit) * 100,
+		UpdatedAt:        time.Now(),
+	}
 }
 
-func (c *PerplexityClient) handleErrorResponse(statusCode int, body []byte) error {
-	var apiError APIErrorResponse
-	if err := json.Unmarshal(body, &apiError); err == nil {
-		return c.mapAPIError(statusCode, apiError.Error.Error.Message)
+// firstHeader returns the value of the first header in keys that is present
+func firstHeader(header http.Header, keys ...string) string {
+	for _, key := range keys {
+		if value := header.Get(key); value != "" {
+			return value
+		}
 	}
+	return ""
+}
+
+// StatusError is an error response from the API, keeping its HTTP status
+type StatusError struct {
+	StatusCode int
+	// Type and Code are the error type and code of the response body, if any
+	Type string
+	Code string
+	// RetryAfter is the wait the API asked for in a Retry-After header, or for
+	// HTTP 429, the time until its rate limit resets
+	RetryAfter time.Duration
+	Err        error
+}
 
-	return c.mapStatusCodeError(statusCode, string(body))
+func (e *StatusError) Error() string {
+	return e.Err.Error()
+}
+
+func (e *StatusError) Unwrap() error {
+	return e.Err
+}
+
+func (c *PerplexityClient) handleErrorResponse(ctx context.Context, statusCode int, header http.Header, body []byte) error {
+	if isUpstreamTimeoutStatus(statusCode) {
+		c.logger.WarnContext(ctx, "API timeout", "status", statusCode)
+		return &TimeoutError{Kind: TimeoutKindUpstream, StatusCode: statusCode}
+	}
+
+	statusErr := &StatusError{StatusCode: statusCode, RetryAfter: parseRetryAfter(header.Get("Retry-After"), time.Now())}
+	if statusCode == http.StatusTooManyRequests {
+		statusErr.RetryAfter = rateLimitWait(header, time.Now())
+	}
+	if apiError, ok := parseAPIError(body); ok {
+		statusErr.Type, statusErr.Code = apiError.Type, apiError.Code
+		statusErr.Err = c.mapAPIError(ctx, statusCode, apiError.Message)
+	} else {
+		statusErr.Err = c.mapStatusCodeError(ctx, statusCode, string(body))
+	}
+	if statusErr.RetryAfter > 0 {
+		statusErr.Err = fmt.Errorf("%w (retry after %ds)", statusErr.Err, int(math.Ceil(statusErr.RetryAfter.Seconds())))
+	}
+	return statusErr
+}
+
+// parseAPIError reads the error object of an error response body, which the
+// API sends as {"error": {...}} or nested once more as {"error": {"error": {...}}}.
+// It reports false when the body has no error object with a message.
+func parseAPIError(body []byte) (APIError, bool) {
+	var nested APIErrorResponse
+	if err := json.Unmarshal(body, &nested); err != nil {
+		return APIError{}, false
+	}
+	if nested.Error.Error.Message != "" {
+		return nested.Error.Error, true
+	}
+	var flat struct {
+		Error APIError `json:"error"`
+	}
+	if err := json.Unmarshal(body, &flat); err != nil || flat.Error.Message == "" {
+		return APIError{}, false
+	}
+	return flat.Error, true
 }
 
-func (c *PerplexityClient) mapAPIError(statusCode int, message string) error {
-	c.logger.Printf("API error: status=%d, message=%s", statusCode, message)
+func (c *PerplexityClient) mapAPIError(ctx context.Context, statusCode int, message string) error {
+	c.logger.WarnContext(ctx, "API error", "status", statusCode, "message", message)
 
 	switch statusCode {
 	case http.StatusBadRequest:
@@ -232,8 +531,8 @@ func (c *PerplexityClient) mapAPIError(statusCode int, message string) error {
 	}
 }
 
-func (c *PerplexityClient) mapStatusCodeError(statusCode int, body string) error {
-	c.logger.Printf("HTTP error: status=%d, body_length=%d", statusCode, len(body))
+func (c *PerplexityClient) mapStatusCodeError(ctx context.Context, statusCode int, body string) error {
+	c.logger.WarnContext(ctx, "HTTP error", "status", statusCode, "body_length", len(body))
 
 	switch statusCode {
 	case http.StatusBadRequest:
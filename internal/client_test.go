@@ -0,0 +1,159 @@
+package internal
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+// benchmarkResponse builds a chat completions response of roughly size bytes,
+// shaped like a long answer with many citations
+func benchmarkResponse(b testing.TB, size int) []byte {
+	var citations, searchResults []map[string]any
+	for i := range 50 {
+		url := fmt.Sprintf("https://example.com/articles/%d", i)
+		citations = append(citations, map[string]any{"url": url})
+		searchResults = append(searchResults, map[string]any{"url": url, "title": fmt.Sprintf("Article %d", i), "snippet": strings.Repeat("snippet ", 40)})
+	}
+	body, err := json.Marshal(map[string]any{
+		"id":      "bench",
+		"model":   "sonar",
+		"created": 1700000000,
+		"usage":   map[string]any{"prompt_tokens": 10, "completion_tokens": 1000, "total_tokens": 1010},
+		"choices": []map[string]any{{
+			"index":   0,
+			"message": map[string]any{"role": "assistant", "content": strings.Repeat("The answer continues [1]. ", size/26)},
+		}},
+		"citations":      citations,
+		"search_results": searchResults,
+	})
+	require.NoError(b, err)
+	return body
+}
+
+func benchmarkClient(b testing.TB, response []byte) *PerplexityClient {
+	return testClient(b, http.StatusOK, response)
+}
+
+// testClient returns a client whose API answers every request with status
+// and body
+func testClient(b testing.TB, status int, body []byte) *PerplexityClient {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(status)
+		_, _ = w.Write(body)
+	}))
+	b.Cleanup(srv.Close)
+
+	client, err := NewPerplexityClient("bench-key")
+	require.NoError(b, err)
+	client.baseURL = srv.URL
+	return client
+}
+
+// BenchmarkSearch measures the allocations of a search round trip, dominated
+// by reading and decoding the response
+func BenchmarkSearch(b *testing.B) {
+	for _, size := range []int{16 << 10, 1 << 20} {
+		b.Run(fmt.Sprintf("response=%dKiB", size>>10), func(b *testing.B) {
+			client := benchmarkClient(b, benchmarkResponse(b, size))
+			req := SearchRequest{Query: "What is new in Go?", Model: "sonar"}
+			b.ReportAllocs()
+			b.ResetTimer()
+			for b.Loop() {
+				_, err := client.Search(context.Background(), req)
+				require.NoError(b, err)
+			}
+		})
+	}
+}
+
+// BenchmarkRawCompletion measures forwarding a request body and returning the
+// response unparsed
+func BenchmarkRawCompletion(b *testing.B) {
+	client := benchmarkClient(b, benchmarkResponse(b, 16<<10))
+	body := []byte(`{"model":"sonar","messages":[{"role":"user","content":"What is new in Go?"}]}`)
+	b.ReportAllocs()
+	b.ResetTimer()
+	for b.Loop() {
+		_, err := client.RawCompletion(context.Background(), "sonar", body)
+		require.NoError(b, err)
+	}
+}
+
+func TestParseAPIError(t *testing.T) {
+	tests := []struct {
+		name string
+		body string
+		want APIError
+		ok   bool
+	}{
+		{"flat", `{"error": {"message": "invalid model", "type": "invalid_request_error"}}`, APIError{Message: "invalid model", Type: "invalid_request_error"}, true},
+		{"nested", `{"error": {"error": {"message": "quota exceeded", "code": "quota"}}}`, APIError{Message: "quota exceeded", Code: "quota"}, true},
+		{"no error object", `{"detail": "Not Found"}`, APIError{}, false},
+		{"empty message", `{"error": {"type": "server_error"}}`, APIError{}, false},
+		{"not an object", `{"error": "boom"}`, APIError{}, false},
+		{"not JSON", `<html>Bad Gateway</html>`, APIError{}, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, ok := parseAPIError([]byte(tt.body))
+			require.Equal(t, tt.ok, ok)
+			require.Equal(t, tt.want, got)
+		})
+	}
+}
+
+func TestSearchErrorWithoutErrorObjectUsesStatus(t *testing.T) {
+	client := testClient(t, http.StatusBadRequest, []byte(`{"detail": "Not Found"}`))
+	_, err := client.Search(context.Background(), SearchRequest{Query: "q", Model: "sonar"})
+	require.EqualError(t, err, "bad request")
+}
+
+// TestSearchDecodesPooledResponses checks that responses read into pooled
+// buffers decode like the raw body, for responses small enough to pool and
+// for ones over maxPooledBufferBytes, and that results stay intact once
+// their buffer is reused
+func TestSearchDecodesPooledResponses(t *testing.T) {
+	responses := [][]byte{
+		benchmarkResponse(t, 16<<10),
+		benchmarkResponse(t, maxPooledBufferBytes+(1<<20)),
+		[]byte(`{"id":"small","model":"sonar","choices":[{"message":{"content":"Short [1]"}}],"citations":["https://example.com/short"]}`),
+	}
+	var calls atomic.Int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		_, _ = w.Write(responses[int(calls.Add(1)-1)%len(responses)])
+	}))
+	t.Cleanup(srv.Close)
+	client, err := NewPerplexityClient("test-key")
+	require.NoError(t, err)
+	client.baseURL = srv.URL
+
+	var want, got []*SearchResult
+	for _, response := range responses {
+		var apiResp APIChatResponse
+		require.NoError(t, json.Unmarshal(response, &apiResp))
+		expected := client.apiToSearchResult(apiResp)
+		want = append(want, &expected)
+
+		result, err := client.Search(context.Background(), SearchRequest{Query: "q", Model: "sonar"})
+		require.NoError(t, err)
+		require.Equal(t, &expected, result)
+		got = append(got, result)
+	}
+	require.Equal(t, want, got, "results are unchanged after their buffers are reused")
+
+	raw, err := client.RawCompletion(context.Background(), "sonar", []byte(`{"model":"sonar"}`))
+	require.NoError(t, err)
+	_, err = client.Search(context.Background(), SearchRequest{Query: "q", Model: "sonar"})
+	require.NoError(t, err)
+	require.Equal(t, responses[0], raw)
+}
@@ -1,41 +1,605 @@
 package internal
 
 import (
+	"errors"
 	"fmt"
+	"maps"
+	"net"
 	"os"
+	"regexp"
+	"slices"
 	"strconv"
+	"strings"
 	"time"
 )
 
+// Defaults for the server transport
+const (
+	DefaultHTTPHost = "127.0.0.1"
+	DefaultHTTPPort = 8080
+)
+
 type Config struct {
 	PerplexityAPIKey string
-	DefaultModel     string
-	RequestTimeout   time.Duration
-	LogLevel         string
+	// PerplexityAPIKeyFile is a mounted secret holding the API key; it is re-read when it changes
+	PerplexityAPIKeyFile string
+	// PerplexitySecretARN names an AWS Secrets Manager secret or SSM parameter holding the API key
+	PerplexitySecretARN string
+	// Vault locates the API key in HashiCorp Vault when Vault.SecretPath is set
+	Vault VaultConfig
+	// SecretRefreshInterval is how often a key file or secret is re-read for rotation
+	SecretRefreshInterval time.Duration
+	DefaultModel          string
+	RequestTimeout        time.Duration
+	// ShutdownTimeout bounds the drain of tool calls in flight on shutdown;
+	// 0 waits as long as the longest request timeout
+	ShutdownTimeout   time.Duration
+	LogLevel          string
+	SessionTTL        time.Duration
+	SessionMaxHistory int
+	JobTTL            time.Duration
+	MaxJobs           int
+	MaxBatchQueries   int
+	BatchConcurrency  int
+	StoragePath       string
+	ResultRetention   time.Duration
+	SlowCallWarning   time.Duration
+	Transport         string
+	Host              string
+	Port              int
+	// DisabledTools lists tools that are not registered with the MCP server
+	DisabledTools map[string]bool
+	// QualitySampleRate is the fraction of answers queued for quality review (0 disables)
+	QualitySampleRate float64
+	// AllowedModels restricts the models clients may request (empty allows all);
+	// DeniedModels are refused even when allowed
+	AllowedModels []string
+	DeniedModels  []string
+	// AllowUnknownModels forwards models missing from SonarModels, such as
+	// ones released after this build, when their name looks like a model name
+	AllowUnknownModels bool
+	// ModelFallbacks maps a model to the model retried when it is rate limited
+	// or failing; fallbacks chain until a model has none
+	ModelFallbacks map[string]string
+	// ToolFallbacks selects each tool's response when the API call fails
+	// (FallbackError when unset); UnavailableMessage is the FallbackUnavailable answer
+	ToolFallbacks      map[string]string
+	UnavailableMessage string
+	// ReasoningOutput selects how the <think> trace of reasoning models is returned
+	ReasoningOutput string
+	// ResponseRedactions rewrite the answers tools return
+	ResponseRedactions RedactionRules
+	// ToolTimeouts and ModelTimeouts replace RequestTimeout for calls of a tool
+	// or to a model; a tool's timeout takes precedence over its model's
+	ToolTimeouts  map[string]time.Duration
+	ModelTimeouts map[string]time.Duration
+	// ToolDefaults holds per-tool parameter defaults, keyed by tool name
+	ToolDefaults map[string]ToolDefaults
+	// ProxyURL routes API requests through a proxy; when empty HTTPS_PROXY applies
+	ProxyURL string
+	// ModelPrices is the price table used to estimate the cost of each request
+	ModelPrices map[string]ModelPrice
+	// Budgets limits daily and monthly token use and estimated cost
+	Budgets Budgets
+	// AuditLogPath is a JSONL file recording every tool call (empty disables)
+	AuditLogPath string
+	// LogOutput is where the server logs: stderr, file or syslog
+	LogOutput string
+	// LogFormat is json or text
+	LogFormat string
+	// LogFile is the rotated file written with LogOutput file
+	LogFile LogFile
+	// LogSyslog is the connection used with LogOutput syslog
+	LogSyslog LogSyslog
+	// AdminAddr is the listen address of the admin API (empty disables);
+	// AdminToken is the bearer token it requires, mandatory off loopback
+	AdminAddr  string
+	AdminToken string
+	// AuthTokens are the bearer tokens accepted by the HTTP transport (empty
+	// leaves it open)
+	AuthTokens []string
+	// RateLimitPerMinute and RateLimitConcurrent limit the tool calls of each
+	// HTTP client, identified by bearer token or IP (0 disables either)
+	RateLimitPerMinute  int
+	RateLimitConcurrent int
+	// MaxConcurrentAPICalls bounds the API requests in flight across all
+	// clients; further requests queue (0 disables)
+	MaxConcurrentAPICalls int
+	// APIQueueMaxDepth and APIQueueShedWait shed new calls while that many
+	// requests are queued or the oldest has waited that long (0 disables either)
+	APIQueueMaxDepth int
+	APIQueueShedWait time.Duration
+	// APIConnectionPool tunes connection reuse for API requests
+	APIConnectionPool ConnectionPool
+	// APIRetryPolicy selects which rate-limited API requests are retried
+	APIRetryPolicy RetryPolicy
+	// MaxResponseBytes is the largest API response accepted
+	MaxResponseBytes int64
+	// MaxQueryLength bounds the query and system prompt of search calls
+	MaxQueryLength int
+	// MaxDomainFilters bounds the domains of sources and exclude_sources together
+	MaxDomainFilters int
+	// TLSCertFile and TLSKeyFile make the HTTP transport serve HTTPS; renewed
+	// files are picked up every SecretRefreshInterval
+	TLSCertFile string
+	TLSKeyFile  string
+	// TLSClientCAFile enables mutual TLS: clients must present a certificate
+	// signed by one of its CAs
+	TLSClientCAFile string
+	// HTTPLimits bounds request sizes and timeouts on the HTTP transport
+	HTTPLimits HTTPLimits
+	// Provider selects the backend that answers searches
+	Provider ProviderConfig
+	// PluginDir holds executables that serve additional tools (empty disables)
+	PluginDir string
+	// Webhooks configures the callbacks of research jobs
+	Webhooks WebhookConfig
+	// QueryFilter redacts or rejects requests carrying personal data before they leave the server
+	QueryFilter QueryFilterConfig
+	// Sentry reports failed tool calls and panics to an error tracker
+	Sentry SentryConfig
+	// StatsD sends tool call metrics to a StatsD server or Datadog agent
+	StatsD StatsDConfig
+}
+
+// ToolDefaults are the parameters a tool uses when a call leaves them unset
+type ToolDefaults struct {
+	Model         string
+	MaxTokens     int
+	SearchMode    string
+	Temperature   *float64
+	CitationStyle string
 }
 
+// NewConfig loads configuration from the file named by CONFIG_PATH (if any) and the environment
 func NewConfig() (*Config, error) {
-	apiKey := os.Getenv("PERPLEXITY_API_KEY")
-	if apiKey == "" {
-		return nil, fmt.Errorf("PERPLEXITY_API_KEY environment variable is required")
-	}
+	return LoadConfig(os.Getenv("CONFIG_PATH"))
+}
 
+// LoadConfig builds the configuration with the following precedence, lowest first:
+// built-in defaults, the YAML file at path (skipped when empty), environment variables.
+func LoadConfig(path string) (*Config, error) {
 	config := &Config{
-		PerplexityAPIKey: apiKey,
-		DefaultModel:     getEnvWithDefault("PERPLEXITY_DEFAULT_MODEL", "sonar"),
-		RequestTimeout:   30 * time.Second,
-		LogLevel:         getEnvWithDefault("LOG_LEVEL", "INFO"),
+		DefaultModel:       "sonar",
+		RequestTimeout:     30 * time.Second,
+		LogLevel:           "INFO",
+		LogOutput:          LogOutputStderr,
+		LogFormat:          LogFormatJSON,
+		LogSyslog:          LogSyslog{Tag: DefaultSyslogTag},
+		SessionTTL:         DefaultSessionTTL,
+		SessionMaxHistory:  DefaultSessionMaxHistory,
+		JobTTL:             DefaultJobTTL,
+		ResultRetention:    DefaultResultRetention,
+		MaxJobs:            DefaultMaxJobs,
+		MaxBatchQueries:    DefaultMaxBatchQueries,
+		BatchConcurrency:   DefaultBatchConcurrency,
+		QueryFilter:        QueryFilterConfig{Action: QueryFilterOff, Patterns: QueryFilterPatterns},
+		SlowCallWarning:    DefaultSlowCallWarning,
+		Transport:          TransportStdio,
+		Host:               DefaultHTTPHost,
+		Port:               DefaultHTTPPort,
+		DisabledTools:      make(map[string]bool),
+		ToolFallbacks:      make(map[string]string),
+		ModelFallbacks:     make(map[string]string),
+		ToolDefaults:       make(map[string]ToolDefaults),
+		ModelPrices:        maps.Clone(DefaultModelPrices),
+		UnavailableMessage: DefaultUnavailableMessage,
+		ReasoningOutput:    ReasoningStrip,
+		ToolTimeouts:       make(map[string]time.Duration),
+		ModelTimeouts:      map[string]time.Duration{DeepResearchModel: DefaultDeepResearchTimeout},
+
+		SecretRefreshInterval: DefaultSecretRefreshInterval,
+		Vault:                 VaultConfig{AuthMethod: VaultAuthToken},
+		HTTPLimits: HTTPLimits{
+			MaxRequestBytes: DefaultHTTPMaxRequestBytes,
+			MaxHeaderBytes:  DefaultHTTPMaxHeaderBytes,
+			ReadTimeout:     DefaultHTTPReadTimeout,
+			IdleTimeout:     DefaultHTTPIdleTimeout,
+		},
+		Provider: ProviderConfig{Type: ProviderPerplexity},
+		APIConnectionPool: ConnectionPool{
+			MaxIdleConns:        DefaultAPIMaxIdleConns,
+			MaxIdleConnsPerHost: DefaultAPIMaxIdleConnsPerHost,
+			IdleConnTimeout:     DefaultAPIIdleConnTimeout,
+			KeepAlive:           DefaultAPIKeepAlive,
+		},
+		APIRetryPolicy: RetryPolicy{
+			Retries: DefaultAPIRateLimitRetries,
+			MaxWait: DefaultAPIMaxRetryWait,
+		},
+		LogFile: LogFile{
+			MaxSize:    DefaultLogFileMaxSize,
+			MaxBackups: DefaultLogFileMaxBackups,
+		},
+		StatsD: StatsDConfig{
+			Port:   DefaultStatsDPort,
+			Prefix: DefaultStatsDPrefix,
+		},
+		MaxResponseBytes: DefaultMaxResponseBytes,
+		MaxQueryLength:   DefaultMaxQueryLength,
+		MaxDomainFilters: DefaultMaxDomainFilters,
 	}
 
-	if timeoutStr := os.Getenv("REQUEST_TIMEOUT"); timeoutStr != "" {
-		if timeoutSec, err := strconv.Atoi(timeoutStr); err == nil && timeoutSec > 0 {
-			config.RequestTimeout = time.Duration(timeoutSec) * time.Second
+	if path != "" {
+		if err := config.applyFile(path); err != nil {
+			return nil, err
 		}
 	}
 
+	config.applyEnv()
 	return config, nil
 }
 
+// applyEnv overrides configuration with any environment variables that are set
+func (c *Config) applyEnv() {
+	// A key source set in the environment replaces any source from the config file
+	apiKey, apiKeyFile, secretARN := os.Getenv("PERPLEXITY_API_KEY"), os.Getenv("PERPLEXITY_API_KEY_FILE"), os.Getenv("PERPLEXITY_SECRET_ARN")
+	vaultPath := os.Getenv("PERPLEXITY_VAULT_PATH")
+	if countNonEmpty(apiKey, apiKeyFile, secretARN, vaultPath) > 0 {
+		c.PerplexityAPIKey, c.PerplexityAPIKeyFile, c.PerplexitySecretARN = apiKey, apiKeyFile, secretARN
+		c.Vault.SecretPath = vaultPath
+	}
+
+	// Standard Vault client variables plus the server's own Vault settings
+	c.Vault.Addr = getEnvWithDefault("VAULT_ADDR", c.Vault.Addr)
+	c.Vault.Token = getEnvWithDefault("VAULT_TOKEN", c.Vault.Token)
+	c.Vault.Namespace = getEnvWithDefault("VAULT_NAMESPACE", c.Vault.Namespace)
+	c.Vault.SecretField = getEnvWithDefault("PERPLEXITY_VAULT_FIELD", c.Vault.SecretField)
+	c.Vault.AuthMethod = getEnvWithDefault("VAULT_AUTH_METHOD", c.Vault.AuthMethod)
+	c.Vault.KubernetesRole = getEnvWithDefault("VAULT_K8S_ROLE", c.Vault.KubernetesRole)
+	c.Vault.KubernetesMount = getEnvWithDefault("VAULT_K8S_MOUNT", c.Vault.KubernetesMount)
+	c.DefaultModel = getEnvWithDefault("PERPLEXITY_DEFAULT_MODEL", c.DefaultModel)
+	c.LogLevel = getEnvWithDefault("LOG_LEVEL", c.LogLevel)
+	c.StoragePath = getEnvWithDefault("STORAGE_PATH", c.StoragePath)
+	c.Transport = getEnvWithDefault("MCP_TRANSPORT", c.Transport)
+	c.Host = getEnvWithDefault("MCP_HOST", c.Host)
+	c.UnavailableMessage = getEnvWithDefault("UNAVAILABLE_MESSAGE", c.UnavailableMessage)
+	c.ReasoningOutput = getEnvWithDefault("REASONING_OUTPUT", c.ReasoningOutput)
+	c.ProxyURL = getEnvWithDefault("PROXY_URL", c.ProxyURL)
+	c.AuditLogPath = getEnvWithDefault("AUDIT_LOG_PATH", c.AuditLogPath)
+	c.LogOutput = getEnvWithDefault("LOG_OUTPUT", c.LogOutput)
+	c.LogFormat = getEnvWithDefault("LOG_FORMAT", c.LogFormat)
+	c.LogFile.Path = getEnvWithDefault("LOG_FILE_PATH", c.LogFile.Path)
+	c.LogSyslog.Addr = getEnvWithDefault("LOG_SYSLOG_ADDR", c.LogSyslog.Addr)
+	c.LogSyslog.Tag = getEnvWithDefault("LOG_SYSLOG_TAG", c.LogSyslog.Tag)
+	c.TLSCertFile = getEnvWithDefault("TLS_CERT_FILE", c.TLSCertFile)
+	c.TLSKeyFile = getEnvWithDefault("TLS_KEY_FILE", c.TLSKeyFile)
+	c.TLSClientCAFile = getEnvWithDefault("TLS_CLIENT_CA_FILE", c.TLSClientCAFile)
+	c.AdminAddr = getEnvWithDefault("ADMIN_ADDR", c.AdminAddr)
+	c.AdminToken = getEnvWithDefault("ADMIN_TOKEN", c.AdminToken)
+	c.PluginDir = getEnvWithDefault("PLUGIN_DIR", c.PluginDir)
+	c.Provider.Type = getEnvWithDefault("SEARCH_PROVIDER", c.Provider.Type)
+	c.Provider.BaseURL = getEnvWithDefault("SEARCH_PROVIDER_BASE_URL", c.Provider.BaseURL)
+	c.Provider.Model = getEnvWithDefault("SEARCH_PROVIDER_MODEL", c.Provider.Model)
+
+	// REQUEST_TIMEOUT_SECONDS is the documented name; REQUEST_TIMEOUT is still honoured
+	for _, key := range []string{"REQUEST_TIMEOUT_SECONDS", "REQUEST_TIMEOUT"} {
+		if timeoutStr := os.Getenv(key); timeoutStr != "" {
+			if timeoutSec, err := strconv.Atoi(timeoutStr); err == nil && timeoutSec > 0 {
+				c.RequestTimeout = time.Duration(timeoutSec) * time.Second
+			}
+		}
+	}
+
+	if shutdownStr := os.Getenv("SHUTDOWN_TIMEOUT_SECONDS"); shutdownStr != "" {
+		if shutdownSec, err := strconv.Atoi(shutdownStr); err == nil && shutdownSec > 0 {
+			c.ShutdownTimeout = time.Duration(shutdownSec) * time.Second
+		}
+	}
+
+	if ttlStr := os.Getenv("SESSION_TTL_MINUTES"); ttlStr != "" {
+		if ttlMin, err := strconv.Atoi(ttlStr); err == nil && ttlMin > 0 {
+			c.SessionTTL = time.Duration(ttlMin) * time.Minute
+		}
+	}
+
+	if historyStr := os.Getenv("SESSION_MAX_HISTORY"); historyStr != "" {
+		if history, err := strconv.Atoi(historyStr); err == nil && history > 0 {
+			c.SessionMaxHistory = history
+		}
+	}
+
+	if daysStr := os.Getenv("RESULT_RETENTION_DAYS"); daysStr != "" {
+		if days, err := strconv.Atoi(daysStr); err == nil && days > 0 {
+			c.ResultRetention = time.Duration(days) * 24 * time.Hour
+		}
+	}
+
+	if ttlStr := os.Getenv("JOB_TTL_MINUTES"); ttlStr != "" {
+		if ttlMin, err := strconv.Atoi(ttlStr); err == nil && ttlMin > 0 {
+			c.JobTTL = time.Duration(ttlMin) * time.Minute
+		}
+	}
+
+	if maxStr := os.Getenv("MAX_JOBS"); maxStr != "" {
+		if maxJobs, err := strconv.Atoi(maxStr); err == nil && maxJobs > 0 {
+			c.MaxJobs = maxJobs
+		}
+	}
+
+	if maxStr := os.Getenv("MAX_BATCH_QUERIES"); maxStr != "" {
+		if maxQueries, err := strconv.Atoi(maxStr); err == nil && maxQueries > 0 {
+			c.MaxBatchQueries = maxQueries
+		}
+	}
+
+	if concurrencyStr := os.Getenv("BATCH_CONCURRENCY"); concurrencyStr != "" {
+		if concurrency, err := strconv.Atoi(concurrencyStr); err == nil && concurrency > 0 {
+			c.BatchConcurrency = concurrency
+		}
+	}
+
+	// Zero disables slow call warnings
+	if warningStr := os.Getenv("SLOW_CALL_WARNING_SECONDS"); warningStr != "" {
+		if warningSec, err := strconv.Atoi(warningStr); err == nil && warningSec >= 0 {
+			c.SlowCallWarning = time.Duration(warningSec) * time.Second
+		}
+	}
+
+	if portStr := os.Getenv("MCP_PORT"); portStr != "" {
+		if port, err := strconv.Atoi(portStr); err == nil {
+			c.Port = port
+		}
+	}
+
+	if refreshStr := os.Getenv("SECRET_REFRESH_SECONDS"); refreshStr != "" {
+		if refreshSec, err := strconv.Atoi(refreshStr); err == nil && refreshSec > 0 {
+			c.SecretRefreshInterval = time.Duration(refreshSec) * time.Second
+		}
+	}
+
+	if sizeStr := os.Getenv("HTTP_MAX_REQUEST_BYTES"); sizeStr != "" {
+		if size, err := strconv.ParseInt(sizeStr, 10, 64); err == nil {
+			c.HTTPLimits.MaxRequestBytes = size
+		}
+	}
+	if sizeStr := os.Getenv("HTTP_MAX_HEADER_BYTES"); sizeStr != "" {
+		if size, err := strconv.Atoi(sizeStr); err == nil {
+			c.HTTPLimits.MaxHeaderBytes = size
+		}
+	}
+	// Zero disables any of the HTTP timeouts
+	httpTimeouts := []struct {
+		key   string
+		value *time.Duration
+	}{
+		{"HTTP_READ_TIMEOUT_SECONDS", &c.HTTPLimits.ReadTimeout},
+		{"HTTP_WRITE_TIMEOUT_SECONDS", &c.HTTPLimits.WriteTimeout},
+		{"HTTP_IDLE_TIMEOUT_SECONDS", &c.HTTPLimits.IdleTimeout},
+	}
+	for _, timeout := range httpTimeouts {
+		if secondsStr := os.Getenv(timeout.key); secondsStr != "" {
+			if seconds, err := strconv.Atoi(secondsStr); err == nil {
+				*timeout.value = time.Duration(seconds) * time.Second
+			}
+		}
+	}
+
+	if limitStr := os.Getenv("RATE_LIMIT_PER_MINUTE"); limitStr != "" {
+		if limit, err := strconv.Atoi(limitStr); err == nil {
+			c.RateLimitPerMinute = limit
+		}
+	}
+	if limitStr := os.Getenv("RATE_LIMIT_CONCURRENT"); limitStr != "" {
+		if limit, err := strconv.Atoi(limitStr); err == nil {
+			c.RateLimitConcurrent = limit
+		}
+	}
+	if limitStr := os.Getenv("MAX_CONCURRENT_API_CALLS"); limitStr != "" {
+		if limit, err := strconv.Atoi(limitStr); err == nil {
+			c.MaxConcurrentAPICalls = limit
+		}
+	}
+	if depthStr := os.Getenv("API_QUEUE_MAX_DEPTH"); depthStr != "" {
+		if depth, err := strconv.Atoi(depthStr); err == nil {
+			c.APIQueueMaxDepth = depth
+		}
+	}
+	if waitStr := os.Getenv("API_QUEUE_SHED_WAIT_SECONDS"); waitStr != "" {
+		if waitSec, err := strconv.Atoi(waitStr); err == nil {
+			c.APIQueueShedWait = time.Duration(waitSec) * time.Second
+		}
+	}
+	if connsStr := os.Getenv("API_MAX_IDLE_CONNS"); connsStr != "" {
+		if conns, err := strconv.Atoi(connsStr); err == nil {
+			c.APIConnectionPool.MaxIdleConns = conns
+		}
+	}
+	if connsStr := os.Getenv("API_MAX_IDLE_CONNS_PER_HOST"); connsStr != "" {
+		if conns, err := strconv.Atoi(connsStr); err == nil {
+			c.APIConnectionPool.MaxIdleConnsPerHost = conns
+		}
+	}
+	if timeoutStr := os.Getenv("API_IDLE_CONN_TIMEOUT_SECONDS"); timeoutStr != "" {
+		if timeoutSec, err := strconv.Atoi(timeoutStr); err == nil {
+			c.APIConnectionPool.IdleConnTimeout = time.Duration(timeoutSec) * time.Second
+		}
+	}
+	if keepAliveStr := os.Getenv("API_KEEPALIVE_SECONDS"); keepAliveStr != "" {
+		if keepAliveSec, err := strconv.Atoi(keepAliveStr); err == nil {
+			c.APIConnectionPool.KeepAlive = time.Duration(keepAliveSec) * time.Second
+		}
+	}
+	if disableStr := os.Getenv("API_DISABLE_KEEPALIVES"); disableStr != "" {
+		if disable, err := strconv.ParseBool(disableStr); err == nil {
+			c.APIConnectionPool.DisableKeepAlives = disable
+		}
+	}
+	if retriesStr := os.Getenv("API_RATE_LIMIT_RETRIES"); retriesStr != "" {
+		if retries, err := strconv.Atoi(retriesStr); err == nil {
+			c.APIRetryPolicy.Retries = retries
+		}
+	}
+	if waitStr := os.Getenv("API_MAX_RETRY_WAIT_SECONDS"); waitStr != "" {
+		if waitSec, err := strconv.Atoi(waitStr); err == nil {
+			c.APIRetryPolicy.MaxWait = time.Duration(waitSec) * time.Second
+		}
+	}
+	if sizeStr := os.Getenv("LOG_FILE_MAX_SIZE_MB"); sizeStr != "" {
+		if size, err := strconv.ParseInt(sizeStr, 10, 64); err == nil {
+			c.LogFile.MaxSize = size * 1024 * 1024
+		}
+	}
+	if backupsStr := os.Getenv("LOG_FILE_MAX_BACKUPS"); backupsStr != "" {
+		if backups, err := strconv.Atoi(backupsStr); err == nil {
+			c.LogFile.MaxBackups = backups
+		}
+	}
+	if ageStr := os.Getenv("LOG_FILE_MAX_AGE_DAYS"); ageStr != "" {
+		if ageDays, err := strconv.Atoi(ageStr); err == nil {
+			c.LogFile.MaxAge = time.Duration(ageDays) * 24 * time.Hour
+		}
+	}
+	c.StatsD.Host = getEnvWithDefault("STATSD_HOST", c.StatsD.Host)
+	c.StatsD.Prefix = getEnvWithDefault("STATSD_PREFIX", c.StatsD.Prefix)
+	if portStr := os.Getenv("STATSD_PORT"); portStr != "" {
+		if port, err := strconv.Atoi(portStr); err == nil {
+			c.StatsD.Port = port
+		}
+	}
+	if tagsStr := os.Getenv("STATSD_TAGS"); tagsStr != "" {
+		if tags, err := strconv.ParseBool(tagsStr); err == nil {
+			c.StatsD.Tags = tags
+		}
+	}
+	if sizeStr := os.Getenv("MAX_RESPONSE_BYTES"); sizeStr != "" {
+		if size, err := strconv.ParseInt(sizeStr, 10, 64); err == nil {
+			c.MaxResponseBytes = size
+		}
+	}
+	if lengthStr := os.Getenv("MAX_QUERY_LENGTH"); lengthStr != "" {
+		if length, err := strconv.Atoi(lengthStr); err == nil {
+			c.MaxQueryLength = length
+		}
+	}
+	if filtersStr := os.Getenv("MAX_DOMAIN_FILTERS"); filtersStr != "" {
+		if filters, err := strconv.Atoi(filtersStr); err == nil {
+			c.MaxDomainFilters = filters
+		}
+	}
+
+	if rateStr := os.Getenv("QUALITY_SAMPLE_RATE"); rateStr != "" {
+		if rate, err := strconv.ParseFloat(rateStr, 64); err == nil {
+			c.QualitySampleRate = rate
+		}
+	}
+
+	if disabled, ok := os.LookupEnv("DISABLED_TOOLS"); ok {
+		c.DisabledTools = make(map[string]bool)
+		for _, name := range splitList(disabled) {
+			c.DisabledTools[name] = true
+		}
+	}
+
+	// MCP_AUTH_TOKEN holds one token; MCP_AUTH_TOKENS a list for rotation
+	if tokens := splitList(os.Getenv("MCP_AUTH_TOKEN") + "," + os.Getenv("MCP_AUTH_TOKENS")); len(tokens) > 0 {
+		c.AuthTokens = tokens
+	}
+
+	// The webhook secret only comes from the environment, like other secrets
+	c.Webhooks.Secret = os.Getenv("WEBHOOK_SECRET")
+	if hosts, ok := os.LookupEnv("WEBHOOK_ALLOWED_HOSTS"); ok {
+		c.Webhooks.AllowedHosts = splitList(hosts)
+	}
+	if allowStr := os.Getenv("WEBHOOK_ALLOW_PRIVATE_NETWORKS"); allowStr != "" {
+		if allow, err := strconv.ParseBool(allowStr); err == nil {
+			c.Webhooks.AllowPrivateNetworks = allow
+		}
+	}
+
+	// The Sentry DSN embeds the project's key, so it only comes from the environment too
+	c.Sentry.DSN = os.Getenv("SENTRY_DSN")
+	c.Sentry.Environment = getEnvWithDefault("SENTRY_ENVIRONMENT", c.Sentry.Environment)
+
+	if action := os.Getenv("QUERY_FILTER"); action != "" {
+		c.QueryFilter.Action = strings.ToLower(action)
+	}
+	if patterns, ok := os.LookupEnv("QUERY_FILTER_PATTERNS"); ok {
+		c.QueryFilter.Patterns = splitList(patterns)
+	}
+
+	if allowed, ok := os.LookupEnv("ALLOWED_MODELS"); ok {
+		c.AllowedModels = splitList(allowed)
+	}
+	if denied, ok := os.LookupEnv("DENIED_MODELS"); ok {
+		c.DeniedModels = splitList(denied)
+	}
+	if allowStr := os.Getenv("ALLOW_UNKNOWN_MODELS"); allowStr != "" {
+		if allow, err := strconv.ParseBool(allowStr); err == nil {
+			c.AllowUnknownModels = allow
+		}
+	}
+
+	budgets := []struct {
+		key   string
+		value *float64
+	}{
+		{"BUDGET_DAILY_TOKENS", &c.Budgets.DailyTokens.Hard},
+		{"BUDGET_DAILY_TOKENS_SOFT", &c.Budgets.DailyTokens.Soft},
+		{"BUDGET_DAILY_USD", &c.Budgets.DailyUSD.Hard},
+		{"BUDGET_DAILY_USD_SOFT", &c.Budgets.DailyUSD.Soft},
+		{"BUDGET_MONTHLY_TOKENS", &c.Budgets.MonthlyTokens.Hard},
+		{"BUDGET_MONTHLY_TOKENS_SOFT", &c.Budgets.MonthlyTokens.Soft},
+		{"BUDGET_MONTHLY_USD", &c.Budgets.MonthlyUSD.Hard},
+		{"BUDGET_MONTHLY_USD_SOFT", &c.Budgets.MonthlyUSD.Soft},
+	}
+	for _, budget := range budgets {
+		if valueStr := os.Getenv(budget.key); valueStr != "" {
+			if value, err := strconv.ParseFloat(valueStr, 64); err == nil {
+				*budget.value = value
+			}
+		}
+	}
+
+	// TOOL_TIMEOUTS and MODEL_TIMEOUTS are comma-separated lists of name=seconds pairs
+	for _, timeouts := range []struct {
+		key   string
+		value *map[string]time.Duration
+	}{
+		{"TOOL_TIMEOUTS", &c.ToolTimeouts},
+		{"MODEL_TIMEOUTS", &c.ModelTimeouts},
+	} {
+		if pairs, ok := os.LookupEnv(timeouts.key); ok {
+			*timeouts.value = make(map[string]time.Duration)
+			for _, pair := range splitList(pairs) {
+				name, secondsStr, _ := strings.Cut(pair, "=")
+				// Unparsable values become zero and are reported by Validate
+				seconds, _ := strconv.Atoi(strings.TrimSpace(secondsStr))
+				(*timeouts.value)[strings.TrimSpace(name)] = time.Duration(seconds) * time.Second
+			}
+		}
+	}
+
+	// TOOL_FALLBACKS is a comma-separated list of tool=mode pairs
+	if fallbacks, ok := os.LookupEnv("TOOL_FALLBACKS"); ok {
+		c.ToolFallbacks = make(map[string]string)
+		for _, pair := range splitList(fallbacks) {
+			name, mode, _ := strings.Cut(pair, "=")
+			c.ToolFallbacks[strings.TrimSpace(name)] = strings.TrimSpace(mode)
+		}
+	}
+
+	// MODEL_FALLBACKS is a comma-separated list of model=fallback pairs
+	if fallbacks, ok := os.LookupEnv("MODEL_FALLBACKS"); ok {
+		c.ModelFallbacks = make(map[string]string)
+		for _, pair := range splitList(fallbacks) {
+			model, fallback, _ := strings.Cut(pair, "=")
+			c.ModelFallbacks[strings.TrimSpace(model)] = strings.TrimSpace(fallback)
+		}
+	}
+}
+
+// splitList parses a comma-separated list, dropping empty entries
+func splitList(value string) []string {
+	var items []string
+	for _, item := range strings.Split(value, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			items = append(items, item)
+		}
+	}
+	return items
+}
+
 func getEnvWithDefault(key, defaultValue string) string {
 	if value := os.Getenv(key); value != "" {
 		return value
@@ -43,12 +607,328 @@ func getEnvWithDefault(key, defaultValue string) string {
 	return defaultValue
 }
 
+// ToolEnabled reports whether the named tool should be registered
+func (c *Config) ToolEnabled(name string) bool {
+	return !c.DisabledTools[name]
+}
+
+// Fallback returns the fallback mode for the named tool
+func (c *Config) Fallback(name string) string {
+	if mode := c.ToolFallbacks[name]; mode != "" {
+		return mode
+	}
+	return FallbackError
+}
+
+// DefaultModelFor returns the model the named tool uses when a call names none
+func (c *Config) DefaultModelFor(name string) string {
+	if model := c.ToolDefaults[name].Model; model != "" {
+		return model
+	}
+	return c.DefaultModel
+}
+
+// TimeoutFor returns the request timeout of a call of the named tool to model,
+// and the setting it comes from for timeout errors
+func (c *Config) TimeoutFor(name, model string) (time.Duration, string) {
+	if timeout, ok := c.ToolTimeouts[name]; ok {
+		return timeout, fmt.Sprintf("timeout of tool %s", name)
+	}
+	if timeout, ok := c.ModelTimeouts[model]; ok {
+		return timeout, fmt.Sprintf("timeout of model %s", model)
+	}
+	return c.RequestTimeout, "REQUEST_TIMEOUT_SECONDS"
+}
+
+// ShutdownWait returns how long shutdown waits for tool calls in flight:
+// ShutdownTimeout, or by default the longest request, tool or model timeout,
+// so no call is cut off before its own timeout
+func (c *Config) ShutdownWait() time.Duration {
+	if c.ShutdownTimeout > 0 {
+		return c.ShutdownTimeout
+	}
+	wait := c.RequestTimeout
+	for _, timeout := range c.ModelTimeouts {
+		wait = max(wait, timeout)
+	}
+	for _, timeout := range c.ToolTimeouts {
+		wait = max(wait, timeout)
+	}
+	return wait
+}
+
+// applyToolDefaults fills the parameters req leaves unset from the named tool's defaults
+func (c *Config) applyToolDefaults(name string, req *SearchRequest) {
+	defaults := c.ToolDefaults[name]
+	if req.Model == "" {
+		req.Model = c.DefaultModelFor(name)
+	}
+	if req.MaxTokens == 0 {
+		req.MaxTokens = defaults.MaxTokens
+	}
+	if req.SearchMode == "" {
+		req.SearchMode = defaults.SearchMode
+	}
+	if req.CitationStyle == "" && req.OutputFormat == OutputFormatMarkdown && !req.SourcesOnly {
+		req.CitationStyle = defaults.CitationStyle
+	}
+	if req.Temperature == nil {
+		req.Temperature = defaults.Temperature
+	}
+}
+
+// Models returns the Sonar models clients may request, in SonarModels order,
+// followed by any unknown models named in the allow list
+func (c *Config) Models() []string {
+	var models []string
+	for _, model := range SonarModels {
+		if c.modelAllowed(model) {
+			models = append(models, model)
+		}
+	}
+	for _, model := range c.AllowedModels {
+		if !slices.Contains(models, model) && c.knownModel(model) && c.modelAllowed(model) {
+			models = append(models, model)
+		}
+	}
+	return models
+}
+
+// modelNamePattern is the safe character set required of models missing from
+// SonarModels, which are forwarded to the API as is
+var modelNamePattern = regexp.MustCompile(`^[A-Za-z0-9][A-Za-z0-9._-]{0,63}$`)
+
+// knownModel reports whether model is a Sonar model or, with
+// AllowUnknownModels, a well-formed name of another one
+func (c *Config) knownModel(model string) bool {
+	return slices.Contains(SonarModels, model) || (c.AllowUnknownModels && modelNamePattern.MatchString(model))
+}
+
+// CheckModel returns an error if model is unknown or the allow and deny lists forbid it
+func (c *Config) CheckModel(model string) error {
+	if !c.knownModel(model) {
+		if c.AllowUnknownModels {
+			return fmt.Errorf("invalid model name %q", model)
+		}
+		return fmt.Errorf("unknown model %q (supported: %s)", model, strings.Join(c.Models(), ", "))
+	}
+	if !c.modelAllowed(model) {
+		return fmt.Errorf("model %q is not allowed on this server (allowed: %s)", model, strings.Join(c.Models(), ", "))
+	}
+	return nil
+}
+
+func (c *Config) modelAllowed(model string) bool {
+	if slices.Contains(c.DeniedModels, model) {
+		return false
+	}
+	return len(c.AllowedModels) == 0 || slices.Contains(c.AllowedModels, model)
+}
+
+// Addr returns the host:port the HTTP transport listens on
+func (c *Config) Addr() string {
+	return fmt.Sprintf("%s:%d", c.Host, c.Port)
+}
+
+// Validate checks the configuration and returns all of its problems, joined
 func (c *Config) Validate() error {
-	if c.PerplexityAPIKey == "" {
-		return fmt.Errorf("API key is required")
+	var errs []error
+	// Exactly one source of the API key; external sources are read by a SecretProvider
+	switch countNonEmpty(c.PerplexityAPIKey, c.PerplexityAPIKeyFile, c.PerplexitySecretARN, c.Vault.SecretPath) {
+	case 0:
+		errs = append(errs, fmt.Errorf("PERPLEXITY_API_KEY, PERPLEXITY_API_KEY_FILE, PERPLEXITY_SECRET_ARN or PERPLEXITY_VAULT_PATH environment variable is required"))
+	case 1:
+	default:
+		errs = append(errs, fmt.Errorf("PERPLEXITY_API_KEY, PERPLEXITY_API_KEY_FILE, PERPLEXITY_SECRET_ARN and PERPLEXITY_VAULT_PATH are mutually exclusive"))
+	}
+	if _, err := ParseLogLevel(c.LogLevel); err != nil {
+		errs = append(errs, err)
+	}
+	if !slices.Contains(LogOutputs, c.LogOutput) {
+		errs = append(errs, fmt.Errorf("invalid log output %q: must be %q, %q or %q", c.LogOutput, LogOutputStderr, LogOutputFile, LogOutputSyslog))
+	}
+	if c.LogFormat != LogFormatJSON && c.LogFormat != LogFormatText {
+		errs = append(errs, fmt.Errorf("invalid log format %q: must be %q or %q", c.LogFormat, LogFormatJSON, LogFormatText))
+	}
+	if c.LogOutput == LogOutputFile {
+		if err := c.LogFile.Validate(); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	if c.SecretRefreshInterval <= 0 {
+		errs = append(errs, fmt.Errorf("secret refresh interval must be positive"))
 	}
 	if c.RequestTimeout <= 0 {
-		return fmt.Errorf("request timeout must be positive")
+		errs = append(errs, fmt.Errorf("request timeout must be positive"))
 	}
-	return nil
+	if c.ShutdownTimeout < 0 {
+		errs = append(errs, fmt.Errorf("shutdown timeout must not be negative"))
+	}
+	for name, timeout := range c.ToolTimeouts {
+		if timeout <= 0 {
+			errs = append(errs, fmt.Errorf("timeout of tool %s must be positive", name))
+		}
+	}
+	for model, timeout := range c.ModelTimeouts {
+		if !c.knownModel(model) {
+			errs = append(errs, fmt.Errorf("unknown model in timeouts: %s", model))
+		}
+		if timeout <= 0 {
+			errs = append(errs, fmt.Errorf("timeout of model %s must be positive", model))
+		}
+	}
+	if c.SessionTTL <= 0 {
+		errs = append(errs, fmt.Errorf("session TTL must be positive"))
+	}
+	if c.SessionMaxHistory < 2 || c.SessionMaxHistory > MaxContextMessages {
+		errs = append(errs, fmt.Errorf("session max history must be between 2 and %d", MaxContextMessages))
+	}
+	if c.JobTTL <= 0 || c.MaxJobs <= 0 {
+		errs = append(errs, fmt.Errorf("job TTL and max jobs must be positive"))
+	}
+	if c.ResultRetention <= 0 {
+		errs = append(errs, fmt.Errorf("result retention must be positive"))
+	}
+	if c.MaxBatchQueries <= 0 || c.BatchConcurrency <= 0 {
+		errs = append(errs, fmt.Errorf("max batch queries and batch concurrency must be positive"))
+	}
+	switch c.Transport {
+	case TransportStdio, TransportHTTP:
+	default:
+		errs = append(errs, fmt.Errorf("invalid transport %q: must be %q or %q", c.Transport, TransportStdio, TransportHTTP))
+	}
+	if c.Port <= 0 || c.Port > 65535 {
+		errs = append(errs, fmt.Errorf("invalid port: %d", c.Port))
+	}
+	if c.QualitySampleRate < 0 || c.QualitySampleRate > 1 {
+		errs = append(errs, fmt.Errorf("quality sample rate must be between 0 and 1"))
+	}
+	for _, model := range slices.Concat(c.AllowedModels, c.DeniedModels) {
+		if !c.knownModel(model) {
+			errs = append(errs, fmt.Errorf("unknown model in allow/deny list: %s", model))
+		}
+	}
+	if len(c.Models()) == 0 {
+		errs = append(errs, fmt.Errorf("model allow/deny lists permit no models"))
+	}
+	if err := c.CheckModel(c.DefaultModel); err != nil {
+		errs = append(errs, fmt.Errorf("default model: %w", err))
+	}
+	for model, fallback := range c.ModelFallbacks {
+		if !c.knownModel(model) {
+			errs = append(errs, fmt.Errorf("unknown model in model fallbacks: %s", model))
+		}
+		if err := c.CheckModel(fallback); err != nil {
+			errs = append(errs, fmt.Errorf("fallback for model %s: %w", model, err))
+		}
+		// Follow the chain from model; returning to a model seen before is a loop
+		seen := map[string]bool{model: true}
+		for next := fallback; next != ""; next = c.ModelFallbacks[next] {
+			if seen[next] {
+				errs = append(errs, fmt.Errorf("model fallbacks loop back to %s", next))
+				break
+			}
+			seen[next] = true
+		}
+	}
+	if c.ProxyURL != "" {
+		if _, err := ParseProxyURL(c.ProxyURL); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	for name, defaults := range c.ToolDefaults {
+		if defaults.Model != "" {
+			if err := c.CheckModel(defaults.Model); err != nil {
+				errs = append(errs, fmt.Errorf("default model for tool %s: %w", name, err))
+			}
+		}
+		if defaults.MaxTokens < 0 || defaults.MaxTokens > 128000 {
+			errs = append(errs, fmt.Errorf("invalid default max_tokens for tool %s: %d", name, defaults.MaxTokens))
+		}
+		if defaults.SearchMode != "" && !slices.Contains(SearchModes, defaults.SearchMode) {
+			errs = append(errs, fmt.Errorf("invalid default search_mode for tool %s: %s", name, defaults.SearchMode))
+		}
+		if t := defaults.Temperature; t != nil && (*t < 0 || *t > 2) {
+			errs = append(errs, fmt.Errorf("invalid default temperature for tool %s: %g", name, *t))
+		}
+		if defaults.CitationStyle != "" && !slices.Contains(CitationStyles, defaults.CitationStyle) {
+			errs = append(errs, fmt.Errorf("invalid default citation_style for tool %s: %s", name, defaults.CitationStyle))
+		}
+	}
+	for model, price := range c.ModelPrices {
+		if price.InputPerMillion < 0 || price.OutputPerMillion < 0 || price.PerRequest < 0 {
+			errs = append(errs, fmt.Errorf("invalid price for model %s: prices must not be negative", model))
+		}
+	}
+	if err := c.Budgets.Validate(); err != nil {
+		errs = append(errs, err)
+	}
+	if (c.TLSCertFile == "") != (c.TLSKeyFile == "") {
+		errs = append(errs, fmt.Errorf("TLS_CERT_FILE and TLS_KEY_FILE must be set together"))
+	}
+	if c.TLSClientCAFile != "" && c.TLSCertFile == "" {
+		errs = append(errs, fmt.Errorf("TLS_CLIENT_CA_FILE requires TLS_CERT_FILE and TLS_KEY_FILE"))
+	}
+	if !slices.Contains(ReasoningOutputModes, c.ReasoningOutput) {
+		errs = append(errs, fmt.Errorf("invalid reasoning output %q: must be %q, %q or %q", c.ReasoningOutput, ReasoningStrip, ReasoningSeparate, ReasoningKeep))
+	}
+	if err := c.HTTPLimits.Validate(); err != nil {
+		errs = append(errs, err)
+	}
+	if err := c.Provider.Validate(); err != nil {
+		errs = append(errs, err)
+	}
+	if err := c.QueryFilter.Validate(); err != nil {
+		errs = append(errs, err)
+	}
+	if err := c.ResponseRedactions.Validate(); err != nil {
+		errs = append(errs, err)
+	}
+	if c.RateLimitPerMinute < 0 || c.RateLimitConcurrent < 0 {
+		errs = append(errs, fmt.Errorf("rate limits must not be negative"))
+	}
+	if c.MaxConcurrentAPICalls < 0 {
+		errs = append(errs, fmt.Errorf("max concurrent API calls must not be negative"))
+	}
+	if c.APIQueueMaxDepth < 0 || c.APIQueueShedWait < 0 {
+		errs = append(errs, fmt.Errorf("API queue shedding thresholds must not be negative"))
+	}
+	if err := c.APIConnectionPool.Validate(); err != nil {
+		errs = append(errs, err)
+	}
+	if err := c.APIRetryPolicy.Validate(); err != nil {
+		errs = append(errs, err)
+	}
+	if err := c.Sentry.Validate(); err != nil {
+		errs = append(errs, err)
+	}
+	if err := c.StatsD.Validate(); err != nil {
+		errs = append(errs, err)
+	}
+	// Below a kilobyte not even a short answer fits
+	if c.MaxResponseBytes < 1024 {
+		errs = append(errs, fmt.Errorf("max response bytes must be at least 1024"))
+	}
+	if c.MaxQueryLength <= 0 {
+		errs = append(errs, fmt.Errorf("max query length must be positive"))
+	}
+	if c.MaxDomainFilters <= 0 {
+		errs = append(errs, fmt.Errorf("max domain filters must be positive"))
+	}
+	if c.AdminAddr != "" {
+		host, _, err := net.SplitHostPort(c.AdminAddr)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("invalid admin address %q: %w", c.AdminAddr, err))
+		} else if ip := net.ParseIP(host); host != "localhost" && (ip == nil || !ip.IsLoopback()) && c.AdminToken == "" {
+			errs = append(errs, fmt.Errorf("admin address %s is not a loopback address and requires ADMIN_TOKEN", c.AdminAddr))
+		}
+	}
+	for name, mode := range c.ToolFallbacks {
+		switch mode {
+		case FallbackError, FallbackStale, FallbackUnavailable:
+		default:
+			errs = append(errs, fmt.Errorf("invalid fallback %q for tool %s: must be %q, %q or %q", mode, name, FallbackError, FallbackStale, FallbackUnavailable))
+		}
+	}
+	return errors.Join(errs...)
 }
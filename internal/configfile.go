@@ -0,0 +1,519 @@
+package internal
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"maps"
+	"os"
+	"time"
+
+	"gopkg.in/yaml.v3"
+)
+
+// fileConfig is the YAML layout of the configuration file. Unset fields keep
+// their defaults; environment variables override anything set here.
+type fileConfig struct {
+	// APIKeyEnv names the environment variable holding the Perplexity API key,
+	// so the secret itself never has to be written into the file.
+	APIKeyEnv string `yaml:"api_key_env"`
+	// APIKeyFile is a mounted secret file holding the key, as an alternative to APIKeyEnv
+	APIKeyFile string `yaml:"api_key_file"`
+	// APIKeySecretARN names an AWS Secrets Manager secret or SSM parameter holding the key
+	APIKeySecretARN string `yaml:"api_key_secret_arn"`
+
+	// Vault reads the key from HashiCorp Vault; the token itself comes from VAULT_TOKEN
+	Vault struct {
+		Addr            string `yaml:"addr"`
+		Namespace       string `yaml:"namespace"`
+		SecretPath      string `yaml:"secret_path"`
+		SecretField     string `yaml:"secret_field"`
+		AuthMethod      string `yaml:"auth_method"`
+		KubernetesRole  string `yaml:"kubernetes_role"`
+		KubernetesMount string `yaml:"kubernetes_mount"`
+	} `yaml:"vault"`
+	DefaultModel string `yaml:"default_model"`
+	LogLevel     string `yaml:"log_level"`
+	StoragePath  string `yaml:"storage_path"`
+	// ResultRetentionDays is how long results are kept in the storage file
+	ResultRetentionDays int `yaml:"result_retention_days"`
+	// UnavailableMessage is the answer of tools using the "unavailable" fallback
+	UnavailableMessage string `yaml:"unavailable_message"`
+	ProxyURL           string `yaml:"proxy_url"`
+	AuditLogPath       string `yaml:"audit_log_path"`
+	// LogOutput is stderr, file or syslog, written as LogFile or LogSyslog configures
+	LogOutput string `yaml:"log_output"`
+	// LogFormat is json or text
+	LogFormat string `yaml:"log_format"`
+	LogFile   struct {
+		Path       string `yaml:"path"`
+		MaxSizeMB  *int64 `yaml:"max_size_mb"`
+		MaxBackups *int   `yaml:"max_backups"`
+		MaxAgeDays *int   `yaml:"max_age_days"`
+	} `yaml:"log_file"`
+	LogSyslog struct {
+		Addr string `yaml:"addr"`
+		Tag  string `yaml:"tag"`
+	} `yaml:"log_syslog"`
+	// AdminAddr enables the admin API; its token only comes from ADMIN_TOKEN
+	AdminAddr string `yaml:"admin_addr"`
+	// ReasoningOutput is strip, separate or keep
+	ReasoningOutput string `yaml:"reasoning_output"`
+	// ResponseRedactions rewrite matches of their patterns in returned answers
+	ResponseRedactions RedactionRules `yaml:"response_redactions"`
+	// PluginDir holds executables that serve additional tools
+	PluginDir string `yaml:"plugin_dir"`
+	// MaxQueryLength bounds the query and system prompt of search calls
+	MaxQueryLength int `yaml:"max_query_length"`
+	// MaxDomainFilters bounds the domains of sources and exclude_sources together
+	MaxDomainFilters int `yaml:"max_domain_filters"`
+
+	Timeouts struct {
+		RequestSeconds         int  `yaml:"request_seconds"`
+		SlowCallWarningSeconds *int `yaml:"slow_call_warning_seconds"`
+		SecretRefreshSeconds   int  `yaml:"secret_refresh_seconds"`
+		ShutdownSeconds        int  `yaml:"shutdown_seconds"`
+		// Models maps model names to their request timeout in seconds
+		Models map[string]int `yaml:"models"`
+	} `yaml:"timeouts"`
+
+	Sessions struct {
+		TTLMinutes int `yaml:"ttl_minutes"`
+		MaxHistory int `yaml:"max_history"`
+	} `yaml:"sessions"`
+
+	Jobs struct {
+		TTLMinutes int `yaml:"ttl_minutes"`
+		MaxJobs    int `yaml:"max_jobs"`
+		// WebhookAllowedHosts restricts job callback URLs to these hosts
+		WebhookAllowedHosts []string `yaml:"webhook_allowed_hosts"`
+		// WebhookAllowPrivateNetworks lets callbacks reach loopback and private addresses
+		WebhookAllowPrivateNetworks *bool `yaml:"webhook_allow_private_networks"`
+	} `yaml:"jobs"`
+
+	Batch struct {
+		MaxQueries  int `yaml:"max_queries"`
+		Concurrency int `yaml:"concurrency"`
+	} `yaml:"batch"`
+
+	// QueryFilter scans outgoing requests for personal data
+	QueryFilter struct {
+		Action   string   `yaml:"action"`
+		Patterns []string `yaml:"patterns"`
+		// Custom maps pattern names to regular expressions
+		Custom map[string]string `yaml:"custom"`
+	} `yaml:"query_filter"`
+
+	// StatsD sends metrics to a StatsD server or Datadog agent
+	StatsD struct {
+		Host   string `yaml:"host"`
+		Port   int    `yaml:"port"`
+		Prefix string `yaml:"prefix"`
+		Tags   *bool  `yaml:"tags"`
+	} `yaml:"statsd"`
+
+	Transport struct {
+		Type string `yaml:"type"`
+		Host string `yaml:"host"`
+		Port int    `yaml:"port"`
+		// TLSCertFile and TLSKeyFile serve the HTTP transport over HTTPS
+		TLSCertFile string `yaml:"tls_cert_file"`
+		TLSKeyFile  string `yaml:"tls_key_file"`
+		// TLSClientCAFile requires client certificates signed by these CAs
+		TLSClientCAFile string `yaml:"tls_client_ca_file"`
+
+		// Limits protect the HTTP transport from slow or oversized requests
+		Limits struct {
+			MaxRequestBytes     int64 `yaml:"max_request_bytes"`
+			MaxHeaderBytes      int   `yaml:"max_header_bytes"`
+			ReadTimeoutSeconds  *int  `yaml:"read_timeout_seconds"`
+			WriteTimeoutSeconds *int  `yaml:"write_timeout_seconds"`
+			IdleTimeoutSeconds  *int  `yaml:"idle_timeout_seconds"`
+		} `yaml:"limits"`
+	} `yaml:"transport"`
+
+	Tools map[string]fileToolConfig `yaml:"tools"`
+
+	Models struct {
+		Allow []string `yaml:"allow"`
+		Deny  []string `yaml:"deny"`
+		// AllowUnknown forwards models this server does not know
+		AllowUnknown *bool `yaml:"allow_unknown"`
+		// Fallbacks maps a model to the model retried when it fails
+		Fallbacks map[string]string `yaml:"fallbacks"`
+	} `yaml:"models"`
+
+	// Pricing overrides the estimated price of individual models
+	Pricing map[string]ModelPrice `yaml:"pricing"`
+
+	Budgets struct {
+		DailyTokens   *fileBudgetLimit `yaml:"daily_tokens"`
+		DailyUSD      *fileBudgetLimit `yaml:"daily_usd"`
+		MonthlyTokens *fileBudgetLimit `yaml:"monthly_tokens"`
+		MonthlyUSD    *fileBudgetLimit `yaml:"monthly_usd"`
+	} `yaml:"budgets"`
+
+	Sampling struct {
+		Rate *float64 `yaml:"rate"`
+	} `yaml:"sampling"`
+
+	// RateLimit applies to each HTTP client, identified by bearer token or IP
+	RateLimit struct {
+		PerMinute  *int `yaml:"per_minute"`
+		Concurrent *int `yaml:"concurrent"`
+	} `yaml:"rate_limit"`
+
+	// Upstream tunes requests to the API
+	Upstream struct {
+		MaxConcurrentCalls *int `yaml:"max_concurrent_calls"`
+		MaxQueueDepth      *int `yaml:"max_queue_depth"`
+		ShedWaitSeconds    *int `yaml:"shed_wait_seconds"`
+
+		MaxIdleConns           *int  `yaml:"max_idle_conns"`
+		MaxIdleConnsPerHost    *int  `yaml:"max_idle_conns_per_host"`
+		IdleConnTimeoutSeconds *int  `yaml:"idle_conn_timeout_seconds"`
+		KeepAliveSeconds       *int  `yaml:"keepalive_seconds"`
+		DisableKeepAlives      *bool `yaml:"disable_keepalives"`
+
+		RateLimitRetries    *int `yaml:"rate_limit_retries"`
+		MaxRetryWaitSeconds *int `yaml:"max_retry_wait_seconds"`
+
+		// MaxResponseBytes is the largest API response accepted
+		MaxResponseBytes int64 `yaml:"max_response_bytes"`
+	} `yaml:"upstream"`
+
+	// Provider selects the search backend; the API key is sent to it as a bearer token
+	Provider struct {
+		Type    string `yaml:"type"`
+		BaseURL string `yaml:"base_url"`
+		Model   string `yaml:"model"`
+	} `yaml:"provider"`
+}
+
+type fileBudgetLimit struct {
+	Soft float64 `yaml:"soft"`
+	Hard float64 `yaml:"hard"`
+}
+
+type fileToolConfig struct {
+	Enabled  *bool  `yaml:"enabled"`
+	Fallback string `yaml:"fallback"`
+	// TimeoutSeconds replaces the request timeout for calls of the tool
+	TimeoutSeconds int `yaml:"timeout_seconds"`
+
+	Defaults struct {
+		Model         string   `yaml:"model"`
+		MaxTokens     int      `yaml:"max_tokens"`
+		SearchMode    string   `yaml:"search_mode"`
+		Temperature   *float64 `yaml:"temperature"`
+		CitationStyle string   `yaml:"citation_style"`
+	} `yaml:"defaults"`
+}
+
+// applyFile reads the YAML configuration file at path into c
+func (c *Config) applyFile(path string) error {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return fmt.Errorf("failed to read config file: %w", err)
+	}
+
+	var file fileConfig
+	decoder := yaml.NewDecoder(bytes.NewReader(data))
+	decoder.KnownFields(true)
+	if err := decoder.Decode(&file); err != nil && !errors.Is(err, io.EOF) {
+		return fmt.Errorf("failed to parse config file %s: %w", path, err)
+	}
+
+	if countNonEmpty(file.APIKeyEnv, file.APIKeyFile, file.APIKeySecretARN, file.Vault.SecretPath) > 1 {
+		return fmt.Errorf("config file %s: api_key_env, api_key_file, api_key_secret_arn and vault.secret_path are mutually exclusive", path)
+	}
+	if file.APIKeyEnv != "" {
+		c.PerplexityAPIKey = os.Getenv(file.APIKeyEnv)
+	}
+	if file.APIKeyFile != "" {
+		c.PerplexityAPIKeyFile = file.APIKeyFile
+	}
+	if file.APIKeySecretARN != "" {
+		c.PerplexitySecretARN = file.APIKeySecretARN
+	}
+	if file.Vault.Addr != "" {
+		c.Vault.Addr = file.Vault.Addr
+	}
+	if file.Vault.Namespace != "" {
+		c.Vault.Namespace = file.Vault.Namespace
+	}
+	if file.Vault.SecretPath != "" {
+		c.Vault.SecretPath = file.Vault.SecretPath
+	}
+	if file.Vault.SecretField != "" {
+		c.Vault.SecretField = file.Vault.SecretField
+	}
+	if file.Vault.AuthMethod != "" {
+		c.Vault.AuthMethod = file.Vault.AuthMethod
+	}
+	if file.Vault.KubernetesRole != "" {
+		c.Vault.KubernetesRole = file.Vault.KubernetesRole
+	}
+	if file.Vault.KubernetesMount != "" {
+		c.Vault.KubernetesMount = file.Vault.KubernetesMount
+	}
+	if file.DefaultModel != "" {
+		c.DefaultModel = file.DefaultModel
+	}
+	if file.LogLevel != "" {
+		c.LogLevel = file.LogLevel
+	}
+	if file.StoragePath != "" {
+		c.StoragePath = file.StoragePath
+	}
+	if file.ResultRetentionDays != 0 {
+		c.ResultRetention = time.Duration(file.ResultRetentionDays) * 24 * time.Hour
+	}
+	if file.UnavailableMessage != "" {
+		c.UnavailableMessage = file.UnavailableMessage
+	}
+	if file.ReasoningOutput != "" {
+		c.ReasoningOutput = file.ReasoningOutput
+	}
+	if file.ResponseRedactions != nil {
+		c.ResponseRedactions = file.ResponseRedactions
+	}
+	if file.ProxyURL != "" {
+		c.ProxyURL = file.ProxyURL
+	}
+	if file.AuditLogPath != "" {
+		c.AuditLogPath = file.AuditLogPath
+	}
+	if file.LogOutput != "" {
+		c.LogOutput = file.LogOutput
+	}
+	if file.LogFormat != "" {
+		c.LogFormat = file.LogFormat
+	}
+	if file.LogFile.Path != "" {
+		c.LogFile.Path = file.LogFile.Path
+	}
+	if file.LogSyslog.Addr != "" {
+		c.LogSyslog.Addr = file.LogSyslog.Addr
+	}
+	if file.LogSyslog.Tag != "" {
+		c.LogSyslog.Tag = file.LogSyslog.Tag
+	}
+	if file.LogFile.MaxSizeMB != nil {
+		c.LogFile.MaxSize = *file.LogFile.MaxSizeMB * 1024 * 1024
+	}
+	if file.LogFile.MaxBackups != nil {
+		c.LogFile.MaxBackups = *file.LogFile.MaxBackups
+	}
+	if file.LogFile.MaxAgeDays != nil {
+		c.LogFile.MaxAge = time.Duration(*file.LogFile.MaxAgeDays) * 24 * time.Hour
+	}
+	if file.AdminAddr != "" {
+		c.AdminAddr = file.AdminAddr
+	}
+	if file.PluginDir != "" {
+		c.PluginDir = file.PluginDir
+	}
+	if file.MaxQueryLength != 0 {
+		c.MaxQueryLength = file.MaxQueryLength
+	}
+	if file.MaxDomainFilters != 0 {
+		c.MaxDomainFilters = file.MaxDomainFilters
+	}
+	if file.Timeouts.RequestSeconds != 0 {
+		c.RequestTimeout = time.Duration(file.Timeouts.RequestSeconds) * time.Second
+	}
+	if file.Timeouts.SlowCallWarningSeconds != nil {
+		c.SlowCallWarning = time.Duration(*file.Timeouts.SlowCallWarningSeconds) * time.Second
+	}
+	if file.Timeouts.ShutdownSeconds != 0 {
+		c.ShutdownTimeout = time.Duration(file.Timeouts.ShutdownSeconds) * time.Second
+	}
+	if file.Timeouts.SecretRefreshSeconds != 0 {
+		c.SecretRefreshInterval = time.Duration(file.Timeouts.SecretRefreshSeconds) * time.Second
+	}
+	for model, seconds := range file.Timeouts.Models {
+		c.ModelTimeouts[model] = time.Duration(seconds) * time.Second
+	}
+	if file.Sessions.TTLMinutes != 0 {
+		c.SessionTTL = time.Duration(file.Sessions.TTLMinutes) * time.Minute
+	}
+	if file.Sessions.MaxHistory != 0 {
+		c.SessionMaxHistory = file.Sessions.MaxHistory
+	}
+	if file.Jobs.TTLMinutes != 0 {
+		c.JobTTL = time.Duration(file.Jobs.TTLMinutes) * time.Minute
+	}
+	if file.Jobs.MaxJobs != 0 {
+		c.MaxJobs = file.Jobs.MaxJobs
+	}
+	if len(file.Jobs.WebhookAllowedHosts) > 0 {
+		c.Webhooks.AllowedHosts = file.Jobs.WebhookAllowedHosts
+	}
+	if file.Jobs.WebhookAllowPrivateNetworks != nil {
+		c.Webhooks.AllowPrivateNetworks = *file.Jobs.WebhookAllowPrivateNetworks
+	}
+	if file.Batch.MaxQueries != 0 {
+		c.MaxBatchQueries = file.Batch.MaxQueries
+	}
+	if file.Batch.Concurrency != 0 {
+		c.BatchConcurrency = file.Batch.Concurrency
+	}
+	if file.QueryFilter.Action != "" {
+		c.QueryFilter.Action = file.QueryFilter.Action
+	}
+	if file.QueryFilter.Patterns != nil {
+		c.QueryFilter.Patterns = file.QueryFilter.Patterns
+	}
+	if len(file.QueryFilter.Custom) > 0 {
+		c.QueryFilter.Custom = file.QueryFilter.Custom
+	}
+	if file.StatsD.Host != "" {
+		c.StatsD.Host = file.StatsD.Host
+	}
+	if file.StatsD.Port != 0 {
+		c.StatsD.Port = file.StatsD.Port
+	}
+	if file.StatsD.Prefix != "" {
+		c.StatsD.Prefix = file.StatsD.Prefix
+	}
+	if file.StatsD.Tags != nil {
+		c.StatsD.Tags = *file.StatsD.Tags
+	}
+	if file.Transport.Type != "" {
+		c.Transport = file.Transport.Type
+	}
+	if file.Transport.Host != "" {
+		c.Host = file.Transport.Host
+	}
+	if file.Transport.Port != 0 {
+		c.Port = file.Transport.Port
+	}
+	if file.Transport.TLSCertFile != "" {
+		c.TLSCertFile = file.Transport.TLSCertFile
+	}
+	if file.Transport.TLSKeyFile != "" {
+		c.TLSKeyFile = file.Transport.TLSKeyFile
+	}
+	if file.Transport.TLSClientCAFile != "" {
+		c.TLSClientCAFile = file.Transport.TLSClientCAFile
+	}
+	if limits := file.Transport.Limits; limits.MaxRequestBytes != 0 {
+		c.HTTPLimits.MaxRequestBytes = limits.MaxRequestBytes
+	}
+	if limits := file.Transport.Limits; limits.MaxHeaderBytes != 0 {
+		c.HTTPLimits.MaxHeaderBytes = limits.MaxHeaderBytes
+	}
+	for _, timeout := range []struct {
+		seconds *int
+		value   *time.Duration
+	}{
+		{file.Transport.Limits.ReadTimeoutSeconds, &c.HTTPLimits.ReadTimeout},
+		{file.Transport.Limits.WriteTimeoutSeconds, &c.HTTPLimits.WriteTimeout},
+		{file.Transport.Limits.IdleTimeoutSeconds, &c.HTTPLimits.IdleTimeout},
+	} {
+		if timeout.seconds != nil {
+			*timeout.value = time.Duration(*timeout.seconds) * time.Second
+		}
+	}
+	if file.Models.Allow != nil {
+		c.AllowedModels = file.Models.Allow
+	}
+	if file.Models.Deny != nil {
+		c.DeniedModels = file.Models.Deny
+	}
+	if file.Models.AllowUnknown != nil {
+		c.AllowUnknownModels = *file.Models.AllowUnknown
+	}
+	maps.Copy(c.ModelFallbacks, file.Models.Fallbacks)
+	maps.Copy(c.ModelPrices, file.Pricing)
+	for _, budget := range []struct {
+		file   *fileBudgetLimit
+		config *BudgetLimit
+	}{
+		{file.Budgets.DailyTokens, &c.Budgets.DailyTokens},
+		{file.Budgets.DailyUSD, &c.Budgets.DailyUSD},
+		{file.Budgets.MonthlyTokens, &c.Budgets.MonthlyTokens},
+		{file.Budgets.MonthlyUSD, &c.Budgets.MonthlyUSD},
+	} {
+		if budget.file != nil {
+			*budget.config = BudgetLimit(*budget.file)
+		}
+	}
+	if file.Sampling.Rate != nil {
+		c.QualitySampleRate = *file.Sampling.Rate
+	}
+	if file.RateLimit.PerMinute != nil {
+		c.RateLimitPerMinute = *file.RateLimit.PerMinute
+	}
+	if file.RateLimit.Concurrent != nil {
+		c.RateLimitConcurrent = *file.RateLimit.Concurrent
+	}
+	if file.Upstream.MaxConcurrentCalls != nil {
+		c.MaxConcurrentAPICalls = *file.Upstream.MaxConcurrentCalls
+	}
+	if file.Upstream.MaxQueueDepth != nil {
+		c.APIQueueMaxDepth = *file.Upstream.MaxQueueDepth
+	}
+	if file.Upstream.ShedWaitSeconds != nil {
+		c.APIQueueShedWait = time.Duration(*file.Upstream.ShedWaitSeconds) * time.Second
+	}
+	if file.Upstream.MaxIdleConns != nil {
+		c.APIConnectionPool.MaxIdleConns = *file.Upstream.MaxIdleConns
+	}
+	if file.Upstream.MaxIdleConnsPerHost != nil {
+		c.APIConnectionPool.MaxIdleConnsPerHost = *file.Upstream.MaxIdleConnsPerHost
+	}
+	if file.Upstream.IdleConnTimeoutSeconds != nil {
+		c.APIConnectionPool.IdleConnTimeout = time.Duration(*file.Upstream.IdleConnTimeoutSeconds) * time.Second
+	}
+	if file.Upstream.KeepAliveSeconds != nil {
+		c.APIConnectionPool.KeepAlive = time.Duration(*file.Upstream.KeepAliveSeconds) * time.Second
+	}
+	if file.Upstream.DisableKeepAlives != nil {
+		c.APIConnectionPool.DisableKeepAlives = *file.Upstream.DisableKeepAlives
+	}
+	if file.Upstream.RateLimitRetries != nil {
+		c.APIRetryPolicy.Retries = *file.Upstream.RateLimitRetries
+	}
+	if file.Upstream.MaxRetryWaitSeconds != nil {
+		c.APIRetryPolicy.MaxWait = time.Duration(*file.Upstream.MaxRetryWaitSeconds) * time.Second
+	}
+	if file.Upstream.MaxResponseBytes != 0 {
+		c.MaxResponseBytes = file.Upstream.MaxResponseBytes
+	}
+	if file.Provider.Type != "" {
+		c.Provider.Type = file.Provider.Type
+	}
+	if file.Provider.BaseURL != "" {
+		c.Provider.BaseURL = file.Provider.BaseURL
+	}
+	if file.Provider.Model != "" {
+		c.Provider.Model = file.Provider.Model
+	}
+	for name, tool := range file.Tools {
+		if tool.Enabled != nil {
+			c.DisabledTools[name] = !*tool.Enabled
+		}
+		if tool.Fallback != "" {
+			c.ToolFallbacks[name] = tool.Fallback
+		}
+		if tool.TimeoutSeconds != 0 {
+			c.ToolTimeouts[name] = time.Duration(tool.TimeoutSeconds) * time.Second
+		}
+		c.ToolDefaults[name] = ToolDefaults(tool.Defaults)
+	}
+
+	return nil
+}
+
+func countNonEmpty(values ...string) int {
+	count := 0
+	for _, value := range values {
+		if value != "" {
+			count++
+		}
+	}
+	return count
+}
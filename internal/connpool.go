@@ -0,0 +1,61 @@
+package internal
+
+import (
+	"fmt"
+	"net"
+	"net/http"
+	"time"
+)
+
+// Defaults for the connection pool of the API client. The per-host limit is
+// the one that matters, as every request goes to the same host.
+const (
+	DefaultAPIMaxIdleConns        = 100
+	DefaultAPIMaxIdleConnsPerHost = 16
+	DefaultAPIIdleConnTimeout     = 90 * time.Second
+	DefaultAPIKeepAlive           = 30 * time.Second
+)
+
+// apiDialTimeout bounds establishing a TCP connection to the API
+const apiDialTimeout = 30 * time.Second
+
+// ConnectionPool tunes how the API client reuses connections
+type ConnectionPool struct {
+	// MaxIdleConns bounds the idle connections kept across all hosts (0 is unlimited)
+	MaxIdleConns int
+	// MaxIdleConnsPerHost bounds the idle connections kept to the API host.
+	// Under concurrency higher than this, connections are closed after use
+	// and new ones opened, each with a TLS handshake.
+	MaxIdleConnsPerHost int
+	// IdleConnTimeout closes idle connections left unused this long (0 keeps them)
+	IdleConnTimeout time.Duration
+	// KeepAlive is the interval of TCP keep-alive probes (0 disables them)
+	KeepAlive time.Duration
+	// DisableKeepAlives opens a new connection for every request
+	DisableKeepAlives bool
+}
+
+// Validate rejects negative limits and a per-host limit below one connection
+func (p ConnectionPool) Validate() error {
+	if p.MaxIdleConns < 0 || p.MaxIdleConnsPerHost <= 0 {
+		return fmt.Errorf("API idle connection limits must be positive")
+	}
+	if p.IdleConnTimeout < 0 || p.KeepAlive < 0 {
+		return fmt.Errorf("API connection timeouts must not be negative")
+	}
+	return nil
+}
+
+// Apply sets the pool's limits and dialer on transport
+func (p ConnectionPool) Apply(transport *http.Transport) {
+	keepAlive := p.KeepAlive
+	if keepAlive == 0 {
+		// A zero net.Dialer.KeepAlive means the default interval, not disabled
+		keepAlive = -1
+	}
+	transport.DialContext = (&net.Dialer{Timeout: apiDialTimeout, KeepAlive: keepAlive}).DialContext
+	transport.MaxIdleConns = p.MaxIdleConns
+	transport.MaxIdleConnsPerHost = p.MaxIdleConnsPerHost
+	transport.IdleConnTimeout = p.IdleConnTimeout
+	transport.DisableKeepAlives = p.DisableKeepAlives
+}
@@ -0,0 +1,121 @@
+package internal
+
+import (
+	"fmt"
+	"net/url"
+	"slices"
+	"strings"
+)
+
+// Lengths of a DNS name and of each of its labels
+const (
+	maxDomainLength      = 253
+	maxDomainLabelLength = 63
+)
+
+// normalizeDomain converts an entry of sources or exclude_sources to the bare
+// domain search_domain_filter expects. It accepts URLs, ports, a trailing
+// dot and *.example.com wildcards, which the API already implies: a domain
+// filter matches its subdomains.
+func normalizeDomain(entry string) (string, error) {
+	domain := strings.ToLower(strings.TrimSpace(entry))
+	if strings.Contains(domain, "://") {
+		u, err := url.Parse(domain)
+		if err != nil || u.Host == "" {
+			return "", fmt.Errorf("invalid domain %q", entry)
+		}
+		domain = u.Host
+	}
+	domain, _, _ = strings.Cut(domain, "/")
+	if host, port, ok := strings.Cut(domain, ":"); ok && port != "" && strings.Trim(port, "0123456789") == "" {
+		domain = host
+	}
+	domain = strings.TrimPrefix(domain, "*.")
+	domain = strings.TrimSuffix(domain, ".")
+
+	if len(domain) > maxDomainLength {
+		return "", fmt.Errorf("invalid domain %q: longer than %d characters", entry, maxDomainLength)
+	}
+	labels := strings.Split(domain, ".")
+	if len(labels) < 2 {
+		return "", fmt.Errorf("invalid domain %q: expected a name like example.com", entry)
+	}
+	for _, label := range labels {
+		if err := checkDomainLabel(label); err != nil {
+			return "", fmt.Errorf("invalid domain %q: %w", entry, err)
+		}
+	}
+	return domain, nil
+}
+
+func checkDomainLabel(label string) error {
+	if label == "" || len(label) > maxDomainLabelLength {
+		return fmt.Errorf("labels must be 1 to %d characters", maxDomainLabelLength)
+	}
+	if label[0] == '-' || label[len(label)-1] == '-' {
+		return fmt.Errorf("labels cannot start or end with '-'")
+	}
+	for _, c := range label {
+		switch {
+		case c >= 'a' && c <= 'z', c >= '0' && c <= '9', c == '-':
+		case c > 127:
+			return fmt.Errorf("use the punycode (xn--) form of internationalized names")
+		default:
+			return fmt.Errorf("unexpected character %q", c)
+		}
+	}
+	return nil
+}
+
+// domainFilter returns the search_domain_filter of r: its normalized sources,
+// then its excluded domains with a "-" prefix, without duplicates. A source
+// given with the "-" prefix is excluded too.
+func (r *SearchRequest) domainFilter() ([]string, error) {
+	var included, excluded []string
+	add := func(field string, i int, entry string, exclude bool) error {
+		if strings.HasPrefix(strings.TrimSpace(entry), "-") {
+			entry, exclude = strings.TrimPrefix(strings.TrimSpace(entry), "-"), true
+		}
+		domain, err := normalizeDomain(entry)
+		if err != nil {
+			return fmt.Errorf("%s[%d]: %w", field, i, err)
+		}
+		if exclude {
+			if !slices.Contains(excluded, domain) {
+				excluded = append(excluded, domain)
+			}
+		} else if !slices.Contains(included, domain) {
+			included = append(included, domain)
+		}
+		return nil
+	}
+	for i, entry := range r.Sources {
+		if err := add("sources", i, entry, false); err != nil {
+			return nil, err
+		}
+	}
+	for i, entry := range r.ExcludeSources {
+		if err := add("exclude_sources", i, entry, true); err != nil {
+			return nil, err
+		}
+	}
+
+	for _, domain := range excluded {
+		if slices.Contains(included, domain) {
+			return nil, fmt.Errorf("domain %s is both included and excluded", domain)
+		}
+	}
+	maxFilters := r.MaxDomainFilters
+	if maxFilters <= 0 {
+		maxFilters = DefaultMaxDomainFilters
+	}
+	if n := len(included) + len(excluded); n > maxFilters {
+		return nil, fmt.Errorf("too many domains in sources and exclude_sources: %d > %d", n, maxFilters)
+	}
+
+	filter := included
+	for _, domain := range excluded {
+		filter = append(filter, "-"+domain)
+	}
+	return filter, nil
+}
@@ -0,0 +1,113 @@
+package internal
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestNormalizeDomain(t *testing.T) {
+	tests := []struct {
+		entry string
+		want  string
+		err   string
+	}{
+		{entry: "example.com", want: "example.com"},
+		{entry: "  Docs.Example.COM ", want: "docs.example.com"},
+		{entry: "https://www.example.com/path?q=1", want: "www.example.com"},
+		{entry: "example.com:8443/docs", want: "example.com"},
+		{entry: "*.example.com", want: "example.com"},
+		{entry: "example.com.", want: "example.com"},
+		{entry: "xn--bcher-kva.example", want: "xn--bcher-kva.example"},
+		{entry: "localhost", err: "expected a name like example.com"},
+		{entry: "exa_mple.com", err: "unexpected character '_'"},
+		{entry: "-example.com", err: "cannot start or end with '-'"},
+		{entry: "example..com", err: "labels must be 1 to 63 characters"},
+		{entry: strings.Repeat("a", 64) + ".com", err: "labels must be 1 to 63 characters"},
+		{entry: strings.Repeat("a.", 127) + "com", err: "longer than 253 characters"},
+		{entry: "bücher.example", err: "punycode"},
+		{entry: "https://", err: "invalid domain"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.entry, func(t *testing.T) {
+			got, err := normalizeDomain(tt.entry)
+			if tt.err != "" {
+				require.ErrorContains(t, err, tt.err)
+				return
+			}
+			require.NoError(t, err)
+			require.Equal(t, tt.want, got)
+		})
+	}
+}
+
+func TestSearchRequestDomainFilter(t *testing.T) {
+	tests := []struct {
+		name       string
+		sources    []string
+		exclude    []string
+		maxFilters int
+		want       []string
+		err        string
+	}{
+		{name: "none"},
+		{
+			name:    "included then excluded",
+			sources: []string{"https://arxiv.org/abs/1", "nature.com"},
+			exclude: []string{"reddit.com"},
+			want:    []string{"arxiv.org", "nature.com", "-reddit.com"},
+		},
+		{
+			name:    "duplicates dropped",
+			sources: []string{"Example.com", "*.example.com", "-spam.com"},
+			exclude: []string{"spam.com"},
+			want:    []string{"example.com", "-spam.com"},
+		},
+		{
+			name:    "included and excluded",
+			sources: []string{"example.com"},
+			exclude: []string{"www.example.com", "example.com"},
+			err:     "domain example.com is both included and excluded",
+		},
+		{
+			name:    "invalid entry",
+			exclude: []string{"ok.com", "not a domain"},
+			err:     "exclude_sources[1]: invalid domain",
+		},
+		{
+			name:       "over the limit",
+			sources:    []string{"a.com", "b.com"},
+			exclude:    []string{"c.com"},
+			maxFilters: 2,
+			err:        "too many domains in sources and exclude_sources: 3 > 2",
+		},
+		{
+			name:    "default limit",
+			sources: []string{"a.com", "b.com", "c.com", "d.com", "e.com", "f.com", "g.com", "h.com", "i.com", "j.com", "k.com"},
+			err:     "11 > 10",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := SearchRequest{Sources: tt.sources, ExcludeSources: tt.exclude, MaxDomainFilters: tt.maxFilters}
+			got, err := req.domainFilter()
+			if tt.err != "" {
+				require.ErrorContains(t, err, tt.err)
+				return
+			}
+			require.NoError(t, err)
+			require.Equal(t, tt.want, got)
+		})
+	}
+}
+
+func TestSearchRequestSendsDomainFilter(t *testing.T) {
+	client, err := NewPerplexityClient("test-key")
+	require.NoError(t, err)
+	apiReq := client.searchToAPIRequest(SearchRequest{Query: "q", Sources: []string{"https://Go.dev/doc"}, ExcludeSources: []string{"*.medium.com"}})
+	require.Equal(t, []string{"go.dev", "-medium.com"}, apiReq.SearchDomainFilter)
+
+	apiReq = client.searchToAPIRequest(SearchRequest{Query: "q"})
+	require.Nil(t, apiReq.SearchDomainFilter)
+}
@@ -0,0 +1,98 @@
+package internal
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+
+	"github.com/mark3labs/mcp-go/mcp"
+	"github.com/mark3labs/mcp-go/server"
+)
+
+// ErrDraining is returned for tool calls that arrive while the server shuts
+// down. The call was not started, so clients can safely retry it elsewhere or
+// once the server is back.
+var ErrDraining = errors.New("server is shutting down, retry the call")
+
+// Drainer tracks in-flight tool calls so shutdown can wait for them instead of
+// cutting off Perplexity requests that are already paid for
+type Drainer struct {
+	mu       sync.Mutex
+	draining bool
+	active   int
+	idle     chan struct{}
+}
+
+func NewDrainer() *Drainer {
+	return &Drainer{}
+}
+
+// Middleware counts in-flight tool calls and rejects new ones while draining
+func (d *Drainer) Middleware() server.ToolHandlerMiddleware {
+	return func(next server.ToolHandlerFunc) server.ToolHandlerFunc {
+		return func(ctx context.Context, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+			if !d.start() {
+				return &mcp.CallToolResult{
+					Content: []mcp.Content{
+						mcp.TextContent{
+							Type: "text",
+							Text: fmt.Sprintf("Call rejected: %s", ErrDraining.Error()),
+						},
+					},
+					IsError: true,
+				}, ErrDraining
+			}
+			defer d.done()
+
+			return next(ctx, request)
+		}
+	}
+}
+
+func (d *Drainer) start() bool {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	if d.draining {
+		return false
+	}
+	d.active++
+	return true
+}
+
+func (d *Drainer) done() {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	d.active--
+	if d.active == 0 && d.idle != nil {
+		close(d.idle)
+		d.idle = nil
+	}
+}
+
+// Drain stops accepting tool calls and waits until those in flight finish or
+// ctx is done. It returns the number of calls still running when it gave up.
+func (d *Drainer) Drain(ctx context.Context) int {
+	d.mu.Lock()
+	d.draining = true
+	if d.active == 0 {
+		d.mu.Unlock()
+		return 0
+	}
+	if d.idle == nil {
+		d.idle = make(chan struct{})
+	}
+	idle := d.idle
+	d.mu.Unlock()
+
+	select {
+	case <-idle:
+		return 0
+	case <-ctx.Done():
+		d.mu.Lock()
+		defer d.mu.Unlock()
+		return d.active
+	}
+}
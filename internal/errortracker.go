@@ -0,0 +1,300 @@
+package internal
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"runtime"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/mark3labs/mcp-go/mcp"
+	"github.com/mark3labs/mcp-go/server"
+)
+
+// Limits of error reports. Reports beyond errorReportsInFlight are dropped
+// rather than queued, so an outage of the tracker cannot pile up goroutines.
+const (
+	errorReportTimeout   = 5 * time.Second
+	errorReportsInFlight = 16
+	maxPanicValueLength  = 200
+)
+
+// Classes of reported failures, besides the types of APIErrorDetails
+const (
+	ErrorClassPanic     = "panic"
+	ErrorClassToolError = "tool_error"
+)
+
+// SentryConfig enables error reporting to Sentry or a compatible tracker
+type SentryConfig struct {
+	// DSN is the project's client key URL (empty disables reporting)
+	DSN string
+	// Environment names the deployment, such as production
+	Environment string
+}
+
+// sentryDSN is the parsed form of a DSN, such as https://key@host/42
+type sentryDSN struct {
+	endpoint  string
+	publicKey string
+}
+
+func parseSentryDSN(dsn string) (sentryDSN, error) {
+	u, err := url.Parse(dsn)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return sentryDSN{}, fmt.Errorf("invalid Sentry DSN: must be an http or https URL")
+	}
+	if u.User == nil || u.User.Username() == "" {
+		return sentryDSN{}, fmt.Errorf("invalid Sentry DSN: missing public key")
+	}
+	path := strings.TrimSuffix(u.Path, "/")
+	slash := strings.LastIndex(path, "/")
+	project := path[slash+1:]
+	if project == "" {
+		return sentryDSN{}, fmt.Errorf("invalid Sentry DSN: missing project ID")
+	}
+	endpoint := fmt.Sprintf("%s://%s%s/api/%s/envelope/", u.Scheme, u.Host, path[:slash], project)
+	return sentryDSN{endpoint: endpoint, publicKey: u.User.Username()}, nil
+}
+
+func (c SentryConfig) Validate() error {
+	if c.DSN == "" {
+		return nil
+	}
+	_, err := parseSentryDSN(c.DSN)
+	return err
+}
+
+// ErrorTracker reports failed tool calls and panics in tool handlers to Sentry.
+// Reports carry only the tool name, request ID, transport and error class, and
+// for panics the sanitized panic value and stack; arguments, queries and
+// answers are never sent.
+type ErrorTracker struct {
+	dsn         sentryDSN
+	environment string
+	client      *http.Client
+	logger      *slog.Logger
+
+	inFlight chan struct{}
+	wg       sync.WaitGroup
+}
+
+// NewErrorTracker returns a tracker for config, or nil when no DSN is set
+func NewErrorTracker(config SentryConfig) (*ErrorTracker, error) {
+	if config.DSN == "" {
+		return nil, nil
+	}
+	dsn, err := parseSentryDSN(config.DSN)
+	if err != nil {
+		return nil, err
+	}
+	return &ErrorTracker{
+		dsn:         dsn,
+		environment: config.Environment,
+		client:      &http.Client{Timeout: errorReportTimeout},
+		logger:      slog.Default().With("component", "errortracker"),
+		inFlight:    make(chan struct{}, errorReportsInFlight),
+	}, nil
+}
+
+// Middleware reports tool calls that fail, and recovers panics in the tools
+// below it, reporting them and failing the call instead of the server.
+// Register it right after RequestIDMiddleware, so API failures are seen before
+// they become error results and reports carry the request ID.
+func (t *ErrorTracker) Middleware(transport string) server.ToolHandlerMiddleware {
+	return func(next server.ToolHandlerFunc) server.ToolHandlerFunc {
+		return func(ctx context.Context, request mcp.CallToolRequest) (result *mcp.CallToolResult, err error) {
+			tool := request.Params.Name
+			defer func() {
+				if recovered := recover(); recovered != nil {
+					t.logger.ErrorContext(ctx, "Tool handler panicked", "tool", tool, "panic", fmt.Sprint(recovered))
+					t.report(ctx, tool, transport, ErrorClassPanic, panicException(recovered))
+					result, err = nil, fmt.Errorf("internal error in %s", tool)
+				}
+			}()
+
+			result, err = next(ctx, request)
+			if class := errorClass(ctx, err); class != "" {
+				t.report(ctx, tool, transport, class, nil)
+			}
+			return result, err
+		}
+	}
+}
+
+// errorClass names the kind of a tool call's error, or returns "" when it is
+// not worth an alert: no error, a cancelled call, a rate limit or a query
+// rejected by the outbound filter
+func errorClass(ctx context.Context, err error) string {
+	if err == nil || ctx.Err() != nil || errors.Is(err, ErrQueryBlocked) {
+		return ""
+	}
+	details := apiErrorDetails(err)
+	switch {
+	case details == nil:
+		return ErrorClassToolError
+	case details.Type == APIErrorRateLimited:
+		return ""
+	default:
+		return details.Type
+	}
+}
+
+// sentryException is the exception of a reported panic
+type sentryException struct {
+	Type       string           `json:"type"`
+	Value      string           `json:"value"`
+	Stacktrace *sentryStackRoot `json:"stacktrace,omitempty"`
+}
+
+type sentryStackRoot struct {
+	Frames []sentryFrame `json:"frames"`
+}
+
+type sentryFrame struct {
+	Function string `json:"function"`
+	Filename string `json:"filename"`
+	Lineno   int    `json:"lineno"`
+	InApp    bool   `json:"in_app"`
+}
+
+// panicException describes a recovered panic with the stack of the goroutine
+// that panicked, oldest frame first as Sentry expects
+func panicException(recovered any) *sentryException {
+	pcs := make([]uintptr, 64)
+	n := runtime.Callers(3, pcs)
+	frames := runtime.CallersFrames(pcs[:n])
+
+	var stack []sentryFrame
+	for {
+		frame, more := frames.Next()
+		stack = append(stack, sentryFrame{
+			Function: frame.Function,
+			Filename: frame.File,
+			Lineno:   frame.Line,
+			InApp:    strings.HasPrefix(frame.Function, "github.com/passingbreeze-bonfire/perplexity-mcp-golang/"),
+		})
+		if !more {
+			break
+		}
+	}
+	for i, j := 0, len(stack)-1; i < j; i, j = i+1, j-1 {
+		stack[i], stack[j] = stack[j], stack[i]
+	}
+	return &sentryException{
+		Type:       ErrorClassPanic,
+		Value:      truncateRunes(redactLogText(fmt.Sprint(recovered)), maxPanicValueLength),
+		Stacktrace: &sentryStackRoot{Frames: stack},
+	}
+}
+
+// report sends an event in the background; it is dropped when too many
+// reports are in flight
+func (t *ErrorTracker) report(ctx context.Context, tool, transport, class string, exception *sentryException) {
+	select {
+	case t.inFlight <- struct{}{}:
+	default:
+		t.logger.WarnContext(ctx, "Error report dropped", "tool", tool, "class", class)
+		return
+	}
+
+	level := "error"
+	if exception == nil {
+		exception = &sentryException{Type: class, Value: fmt.Sprintf("%s failed", tool)}
+	} else {
+		level = "fatal"
+	}
+	event := map[string]any{
+		"event_id":    newEventID(),
+		"timestamp":   time.Now().UTC().Format(time.RFC3339Nano),
+		"level":       level,
+		"platform":    "go",
+		"logger":      ServerName,
+		"release":     ServerName + "@" + ServerVersion,
+		"environment": t.environment,
+		"message":     map[string]string{"formatted": fmt.Sprintf("%s: %s", tool, class)},
+		"exception":   map[string]any{"values": []*sentryException{exception}},
+		// Grouping by tool and class turns a regression into one issue
+		"fingerprint": []string{tool, class},
+		"tags": map[string]string{
+			"tool":        tool,
+			"request_id":  RequestIDFromContext(ctx),
+			"transport":   transport,
+			"error_class": class,
+		},
+	}
+
+	t.wg.Add(1)
+	go func() {
+		defer func() {
+			<-t.inFlight
+			t.wg.Done()
+		}()
+		if err := t.send(event); err != nil {
+			t.logger.WarnContext(ctx, "Failed to send error report", "error", err)
+		}
+	}()
+}
+
+// send posts event as a Sentry envelope
+func (t *ErrorTracker) send(event map[string]any) error {
+	header, err := json.Marshal(map[string]any{"event_id": event["event_id"], "sent_at": time.Now().UTC().Format(time.RFC3339Nano)})
+	if err != nil {
+		return err
+	}
+	payload, err := json.Marshal(event)
+	if err != nil {
+		return err
+	}
+	var body bytes.Buffer
+	body.Write(header)
+	body.WriteString("\n{\"type\":\"event\"}\n")
+	body.Write(payload)
+	body.WriteByte('\n')
+
+	req, err := http.NewRequest(http.MethodPost, t.dsn.endpoint, &body)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/x-sentry-envelope")
+	req.Header.Set("X-Sentry-Auth", fmt.Sprintf("Sentry sentry_version=7, sentry_client=%s/%s, sentry_key=%s", ServerName, ServerVersion, t.dsn.publicKey))
+
+	resp, err := t.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer func() { _ = resp.Body.Close() }()
+	if resp.StatusCode >= 300 {
+		return fmt.Errorf("tracker responded with HTTP %d", resp.StatusCode)
+	}
+	return nil
+}
+
+// Flush waits for reports in flight until ctx is done
+func (t *ErrorTracker) Flush(ctx context.Context) {
+	done := make(chan struct{})
+	go func() {
+		t.wg.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-ctx.Done():
+	}
+}
+
+// newEventID returns a random 32-character hex event ID
+func newEventID() string {
+	b := make([]byte, 16)
+	_, _ = rand.Read(b)
+	return hex.EncodeToString(b)
+}
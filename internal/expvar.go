@@ -0,0 +1,94 @@
+package internal
+
+import (
+	"expvar"
+	"runtime"
+	"runtime/debug"
+	"sync"
+	"time"
+)
+
+// ExpvarPath serves the expvar variables on the admin API
+const ExpvarPath = "/debug/vars"
+
+// BuildInfo describes the running binary
+type BuildInfo struct {
+	Name      string `json:"name"`
+	Version   string `json:"version"`
+	GoVersion string `json:"go_version"`
+	Module    string `json:"module,omitempty"`
+	Revision  string `json:"vcs_revision,omitempty"`
+	Time      string `json:"vcs_time,omitempty"`
+	Modified  bool   `json:"vcs_modified,omitempty"`
+}
+
+// RuntimeStats is a summary of the Go runtime, next to the full memstats
+// variable expvar publishes itself
+type RuntimeStats struct {
+	Goroutines    int     `json:"goroutines"`
+	GOMAXPROCS    int     `json:"gomaxprocs"`
+	NumCPU        int     `json:"num_cpu"`
+	HeapAllocMB   float64 `json:"heap_alloc_mb"`
+	NumGC         uint32  `json:"num_gc"`
+	UptimeSeconds int64   `json:"uptime_seconds"`
+}
+
+// CounterStats are the basic counters of the perplexity://stats resource
+type CounterStats struct {
+	ByTransport map[string]TransportStats `json:"by_transport"`
+	Usage       UsageTotals               `json:"usage"`
+	APICalls    APICallStats              `json:"api_calls"`
+}
+
+var publishExpvarsOnce sync.Once
+
+// PublishExpvars publishes the build, runtime and counters variables served
+// at ExpvarPath. expvar variables are process-wide, so only the first call
+// publishes.
+func PublishExpvars(stats *RequestStats, usage *UsageTracker, limiter *APILimiter) {
+	publishExpvarsOnce.Do(func() {
+		build := buildInfo()
+		expvar.Publish("build", expvar.Func(func() any { return build }))
+		expvar.Publish("runtime", expvar.Func(func() any { return runtimeStats(stats.started) }))
+		expvar.Publish("counters", expvar.Func(func() any {
+			return CounterStats{
+				ByTransport: stats.Snapshot().ByTransport,
+				Usage:       usage.Summary().Total,
+				APICalls:    limiter.Stats(),
+			}
+		}))
+	})
+}
+
+func buildInfo() BuildInfo {
+	info := BuildInfo{Name: ServerName, Version: ServerVersion, GoVersion: runtime.Version()}
+	build, ok := debug.ReadBuildInfo()
+	if !ok {
+		return info
+	}
+	info.Module = build.Main.Path
+	for _, setting := range build.Settings {
+		switch setting.Key {
+		case "vcs.revision":
+			info.Revision = setting.Value
+		case "vcs.time":
+			info.Time = setting.Value
+		case "vcs.modified":
+			info.Modified = setting.Value == "true"
+		}
+	}
+	return info
+}
+
+func runtimeStats(started time.Time) RuntimeStats {
+	var mem runtime.MemStats
+	runtime.ReadMemStats(&mem)
+	return RuntimeStats{
+		Goroutines:    runtime.NumGoroutine(),
+		GOMAXPROCS:    runtime.GOMAXPROCS(0),
+		NumCPU:        runtime.NumCPU(),
+		HeapAllocMB:   float64(mem.HeapAlloc) / (1024 * 1024),
+		NumGC:         mem.NumGC,
+		UptimeSeconds: int64(time.Since(started).Seconds()),
+	}
+}
@@ -0,0 +1,101 @@
+package internal
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"strings"
+
+	"github.com/mark3labs/mcp-go/mcp"
+)
+
+// Fallback modes select what a tool returns once an upstream call has failed
+const (
+	// FallbackError returns the error to the client
+	FallbackError = "error"
+	// FallbackStale returns the last answer to the same request, marked stale
+	FallbackStale = "stale"
+	// FallbackUnavailable returns the configured "service unavailable" answer
+	FallbackUnavailable = "unavailable"
+)
+
+// DefaultUnavailableMessage is the answer returned by the unavailable fallback.
+// {tool} and {query} are replaced with the tool name and the query.
+const DefaultUnavailableMessage = "Perplexity is temporarily unavailable, so {tool} could not answer \"{query}\". Please try again later."
+
+// queryKey identifies requests that ask the same question, so the stale
+// fallback only ever returns an answer to an identical request
+func queryKey(req SearchRequest) string {
+	fields := []any{
+		req.Model,
+		strings.ToLower(strings.TrimSpace(req.Query)),
+		req.SystemPrompt,
+		req.ContextMessages,
+		req.SearchMode,
+		req.DateRange,
+		req.Sources,
+		req.UserLocation,
+	}
+	// Appended only when set, so the keys of stored answers stay valid
+	if len(req.ExcludeSources) > 0 {
+		fields = append(fields, req.ExcludeSources)
+	}
+	data, _ := json.Marshal(fields)
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:])
+}
+
+// degradedResult applies the tool's configured fallback after the upstream call
+// for req failed with err. format renders a stale answer the way the tool
+// renders fresh ones, as text and structured content; stale answers are taken
+// from those of the calling client. It returns nil when the error should be
+// reported as is.
+func degradedResult(ctx context.Context, config *Config, tool string, results *ResultStore, req SearchRequest, err error, format func(*SearchResult) (string, any, error)) *mcp.CallToolResult {
+	// A blocked query is refused, not answered from the cache
+	if errors.Is(err, ErrQueryBlocked) {
+		return nil
+	}
+	degraded := map[string]any{
+		"mode":   config.Fallback(tool),
+		"reason": err.Error(),
+	}
+
+	fields := map[string]any{"degraded": degraded}
+	var text string
+	var data any
+	switch config.Fallback(tool) {
+	case FallbackStale:
+		cached, ok := results.Latest(queryKey(req), clientIdentity(ctx))
+		if !ok {
+			return nil
+		}
+		stale := *cached
+		stale.Stale = true
+		content, structured, formatErr := format(&stale)
+		if formatErr != nil {
+			return nil
+		}
+		text, data = content, structured
+		degraded["answered_at"] = cached.Created
+		usageMeta(fields, config.ModelPrices, []*SearchResult{&stale})
+	case FallbackUnavailable:
+		text = strings.NewReplacer("{tool}", tool, "{query}", req.Query).Replace(config.UnavailableMessage)
+		data = map[string]any{"content": text}
+	default:
+		return nil
+	}
+
+	return &mcp.CallToolResult{
+		Content: []mcp.Content{
+			mcp.TextContent{
+				Type: "text",
+				Text: text,
+			},
+		},
+		StructuredContent: data,
+		IsError:           false,
+		Result:            mcp.Result{Meta: &mcp.Meta{AdditionalFields: fields}},
+	}
+}
@@ -0,0 +1,87 @@
+package internal
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+
+	"github.com/mark3labs/mcp-go/mcp"
+)
+
+// Server identity reported to MCP clients
+const (
+	ServerName    = "perplexity-mcp-server"
+	ServerVersion = "1.0.0"
+)
+
+// FeaturesURI is the resource URI of the server's feature manifest
+const FeaturesURI = "perplexity://features"
+
+// FeatureManifest describes which optional capabilities this server build and
+// configuration provide, so clients can feature-detect instead of hard-coding
+// assumptions about a deployment. Update it whenever a capability is added.
+type FeatureManifest struct {
+	Server   string          `json:"server"`
+	Version  string          `json:"version"`
+	Features map[string]bool `json:"features"`
+}
+
+// NewFeatureManifest builds the manifest for the running configuration
+func NewFeatureManifest(config *Config) FeatureManifest {
+	return FeatureManifest{
+		Server:  ServerName,
+		Version: ServerVersion,
+		Features: map[string]bool{
+			"streaming":         false,
+			"sessions":          true,
+			"notebooks":         true,
+			"result_resources":  true,
+			"persistence":       config.StoragePath != "",
+			"cache":             true,
+			"sections":          true,
+			"markdown_output":   true,
+			"structured_output": true,
+			"user_location":     config.Provider.Type == ProviderPerplexity,
+			"web_search":        config.Provider.Type == ProviderPerplexity,
+			"images":            config.Provider.Type == ProviderPerplexity,
+			"async":             config.ToolEnabled("perplexity_research_async"),
+			"batch":             config.ToolEnabled("perplexity_batch_search"),
+			"slow_call_notice":  config.SlowCallWarning > 0,
+			"stats":             true,
+			"prompts":           true,
+			"usage":             true,
+			"annotations":       config.ToolEnabled("perplexity_annotate"),
+			"review_queue":      config.QualitySampleRate > 0,
+			"query_filter":      config.QueryFilter.Action != QueryFilterOff,
+			"redactions":        len(config.ResponseRedactions) > 0,
+		},
+	}
+}
+
+// CreateFeaturesResource creates the perplexity://features resource
+func CreateFeaturesResource() mcp.Resource {
+	return mcp.NewResource(
+		FeaturesURI,
+		"Feature manifest",
+		mcp.WithResourceDescription("Machine-readable list of the capabilities supported by this server"),
+		mcp.WithMIMEType("application/json"),
+	)
+}
+
+// FeaturesResourceHandler creates the resources/read handler for the feature manifest
+func FeaturesResourceHandler(manifest FeatureManifest) func(ctx context.Context, request mcp.ReadResourceRequest) ([]mcp.ResourceContents, error) {
+	return func(ctx context.Context, request mcp.ReadResourceRequest) ([]mcp.ResourceContents, error) {
+		jsonBytes, err := json.MarshalIndent(manifest, "", "  ")
+		if err != nil {
+			return nil, fmt.Errorf("failed to marshal feature manifest: %w", err)
+		}
+
+		return []mcp.ResourceContents{
+			mcp.TextResourceContents{
+				URI:      request.Params.URI,
+				MIMEType: "application/json",
+				Text:     string(jsonBytes),
+			},
+		}, nil
+	}
+}
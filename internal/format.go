@@ -0,0 +1,168 @@
+package internal
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// citationMarkerPattern matches inline [n] citation markers in answer text
+var citationMarkerPattern = regexp.MustCompile(`\[(\d+)\]`)
+
+// formatSearchResultAsMarkdown renders SearchResult as a markdown document for MCP response
+func formatSearchResultAsMarkdown(result *SearchResult, req *SearchRequest) string {
+	var b strings.Builder
+
+	if result.Stale {
+		fmt.Fprintf(&b, "> **Stale answer** from %s: Perplexity is currently unavailable.\n\n", result.Created.UTC().Format(time.RFC3339))
+	}
+	if result.RequestedModel != "" {
+		fmt.Fprintf(&b, "> Answered by %s: %s is currently unavailable.\n\n", result.Model, result.RequestedModel)
+	}
+	if rewrite := result.QueryRewrite; rewrite != nil && rewrite.Rewritten != rewrite.Original {
+		fmt.Fprintf(&b, "> Searched as: %s\n\n", rewrite.Rewritten)
+	}
+
+	if !req.SourcesOnly {
+		content := result.Content
+		switch req.CitationStyle {
+		case CitationStyleLinks:
+			content = expandCitationLinks(content, result.Citations)
+		case CitationStyleFootnotes:
+			content = expandCitationFootnotes(content, result.Citations)
+		}
+		b.WriteString(content)
+		b.WriteString("\n\n")
+		if t := result.Truncation; t != nil {
+			fmt.Fprintf(&b, "_Answer truncated at %d of %d characters. Read the rest from %s_\n\n", t.ReturnedChars, t.TotalChars, t.ContinuationURI)
+		}
+	}
+
+	if req.CitationStyle == CitationStyleFootnotes && len(result.Citations) > 0 {
+		// Footnote definitions render as the document's reference list
+		for _, citation := range result.Citations {
+			fmt.Fprintf(&b, "[^%d]: [%s](%s)%s%s\n", citation.Number, citationTitle(citation), citation.URL, citationIdentifiers(citation), citationStatus(citation))
+		}
+	} else if len(result.Citations) > 0 {
+		b.WriteString("## Citations\n\n")
+		for _, citation := range result.Citations {
+			fmt.Fprintf(&b, "%d. [%s](%s)%s%s\n", citation.Number, citationTitle(citation), citation.URL, citationIdentifiers(citation), citationStatus(citation))
+		}
+	}
+
+	if len(result.Sources) > 0 {
+		b.WriteString("\n## Sources\n\n")
+		for _, source := range result.Sources {
+			title := source.Title
+			if title == "" {
+				title = source.URL
+			}
+			fmt.Fprintf(&b, "- [%s](%s)", title, source.URL)
+			if source.Snippet != "" {
+				fmt.Fprintf(&b, ": %s", source.Snippet)
+			}
+			b.WriteString("\n")
+		}
+	}
+
+	if len(result.Images) > 0 {
+		formatImages(&b, result.Images)
+	}
+
+	if result.ID != "" {
+		fmt.Fprintf(&b, "\n_Full result: %s_\n", SearchURI(result.ID))
+	}
+
+	return strings.TrimSpace(b.String())
+}
+
+// citationTitle is the link text of a citation, its URL when it has no title
+func citationTitle(citation Citation) string {
+	if citation.Title == "" {
+		return citation.URL
+	}
+	return citation.Title
+}
+
+// citationIdentifiers lists the DOI and arXiv ID of a citation
+func citationIdentifiers(citation Citation) string {
+	var ids string
+	if citation.DOI != "" {
+		ids += " doi:" + citation.DOI
+	}
+	if citation.ArXivID != "" {
+		ids += " arXiv:" + citation.ArXivID
+	}
+	return ids
+}
+
+// citationStatus flags a citation whose link check failed
+func citationStatus(citation Citation) string {
+	switch {
+	case citation.Reachable == nil || *citation.Reachable:
+		return ""
+	case citation.Status == 0:
+		return " _(unreachable)_"
+	default:
+		return fmt.Sprintf(" _(unreachable: HTTP %d)_", citation.Status)
+	}
+}
+
+// expandCitationLinks rewrites inline [n] markers into markdown links pointing at
+// the matching citation URL. Markers without a matching citation and markers that
+// are already part of a link are left untouched.
+func expandCitationLinks(content string, citations []Citation) string {
+	return replaceCitationMarkers(content, citations, func(marker string, number int, url string) string {
+		return fmt.Sprintf("[%s](%s)", marker, url)
+	})
+}
+
+// expandCitationFootnotes rewrites inline [n] markers into markdown footnote
+// references [^n], defined by the citation list, under the same rules as
+// expandCitationLinks
+func expandCitationFootnotes(content string, citations []Citation) string {
+	return replaceCitationMarkers(content, citations, func(marker string, number int, url string) string {
+		return fmt.Sprintf("[^%d]", number)
+	})
+}
+
+// replaceCitationMarkers replaces each [n] marker that has a matching citation
+// URL and is not already part of a link with the output of replace
+func replaceCitationMarkers(content string, citations []Citation, replace func(marker string, number int, url string) string) string {
+	if len(citations) == 0 {
+		return content
+	}
+
+	urls := make(map[int]string, len(citations))
+	for _, citation := range citations {
+		if citation.URL != "" {
+			urls[citation.Number] = citation.URL
+		}
+	}
+
+	matches := citationMarkerPattern.FindAllStringSubmatchIndex(content, -1)
+	if len(matches) == 0 {
+		return content
+	}
+
+	var b strings.Builder
+	last := 0
+	for _, m := range matches {
+		start, end := m[0], m[1]
+		alreadyLinked := (start > 0 && content[start-1] == '[') ||
+			(end < len(content) && content[end] == '(')
+		number, err := strconv.Atoi(content[m[2]:m[3]])
+		url, ok := urls[number]
+		if alreadyLinked || err != nil || !ok {
+			continue
+		}
+		b.WriteString(content[last:start])
+		b.WriteString(replace(content[start:end], number, url))
+		last = end
+	}
+	b.WriteString(content[last:])
+
+	return b.String()
+}
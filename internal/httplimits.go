@@ -0,0 +1,73 @@
+package internal
+
+import (
+	"fmt"
+	"net/http"
+	"time"
+)
+
+// Defaults for the HTTP transport's protections against slow or oversized requests
+const (
+	DefaultHTTPMaxRequestBytes = 1 << 20
+	DefaultHTTPMaxHeaderBytes  = 64 << 10
+	DefaultHTTPReadTimeout     = 30 * time.Second
+	DefaultHTTPIdleTimeout     = 120 * time.Second
+)
+
+// httpReadHeaderTimeout bounds how long a client may take to send its headers
+const httpReadHeaderTimeout = 10 * time.Second
+
+// HTTPLimits protects the HTTP transport from broken or malicious clients.
+// Zero timeouts are disabled.
+type HTTPLimits struct {
+	// MaxRequestBytes is the largest request body accepted
+	MaxRequestBytes int64
+	// MaxHeaderBytes is the largest size of the request line and headers
+	MaxHeaderBytes int
+	// ReadTimeout bounds reading a whole request, body included
+	ReadTimeout time.Duration
+	// WriteTimeout bounds writing the response to a POST. It does not apply to
+	// the long-lived GET event stream, so it must exceed the slowest tool call.
+	WriteTimeout time.Duration
+	// IdleTimeout closes keep-alive connections left unused this long
+	IdleTimeout time.Duration
+}
+
+// Validate rejects size limits below one byte and negative timeouts
+func (l HTTPLimits) Validate() error {
+	if l.MaxRequestBytes <= 0 || l.MaxHeaderBytes <= 0 {
+		return fmt.Errorf("HTTP request and header size limits must be positive")
+	}
+	if l.ReadTimeout < 0 || l.WriteTimeout < 0 || l.IdleTimeout < 0 {
+		return fmt.Errorf("HTTP timeouts must not be negative")
+	}
+	return nil
+}
+
+// Apply sets the server's header limit and connection timeouts
+func (l HTTPLimits) Apply(server *http.Server) {
+	server.MaxHeaderBytes = l.MaxHeaderBytes
+	server.ReadHeaderTimeout = httpReadHeaderTimeout
+	server.ReadTimeout = l.ReadTimeout
+	server.IdleTimeout = l.IdleTimeout
+}
+
+// Handler refuses request bodies over MaxRequestBytes with 413 Request Entity
+// Too Large and applies WriteTimeout to responses other than event streams
+func (l HTTPLimits) Handler(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.ContentLength > l.MaxRequestBytes {
+			writeJSON(w, http.StatusRequestEntityTooLarge, map[string]string{
+				"error": fmt.Sprintf("request body exceeds %d bytes", l.MaxRequestBytes),
+			})
+			return
+		}
+		// Bodies without a Content-Length fail to decode once they pass the limit
+		r.Body = http.MaxBytesReader(w, r.Body, l.MaxRequestBytes)
+
+		if l.WriteTimeout > 0 && r.Method != http.MethodGet {
+			_ = http.NewResponseController(w).SetWriteDeadline(time.Now().Add(l.WriteTimeout))
+		}
+		next.ServeHTTP(w, r)
+	})
+}
@@ -0,0 +1,82 @@
+package internal
+
+import (
+	"fmt"
+	"regexp"
+	"slices"
+	"strings"
+)
+
+// MaxImageFormatFilters bounds the formats of image_format_filter
+const MaxImageFormatFilters = 10
+
+// imageFormatPattern matches an image file extension such as svg or jpeg
+var imageFormatPattern = regexp.MustCompile(`^[a-z0-9]{2,5}$`)
+
+// Image is an image returned with an answer when return_images is set
+type Image struct {
+	ImageURL  string `json:"image_url"`
+	OriginURL string `json:"origin_url,omitempty"`
+	Height    int    `json:"height,omitempty"`
+	Width     int    `json:"width,omitempty"`
+}
+
+// imageFilters returns the normalized image_domain_filter and
+// image_format_filter of the request. Domains are normalized like sources,
+// keeping a leading "-" that excludes them; formats are lowercased file
+// extensions without a dot.
+func (r *SearchRequest) imageFilters() ([]string, []string, error) {
+	if !r.ReturnImages && (len(r.ImageDomainFilter) > 0 || len(r.ImageFormatFilter) > 0) {
+		return nil, nil, fmt.Errorf("image_domain_filter and image_format_filter require return_images")
+	}
+
+	maxFilters := r.MaxDomainFilters
+	if maxFilters <= 0 {
+		maxFilters = DefaultMaxDomainFilters
+	}
+	if len(r.ImageDomainFilter) > maxFilters {
+		return nil, nil, fmt.Errorf("too many domains in image_domain_filter: %d > %d", len(r.ImageDomainFilter), maxFilters)
+	}
+	var domains []string
+	for i, entry := range r.ImageDomainFilter {
+		entry = strings.TrimSpace(entry)
+		prefix := ""
+		if strings.HasPrefix(entry, "-") {
+			entry, prefix = entry[1:], "-"
+		}
+		domain, err := normalizeDomain(entry)
+		if err != nil {
+			return nil, nil, fmt.Errorf("image_domain_filter[%d]: %w", i, err)
+		}
+		if !slices.Contains(domains, prefix+domain) {
+			domains = append(domains, prefix+domain)
+		}
+	}
+
+	if len(r.ImageFormatFilter) > MaxImageFormatFilters {
+		return nil, nil, fmt.Errorf("too many formats in image_format_filter: %d > %d", len(r.ImageFormatFilter), MaxImageFormatFilters)
+	}
+	var formats []string
+	for i, entry := range r.ImageFormatFilter {
+		format := strings.TrimPrefix(strings.ToLower(strings.TrimSpace(entry)), ".")
+		if !imageFormatPattern.MatchString(format) {
+			return nil, nil, fmt.Errorf("image_format_filter[%d]: invalid image format %q, expected an extension like svg", i, entry)
+		}
+		if !slices.Contains(formats, format) {
+			formats = append(formats, format)
+		}
+	}
+	return domains, formats, nil
+}
+
+// formatImages renders the images of an answer as a markdown list
+func formatImages(b *strings.Builder, images []Image) {
+	b.WriteString("\n## Images\n\n")
+	for _, image := range images {
+		fmt.Fprintf(b, "- ![](%s)", image.ImageURL)
+		if image.OriginURL != "" {
+			fmt.Fprintf(b, " from %s", image.OriginURL)
+		}
+		b.WriteString("\n")
+	}
+}
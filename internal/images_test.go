@@ -0,0 +1,79 @@
+package internal
+
+import (
+	"context"
+	"net/http"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestSearchRequestImageFilters(t *testing.T) {
+	tests := []struct {
+		name    string
+		req     SearchRequest
+		domains []string
+		formats []string
+		err     string
+	}{
+		{name: "none"},
+		{
+			name:    "normalized",
+			req:     SearchRequest{ReturnImages: true, ImageDomainFilter: []string{"https://commons.Wikimedia.org/wiki", "-gettyimages.com", "wikimedia.org"}, ImageFormatFilter: []string{".SVG", "png", "svg"}},
+			domains: []string{"commons.wikimedia.org", "-gettyimages.com", "wikimedia.org"},
+			formats: []string{"svg", "png"},
+		},
+		{
+			name: "filters without return_images",
+			req:  SearchRequest{ImageFormatFilter: []string{"svg"}},
+			err:  "image_domain_filter and image_format_filter require return_images",
+		},
+		{
+			name: "invalid domain",
+			req:  SearchRequest{ReturnImages: true, ImageDomainFilter: []string{"ok.com", "-not a domain"}},
+			err:  "image_domain_filter[1]: invalid domain",
+		},
+		{
+			name: "invalid format",
+			req:  SearchRequest{ReturnImages: true, ImageFormatFilter: []string{"image/svg+xml"}},
+			err:  `image_format_filter[0]: invalid image format "image/svg+xml"`,
+		},
+		{
+			name: "too many domains",
+			req:  SearchRequest{ReturnImages: true, ImageDomainFilter: []string{"a.com", "b.com"}, MaxDomainFilters: 1},
+			err:  "too many domains in image_domain_filter: 2 > 1",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			domains, formats, err := tt.req.imageFilters()
+			if tt.err != "" {
+				require.ErrorContains(t, err, tt.err)
+				return
+			}
+			require.NoError(t, err)
+			require.Equal(t, tt.domains, domains)
+			require.Equal(t, tt.formats, formats)
+		})
+	}
+}
+
+func TestSearchReturnsImages(t *testing.T) {
+	client := testClient(t, http.StatusOK, []byte(`{
+		"id": "r1",
+		"model": "sonar",
+		"choices": [{"message": {"role": "assistant", "content": "A diagram."}}],
+		"images": [{"image_url": "https://upload.wikimedia.org/a.svg", "origin_url": "https://en.wikipedia.org/wiki/A", "height": 300, "width": 400}]
+	}`))
+
+	req := SearchRequest{Query: "q", ReturnImages: true, ImageDomainFilter: []string{"wikimedia.org"}, ImageFormatFilter: []string{"svg"}}
+	apiReq := client.searchToAPIRequest(req)
+	require.True(t, apiReq.ReturnImages)
+	require.Equal(t, []string{"wikimedia.org"}, apiReq.ImageDomainFilter)
+	require.Equal(t, []string{"svg"}, apiReq.ImageFormatFilter)
+
+	result, err := client.Search(context.Background(), req)
+	require.NoError(t, err)
+	require.Equal(t, []Image{{ImageURL: "https://upload.wikimedia.org/a.svg", OriginURL: "https://en.wikipedia.org/wiki/A", Height: 300, Width: 400}}, result.Images)
+	require.Contains(t, formatSearchResultAsMarkdown(result, &req), "## Images\n\n- ![](https://upload.wikimedia.org/a.svg) from https://en.wikipedia.org/wiki/A")
+}
@@ -0,0 +1,849 @@
+package internal
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"regexp"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/mark3labs/mcp-go/mcp"
+)
+
+// Research job states
+const (
+	JobRunning   = "running"
+	JobCompleted = "completed"
+	JobFailed    = "failed"
+	JobCancelled = "cancelled"
+)
+
+// JobStatuses lists the states a job can be in
+var JobStatuses = []string{JobRunning, JobCompleted, JobFailed, JobCancelled}
+
+// Job defaults used when not configured
+const (
+	DefaultJobTTL  = time.Hour
+	DefaultMaxJobs = 100
+)
+
+// JobURIPrefix is the URI scheme of research job resources
+const JobURIPrefix = "job://"
+
+// ErrTooManyJobs is returned when a job cannot start because MaxJobs jobs are
+// still running. It can be retried once one of them finishes.
+var ErrTooManyJobs = errors.New("too many research jobs running")
+
+var jobIDPattern = regexp.MustCompile(`^job_[0-9a-f]{16}$`)
+
+func validateJobID(id string) error {
+	if !jobIDPattern.MatchString(id) {
+		return fmt.Errorf("invalid job_id: %s", id)
+	}
+	return nil
+}
+
+// Job is a search run in the background, so calls that take longer than the
+// client's tool call timeout can be started now and read later
+type Job struct {
+	ID       string     `json:"job_id"`
+	Status   string     `json:"status"`
+	Query    string     `json:"query"`
+	Model    string     `json:"model"`
+	Created  time.Time  `json:"created"`
+	Finished *time.Time `json:"finished,omitempty"`
+	// ResultID is the stored result of a completed job
+	ResultID string `json:"result_id,omitempty"`
+	Error    string `json:"error,omitempty"`
+	// CallbackURL is sent the job when it finishes
+	CallbackURL string `json:"callback_url,omitempty"`
+	// Owner is the identity of the HTTP client that started the job, which
+	// alone may read or cancel it (empty over stdio)
+	Owner string `json:"owner,omitempty"`
+
+	req    SearchRequest
+	result *SearchResult
+	cancel context.CancelFunc
+}
+
+// JobManager runs research jobs and keeps them in memory, and in storage when
+// configured. Finished jobs expire after ttl, and at most maxJobs are kept:
+// the oldest finished job makes room for a new one, and a new job is refused
+// while all of them are running.
+type JobManager struct {
+	mu      sync.Mutex
+	jobs    map[string]*Job
+	order   []string
+	ttl     time.Duration
+	maxJobs int
+	now     func() time.Time
+	storage *Storage
+	// onFinish is told about each job that completes, fails or is cancelled
+	onFinish func(Job)
+}
+
+func NewJobManager(ttl time.Duration, maxJobs int) *JobManager {
+	if ttl <= 0 {
+		ttl = DefaultJobTTL
+	}
+	if maxJobs <= 0 {
+		maxJobs = DefaultMaxJobs
+	}
+	return &JobManager{
+		jobs:    make(map[string]*Job),
+		ttl:     ttl,
+		maxJobs: maxJobs,
+		now:     time.Now,
+	}
+}
+
+// UseStorage restores unexpired jobs from storage and persists every later
+// change. It returns the jobs that were running when the server stopped, whose
+// API requests were lost; they stay running until ResumeJobs sends them again.
+func (m *JobManager) UseStorage(storage *Storage) ([]Job, error) {
+	records, err := storage.loadJobs()
+	if err != nil {
+		return nil, err
+	}
+	slices.SortFunc(records, func(a, b jobRecord) int {
+		return a.Job.Created.Compare(b.Job.Created)
+	})
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.storage = storage
+	for _, record := range records {
+		job := record.Job
+		job.req = record.Request
+		job.result = record.Result
+		m.jobs[job.ID] = &job
+		m.order = append(m.order, job.ID)
+	}
+	m.expire()
+	for len(m.order) > m.maxJobs {
+		if !m.evictFinished() {
+			break
+		}
+	}
+
+	var interrupted []Job
+	for _, id := range m.order {
+		if job := m.jobs[id]; job.Status == JobRunning {
+			interrupted = append(interrupted, *job)
+		}
+	}
+	return interrupted, nil
+}
+
+// OnFinish registers fn to be called with each job that completes, fails or
+// is cancelled
+func (m *JobManager) OnFinish(fn func(Job)) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.onFinish = fn
+}
+
+// Start runs run for req in the background and returns the job tracking it,
+// owned by the client identity of ctx. The job is not cancelled when ctx is,
+// but keeps its values such as the request ID for logging.
+func (m *JobManager) Start(ctx context.Context, req SearchRequest, callbackURL string, run func(context.Context) (*SearchResult, error)) (Job, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.expire()
+	if len(m.order) >= m.maxJobs && !m.evictFinished() {
+		return Job{}, fmt.Errorf("%w: %d jobs, retry once one finishes", ErrTooManyJobs, len(m.order))
+	}
+
+	job := &Job{
+		ID:          newJobID(),
+		Status:      JobRunning,
+		Query:       req.Query,
+		Model:       req.Model,
+		Created:     m.now(),
+		req:         req,
+		CallbackURL: callbackURL,
+		Owner:       clientIdentity(ctx),
+	}
+	m.jobs[job.ID] = job
+	m.order = append(m.order, job.ID)
+	m.save(job)
+	m.run(ctx, job, run)
+	return *job, nil
+}
+
+// resume runs the request of a restored running job again
+func (m *JobManager) resume(ctx context.Context, id string, run func(context.Context) (*SearchResult, error)) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if job, ok := m.jobs[id]; ok && job.Status == JobRunning && job.cancel == nil {
+		m.run(ctx, job, run)
+	}
+}
+
+// run calls run for job in the background. Callers must hold m.mu.
+func (m *JobManager) run(ctx context.Context, job *Job, run func(context.Context) (*SearchResult, error)) {
+	jobCtx, cancel := context.WithCancel(context.WithoutCancel(ctx))
+	job.cancel = cancel
+	go func() {
+		defer cancel()
+		result, err := run(jobCtx)
+		m.finish(job.ID, result, err)
+	}()
+}
+
+// Get returns the job with id, unless it is unknown, expired or not owned by
+// owner. Jobs of other clients are reported as unknown, so their IDs cannot be
+// probed.
+func (m *JobManager) Get(id, owner string) (Job, bool) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.expire()
+	job, ok := m.jobs[id]
+	if !ok || job.Owner != owner {
+		return Job{}, false
+	}
+	return *job, true
+}
+
+// List returns the jobs of owner kept, oldest first, limited to those in
+// status unless it is empty
+func (m *JobManager) List(status, owner string) []Job {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.expire()
+	jobs := []Job{}
+	for _, id := range m.order {
+		if job := m.jobs[id]; job.Owner == owner && (status == "" || job.Status == status) {
+			jobs = append(jobs, *job)
+		}
+	}
+	return jobs
+}
+
+// Cancel aborts a running job of owner, whose API request is cancelled, and returns it
+func (m *JobManager) Cancel(id, owner string) (Job, error) {
+	job, onFinish, err := m.cancel(id, owner)
+	if err == nil && onFinish != nil {
+		onFinish(job)
+	}
+	return job, err
+}
+
+func (m *JobManager) cancel(id, owner string) (Job, func(Job), error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.expire()
+	job, ok := m.jobs[id]
+	if !ok || job.Owner != owner {
+		return Job{}, nil, fmt.Errorf("job not found: %s", id)
+	}
+	if job.Status != JobRunning {
+		return Job{}, nil, fmt.Errorf("job %s is already %s", id, job.Status)
+	}
+	if job.cancel != nil {
+		job.cancel()
+	}
+	finished := m.now()
+	job.Status = JobCancelled
+	job.Finished = &finished
+	m.save(job)
+	return *job, m.onFinish, nil
+}
+
+func (m *JobManager) finish(id string, result *SearchResult, err error) {
+	if job, onFinish, ok := m.settle(id, result, err); ok && onFinish != nil {
+		onFinish(job)
+	}
+}
+
+// settle records the outcome of a job's request and reports whether the job
+// was still running
+func (m *JobManager) settle(id string, result *SearchResult, err error) (Job, func(Job), bool) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	job, ok := m.jobs[id]
+	// A cancelled job stays cancelled whatever its request returned
+	if !ok || job.Status != JobRunning {
+		return Job{}, nil, false
+	}
+	finished := m.now()
+	job.Finished = &finished
+	if err != nil {
+		job.Status = JobFailed
+		job.Error = err.Error()
+	} else {
+		job.Status = JobCompleted
+		job.result = result
+		job.ResultID = result.ID
+	}
+	m.save(job)
+	return *job, m.onFinish, true
+}
+
+// save persists job when storage is configured. Callers must hold m.mu.
+func (m *JobManager) save(job *Job) {
+	if m.storage == nil {
+		return
+	}
+	record := jobRecord{Job: *job, Request: job.req, Result: job.result}
+	if err := m.storage.saveJob(record); err != nil {
+		m.storage.logger.Warn("Failed to persist job", "job_id", job.ID, "error", err)
+	}
+}
+
+// remove drops a job from memory and storage. Callers must hold m.mu.
+func (m *JobManager) remove(id string) {
+	delete(m.jobs, id)
+	if m.storage != nil {
+		if err := m.storage.deleteJob(id); err != nil {
+			m.storage.logger.Warn("Failed to delete job", "job_id", id, "error", err)
+		}
+	}
+}
+
+// expire drops jobs that finished more than ttl ago
+func (m *JobManager) expire() {
+	cutoff := m.now().Add(-m.ttl)
+	m.order = slices.DeleteFunc(m.order, func(id string) bool {
+		job := m.jobs[id]
+		if job.Finished == nil || job.Finished.After(cutoff) {
+			return false
+		}
+		m.remove(id)
+		return true
+	})
+}
+
+// evictFinished drops the oldest finished job and reports whether there was one
+func (m *JobManager) evictFinished() bool {
+	for i, id := range m.order {
+		if m.jobs[id].Finished != nil {
+			m.remove(id)
+			m.order = slices.Delete(m.order, i, i+1)
+			return true
+		}
+	}
+	return false
+}
+
+// newJobID returns a random job ID, distinct from result and request IDs
+func newJobID() string {
+	b := make([]byte, 8)
+	_, _ = rand.Read(b)
+	return "job_" + hex.EncodeToString(b)
+}
+
+// JobURI returns the job:// resource URI of a research job
+func JobURI(id string) string {
+	return JobURIPrefix + id
+}
+
+// jobData is the JSON form of a job, with the result of a completed job in
+// the format of perplexity_search
+func jobData(job Job) map[string]any {
+	data := jobSummary(job)
+	if job.result != nil {
+		data["result"] = searchResultData(job.result, &job.req)
+	}
+	return data
+}
+
+// jobSummary is the JSON form of a job without its result
+func jobSummary(job Job) map[string]any {
+	data := map[string]any{
+		"job_id":       job.ID,
+		"status":       job.Status,
+		"query":        job.Query,
+		"model":        job.Model,
+		"created":      job.Created,
+		"resource_uri": JobURI(job.ID),
+	}
+	if job.Finished != nil {
+		data["finished"] = *job.Finished
+	}
+	if job.Error != "" {
+		data["error"] = job.Error
+	}
+	if job.ResultID != "" {
+		data["result_id"] = job.ResultID
+	}
+	if job.CallbackURL != "" {
+		data["callback_url"] = job.CallbackURL
+	}
+	return data
+}
+
+// CreateResearchAsyncTool creates the perplexity_research_async tool
+func CreateResearchAsyncTool(config *Config) mcp.Tool {
+	tool := mcp.Tool{
+		Name:        "perplexity_research_async",
+		Description: "Start a long-running research search, such as a sonar-deep-research report, in the background and return a job_id at once instead of waiting for the answer. Read the job's job:// resource for its status and, once completed, its result.",
+		InputSchema: mcp.ToolInputSchema{
+			Type: "object",
+			Properties: map[string]any{
+				"query": map[string]any{
+					"type":        "string",
+					"description": "The research question",
+					"minLength":   1,
+					"maxLength":   config.MaxQueryLength,
+				},
+				"model": map[string]any{
+					"type":        "string",
+					"description": fmt.Sprintf("The Sonar model to use (optional, defaults to '%s')", researchAsyncModel(config)),
+					"enum":        config.Models(),
+				},
+				"reasoning_effort": map[string]any{
+					"type":        "string",
+					"description": "How hard sonar-deep-research works on the answer: 'low' is faster and cheaper, 'high' searches and reasons more (optional, ignored by other models)",
+					"enum":        ReasoningEfforts,
+				},
+				"system_prompt": map[string]any{
+					"type":        "string",
+					"description": "Instructions that steer the tone, language, and formatting of the report (optional)",
+					"maxLength":   config.MaxQueryLength,
+				},
+				"max_tokens": map[string]any{
+					"type":        "number",
+					"description": "Maximum number of tokens in the response (optional)",
+					"minimum":     1,
+					"maximum":     128000,
+				},
+				"search_mode": map[string]any{
+					"type":        "string",
+					"description": "The search mode to use (optional, defaults to 'web')",
+					"enum":        SearchModes,
+				},
+				"date_range": map[string]any{
+					"type":        "string",
+					"description": "Filter search results by date range (optional)",
+					"enum":        DateRanges,
+				},
+				"sources": map[string]any{
+					"type":        "array",
+					"description": fmt.Sprintf("Limit search to specific domains (optional, max %d)", config.MaxDomainFilters),
+					"items": map[string]any{
+						"type": "string",
+					},
+					"maxItems": config.MaxDomainFilters,
+				},
+				"exclude_sources": map[string]any{
+					"type":        "array",
+					"description": fmt.Sprintf("Domains to leave out of the search (optional; at most %d together with sources)", config.MaxDomainFilters),
+					"items": map[string]any{
+						"type": "string",
+					},
+					"maxItems": config.MaxDomainFilters,
+				},
+				"callback_url": map[string]any{
+					"type":        "string",
+					"description": "URL the finished job is POSTed to, signed with the server's webhook secret (optional)",
+					"format":      "uri",
+					"maxLength":   MaxCallbackURLLength,
+				},
+			},
+			Required: []string{"query"},
+		},
+		OutputSchema: jobOutputSchema(),
+	}
+	relaxModelSchema(&tool, config)
+	return tool
+}
+
+// researchAsyncModel is the model of perplexity_research_async calls that name
+// none: the tool's configured default, else sonar-deep-research when allowed
+func researchAsyncModel(config *Config) string {
+	if model := config.ToolDefaults["perplexity_research_async"].Model; model != "" {
+		return model
+	}
+	if slices.Contains(config.Models(), DeepResearchModel) {
+		return DeepResearchModel
+	}
+	return config.DefaultModel
+}
+
+// ResearchAsyncHandler creates the handler function for the perplexity_research_async tool
+func ResearchAsyncHandler(client SearchProvider, live *LiveConfig, results *ResultStore, jobs *JobManager, usage *UsageTracker) func(ctx context.Context, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+	return func(ctx context.Context, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+		// Read the configuration once per call; the job keeps using it
+		config := live.Get()
+
+		req, err := parseResearchAsyncRequest(request)
+		if err == nil {
+			if req.Model == "" {
+				req.Model = researchAsyncModel(config)
+			}
+			config.applyToolDefaults("perplexity_research_async", req)
+			req.MaxQueryLength = config.MaxQueryLength
+			req.MaxDomainFilters = config.MaxDomainFilters
+			err = config.CheckModel(req.Model)
+		}
+		// Validate now, as a job that fails at once helps nobody
+		if err == nil {
+			err = req.Validate()
+		}
+		callbackURL := request.GetString("callback_url", "")
+		if err == nil && callbackURL != "" {
+			err = config.Webhooks.CheckURL(callbackURL)
+		}
+		if err != nil {
+			return &mcp.CallToolResult{
+				Content: []mcp.Content{
+					mcp.TextContent{
+						Type: "text",
+						Text: fmt.Sprintf("Invalid research request: %s", err.Error()),
+					},
+				},
+				IsError: true,
+			}, err
+		}
+
+		if _, err := config.Budgets.Check(usage); err != nil {
+			return &mcp.CallToolResult{
+				Content: []mcp.Content{
+					mcp.TextContent{
+						Type: "text",
+						Text: fmt.Sprintf("Research failed: %s", err.Error()),
+					},
+				},
+				IsError: true,
+			}, err
+		}
+
+		job, err := jobs.Start(ctx, *req, callbackURL, researchJob(client, config, results, usage, *req))
+		if err != nil {
+			return &mcp.CallToolResult{
+				Content: []mcp.Content{
+					mcp.TextContent{
+						Type: "text",
+						Text: fmt.Sprintf("Research failed: %s", err.Error()),
+					},
+				},
+				IsError: true,
+			}, err
+		}
+
+		return jobToolResult(jobData(job))
+	}
+}
+
+// researchJob returns the function a job runs for req: the search, then
+// storing the answer and recording its usage
+func researchJob(client SearchProvider, config *Config, results *ResultStore, usage *UsageTracker, req SearchRequest) func(context.Context) (*SearchResult, error) {
+	return func(ctx context.Context) (*SearchResult, error) {
+		result, err := searchWithModelFallback(ctx, client, config, "perplexity_research_async", req, nil)
+		if err != nil {
+			// Cancelled jobs are not failures worth a warning
+			if ctx.Err() == nil {
+				slog.Default().WarnContext(ctx, "Research job failed", "model", req.Model, "error", err)
+			}
+			return nil, err
+		}
+		results.PutAnswer(ctx, req, result)
+		usage.Record(config.ModelPrices, "perplexity_research_async", "", result)
+		// The job keeps the answer as its tools and callback return it
+		return config.ResponseRedactions.apply(result), nil
+	}
+}
+
+// ResumeJobs sends the requests of jobs interrupted by a restart again, as
+// returned by JobManager.UseStorage. Jobs fail at once while a hard budget
+// limit is reached.
+func ResumeJobs(ctx context.Context, jobs *JobManager, interrupted []Job, client SearchProvider, live *LiveConfig, results *ResultStore, usage *UsageTracker) {
+	config := live.Get()
+	for _, job := range interrupted {
+		run := researchJob(client, config, results, usage, job.req)
+		if _, err := config.Budgets.Check(usage); err != nil {
+			run = func(context.Context) (*SearchResult, error) { return nil, err }
+		}
+		jobs.resume(ctx, job.ID, run)
+	}
+}
+
+// jobToolResult returns data as the JSON text and structured content of a tool result
+func jobToolResult(data map[string]any) (*mcp.CallToolResult, error) {
+	content, err := json.MarshalIndent(data, "", "  ")
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal job: %w", err)
+	}
+	return &mcp.CallToolResult{
+		Content: []mcp.Content{
+			mcp.TextContent{
+				Type: "text",
+				Text: string(content),
+			},
+		},
+		StructuredContent: data,
+		IsError:           false,
+	}, nil
+}
+
+// jobIDArgument returns the validated job_id argument of request
+func jobIDArgument(request mcp.CallToolRequest) (string, error) {
+	jobID, err := request.RequireString("job_id")
+	if err != nil {
+		return "", fmt.Errorf("job_id must be a string")
+	}
+	if err := validateJobID(jobID); err != nil {
+		return "", err
+	}
+	return jobID, nil
+}
+
+// jobIDProperty is the input schema of the job_id argument
+var jobIDProperty = map[string]any{
+	"type":        "string",
+	"description": "The job_id returned by perplexity_research_async",
+	"pattern":     jobIDPattern.String(),
+}
+
+// CreateJobStatusTool creates the perplexity_job_status tool
+func CreateJobStatusTool() mcp.Tool {
+	return mcp.Tool{
+		Name:        "perplexity_job_status",
+		Description: "Report the status of research jobs started with perplexity_research_async: one job by job_id, or every job kept, optionally only those with a given status.",
+		InputSchema: mcp.ToolInputSchema{
+			Type: "object",
+			Properties: map[string]any{
+				"job_id": map[string]any{
+					"type":        "string",
+					"description": "The job to report on (optional, omit to list jobs)",
+					"pattern":     jobIDPattern.String(),
+				},
+				"status": map[string]any{
+					"type":        "string",
+					"description": "List only jobs with this status (optional)",
+					"enum":        JobStatuses,
+				},
+			},
+		},
+		OutputSchema: jobStatusOutputSchema(),
+	}
+}
+
+// JobStatusHandler creates the handler function for the perplexity_job_status tool
+func JobStatusHandler(jobs *JobManager) func(ctx context.Context, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+	return func(ctx context.Context, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+		list, err := jobStatus(ctx, jobs, request)
+		if err != nil {
+			return &mcp.CallToolResult{
+				Content: []mcp.Content{
+					mcp.TextContent{
+						Type: "text",
+						Text: fmt.Sprintf("Job status failed: %s", err.Error()),
+					},
+				},
+				IsError: true,
+			}, err
+		}
+
+		summaries := make([]map[string]any, len(list))
+		for i, job := range list {
+			summaries[i] = jobSummary(job)
+		}
+		return jobToolResult(map[string]any{"jobs": summaries})
+	}
+}
+
+// jobStatus returns the caller's job named by the job_id argument, or its jobs
+// with the status argument
+func jobStatus(ctx context.Context, jobs *JobManager, request mcp.CallToolRequest) ([]Job, error) {
+	status := request.GetString("status", "")
+	if status != "" && !slices.Contains(JobStatuses, status) {
+		return nil, fmt.Errorf("invalid status: %s", status)
+	}
+	if _, ok := request.GetArguments()["job_id"]; !ok {
+		return jobs.List(status, clientIdentity(ctx)), nil
+	}
+
+	jobID, err := jobIDArgument(request)
+	if err != nil {
+		return nil, err
+	}
+	job, ok := jobs.Get(jobID, clientIdentity(ctx))
+	if !ok {
+		return nil, fmt.Errorf("job not found: %s", jobID)
+	}
+	if status != "" && job.Status != status {
+		return []Job{}, nil
+	}
+	return []Job{job}, nil
+}
+
+// CreateJobResultTool creates the perplexity_job_result tool
+func CreateJobResultTool() mcp.Tool {
+	return mcp.Tool{
+		Name:        "perplexity_job_result",
+		Description: "Fetch the result of a completed research job started with perplexity_research_async, in the format of perplexity_search. Fails while the job is running and for failed or cancelled jobs.",
+		InputSchema: mcp.ToolInputSchema{
+			Type: "object",
+			Properties: map[string]any{
+				"job_id": jobIDProperty,
+			},
+			Required: []string{"job_id"},
+		},
+		OutputSchema: jobOutputSchema(),
+	}
+}
+
+// JobResultHandler creates the handler function for the perplexity_job_result tool
+func JobResultHandler(jobs *JobManager, live *LiveConfig) func(ctx context.Context, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+	return func(ctx context.Context, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+		job, err := completedJob(ctx, jobs, request)
+		if err != nil {
+			return &mcp.CallToolResult{
+				Content: []mcp.Content{
+					mcp.TextContent{
+						Type: "text",
+						Text: fmt.Sprintf("Job result failed: %s", err.Error()),
+					},
+				},
+				IsError: true,
+			}, err
+		}
+
+		result, err := jobToolResult(jobData(job))
+		if err == nil && job.result != nil {
+			// Report the job's API call like synchronous searches do
+			fields := map[string]any{}
+			usageMeta(fields, live.Get().ModelPrices, []*SearchResult{job.result})
+			result.Meta = &mcp.Meta{AdditionalFields: fields}
+		}
+		return result, err
+	}
+}
+
+func completedJob(ctx context.Context, jobs *JobManager, request mcp.CallToolRequest) (Job, error) {
+	jobID, err := jobIDArgument(request)
+	if err != nil {
+		return Job{}, err
+	}
+	job, ok := jobs.Get(jobID, clientIdentity(ctx))
+	if !ok {
+		return Job{}, fmt.Errorf("job not found: %s", jobID)
+	}
+	switch job.Status {
+	case JobCompleted:
+		return job, nil
+	case JobFailed:
+		return Job{}, fmt.Errorf("job %s failed: %s", jobID, job.Error)
+	default:
+		return Job{}, fmt.Errorf("job %s is %s", jobID, job.Status)
+	}
+}
+
+// CreateJobCancelTool creates the perplexity_job_cancel tool
+func CreateJobCancelTool() mcp.Tool {
+	return mcp.Tool{
+		Name:        "perplexity_job_cancel",
+		Description: "Cancel a running research job started with perplexity_research_async. Its API request is aborted and the job is kept with status 'cancelled'.",
+		InputSchema: mcp.ToolInputSchema{
+			Type: "object",
+			Properties: map[string]any{
+				"job_id": jobIDProperty,
+			},
+			Required: []string{"job_id"},
+		},
+		OutputSchema: jobOutputSchema(),
+	}
+}
+
+// JobCancelHandler creates the handler function for the perplexity_job_cancel tool
+func JobCancelHandler(jobs *JobManager) func(ctx context.Context, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+	return func(ctx context.Context, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+		jobID, err := jobIDArgument(request)
+		var job Job
+		if err == nil {
+			job, err = jobs.Cancel(jobID, clientIdentity(ctx))
+		}
+		if err != nil {
+			return &mcp.CallToolResult{
+				Content: []mcp.Content{
+					mcp.TextContent{
+						Type: "text",
+						Text: fmt.Sprintf("Job cancel failed: %s", err.Error()),
+					},
+				},
+				IsError: true,
+			}, err
+		}
+
+		return jobToolResult(jobSummary(job))
+	}
+}
+
+func parseResearchAsyncRequest(request mcp.CallToolRequest) (*SearchRequest, error) {
+	query, err := request.RequireString("query")
+	if err != nil {
+		return nil, fmt.Errorf("query must be a string")
+	}
+	maxTokens, err := integerArgument(request, "max_tokens")
+	if err != nil {
+		return nil, err
+	}
+
+	req := &SearchRequest{
+		Query:           query,
+		Model:           request.GetString("model", ""),
+		ReasoningEffort: request.GetString("reasoning_effort", ""),
+		SystemPrompt:    request.GetString("system_prompt", ""),
+		SearchMode:      request.GetString("search_mode", ""),
+		DateRange:       request.GetString("date_range", ""),
+		Sources:         request.GetStringSlice("sources", nil),
+		ExcludeSources:  request.GetStringSlice("exclude_sources", nil),
+	}
+	if maxTokens != nil {
+		req.MaxTokens = *maxTokens
+	}
+	return req, nil
+}
+
+// CreateJobResourceTemplate creates the job://{job_id} resource template
+func CreateJobResourceTemplate() mcp.ResourceTemplate {
+	return mcp.NewResourceTemplate(
+		JobURIPrefix+"{job_id}",
+		"Research job",
+		mcp.WithTemplateDescription("Status of a perplexity_research_async job, with its result once completed"),
+		mcp.WithTemplateMIMEType("application/json"),
+	)
+}
+
+// JobResourceHandler creates the resources/read handler for research jobs
+func JobResourceHandler(jobs *JobManager) func(ctx context.Context, request mcp.ReadResourceRequest) ([]mcp.ResourceContents, error) {
+	return func(ctx context.Context, request mcp.ReadResourceRequest) ([]mcp.ResourceContents, error) {
+		jobID := strings.TrimPrefix(request.Params.URI, JobURIPrefix)
+		if err := validateJobID(jobID); err != nil {
+			return nil, err
+		}
+		job, ok := jobs.Get(jobID, clientIdentity(ctx))
+		if !ok {
+			return nil, fmt.Errorf("job not found: %s", jobID)
+		}
+
+		content, err := json.MarshalIndent(jobData(job), "", "  ")
+		if err != nil {
+			return nil, fmt.Errorf("failed to marshal job: %w", err)
+		}
+		return []mcp.ResourceContents{
+			mcp.TextResourceContents{
+				URI:      request.Params.URI,
+				MIMEType: "application/json",
+				Text:     string(content),
+			},
+		}, nil
+	}
+}
@@ -0,0 +1,198 @@
+package internal
+
+import (
+	"context"
+	"errors"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/mark3labs/mcp-go/mcp"
+	"github.com/stretchr/testify/require"
+)
+
+func withIdentity(identity string) context.Context {
+	return context.WithValue(context.Background(), clientIdentityKey{}, identity)
+}
+
+func jobRequest(name, jobID string) mcp.CallToolRequest {
+	var request mcp.CallToolRequest
+	request.Params.Name = name
+	request.Params.Arguments = map[string]any{"job_id": jobID}
+	return request
+}
+
+func TestJobsOnlyVisibleToTheirOwner(t *testing.T) {
+	jobs := NewJobManager(time.Hour, 10)
+	block := make(chan struct{})
+	defer close(block)
+	running, err := jobs.Start(withIdentity("token:alice"), SearchRequest{Query: "q"}, "", func(ctx context.Context) (*SearchResult, error) {
+		<-block
+		return &SearchResult{ID: "r1"}, nil
+	})
+	require.NoError(t, err)
+	require.Equal(t, "token:alice", running.Owner)
+
+	alice, mallory := withIdentity("token:alice"), withIdentity("ip:198.51.100.9")
+
+	// Another client can neither see, read nor cancel the job
+	for _, handler := range []func(context.Context, mcp.CallToolRequest) (*mcp.CallToolResult, error){
+		JobStatusHandler(jobs),
+		JobResultHandler(jobs, NewLiveConfig(&Config{})),
+		JobCancelHandler(jobs),
+	} {
+		result, err := handler(mallory, jobRequest("", running.ID))
+		require.ErrorContains(t, err, "job not found")
+		require.True(t, result.IsError)
+	}
+	require.Empty(t, jobs.List("", "ip:198.51.100.9"))
+	_, err = JobResourceHandler(jobs)(mallory, mcp.ReadResourceRequest{Params: mcp.ReadResourceParams{URI: JobURI(running.ID)}})
+	require.ErrorContains(t, err, "job not found")
+
+	job, ok := jobs.Get(running.ID, "token:alice")
+	require.True(t, ok)
+	require.Equal(t, JobRunning, job.Status)
+
+	// The owner still can
+	result, err := JobStatusHandler(jobs)(alice, jobRequest("", running.ID))
+	require.NoError(t, err)
+	require.False(t, result.IsError)
+	require.Len(t, jobs.List("", "token:alice"), 1)
+	result, err = JobCancelHandler(jobs)(alice, jobRequest("", running.ID))
+	require.NoError(t, err)
+	require.Equal(t, JobCancelled, result.StructuredContent.(map[string]any)["status"])
+}
+
+// waitJob waits until the job with id is no longer running and returns it
+func waitJob(t *testing.T, jobs *JobManager, id string) Job {
+	t.Helper()
+	var job Job
+	require.Eventually(t, func() bool {
+		job, _ = jobs.Get(id, "")
+		return job.Status != JobRunning
+	}, time.Second, time.Millisecond)
+	return job
+}
+
+func TestJobManagerLifecycle(t *testing.T) {
+	jobs := NewJobManager(time.Hour, 2)
+	now := time.Now()
+	jobs.now = func() time.Time { return now }
+	finished := make(chan Job, 3)
+	jobs.OnFinish(func(job Job) { finished <- job })
+
+	completed, err := jobs.Start(context.Background(), SearchRequest{Query: "a", Model: "sonar"}, "", func(ctx context.Context) (*SearchResult, error) {
+		return &SearchResult{ID: "r1"}, nil
+	})
+	require.NoError(t, err)
+	require.Equal(t, JobRunning, completed.Status)
+	completed = waitJob(t, jobs, completed.ID)
+	require.Equal(t, JobCompleted, completed.Status)
+	require.Equal(t, "r1", completed.ResultID)
+	require.Equal(t, completed.ID, (<-finished).ID)
+
+	failed, err := jobs.Start(context.Background(), SearchRequest{Query: "b"}, "", func(ctx context.Context) (*SearchResult, error) {
+		return nil, errors.New("upstream down")
+	})
+	require.NoError(t, err)
+	failed = waitJob(t, jobs, failed.ID)
+	require.Equal(t, JobFailed, failed.Status)
+	require.Equal(t, "upstream down", failed.Error)
+	<-finished
+
+	// A new job evicts the oldest finished one; with all jobs running, it is refused
+	block := make(chan struct{})
+	running, err := jobs.Start(context.Background(), SearchRequest{Query: "c"}, "", func(ctx context.Context) (*SearchResult, error) {
+		select {
+		case <-block:
+			return &SearchResult{ID: "late"}, nil
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+	})
+	require.NoError(t, err)
+	_, ok := jobs.Get(completed.ID, "")
+	require.False(t, ok)
+	_, err = jobs.Start(context.Background(), SearchRequest{Query: "d"}, "", func(ctx context.Context) (*SearchResult, error) {
+		<-block
+		return &SearchResult{ID: "r2"}, nil
+	})
+	require.NoError(t, err)
+	_, err = jobs.Start(context.Background(), SearchRequest{Query: "e"}, "", nil)
+	require.ErrorIs(t, err, ErrTooManyJobs)
+
+	// A cancelled job stays cancelled when its request returns
+	cancelled, err := jobs.Cancel(running.ID, "")
+	require.NoError(t, err)
+	require.Equal(t, JobCancelled, cancelled.Status)
+	require.Equal(t, JobCancelled, (<-finished).Status)
+	close(block)
+	<-finished
+	_, err = jobs.Cancel(running.ID, "")
+	require.ErrorContains(t, err, "already cancelled")
+	job, _ := jobs.Get(running.ID, "")
+	require.Equal(t, JobCancelled, job.Status)
+	require.Empty(t, job.ResultID)
+
+	// Finished jobs expire after the TTL
+	jobs.mu.Lock()
+	now = now.Add(2 * time.Hour)
+	jobs.mu.Unlock()
+	require.Empty(t, jobs.List("", ""))
+}
+
+func TestResumeJobsRerunsInterruptedJobs(t *testing.T) {
+	storage, err := OpenStorage(filepath.Join(t.TempDir(), "history.db"))
+	require.NoError(t, err)
+	defer func() { _ = storage.Close() }()
+
+	// Jobs left running by a stopped server, and one that had finished
+	finishedAt := time.Now()
+	for _, job := range []Job{
+		{ID: "job_resumed", Status: JobRunning, Query: "resumed", Created: time.Now()},
+		{ID: "job_overbudget", Status: JobRunning, Query: "over budget", Created: time.Now()},
+		{ID: "job_done", Status: JobCompleted, Query: "done", Created: time.Now(), Finished: &finishedAt, ResultID: "old"},
+	} {
+		require.NoError(t, storage.saveJob(jobRecord{Job: job, Request: SearchRequest{Query: job.Query, Model: "sonar"}}))
+	}
+
+	jobs := NewJobManager(time.Hour, 10)
+	interrupted, err := jobs.UseStorage(storage)
+	require.NoError(t, err)
+	require.Len(t, interrupted, 2)
+	for _, job := range interrupted {
+		require.Equal(t, JobRunning, job.Status)
+	}
+
+	var queries []string
+	client := &stubProvider{search: func(ctx context.Context, req SearchRequest) (*SearchResult, error) {
+		queries = append(queries, req.Query)
+		return &SearchResult{ID: "res_" + req.Query, Model: req.Model, Content: "answer"}, nil
+	}}
+	config := &Config{RequestTimeout: time.Second}
+	results := NewResultStore(10)
+	ResumeJobs(context.Background(), jobs, interrupted[:1], client, NewLiveConfig(config), results, NewUsageTracker())
+
+	job := waitJob(t, jobs, "job_resumed")
+	require.Equal(t, JobCompleted, job.Status)
+	require.Equal(t, "res_resumed", job.ResultID)
+	require.Equal(t, []string{"resumed"}, queries)
+	_, ok := results.Get("res_resumed", "")
+	require.True(t, ok)
+
+	// Interrupted jobs fail at once while a hard budget is reached
+	usage := NewUsageTracker()
+	usage.Record(map[string]ModelPrice{"sonar": {InputPerMillion: 1}}, "perplexity_search", "", &SearchResult{Model: "sonar", Usage: Usage{PromptTokens: 2000000}})
+	config.Budgets = Budgets{DailyUSD: BudgetLimit{Hard: 1}}
+	ResumeJobs(context.Background(), jobs, interrupted[1:], client, NewLiveConfig(config), results, usage)
+	job = waitJob(t, jobs, "job_overbudget")
+	require.Equal(t, JobFailed, job.Status)
+	require.Len(t, queries, 1)
+
+	// Both outcomes were persisted
+	restored := NewJobManager(time.Hour, 10)
+	interrupted, err = restored.UseStorage(storage)
+	require.NoError(t, err)
+	require.Empty(t, interrupted)
+	require.Len(t, restored.List("", ""), 3)
+}
@@ -0,0 +1,33 @@
+package internal
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"os"
+	"strings"
+)
+
+// FileSecretProvider reads the API key from a mounted secret file. It is polled
+// rather than watched because Kubernetes updates secret volumes by swapping
+// symlinks, which file change notifications do not report reliably.
+type FileSecretProvider struct {
+	path string
+}
+
+func NewFileSecretProvider(path string) *FileSecretProvider {
+	return &FileSecretProvider{path: path}
+}
+
+// APIKey returns the key stored in the file, ignoring surrounding whitespace
+func (p *FileSecretProvider) APIKey(ctx context.Context) (string, error) {
+	data, err := os.ReadFile(p.path)
+	if err != nil {
+		return "", fmt.Errorf("failed to read API key file: %w", err)
+	}
+	return strings.TrimSpace(string(bytes.TrimPrefix(data, []byte("\xef\xbb\xbf")))), nil
+}
+
+func (p *FileSecretProvider) Source() string {
+	return p.path
+}
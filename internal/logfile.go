@@ -0,0 +1,185 @@
+package internal
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Log outputs selectable with LOG_OUTPUT
+const (
+	LogOutputStderr = "stderr"
+	LogOutputFile   = "file"
+	LogOutputSyslog = "syslog"
+)
+
+// LogOutputs lists the valid LOG_OUTPUT values
+var LogOutputs = []string{LogOutputStderr, LogOutputFile, LogOutputSyslog}
+
+// DefaultSyslogTag identifies the server's syslog messages
+const DefaultSyslogTag = "perplexity-mcp"
+
+// LogSyslog configures the syslog connection of LOG_OUTPUT=syslog
+type LogSyslog struct {
+	// Addr is a remote syslog server such as udp://logs:514 or
+	// unixgram:///run/systemd/journal/syslog; empty uses the local daemon
+	Addr string
+	Tag  string
+}
+
+// Defaults for the rotation of the log file
+const (
+	DefaultLogFileMaxSize    = 100 * 1024 * 1024
+	DefaultLogFileMaxBackups = 5
+)
+
+// backupTimeFormat stamps rotated log files; it sorts by time and has no colons
+const backupTimeFormat = "2006-01-02T15-04-05.000"
+
+// LogFile configures the file written with LOG_OUTPUT=file
+type LogFile struct {
+	Path string
+	// MaxSize rotates the file before a write would grow it past this many bytes
+	MaxSize int64
+	// MaxBackups bounds the rotated files kept (0 keeps all of them)
+	MaxBackups int
+	// MaxAge removes rotated files older than this (0 keeps them)
+	MaxAge time.Duration
+}
+
+func (f LogFile) Validate() error {
+	if f.Path == "" {
+		return fmt.Errorf("log file path is required with log output %q", LogOutputFile)
+	}
+	if f.MaxSize <= 0 {
+		return fmt.Errorf("log file max size must be positive")
+	}
+	if f.MaxBackups < 0 || f.MaxAge < 0 {
+		return fmt.Errorf("log file retention must not be negative")
+	}
+	return nil
+}
+
+// RotatingFile is a log file that is renamed with a timestamp, such as
+// server-2024-05-01T10-00-00.000.log, and replaced by an empty one before a
+// write would make it larger than MaxSize. Rotated files beyond MaxBackups or
+// older than MaxAge are removed.
+type RotatingFile struct {
+	config LogFile
+
+	mu   sync.Mutex
+	file *os.File
+	size int64
+}
+
+// OpenLogFile opens config.Path for appending, creating it and its directory
+// when missing
+func OpenLogFile(config LogFile) (*RotatingFile, error) {
+	if err := os.MkdirAll(filepath.Dir(config.Path), 0o755); err != nil {
+		return nil, fmt.Errorf("failed to create log directory: %w", err)
+	}
+	f := &RotatingFile{config: config}
+	if err := f.open(); err != nil {
+		return nil, err
+	}
+	return f, nil
+}
+
+func (f *RotatingFile) open() error {
+	file, err := os.OpenFile(f.config.Path, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0o600)
+	if err != nil {
+		return fmt.Errorf("failed to open log file: %w", err)
+	}
+	info, err := file.Stat()
+	if err != nil {
+		_ = file.Close()
+		return fmt.Errorf("failed to open log file: %w", err)
+	}
+	f.file, f.size = file, info.Size()
+	return nil
+}
+
+func (f *RotatingFile) Write(p []byte) (int, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	// A line longer than MaxSize still gets a file of its own
+	if f.size > 0 && f.size+int64(len(p)) > f.config.MaxSize {
+		if err := f.rotate(); err != nil {
+			return 0, err
+		}
+	}
+	n, err := f.file.Write(p)
+	f.size += int64(n)
+	return n, err
+}
+
+// rotate renames the current file and opens a new one
+func (f *RotatingFile) rotate() error {
+	if err := f.file.Close(); err != nil {
+		return fmt.Errorf("failed to close log file: %w", err)
+	}
+	if err := os.Rename(f.config.Path, f.backupName(time.Now())); err != nil {
+		return fmt.Errorf("failed to rotate log file: %w", err)
+	}
+	if err := f.open(); err != nil {
+		return err
+	}
+	f.prune()
+	return nil
+}
+
+// backupName is the name of the current file once rotated at t
+func (f *RotatingFile) backupName(t time.Time) string {
+	ext := filepath.Ext(f.config.Path)
+	prefix := strings.TrimSuffix(f.config.Path, ext)
+	return prefix + "-" + t.UTC().Format(backupTimeFormat) + ext
+}
+
+// prune removes the rotated files beyond MaxBackups and older than MaxAge.
+// Failures are left for the next rotation; logging them here would recurse.
+func (f *RotatingFile) prune() {
+	dir := filepath.Dir(f.config.Path)
+	ext := filepath.Ext(f.config.Path)
+	prefix := strings.TrimSuffix(filepath.Base(f.config.Path), ext) + "-"
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return
+	}
+
+	type backup struct {
+		path    string
+		rotated time.Time
+	}
+	var backups []backup
+	for _, entry := range entries {
+		name := entry.Name()
+		if !strings.HasPrefix(name, prefix) || !strings.HasSuffix(name, ext) {
+			continue
+		}
+		stamp := strings.TrimSuffix(strings.TrimPrefix(name, prefix), ext)
+		if rotated, err := time.Parse(backupTimeFormat, stamp); err == nil {
+			backups = append(backups, backup{path: filepath.Join(dir, name), rotated: rotated})
+		}
+	}
+	// Newest first
+	slices.SortFunc(backups, func(a, b backup) int { return b.rotated.Compare(a.rotated) })
+
+	for i, b := range backups {
+		tooMany := f.config.MaxBackups > 0 && i >= f.config.MaxBackups
+		tooOld := f.config.MaxAge > 0 && time.Since(b.rotated) > f.config.MaxAge
+		if tooMany || tooOld {
+			_ = os.Remove(b.path)
+		}
+	}
+}
+
+func (f *RotatingFile) Close() error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.file.Close()
+}
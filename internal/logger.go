@@ -0,0 +1,166 @@
+package internal
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"strings"
+
+	"github.com/mark3labs/mcp-go/mcp"
+	"github.com/mark3labs/mcp-go/server"
+)
+
+// Log formats selectable with LOG_FORMAT
+const (
+	LogFormatJSON = "json"
+	LogFormatText = "text"
+)
+
+// NewLogger returns a logger writing JSON or, with LogFormatText, key=value
+// lines to w at the level held by level. Text written to a terminal is
+// colored by level unless NO_COLOR is set. Email addresses, API keys and URL
+// credentials are redacted from string values and errors, and sensitive
+// attributes are dropped entirely. Log lines written with a context carrying
+// a request ID include it as request_id.
+func NewLogger(w io.Writer, level *slog.LevelVar, format string) *slog.Logger {
+	if format == LogFormatText && isTerminal(w) && os.Getenv("NO_COLOR") == "" {
+		w = colorWriter{w}
+	}
+	return slog.New(requestIDHandler{newLogHandler(w, level, format)})
+}
+
+func newLogHandler(w io.Writer, level *slog.LevelVar, format string) slog.Handler {
+	opts := &slog.HandlerOptions{
+		Level:       level,
+		ReplaceAttr: redactLogAttr,
+	}
+	if format == LogFormatText {
+		return slog.NewTextHandler(w, opts)
+	}
+	return slog.NewJSONHandler(w, opts)
+}
+
+// isTerminal reports whether w is a character device such as a terminal
+func isTerminal(w io.Writer) bool {
+	file, ok := w.(*os.File)
+	if !ok {
+		return false
+	}
+	info, err := file.Stat()
+	return err == nil && info.Mode()&os.ModeCharDevice != 0
+}
+
+// ANSI colors of the text log levels
+var logLevelColors = []struct {
+	level string
+	color string
+}{
+	{"level=ERROR", "\x1b[31m"},
+	{"level=WARN", "\x1b[33m"},
+	{"level=DEBUG", "\x1b[90m"},
+}
+
+// colorWriter colors each text log line by its level; the text handler
+// writes one line per call
+type colorWriter struct {
+	w io.Writer
+}
+
+func (c colorWriter) Write(p []byte) (int, error) {
+	line := string(p)
+	for _, lc := range logLevelColors {
+		if strings.Contains(line, " "+lc.level+" ") {
+			if _, err := io.WriteString(c.w, lc.color+strings.TrimSuffix(line, "\n")+"\x1b[0m\n"); err != nil {
+				return 0, err
+			}
+			return len(p), nil
+		}
+	}
+	return c.w.Write(p)
+}
+
+// ParseLogLevel parses a log level name: debug, info, warn or error
+func ParseLogLevel(name string) (slog.Level, error) {
+	var level slog.Level
+	switch strings.ToLower(name) {
+	case "debug", "info", "warn", "error":
+		if err := level.UnmarshalText([]byte(name)); err != nil {
+			return level, err
+		}
+		return level, nil
+	default:
+		return level, fmt.Errorf("invalid log level %q: must be debug, info, warn or error", name)
+	}
+}
+
+// SlogLevel maps an MCP logging level onto the nearest slog level
+func SlogLevel(level mcp.LoggingLevel) slog.Level {
+	switch level {
+	case mcp.LoggingLevelDebug:
+		return slog.LevelDebug
+	case mcp.LoggingLevelInfo, mcp.LoggingLevelNotice:
+		return slog.LevelInfo
+	case mcp.LoggingLevelWarning:
+		return slog.LevelWarn
+	default:
+		return slog.LevelError
+	}
+}
+
+// SetLevelHook applies a client's logging/setLevel to the server's log level,
+// so debug logging can be turned on without a restart. The level is shared by
+// all sessions and reset to LOG_LEVEL by the next configuration reload.
+func SetLevelHook(level *slog.LevelVar, logger *slog.Logger) server.OnAfterSetLevelFunc {
+	return func(ctx context.Context, id any, message *mcp.SetLevelRequest, result *mcp.EmptyResult) {
+		level.Set(SlogLevel(message.Params.Level))
+		logger.InfoContext(ctx, "Log level changed by client", "level", string(message.Params.Level))
+	}
+}
+
+func redactLogAttr(groups []string, a slog.Attr) slog.Attr {
+	if isSensitiveArgument(a.Key) {
+		return slog.String(a.Key, "[redacted]")
+	}
+	switch a.Value.Kind() {
+	case slog.KindString:
+		return slog.String(a.Key, redactLogText(a.Value.String()))
+	case slog.KindAny:
+		if err, ok := a.Value.Any().(error); ok {
+			return slog.String(a.Key, redactLogText(err.Error()))
+		}
+	}
+	return a
+}
+
+// redactLogText applies the review queue's redactions except the long number
+// rule, which would mask addresses, ports and timestamps operators rely on
+func redactLogText(text string) string {
+	for _, r := range redactionPatterns {
+		if r.replacement != "[number]" {
+			text = r.pattern.ReplaceAllString(text, r.replacement)
+		}
+	}
+	return text
+}
+
+// requestIDHandler adds the request ID of the logging context to each record
+type requestIDHandler struct {
+	slog.Handler
+}
+
+func (h requestIDHandler) Handle(ctx context.Context, record slog.Record) error {
+	if id := RequestIDFromContext(ctx); id != "" {
+		record.AddAttrs(slog.String("request_id", id))
+	}
+	return h.Handler.Handle(ctx, record)
+}
+
+func (h requestIDHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	return requestIDHandler{h.Handler.WithAttrs(attrs)}
+}
+
+func (h requestIDHandler) WithGroup(name string) slog.Handler {
+	return requestIDHandler{h.Handler.WithGroup(name)}
+}
@@ -0,0 +1,87 @@
+//go:build !windows && !plan9
+
+package internal
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"log/slog"
+	"log/syslog"
+	"net/url"
+	"sync"
+)
+
+// NewSyslogLogger returns a logger sending the lines of NewLogger, in format,
+// to syslog, with the priority of each line mapped from its level. Under systemd
+// the local syslog socket is journald's, so lines land in the journal with
+// that priority. The returned closer disconnects from syslog.
+func NewSyslogLogger(config LogSyslog, level *slog.LevelVar, format string) (*slog.Logger, io.Closer, error) {
+	network, addr := "", ""
+	if config.Addr != "" {
+		u, err := url.Parse(config.Addr)
+		if err != nil {
+			return nil, nil, fmt.Errorf("invalid syslog address %q: %w", config.Addr, err)
+		}
+		network, addr = u.Scheme, u.Host
+		if u.Host == "" {
+			addr = u.Path
+		}
+	}
+	writer, err := syslog.Dial(network, addr, syslog.LOG_DAEMON|syslog.LOG_INFO, config.Tag)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to connect to syslog: %w", err)
+	}
+
+	sink := &syslogSink{writer: writer}
+	handler := &syslogHandler{Handler: newLogHandler(sink, level, format), sink: sink}
+	return slog.New(requestIDHandler{handler}), writer, nil
+}
+
+// syslogSink writes each formatted line to syslog at the priority of the
+// record being handled
+type syslogSink struct {
+	mu     sync.Mutex
+	writer *syslog.Writer
+	level  slog.Level
+}
+
+func (s *syslogSink) Write(p []byte) (int, error) {
+	line := string(p)
+	var err error
+	switch {
+	case s.level >= slog.LevelError:
+		err = s.writer.Err(line)
+	case s.level >= slog.LevelWarn:
+		err = s.writer.Warning(line)
+	case s.level >= slog.LevelInfo:
+		err = s.writer.Info(line)
+	default:
+		err = s.writer.Debug(line)
+	}
+	if err != nil {
+		return 0, err
+	}
+	return len(p), nil
+}
+
+// syslogHandler tells the sink the level of each record its JSON handler writes
+type syslogHandler struct {
+	slog.Handler
+	sink *syslogSink
+}
+
+func (h *syslogHandler) Handle(ctx context.Context, record slog.Record) error {
+	h.sink.mu.Lock()
+	defer h.sink.mu.Unlock()
+	h.sink.level = record.Level
+	return h.Handler.Handle(ctx, record)
+}
+
+func (h *syslogHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	return &syslogHandler{Handler: h.Handler.WithAttrs(attrs), sink: h.sink}
+}
+
+func (h *syslogHandler) WithGroup(name string) slog.Handler {
+	return &syslogHandler{Handler: h.Handler.WithGroup(name), sink: h.sink}
+}
@@ -0,0 +1,14 @@
+//go:build windows || plan9
+
+package internal
+
+import (
+	"fmt"
+	"io"
+	"log/slog"
+)
+
+// NewSyslogLogger fails: the platform has no syslog
+func NewSyslogLogger(config LogSyslog, level *slog.LevelVar, format string) (*slog.Logger, io.Closer, error) {
+	return nil, nil, fmt.Errorf("log output %q is not supported on this platform", LogOutputSyslog)
+}
@@ -0,0 +1,137 @@
+package internal
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/mark3labs/mcp-go/mcp"
+	"github.com/mark3labs/mcp-go/server"
+)
+
+// Defaults of the StatsD emitter
+const (
+	DefaultStatsDPort   = 8125
+	DefaultStatsDPrefix = "perplexity_mcp."
+)
+
+// Metrics receives the server's measurements. Tags are key:value pairs;
+// emitters without tag support may drop them.
+type Metrics interface {
+	Count(name string, value int64, tags ...string)
+	Timing(name string, value time.Duration, tags ...string)
+	Close() error
+}
+
+// StatsDConfig enables the StatsD emitter when Host is set
+type StatsDConfig struct {
+	Host   string
+	Port   int
+	Prefix string
+	// Tags appends tags in the DogStatsD format understood by Datadog agents;
+	// plain StatsD servers reject them
+	Tags bool
+}
+
+func (c StatsDConfig) Validate() error {
+	if c.Host != "" && (c.Port <= 0 || c.Port > 65535) {
+		return fmt.Errorf("invalid StatsD port %d", c.Port)
+	}
+	return nil
+}
+
+// StatsDMetrics sends metrics to a StatsD server or Datadog agent over UDP.
+// Sends never block a call: lost packets and send errors are ignored.
+type StatsDMetrics struct {
+	prefix string
+	tags   bool
+
+	mu   sync.Mutex
+	conn net.Conn
+}
+
+// NewStatsDMetrics returns an emitter for config, or nil when no host is set
+func NewStatsDMetrics(config StatsDConfig) (*StatsDMetrics, error) {
+	if config.Host == "" {
+		return nil, nil
+	}
+	conn, err := net.Dial("udp", net.JoinHostPort(config.Host, strconv.Itoa(config.Port)))
+	if err != nil {
+		return nil, fmt.Errorf("failed to open StatsD connection: %w", err)
+	}
+	return &StatsDMetrics{prefix: config.Prefix, tags: config.Tags, conn: conn}, nil
+}
+
+func (m *StatsDMetrics) Count(name string, value int64, tags ...string) {
+	m.send(name, strconv.FormatInt(value, 10), "c", tags)
+}
+
+func (m *StatsDMetrics) Timing(name string, value time.Duration, tags ...string) {
+	m.send(name, strconv.FormatInt(value.Milliseconds(), 10), "ms", tags)
+}
+
+// send writes one metric line, such as prefix.name:1|c|#tool:x
+func (m *StatsDMetrics) send(name, value, kind string, tags []string) {
+	var line strings.Builder
+	line.WriteString(m.prefix + name + ":" + value + "|" + kind)
+	if m.tags && len(tags) > 0 {
+		line.WriteString("|#")
+		for i, tag := range tags {
+			if i > 0 {
+				line.WriteByte(',')
+			}
+			line.WriteString(statsDTagReplacer.Replace(tag))
+		}
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	_, _ = m.conn.Write([]byte(line.String()))
+}
+
+// statsDTagReplacer removes the separators of the line format from tags
+var statsDTagReplacer = strings.NewReplacer("|", "_", ",", "_", "#", "_", "\n", "_")
+
+func (m *StatsDMetrics) Close() error {
+	return m.conn.Close()
+}
+
+// MetricsMiddleware emits, for every tool call over transport, the counter
+// tool.calls and the timer tool.latency tagged with the tool, transport and
+// status, and the tokens and estimated cost reported in the result's _meta
+// as tokens.prompt, tokens.completion and cost.micro_usd tagged with the tool
+// and model
+func MetricsMiddleware(metrics Metrics, transport string) server.ToolHandlerMiddleware {
+	return func(next server.ToolHandlerFunc) server.ToolHandlerFunc {
+		return func(ctx context.Context, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+			start := time.Now()
+			result, err := next(ctx, request)
+
+			tool := "tool:" + request.Params.Name
+			status := "ok"
+			if err != nil || (result != nil && result.IsError) {
+				status = "error"
+			}
+			metrics.Count("tool.calls", 1, tool, "transport:"+transport, "status:"+status)
+			metrics.Timing("tool.latency", time.Since(start), tool, "transport:"+transport, "status:"+status)
+
+			if result != nil && result.Meta != nil {
+				fields := result.Meta.AdditionalFields
+				if usage, ok := fields["usage"].(Usage); ok && usage.TotalTokens > 0 {
+					model, _ := fields["model"].(string)
+					metrics.Count("tokens.prompt", int64(usage.PromptTokens), tool, "model:"+model)
+					metrics.Count("tokens.completion", int64(usage.CompletionTokens), tool, "model:"+model)
+					if cost, ok := fields["cost_usd"].(float64); ok {
+						metrics.Count("cost.micro_usd", int64(math.Round(cost*1e6)), tool, "model:"+model)
+					}
+				}
+			}
+			return result, err
+		}
+	}
+}
@@ -0,0 +1,51 @@
+package internal
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+
+	"github.com/mark3labs/mcp-go/mcp"
+)
+
+// modelFallbackEligible reports whether a search that failed with err may be
+// retried with a fallback model: the model was rate limited, the API failed,
+// or it timed out upstream
+func modelFallbackEligible(err error) bool {
+	var statusErr *StatusError
+	if errors.As(err, &statusErr) {
+		return statusErr.StatusCode == http.StatusTooManyRequests || statusErr.StatusCode >= http.StatusInternalServerError
+	}
+	var timeoutErr *TimeoutError
+	return errors.As(err, &timeoutErr) && timeoutErr.Kind == TimeoutKindUpstream
+}
+
+// searchWithModelFallback runs req for the named tool, each attempt bounded by
+// its tool and model timeout. When the model is rate limited or failing the
+// search is retried with the next model of its ModelFallbacks chain; an
+// answer from a fallback model records the model asked for in RequestedModel.
+func searchWithModelFallback(ctx context.Context, client SearchProvider, config *Config, tool string, req SearchRequest, progress *progressReporter) (*SearchResult, error) {
+	requested := req.Model
+	for {
+		progress.report(fmt.Sprintf("request sent to %s", req.Model))
+		stopWatch := watchSlowCall(ctx, config.SlowCallWarning, req.Model, progress)
+		timeout, limit := config.TimeoutFor(tool, req.Model)
+		result, err := searchWithTimeout(ctx, client, req, timeout, limit)
+		stopWatch()
+
+		next := config.ModelFallbacks[req.Model]
+		if err != nil && next != "" && ctx.Err() == nil && modelFallbackEligible(err) {
+			slog.Default().WarnContext(ctx, "Falling back to another model", "tool", tool, "model", req.Model, "fallback", next, "error", err)
+			sendLogNotification(ctx, mcp.LoggingLevelWarning, fmt.Sprintf("%s failed (%s), retrying with %s", req.Model, err, next))
+			req.Model = next
+			continue
+		}
+
+		if result != nil && req.Model != requested {
+			result.RequestedModel = requested
+		}
+		return result, err
+	}
+}
@@ -0,0 +1,67 @@
+package internal
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/mark3labs/mcp-go/mcp"
+)
+
+// NotebookURIPrefix is the URI scheme of per-session research notebooks
+const NotebookURIPrefix = "notebook://"
+
+// CreateNotebookResourceTemplate creates the notebook://{session_id} resource template
+func CreateNotebookResourceTemplate() mcp.ResourceTemplate {
+	return mcp.NewResourceTemplate(
+		NotebookURIPrefix+"{session_id}",
+		"Research notebook",
+		mcp.WithTemplateDescription("Markdown record of every answer and citation gathered in a perplexity_search session"),
+		mcp.WithTemplateMIMEType("text/markdown"),
+	)
+}
+
+// NotebookResourceHandler creates the resources/read handler for session notebooks
+func NotebookResourceHandler(sessions *SessionManager, live *LiveConfig) func(ctx context.Context, request mcp.ReadResourceRequest) ([]mcp.ResourceContents, error) {
+	return func(ctx context.Context, request mcp.ReadResourceRequest) ([]mcp.ResourceContents, error) {
+		sessionID := strings.TrimPrefix(request.Params.URI, NotebookURIPrefix)
+		entries, ok := sessions.Notebook(sessionID)
+		if !ok {
+			return nil, fmt.Errorf("session not found: %s", sessionID)
+		}
+
+		return []mcp.ResourceContents{
+			mcp.TextResourceContents{
+				URI:      request.Params.URI,
+				MIMEType: "text/markdown",
+				Text:     live.Get().ResponseRedactions.Redact(formatNotebook(sessionID, entries)),
+			},
+		}, nil
+	}
+}
+
+// formatNotebook renders a session's notebook entries as a markdown document
+func formatNotebook(sessionID string, entries []NotebookEntry) string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "# Research notebook: %s\n", sessionID)
+
+	for i, entry := range entries {
+		fmt.Fprintf(&b, "\n## %d. %s\n\n", i+1, entry.Query)
+		fmt.Fprintf(&b, "_%s · %s_\n\n", entry.Created.UTC().Format("2006-01-02 15:04:05 UTC"), entry.Model)
+		b.WriteString(strings.TrimSpace(entry.Answer))
+		b.WriteString("\n")
+
+		if len(entry.Citations) > 0 {
+			b.WriteString("\n**Citations**\n\n")
+			for _, citation := range entry.Citations {
+				title := citation.Title
+				if title == "" {
+					title = citation.URL
+				}
+				fmt.Fprintf(&b, "%d. [%s](%s)\n", citation.Number, title, citation.URL)
+			}
+		}
+	}
+
+	return b.String()
+}
@@ -0,0 +1,106 @@
+package internal
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/mark3labs/mcp-go/mcp"
+	"github.com/mark3labs/mcp-go/server"
+)
+
+// DefaultSlowCallWarning is the elapsed time after which clients are told a call is still running
+const DefaultSlowCallWarning = 20 * time.Second
+
+// sendLogNotification sends a notifications/message to the client that issued the current request.
+// Delivery is best effort: clients that are not initialized simply miss the message.
+func sendLogNotification(ctx context.Context, level mcp.LoggingLevel, message string) {
+	mcpServer := server.ServerFromContext(ctx)
+	if mcpServer == nil {
+		return
+	}
+	_ = mcpServer.SendNotificationToClient(ctx, "notifications/message", map[string]any{
+		"level":  level,
+		"logger": "perplexity",
+		"data":   message,
+	})
+}
+
+// progressReporter sends notifications/progress for a tool call made with a
+// progressToken. Calls without one get a nil reporter whose methods do nothing.
+type progressReporter struct {
+	ctx   context.Context
+	token mcp.ProgressToken
+
+	mu       sync.Mutex
+	progress int
+}
+
+func newProgressReporter(ctx context.Context, request mcp.CallToolRequest) *progressReporter {
+	if request.Params.Meta == nil || request.Params.Meta.ProgressToken == nil {
+		return nil
+	}
+	return &progressReporter{ctx: ctx, token: request.Params.Meta.ProgressToken}
+}
+
+// report advances progress by one step and describes the step in message.
+// The total is unknown, as answers are not streamed.
+func (p *progressReporter) report(message string) {
+	if p == nil {
+		return
+	}
+	mcpServer := server.ServerFromContext(p.ctx)
+	if mcpServer == nil {
+		return
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	p.progress++
+	_ = mcpServer.SendNotificationToClient(p.ctx, "notifications/progress", map[string]any{
+		"progressToken": p.token,
+		"progress":      p.progress,
+		"message":       message,
+	})
+}
+
+// reportResult reports the answer and citations received for result
+func (p *progressReporter) reportResult(result *SearchResult) {
+	p.report(fmt.Sprintf("response received, %d tokens", result.Usage.CompletionTokens))
+	p.report(fmt.Sprintf("%d citations collected", len(result.Citations)))
+}
+
+// watchSlowCall notifies the client every threshold while a call to model is still
+// running, so interactive users know the server isn't hung, and advances progress
+// when the call carries a progressToken. The returned function stops the watcher
+// and must be called once the call completes.
+func watchSlowCall(ctx context.Context, threshold time.Duration, model string, progress *progressReporter) func() {
+	if threshold <= 0 {
+		return func() {}
+	}
+
+	done := make(chan struct{})
+	go func() {
+		start := time.Now()
+		ticker := time.NewTicker(threshold)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-done:
+				return
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+				elapsed := time.Since(start).Round(time.Second)
+				sendLogNotification(ctx, mcp.LoggingLevelInfo,
+					fmt.Sprintf("still working, model=%s, elapsed=%s", model, elapsed))
+				progress.report(fmt.Sprintf("waiting for %s, elapsed %s", model, elapsed))
+			}
+		}
+	}()
+
+	return func() { close(done) }
+}
@@ -0,0 +1,373 @@
+package internal
+
+import "github.com/mark3labs/mcp-go/mcp"
+
+// JSON schemas of the structuredContent each tool returns alongside its text
+// block. Every successful result carries structuredContent matching its tool's
+// outputSchema, so clients can read fields without parsing the text.
+
+var usageSchema = map[string]any{
+	"type": "object",
+	"properties": map[string]any{
+		"prompt_tokens":     map[string]any{"type": "integer"},
+		"completion_tokens": map[string]any{"type": "integer"},
+		"total_tokens":      map[string]any{"type": "integer"},
+	},
+}
+
+var citationSchema = map[string]any{
+	"type": "object",
+	"properties": map[string]any{
+		"number":       map[string]any{"type": "integer"},
+		"url":          map[string]any{"type": "string"},
+		"title":        map[string]any{"type": "string"},
+		"original_url": map[string]any{"type": "string"},
+		"reachable":    map[string]any{"type": "boolean"},
+		"status":       map[string]any{"type": "integer"},
+		"doi":          map[string]any{"type": "string"},
+		"arxiv_id":     map[string]any{"type": "string"},
+	},
+	"required": []string{"number", "url"},
+}
+
+var sourceSchema = map[string]any{
+	"type": "object",
+	"properties": map[string]any{
+		"url":     map[string]any{"type": "string"},
+		"title":   map[string]any{"type": "string"},
+		"snippet": map[string]any{"type": "string"},
+	},
+	"required": []string{"url"},
+}
+
+var imageSchema = map[string]any{
+	"type": "object",
+	"properties": map[string]any{
+		"image_url":  map[string]any{"type": "string"},
+		"origin_url": map[string]any{"type": "string", "description": "The page the image appears on"},
+		"height":     map[string]any{"type": "integer"},
+		"width":      map[string]any{"type": "integer"},
+	},
+	"required": []string{"image_url"},
+}
+
+var sectionSchema = map[string]any{
+	"type": "object",
+	"properties": map[string]any{
+		"index":   map[string]any{"type": "integer"},
+		"title":   map[string]any{"type": "string"},
+		"level":   map[string]any{"type": "integer"},
+		"content": map[string]any{"type": "string"},
+	},
+	"required": []string{"index", "title", "level"},
+}
+
+var usageTotalsSchema = map[string]any{
+	"type": "object",
+	"properties": map[string]any{
+		"calls":             map[string]any{"type": "integer"},
+		"prompt_tokens":     map[string]any{"type": "integer"},
+		"completion_tokens": map[string]any{"type": "integer"},
+		"total_tokens":      map[string]any{"type": "integer"},
+		"cost_usd":          map[string]any{"type": "number"},
+	},
+}
+
+// answerProperties are the fields shared by results that wrap a Perplexity answer
+func answerProperties() map[string]any {
+	properties := map[string]any{
+		"id":           map[string]any{"type": "string", "description": "Result ID, usable with perplexity_get_section and perplexity_annotate"},
+		"resource_uri": map[string]any{"type": "string", "description": "search:// resource holding the full result"},
+		"model":        map[string]any{"type": "string", "description": "The model that answered"},
+		"usage":        usageSchema,
+		"created":      map[string]any{"type": "string", "format": "date-time"},
+		"content":      map[string]any{"type": "string", "description": "The answer, or the unavailable message of a degraded call"},
+		"stale":        map[string]any{"type": "boolean", "description": "Cached answer returned because the API was unavailable"},
+		"citations":    map[string]any{"type": "array", "items": citationSchema},
+		"reasoning":    map[string]any{"type": "string", "description": "Reasoning trace, with reasoning_output set to separate"},
+	}
+	properties["requested_model"] = map[string]any{"type": "string", "description": "The model asked for, when a fallback model answered because it was unavailable"}
+	return properties
+}
+
+// searchOutputSchema describes perplexity_search results
+func searchOutputSchema() mcp.ToolOutputSchema {
+	properties := answerProperties()
+	properties["session_id"] = map[string]any{"type": "string"}
+	properties["sources_only"] = map[string]any{"type": "boolean"}
+	properties["citation_map"] = map[string]any{
+		"type":                 "object",
+		"description":          "Citation numbers returned by the API mapped to their number after deduplication",
+		"additionalProperties": map[string]any{"type": "integer"},
+	}
+	properties["sources"] = map[string]any{"type": "array", "items": sourceSchema}
+	properties["images"] = map[string]any{"type": "array", "description": "Images related to the answer, with return_images", "items": imageSchema}
+	properties["query_rewrite"] = map[string]any{
+		"type":        "object",
+		"description": "The query searched in place of the one asked, with rewrite_query",
+		"properties": map[string]any{
+			"original":  map[string]any{"type": "string"},
+			"rewritten": map[string]any{"type": "string"},
+			"model":     map[string]any{"type": "string"},
+			"usage":     usageSchema,
+		},
+		"required": []string{"original", "rewritten"},
+	}
+	properties["sections"] = map[string]any{"type": "array", "items": sectionSchema}
+	properties["truncation"] = map[string]any{
+		"type":        "object",
+		"description": "Present when max_response_chars cut the answer short",
+		"properties": map[string]any{
+			"total_chars":      map[string]any{"type": "integer"},
+			"returned_chars":   map[string]any{"type": "integer"},
+			"continuation_uri": map[string]any{"type": "string"},
+		},
+		"required": []string{"total_chars", "returned_chars", "continuation_uri"},
+	}
+	return mcp.ToolOutputSchema{Type: "object", Properties: properties}
+}
+
+// checkAgainstOutputSchema describes perplexity_check_against results
+func checkAgainstOutputSchema() mcp.ToolOutputSchema {
+	findings := map[string]any{
+		"type": "array",
+		"items": map[string]any{
+			"type": "object",
+			"properties": map[string]any{
+				"statement": map[string]any{"type": "string"},
+				"citations": map[string]any{"type": "array", "items": citationSchema},
+			},
+			"required": []string{"statement"},
+		},
+	}
+	properties := answerProperties()
+	properties["comparison"] = map[string]any{
+		"type": "object",
+		"properties": map[string]any{
+			"agrees":      findings,
+			"contradicts": findings,
+			"adds":        findings,
+		},
+		"required": []string{"agrees", "contradicts", "adds"},
+	}
+	return mcp.ToolOutputSchema{Type: "object", Properties: properties}
+}
+
+// getSectionOutputSchema describes perplexity_get_section results: the table
+// of contents in sections, or one section's fields
+func getSectionOutputSchema() mcp.ToolOutputSchema {
+	return mcp.ToolOutputSchema{
+		Type: "object",
+		Properties: map[string]any{
+			"result_id": map[string]any{"type": "string"},
+			"sections":  map[string]any{"type": "array", "items": sectionSchema},
+			"section":   map[string]any{"type": "integer"},
+			"title":     map[string]any{"type": "string"},
+			"level":     map[string]any{"type": "integer"},
+			"content":   map[string]any{"type": "string"},
+		},
+		Required: []string{"result_id"},
+	}
+}
+
+// annotateOutputSchema describes perplexity_annotate results
+func annotateOutputSchema() mcp.ToolOutputSchema {
+	return mcp.ToolOutputSchema{
+		Type: "object",
+		Properties: map[string]any{
+			"result_id":   map[string]any{"type": "string"},
+			"annotations": map[string]any{"type": "integer", "description": "Number of annotations on the result"},
+			"annotation": map[string]any{
+				"type": "object",
+				"properties": map[string]any{
+					"rating":              map[string]any{"type": "integer"},
+					"notes":               map[string]any{"type": "string"},
+					"incorrect_citations": map[string]any{"type": "array", "items": map[string]any{"type": "integer"}},
+					"created":             map[string]any{"type": "string", "format": "date-time"},
+				},
+			},
+		},
+		Required: []string{"result_id", "annotations", "annotation"},
+	}
+}
+
+// usageOutputSchema describes perplexity_usage results
+func usageOutputSchema() mcp.ToolOutputSchema {
+	breakdown := map[string]any{"type": "object", "additionalProperties": usageTotalsSchema}
+	return mcp.ToolOutputSchema{
+		Type: "object",
+		Properties: map[string]any{
+			"server": map[string]any{
+				"type": "object",
+				"properties": map[string]any{
+					"since":    map[string]any{"type": "string", "format": "date-time"},
+					"total":    usageTotalsSchema,
+					"by_model": breakdown,
+					"by_tool":  breakdown,
+				},
+			},
+			"result_cache": map[string]any{
+				"type": "object",
+				"properties": map[string]any{
+					"hits":     map[string]any{"type": "integer"},
+					"misses":   map[string]any{"type": "integer"},
+					"hit_rate": map[string]any{"type": "number"},
+				},
+			},
+			"session": map[string]any{
+				"type": "object",
+				"properties": map[string]any{
+					"session_id": map[string]any{"type": "string"},
+					"total":      usageTotalsSchema,
+				},
+			},
+		},
+		Required: []string{"server", "result_cache"},
+	}
+}
+
+// rawOutputSchema describes perplexity_raw results, the API response as returned
+func rawOutputSchema() mcp.ToolOutputSchema {
+	return mcp.ToolOutputSchema{
+		Type: "object",
+		Properties: map[string]any{
+			"id":      map[string]any{"type": "string"},
+			"model":   map[string]any{"type": "string"},
+			"usage":   usageSchema,
+			"choices": map[string]any{"type": "array"},
+		},
+	}
+}
+
+// jobProperties are the fields of a research job, without its result
+func jobProperties() map[string]any {
+	return map[string]any{
+		"job_id":       map[string]any{"type": "string"},
+		"status":       map[string]any{"type": "string", "enum": JobStatuses},
+		"query":        map[string]any{"type": "string"},
+		"model":        map[string]any{"type": "string"},
+		"created":      map[string]any{"type": "string", "format": "date-time"},
+		"finished":     map[string]any{"type": "string", "format": "date-time"},
+		"resource_uri": map[string]any{"type": "string", "description": "job:// resource with the job's status and result"},
+		"error":        map[string]any{"type": "string", "description": "Why a failed job failed"},
+		"result_id":    map[string]any{"type": "string", "description": "Result ID of a completed job's answer"},
+		"callback_url": map[string]any{"type": "string"},
+	}
+}
+
+// jobOutputSchema describes the results of tools that return one research
+// job: perplexity_research_async, perplexity_job_result and perplexity_job_cancel
+func jobOutputSchema() mcp.ToolOutputSchema {
+	properties := jobProperties()
+	properties["result"] = map[string]any{
+		"type":        "object",
+		"description": "The result of a completed job, as returned by perplexity_search",
+		"properties":  searchOutputSchema().Properties,
+	}
+	return mcp.ToolOutputSchema{
+		Type:       "object",
+		Properties: properties,
+		Required:   []string{"job_id", "status", "resource_uri"},
+	}
+}
+
+// jobStatusOutputSchema describes perplexity_job_status results
+func jobStatusOutputSchema() mcp.ToolOutputSchema {
+	job := map[string]any{"type": "object", "properties": jobProperties(), "required": []string{"job_id", "status", "resource_uri"}}
+	return mcp.ToolOutputSchema{
+		Type: "object",
+		Properties: map[string]any{
+			"jobs": map[string]any{"type": "array", "items": job},
+		},
+		Required: []string{"jobs"},
+	}
+}
+
+// summarizeOutputSchema describes perplexity_summarize results
+func summarizeOutputSchema() mcp.ToolOutputSchema {
+	properties := answerProperties()
+	properties["content"] = map[string]any{"type": "string", "description": "The executive summary"}
+	properties["usage"] = map[string]any{"type": "object", "description": "Tokens of both steps", "properties": usageSchema["properties"]}
+	properties["word_count"] = map[string]any{"type": "integer"}
+	properties["target_words"] = map[string]any{"type": "integer"}
+	properties["summary_usage"] = usageSchema
+	properties["search"] = map[string]any{
+		"type":        "object",
+		"description": "The search answer that was summarized",
+		"properties": map[string]any{
+			"id":           map[string]any{"type": "string"},
+			"resource_uri": map[string]any{"type": "string"},
+			"model":        map[string]any{"type": "string"},
+			"usage":        usageSchema,
+		},
+		"required": []string{"id", "resource_uri"},
+	}
+	return mcp.ToolOutputSchema{
+		Type:       "object",
+		Properties: properties,
+		Required:   []string{"id", "content", "usage", "search"},
+	}
+}
+
+// researchWorkflowOutputSchema describes perplexity_research_workflow results
+func researchWorkflowOutputSchema() mcp.ToolOutputSchema {
+	properties := answerProperties()
+	properties["content"] = map[string]any{"type": "string", "description": "The synthesized report"}
+	properties["citations"] = map[string]any{"type": "array", "description": "Citations of all sub-question answers, merged and renumbered", "items": citationSchema}
+	properties["usage"] = map[string]any{"type": "object", "description": "Tokens of every step", "properties": usageSchema["properties"]}
+	properties["step_usage"] = map[string]any{
+		"type": "object",
+		"properties": map[string]any{
+			"plan":      usageSchema,
+			"search":    usageSchema,
+			"synthesis": usageSchema,
+		},
+	}
+	properties["partial"] = map[string]any{"type": "boolean", "description": "Set when budget_seconds expired before the synthesis; content then holds the answered sub-questions"}
+	properties["sub_questions"] = map[string]any{
+		"type": "array",
+		"items": map[string]any{
+			"type": "object",
+			"properties": map[string]any{
+				"index":        map[string]any{"type": "integer"},
+				"question":     map[string]any{"type": "string"},
+				"id":           map[string]any{"type": "string"},
+				"resource_uri": map[string]any{"type": "string"},
+				"error":        map[string]any{"type": "string"},
+			},
+			"required": []string{"index", "question"},
+		},
+	}
+	return mcp.ToolOutputSchema{
+		Type:       "object",
+		Properties: properties,
+		Required:   []string{"id", "content", "usage", "sub_questions"},
+	}
+}
+
+// batchSearchOutputSchema describes perplexity_batch_search results
+func batchSearchOutputSchema() mcp.ToolOutputSchema {
+	item := map[string]any{
+		"type": "object",
+		"properties": map[string]any{
+			"index": map[string]any{"type": "integer"},
+			"query": map[string]any{"type": "string"},
+			"result": map[string]any{
+				"type":        "object",
+				"description": "The result of a successful query, as returned by perplexity_search",
+				"properties":  searchOutputSchema().Properties,
+			},
+			"error": map[string]any{"type": "string"},
+		},
+		"required": []string{"index", "query"},
+	}
+	return mcp.ToolOutputSchema{
+		Type: "object",
+		Properties: map[string]any{
+			"results":   map[string]any{"type": "array", "items": item},
+			"succeeded": map[string]any{"type": "integer"},
+			"failed":    map[string]any{"type": "integer"},
+		},
+		Required: []string{"results", "succeeded", "failed"},
+	}
+}
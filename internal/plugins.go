@@ -0,0 +1,227 @@
+package internal
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"regexp"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/mark3labs/mcp-go/mcp"
+)
+
+// Limits on plugin executables
+const (
+	// pluginDescribeTimeout bounds the describe call made for each plugin at startup
+	pluginDescribeTimeout = 10 * time.Second
+	// MaxPluginOutputBytes is the largest response read from a plugin
+	MaxPluginOutputBytes = 1024 * 1024
+	// maxPluginStderrBytes is how much of a failed plugin's stderr is reported
+	maxPluginStderrBytes = 4096
+)
+
+// pluginEnv lists the environment variables passed to plugins. Everything
+// else, including API keys and tokens, is withheld.
+var pluginEnv = []string{"PATH", "HOME", "LANG", "TMPDIR", "TZ"}
+
+var pluginToolNamePattern = regexp.MustCompile(`^[A-Za-z0-9_-]{1,64}$`)
+
+// PluginTool is an MCP tool served by an executable in the plugin directory.
+//
+// Plugins speak JSON over stdin and stdout. "<plugin> describe" prints
+// {"tools": [{"name", "description", "input_schema"}]}; "<plugin> call <name>"
+// reads the call's arguments object on stdin and prints
+// {"content": "...", "is_error": false}.
+type PluginTool struct {
+	Path string
+	Tool mcp.Tool
+}
+
+type pluginDescription struct {
+	Tools []struct {
+		Name        string          `json:"name"`
+		Description string          `json:"description"`
+		InputSchema json.RawMessage `json:"input_schema"`
+	} `json:"tools"`
+}
+
+type pluginResponse struct {
+	Content string `json:"content"`
+	IsError bool   `json:"is_error"`
+}
+
+// LoadPlugins describes every executable in dir and returns their tools.
+// Hidden files and files without an execute bit are skipped. A plugin that
+// fails to describe itself, or a tool name that is invalid or already taken
+// by reserved or another plugin, is an error so a broken deployment fails at
+// startup.
+func LoadPlugins(ctx context.Context, dir string, reserved []string) ([]PluginTool, error) {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read plugin directory: %w", err)
+	}
+
+	var tools []PluginTool
+	taken := slices.Clone(reserved)
+	for _, entry := range entries {
+		if strings.HasPrefix(entry.Name(), ".") || entry.IsDir() {
+			continue
+		}
+		info, err := entry.Info()
+		if err != nil || !info.Mode().IsRegular() || info.Mode().Perm()&0o111 == 0 {
+			continue
+		}
+
+		path := filepath.Join(dir, entry.Name())
+		describeCtx, cancel := context.WithTimeout(ctx, pluginDescribeTimeout)
+		output, err := runPlugin(describeCtx, path, nil, "describe")
+		cancel()
+		if err != nil {
+			return nil, fmt.Errorf("plugin %s: describe failed: %w", entry.Name(), err)
+		}
+
+		var description pluginDescription
+		if err := json.Unmarshal(output, &description); err != nil {
+			return nil, fmt.Errorf("plugin %s: invalid description: %w", entry.Name(), err)
+		}
+		for _, tool := range description.Tools {
+			if !pluginToolNamePattern.MatchString(tool.Name) {
+				return nil, fmt.Errorf("plugin %s: invalid tool name %q", entry.Name(), tool.Name)
+			}
+			if slices.Contains(taken, tool.Name) {
+				return nil, fmt.Errorf("plugin %s: tool name %s is already in use", entry.Name(), tool.Name)
+			}
+			taken = append(taken, tool.Name)
+
+			schema := tool.InputSchema
+			if len(schema) == 0 {
+				schema = json.RawMessage(`{"type":"object"}`)
+			}
+			tools = append(tools, PluginTool{
+				Path: path,
+				Tool: mcp.NewToolWithRawSchema(tool.Name, tool.Description, schema),
+			})
+		}
+	}
+	return tools, nil
+}
+
+// PluginHandler creates the handler function for a plugin tool. Calls are
+// bounded by the tool's timeout.
+func PluginHandler(plugin PluginTool, live *LiveConfig) func(ctx context.Context, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+	return func(ctx context.Context, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+		config := live.Get()
+
+		timeout, _ := config.TimeoutFor(plugin.Tool.Name, "")
+		response, err := callPlugin(ctx, plugin, request.GetArguments(), timeout)
+		if err != nil {
+			return &mcp.CallToolResult{
+				Content: []mcp.Content{
+					mcp.TextContent{
+						Type: "text",
+						Text: fmt.Sprintf("Plugin %s failed: %s", plugin.Tool.Name, err.Error()),
+					},
+				},
+				IsError: true,
+			}, err
+		}
+
+		return &mcp.CallToolResult{
+			Content: []mcp.Content{
+				mcp.TextContent{
+					Type: "text",
+					Text: response.Content,
+				},
+			},
+			IsError: response.IsError,
+		}, nil
+	}
+}
+
+// callPlugin runs one call of a plugin tool with arguments on stdin
+func callPlugin(ctx context.Context, plugin PluginTool, arguments map[string]any, timeout time.Duration) (*pluginResponse, error) {
+	input, err := json.Marshal(arguments)
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode arguments: %w", err)
+	}
+
+	callCtx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	output, err := runPlugin(callCtx, plugin.Path, input, "call", plugin.Tool.Name)
+	if err != nil {
+		return nil, err
+	}
+	var response pluginResponse
+	if err := json.Unmarshal(output, &response); err != nil {
+		return nil, fmt.Errorf("invalid response: %w", err)
+	}
+	return &response, nil
+}
+
+// runPlugin runs the plugin at path with args, writing stdin to it, and
+// returns its stdout
+func runPlugin(ctx context.Context, path string, stdin []byte, args ...string) ([]byte, error) {
+	cmd := exec.CommandContext(ctx, path, args...)
+	cmd.Dir = filepath.Dir(path)
+	cmd.Env = []string{}
+	for _, key := range pluginEnv {
+		if value, ok := os.LookupEnv(key); ok {
+			cmd.Env = append(cmd.Env, key+"="+value)
+		}
+	}
+	cmd.Stdin = bytes.NewReader(stdin)
+	var stderr bytes.Buffer
+	cmd.Stderr = &limitedWriter{buf: &stderr, remaining: maxPluginStderrBytes}
+
+	stdout, err := cmd.StdoutPipe()
+	if err != nil {
+		return nil, err
+	}
+	if err := cmd.Start(); err != nil {
+		return nil, err
+	}
+	output, readErr := io.ReadAll(io.LimitReader(stdout, MaxPluginOutputBytes+1))
+	// Stop a plugin still writing past the limit instead of waiting for it
+	if len(output) > MaxPluginOutputBytes {
+		_ = cmd.Process.Kill()
+	}
+	waitErr := cmd.Wait()
+
+	switch {
+	case ctx.Err() == context.DeadlineExceeded:
+		return nil, fmt.Errorf("timed out")
+	case len(output) > MaxPluginOutputBytes:
+		return nil, fmt.Errorf("output exceeds %d bytes", MaxPluginOutputBytes)
+	case waitErr != nil:
+		if message := strings.TrimSpace(stderr.String()); message != "" {
+			return nil, fmt.Errorf("%w: %s", waitErr, message)
+		}
+		return nil, waitErr
+	case readErr != nil:
+		return nil, readErr
+	}
+	return output, nil
+}
+
+// limitedWriter keeps the first remaining bytes written to it and discards the rest
+type limitedWriter struct {
+	buf       *bytes.Buffer
+	remaining int
+}
+
+func (w *limitedWriter) Write(p []byte) (int, error) {
+	if w.remaining > 0 {
+		n := min(len(p), w.remaining)
+		w.buf.Write(p[:n])
+		w.remaining -= n
+	}
+	return len(p), nil
+}
@@ -0,0 +1,168 @@
+package internal
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/mark3labs/mcp-go/mcp"
+	"github.com/stretchr/testify/require"
+)
+
+// writePlugin writes an executable shell script named name to dir that prints
+// description for describe and runs call for calls
+func writePlugin(t *testing.T, dir, name, description, call string) {
+	t.Helper()
+	script := "#!/bin/sh\ncase \"$1\" in\ndescribe) echo '" + description + "' ;;\ncall)\n" + call + "\n;;\nesac\n"
+	require.NoError(t, os.WriteFile(filepath.Join(dir, name), []byte(script), 0o755))
+}
+
+// callPluginTool calls the only tool of the plugins in dir
+func callPluginTool(t *testing.T, dir string, config *Config, arguments map[string]any) (*mcp.CallToolResult, error) {
+	t.Helper()
+	plugins, err := LoadPlugins(context.Background(), dir, nil)
+	require.NoError(t, err)
+	require.Len(t, plugins, 1)
+
+	var request mcp.CallToolRequest
+	request.Params.Name = plugins[0].Tool.Name
+	request.Params.Arguments = arguments
+	return PluginHandler(plugins[0], NewLiveConfig(config))(context.Background(), request)
+}
+
+func TestLoadPluginsDiscoversExecutables(t *testing.T) {
+	dir := t.TempDir()
+	writePlugin(t, dir, "echo", `{"tools":[{"name":"echo","description":"Echo the arguments","input_schema":{"type":"object","properties":{"text":{"type":"string"}}}},{"name":"ping","description":"Ping"}]}`,
+		`input=$(cat | sed 's/"/\\"/g'); printf '{"content":"%s %s"}' "$2" "$input"`)
+	// Neither hidden files, files without an execute bit nor directories are run
+	writePlugin(t, dir, ".hidden", `not json`, "")
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "README"), []byte("#!/bin/sh\nexit 1\n"), 0o644))
+	require.NoError(t, os.Mkdir(filepath.Join(dir, "lib"), 0o755))
+
+	plugins, err := LoadPlugins(context.Background(), dir, []string{"perplexity_search"})
+	require.NoError(t, err)
+	require.Len(t, plugins, 2)
+	require.Equal(t, filepath.Join(dir, "echo"), plugins[0].Path)
+	require.Equal(t, "echo", plugins[0].Tool.Name)
+	require.Equal(t, "Echo the arguments", plugins[0].Tool.Description)
+	require.JSONEq(t, `{"type":"object","properties":{"text":{"type":"string"}}}`, string(plugins[0].Tool.RawInputSchema))
+	require.Equal(t, "ping", plugins[1].Tool.Name)
+	require.JSONEq(t, `{"type":"object"}`, string(plugins[1].Tool.RawInputSchema), "tools without a schema take any object")
+
+	var request mcp.CallToolRequest
+	request.Params.Name = "echo"
+	request.Params.Arguments = map[string]any{"text": "hello"}
+	result, err := PluginHandler(plugins[0], NewLiveConfig(&Config{RequestTimeout: 5 * time.Second}))(context.Background(), request)
+	require.NoError(t, err)
+	require.False(t, result.IsError)
+	require.Equal(t, `echo {"text":"hello"}`, result.Content[0].(mcp.TextContent).Text)
+}
+
+func TestLoadPluginsRejectsBrokenPlugins(t *testing.T) {
+	tests := []struct {
+		name    string
+		plugins map[string]string
+		wantErr string
+	}{
+		{
+			name:    "reserved tool name",
+			plugins: map[string]string{"search": `{"tools":[{"name":"perplexity_search"}]}`},
+			wantErr: "plugin search: tool name perplexity_search is already in use",
+		},
+		{
+			name: "name taken by another plugin",
+			plugins: map[string]string{
+				"a": `{"tools":[{"name":"lookup"}]}`,
+				"b": `{"tools":[{"name":"lookup"}]}`,
+			},
+			wantErr: "plugin b: tool name lookup is already in use",
+		},
+		{
+			name:    "name taken twice by one plugin",
+			plugins: map[string]string{"a": `{"tools":[{"name":"lookup"},{"name":"lookup"}]}`},
+			wantErr: "plugin a: tool name lookup is already in use",
+		},
+		{
+			name:    "invalid tool name",
+			plugins: map[string]string{"a": `{"tools":[{"name":"look up"}]}`},
+			wantErr: `plugin a: invalid tool name "look up"`,
+		},
+		{
+			name:    "invalid description",
+			plugins: map[string]string{"a": `tools: lookup`},
+			wantErr: "plugin a: invalid description",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := t.TempDir()
+			for name, description := range tt.plugins {
+				writePlugin(t, dir, name, description, "")
+			}
+			_, err := LoadPlugins(context.Background(), dir, []string{"perplexity_search"})
+			require.ErrorContains(t, err, tt.wantErr)
+		})
+	}
+
+	dir := t.TempDir()
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "failing"), []byte("#!/bin/sh\necho 'missing dependency' >&2\nexit 3\n"), 0o755))
+	_, err := LoadPlugins(context.Background(), dir, nil)
+	require.EqualError(t, err, "plugin failing: describe failed: exit status 3: missing dependency")
+
+	_, err = LoadPlugins(context.Background(), filepath.Join(dir, "missing"), nil)
+	require.ErrorContains(t, err, "failed to read plugin directory")
+}
+
+func TestPluginHandlerLimitsOutput(t *testing.T) {
+	dir := t.TempDir()
+	// Writes forever, so the plugin must be stopped at the limit
+	writePlugin(t, dir, "chatty", `{"tools":[{"name":"chatty"}]}`, `exec yes`)
+
+	result, err := callPluginTool(t, dir, &Config{RequestTimeout: 10 * time.Second}, nil)
+	require.EqualError(t, err, "output exceeds 1048576 bytes")
+	require.True(t, result.IsError)
+	require.Equal(t, "Plugin chatty failed: output exceeds 1048576 bytes", result.Content[0].(mcp.TextContent).Text)
+}
+
+func TestPluginHandlerTimesOut(t *testing.T) {
+	dir := t.TempDir()
+	writePlugin(t, dir, "slow", `{"tools":[{"name":"slow"}]}`, `exec sleep 10`)
+	config := &Config{RequestTimeout: 10 * time.Second, ToolTimeouts: map[string]time.Duration{"slow": 100 * time.Millisecond}}
+
+	start := time.Now()
+	result, err := callPluginTool(t, dir, config, nil)
+	require.EqualError(t, err, "timed out")
+	require.True(t, result.IsError)
+	require.Less(t, time.Since(start), 5*time.Second, "the tool timeout applies")
+}
+
+func TestPluginHandlerReportsPluginErrors(t *testing.T) {
+	dir := t.TempDir()
+	writePlugin(t, dir, "lookup", `{"tools":[{"name":"lookup"}]}`, `echo '{"content":"no such record","is_error":true}'`)
+
+	result, err := callPluginTool(t, dir, &Config{RequestTimeout: 5 * time.Second}, nil)
+	require.NoError(t, err, "errors reported by the plugin are tool results")
+	require.True(t, result.IsError)
+	require.Equal(t, "no such record", result.Content[0].(mcp.TextContent).Text)
+}
+
+func TestPluginsRunWithStrippedEnvironment(t *testing.T) {
+	t.Setenv("PERPLEXITY_API_KEY", "secret-key")
+	t.Setenv("AUTH_TOKENS", "secret-token")
+	t.Setenv("TZ", "UTC")
+
+	dir := t.TempDir()
+	writePlugin(t, dir, "env", `{"tools":[{"name":"env"}]}`,
+		`printf '{"content":"%s"}' "$(env | cut -d= -f1 | sort | tr '\n' ' ')"`)
+
+	result, err := callPluginTool(t, dir, &Config{RequestTimeout: 5 * time.Second}, nil)
+	require.NoError(t, err)
+	names := strings.Fields(result.Content[0].(mcp.TextContent).Text)
+	require.Contains(t, names, "PATH")
+	require.Contains(t, names, "TZ")
+	require.NotContains(t, names, "PERPLEXITY_API_KEY")
+	require.NotContains(t, names, "AUTH_TOKENS")
+}
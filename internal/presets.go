@@ -0,0 +1,283 @@
+package internal
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/mark3labs/mcp-go/mcp"
+)
+
+// secSearchSystemPrompt keeps answers from SEC filings traceable to the filing
+const secSearchSystemPrompt = `Answer from SEC filings. For every figure or statement, name the company, the form type (such as 10-K, 10-Q or 8-K) and the fiscal period or filing date it comes from, and cite the filing. Quote reported numbers as filed, with their units, and say so when the filings do not answer the question.`
+
+// CreateSECSearchTool creates the perplexity_sec_search tool, a preset of
+// perplexity_search that searches SEC filings only
+func CreateSECSearchTool(config *Config) mcp.Tool {
+	tool := mcp.Tool{
+		Name:        "perplexity_sec_search",
+		Description: "Search SEC EDGAR filings (10-K, 10-Q, 8-K and others) for financial research. Answers name the company, form type and period of every figure and cite the filings.",
+		InputSchema: mcp.ToolInputSchema{
+			Type: "object",
+			Properties: map[string]any{
+				"query": map[string]any{
+					"type":        "string",
+					"description": "The question, e.g. \"Apple's revenue by segment in fiscal 2024\"",
+					"minLength":   1,
+					"maxLength":   config.MaxQueryLength,
+				},
+				"model": map[string]any{
+					"type":        "string",
+					"description": fmt.Sprintf("The Sonar model to use (optional, defaults to '%s')", config.DefaultModelFor("perplexity_sec_search")),
+					"enum":        config.Models(),
+				},
+				"max_tokens": map[string]any{
+					"type":        "number",
+					"description": "Maximum number of tokens in the response (optional)",
+					"minimum":     1,
+					"maximum":     128000,
+				},
+				"output_format": map[string]any{
+					"type":        "string",
+					"description": "Format of the returned result (optional, defaults to 'json')",
+					"enum":        []string{OutputFormatJSON, OutputFormatMarkdown},
+					"default":     OutputFormatJSON,
+				},
+			},
+			Required: []string{"query"},
+		},
+		OutputSchema: searchOutputSchema(),
+	}
+	relaxModelSchema(&tool, config)
+	return tool
+}
+
+// SECSearchHandler creates the handler function for the perplexity_sec_search tool
+func SECSearchHandler(client SearchProvider, live *LiveConfig, results *ResultStore, sessions *SessionManager, sampler *QualitySampler, usage *UsageTracker) func(ctx context.Context, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+	return searchHandler("perplexity_sec_search", parseSECSearchRequest, client, live, results, sessions, sampler, usage)
+}
+
+func parseSECSearchRequest(request mcp.CallToolRequest) (*SearchRequest, error) {
+	query, err := request.RequireString("query")
+	if err != nil {
+		return nil, fmt.Errorf("query must be a string")
+	}
+	maxTokens, err := integerArgument(request, "max_tokens")
+	if err != nil {
+		return nil, err
+	}
+
+	req := &SearchRequest{
+		Query:        query,
+		Model:        request.GetString("model", ""),
+		SearchMode:   SearchModeSEC,
+		SystemPrompt: secSearchSystemPrompt,
+		OutputFormat: request.GetString("output_format", ""),
+	}
+	if maxTokens != nil {
+		req.MaxTokens = *maxTokens
+	}
+	return req, nil
+}
+
+// DefaultNewsDateRange is the recency filter of perplexity_news calls that set none
+const DefaultNewsDateRange = "week"
+
+// MaxNewsLanguageLength bounds the language hint of perplexity_news
+const MaxNewsLanguageLength = 50
+
+// newsSystemPrompt shapes news answers into a digest, newest first
+const newsSystemPrompt = `Write a news digest. List each development as a bullet starting with its publication date in bold (YYYY-MM-DD), newest first, followed by a one-sentence headline and a short summary with citations. Group reports of the same event into one bullet, and say so when there is no news in the period.`
+
+// CreateNewsTool creates the perplexity_news tool, a preset of perplexity_search
+// that searches news and returns a dated digest
+func CreateNewsTool(config *Config) mcp.Tool {
+	tool := mcp.Tool{
+		Name:        "perplexity_news",
+		Description: "Get recent news on a topic as a dated digest with sources, newest first. Searches news only, over the past week unless date_range says otherwise.",
+		InputSchema: mcp.ToolInputSchema{
+			Type: "object",
+			Properties: map[string]any{
+				"query": map[string]any{
+					"type":        "string",
+					"description": "The topic to get news on",
+					"minLength":   1,
+					"maxLength":   config.MaxQueryLength,
+				},
+				"date_range": map[string]any{
+					"type":        "string",
+					"description": fmt.Sprintf("How far back to look (optional, defaults to '%s')", DefaultNewsDateRange),
+					"enum":        DateRanges,
+					"default":     DefaultNewsDateRange,
+				},
+				"region": map[string]any{
+					"type":        "string",
+					"description": "Two-letter ISO country code to favor news from, e.g. \"DE\" (optional)",
+					"minLength":   2,
+					"maxLength":   2,
+				},
+				"language": map[string]any{
+					"type":        "string",
+					"description": "Language to write the digest in, e.g. \"German\" (optional, defaults to the language of the query)",
+					"maxLength":   MaxNewsLanguageLength,
+				},
+				"model": map[string]any{
+					"type":        "string",
+					"description": fmt.Sprintf("The Sonar model to use (optional, defaults to '%s')", config.DefaultModelFor("perplexity_news")),
+					"enum":        config.Models(),
+				},
+				"max_tokens": map[string]any{
+					"type":        "number",
+					"description": "Maximum number of tokens in the response (optional)",
+					"minimum":     1,
+					"maximum":     128000,
+				},
+				"output_format": map[string]any{
+					"type":        "string",
+					"description": "Format of the returned result (optional, defaults to 'markdown')",
+					"enum":        []string{OutputFormatJSON, OutputFormatMarkdown},
+					"default":     OutputFormatMarkdown,
+				},
+			},
+			Required: []string{"query"},
+		},
+		OutputSchema: searchOutputSchema(),
+	}
+	relaxModelSchema(&tool, config)
+	return tool
+}
+
+// NewsHandler creates the handler function for the perplexity_news tool
+func NewsHandler(client SearchProvider, live *LiveConfig, results *ResultStore, sessions *SessionManager, sampler *QualitySampler, usage *UsageTracker) func(ctx context.Context, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+	return searchHandler("perplexity_news", parseNewsRequest, client, live, results, sessions, sampler, usage)
+}
+
+func parseNewsRequest(request mcp.CallToolRequest) (*SearchRequest, error) {
+	query, err := request.RequireString("query")
+	if err != nil {
+		return nil, fmt.Errorf("query must be a string")
+	}
+	maxTokens, err := integerArgument(request, "max_tokens")
+	if err != nil {
+		return nil, err
+	}
+
+	req := &SearchRequest{
+		Query:        query,
+		Model:        request.GetString("model", ""),
+		SearchMode:   SearchModeNews,
+		DateRange:    request.GetString("date_range", DefaultNewsDateRange),
+		SystemPrompt: newsSystemPrompt,
+		OutputFormat: request.GetString("output_format", OutputFormatMarkdown),
+	}
+	if maxTokens != nil {
+		req.MaxTokens = *maxTokens
+	}
+	if region := request.GetString("region", ""); region != "" {
+		req.UserLocation = &UserLocation{Country: strings.ToUpper(region)}
+	}
+	if language := strings.TrimSpace(request.GetString("language", "")); language != "" {
+		if len(language) > MaxNewsLanguageLength {
+			return nil, fmt.Errorf("language too long: %d > %d", len(language), MaxNewsLanguageLength)
+		}
+		req.SystemPrompt += fmt.Sprintf(" Write the digest in %s.", language)
+	}
+	return req, nil
+}
+
+// academicSystemPrompt steers academic answers toward citable papers
+const academicSystemPrompt = `Answer from scholarly sources, preferring peer-reviewed papers and preprints. Name the authors and year of the papers you rely on, cite them, and distinguish established findings from preliminary or contested ones.`
+
+// CreateAcademicTool creates the perplexity_academic tool, a preset of
+// perplexity_search that searches scholarly sources and identifies the cited papers
+func CreateAcademicTool(config *Config) mcp.Tool {
+	tool := mcp.Tool{
+		Name:        "perplexity_academic",
+		Description: "Search scholarly sources for academic research, optionally within specific journals or repositories. Citations carry the DOI or arXiv ID of the paper when its URL contains one.",
+		InputSchema: mcp.ToolInputSchema{
+			Type: "object",
+			Properties: map[string]any{
+				"query": map[string]any{
+					"type":        "string",
+					"description": "The research question",
+					"minLength":   1,
+					"maxLength":   config.MaxQueryLength,
+				},
+				"sources": map[string]any{
+					"type":        "array",
+					"description": fmt.Sprintf("Journals or repositories to search within, by domain, e.g. arxiv.org or nature.com (optional, max %d)", config.MaxDomainFilters),
+					"items": map[string]any{
+						"type": "string",
+					},
+					"maxItems": config.MaxDomainFilters,
+				},
+				"exclude_sources": map[string]any{
+					"type":        "array",
+					"description": fmt.Sprintf("Domains to leave out of the search (optional; at most %d together with sources)", config.MaxDomainFilters),
+					"items": map[string]any{
+						"type": "string",
+					},
+					"maxItems": config.MaxDomainFilters,
+				},
+				"date_range": map[string]any{
+					"type":        "string",
+					"description": "Only search papers published within this period (optional)",
+					"enum":        DateRanges,
+				},
+				"model": map[string]any{
+					"type":        "string",
+					"description": fmt.Sprintf("The Sonar model to use (optional, defaults to '%s')", config.DefaultModelFor("perplexity_academic")),
+					"enum":        config.Models(),
+				},
+				"max_tokens": map[string]any{
+					"type":        "number",
+					"description": "Maximum number of tokens in the response (optional)",
+					"minimum":     1,
+					"maximum":     128000,
+				},
+				"output_format": map[string]any{
+					"type":        "string",
+					"description": "Format of the returned result (optional, defaults to 'json')",
+					"enum":        []string{OutputFormatJSON, OutputFormatMarkdown},
+					"default":     OutputFormatJSON,
+				},
+			},
+			Required: []string{"query"},
+		},
+		OutputSchema: searchOutputSchema(),
+	}
+	relaxModelSchema(&tool, config)
+	return tool
+}
+
+// AcademicHandler creates the handler function for the perplexity_academic tool
+func AcademicHandler(client SearchProvider, live *LiveConfig, results *ResultStore, sessions *SessionManager, sampler *QualitySampler, usage *UsageTracker) func(ctx context.Context, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+	return searchHandler("perplexity_academic", parseAcademicRequest, client, live, results, sessions, sampler, usage)
+}
+
+func parseAcademicRequest(request mcp.CallToolRequest) (*SearchRequest, error) {
+	query, err := request.RequireString("query")
+	if err != nil {
+		return nil, fmt.Errorf("query must be a string")
+	}
+	maxTokens, err := integerArgument(request, "max_tokens")
+	if err != nil {
+		return nil, err
+	}
+
+	req := &SearchRequest{
+		Query:          query,
+		Model:          request.GetString("model", ""),
+		SearchMode:     SearchModeAcademic,
+		DateRange:      request.GetString("date_range", ""),
+		Sources:        request.GetStringSlice("sources", nil),
+		ExcludeSources: request.GetStringSlice("exclude_sources", nil),
+		SystemPrompt:   academicSystemPrompt,
+		OutputFormat:   request.GetString("output_format", ""),
+		IdentifyPapers: true,
+	}
+	if maxTokens != nil {
+		req.MaxTokens = *maxTokens
+	}
+	return req, nil
+}
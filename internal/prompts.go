@@ -0,0 +1,114 @@
+package internal
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"strings"
+
+	"github.com/mark3labs/mcp-go/mcp"
+	"github.com/mark3labs/mcp-go/server"
+)
+
+// researchPrompt is a built-in research workflow offered through prompts/get
+type researchPrompt struct {
+	name        string
+	description string
+	// extra is the optional argument beyond topic, described by extraDescription
+	extra            string
+	extraDescription string
+	// extraValues lists the accepted values of extra, or nil for free text
+	extraValues []string
+	// render builds the user message from the topic and the optional argument
+	render func(topic, extra string) string
+}
+
+var researchPrompts = []researchPrompt{
+	{
+		name:             "literature_review",
+		description:      "Survey the academic literature on a topic with cited sources",
+		extra:            "focus",
+		extraDescription: "Aspect of the topic to concentrate on (optional)",
+		render: func(topic, focus string) string {
+			var b strings.Builder
+			fmt.Fprintf(&b, "Write a literature review on %q.", topic)
+			if focus != "" {
+				fmt.Fprintf(&b, " Concentrate on %s.", focus)
+			}
+			b.WriteString("\n\nUse the perplexity_search tool with search_mode \"academic\" and a session_id for this review, so every answer is collected in its notebook. ")
+			b.WriteString("Search for foundational work, the current state of research, open questions and points of disagreement, one search per theme.\n\n")
+			b.WriteString("Structure the review as: overview, key findings by theme, methods in use, open questions, and a reference list. Cite every claim with the sources returned by the tool and do not add sources it did not return.")
+			return b.String()
+		},
+	},
+	{
+		name:             "competitive_analysis",
+		description:      "Compare a company or product with its competitors using current web sources",
+		extra:            "competitors",
+		extraDescription: "Comma-separated competitors to include (optional)",
+		render: func(topic, competitors string) string {
+			var b strings.Builder
+			fmt.Fprintf(&b, "Prepare a competitive analysis of %q.", topic)
+			if competitors != "" {
+				fmt.Fprintf(&b, " Compare it with %s.", competitors)
+			} else {
+				b.WriteString(" Identify its main competitors first.")
+			}
+			b.WriteString("\n\nUse the perplexity_search tool with a session_id to research each company's offering, pricing, market position and recent moves, one search per company. ")
+			b.WriteString("Use date_range \"year\" for recent developments.\n\n")
+			b.WriteString("Present a comparison table followed by strengths, weaknesses, opportunities and threats for each company. Cite the sources returned by the tool and note where information could not be found.")
+			return b.String()
+		},
+	},
+	{
+		name:             "news_briefing",
+		description:      "Summarize recent news on a topic",
+		extra:            "date_range",
+		extraDescription: "How far back to look: day, week or month (optional, defaults to week)",
+		extraValues:      []string{"day", "week", "month"},
+		render: func(topic, dateRange string) string {
+			if dateRange == "" {
+				dateRange = "week"
+			}
+			var b strings.Builder
+			fmt.Fprintf(&b, "Write a news briefing on %q covering the last %s.", topic, dateRange)
+			fmt.Fprintf(&b, "\n\nUse the perplexity_search tool with search_mode \"news\" and date_range %q. ", dateRange)
+			b.WriteString("Run follow-up searches for the most significant stories.\n\n")
+			b.WriteString("Open with a three-sentence summary, then list the key developments with their date and source, and close with what to watch next. Cite the sources returned by the tool.")
+			return b.String()
+		},
+	},
+}
+
+// ResearchPrompts returns the built-in research prompt templates for use with mcp-go
+func ResearchPrompts() []server.ServerPrompt {
+	prompts := make([]server.ServerPrompt, len(researchPrompts))
+	for i, p := range researchPrompts {
+		prompts[i] = server.ServerPrompt{
+			Prompt: mcp.NewPrompt(p.name,
+				mcp.WithPromptDescription(p.description),
+				mcp.WithArgument("topic", mcp.ArgumentDescription("Subject to research"), mcp.RequiredArgument()),
+				mcp.WithArgument(p.extra, mcp.ArgumentDescription(p.extraDescription)),
+			),
+			Handler: researchPromptHandler(p),
+		}
+	}
+	return prompts
+}
+
+func researchPromptHandler(p researchPrompt) server.PromptHandlerFunc {
+	return func(ctx context.Context, request mcp.GetPromptRequest) (*mcp.GetPromptResult, error) {
+		topic := strings.TrimSpace(request.Params.Arguments["topic"])
+		if topic == "" {
+			return nil, fmt.Errorf("topic is required")
+		}
+		extra := strings.TrimSpace(request.Params.Arguments[p.extra])
+		if extra != "" && p.extraValues != nil && !slices.Contains(p.extraValues, extra) {
+			return nil, fmt.Errorf("invalid %s %q: must be one of %s", p.extra, extra, strings.Join(p.extraValues, ", "))
+		}
+
+		return mcp.NewGetPromptResult(p.description, []mcp.PromptMessage{
+			mcp.NewPromptMessage(mcp.RoleUser, mcp.NewTextContent(p.render(topic, extra))),
+		}), nil
+	}
+}
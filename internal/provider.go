@@ -0,0 +1,117 @@
+package internal
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"net/url"
+	"slices"
+)
+
+// Search providers selectable with SEARCH_PROVIDER
+const (
+	// ProviderPerplexity is the Perplexity Sonar API, the default
+	ProviderPerplexity = "perplexity"
+	// ProviderOpenAICompatible is any server implementing the OpenAI chat
+	// completions API, e.g. a self-hosted model or an LLM gateway
+	ProviderOpenAICompatible = "openai-compatible"
+)
+
+var SearchProviders = []string{ProviderPerplexity, ProviderOpenAICompatible}
+
+// SearchProvider is the backend answering the search tools. Tools only depend
+// on this interface, so the backend can change without changing the MCP surface.
+type SearchProvider interface {
+	Search(ctx context.Context, req SearchRequest) (*SearchResult, error)
+	// RawCompletion forwards a validated chat completions request body unchanged
+	RawCompletion(ctx context.Context, model string, body []byte) ([]byte, error)
+	// RateLimitStatus returns the last rate-limit headroom reported by the backend, or nil
+	RateLimitStatus() *RateLimitStatus
+	VerifyCitations(ctx context.Context, citations []Citation) []Citation
+	SetAPIKey(apiKey string)
+	UseProxy(proxyURL string) (*url.URL, error)
+}
+
+// ProviderConfig selects and locates the search backend
+type ProviderConfig struct {
+	Type string
+	// BaseURL overrides the API root that /chat/completions is appended to
+	BaseURL string
+	// Model is the backend model used by openai-compatible providers in place
+	// of the Sonar model a call asks for
+	Model string
+}
+
+func (p ProviderConfig) Validate() error {
+	if !slices.Contains(SearchProviders, p.Type) {
+		return fmt.Errorf("invalid search provider %q: must be %q or %q", p.Type, ProviderPerplexity, ProviderOpenAICompatible)
+	}
+	if p.BaseURL != "" {
+		u, err := url.Parse(p.BaseURL)
+		if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			return fmt.Errorf("invalid search provider base URL %q: must be an http or https URL", p.BaseURL)
+		}
+	}
+	if p.Type == ProviderOpenAICompatible && (p.BaseURL == "" || p.Model == "") {
+		return fmt.Errorf("the %s search provider requires SEARCH_PROVIDER_BASE_URL and SEARCH_PROVIDER_MODEL", ProviderOpenAICompatible)
+	}
+	return nil
+}
+
+// NewSearchProvider creates the backend selected by config. API requests wait
+// for limiter when it is not nil.
+func NewSearchProvider(config ProviderConfig, apiKey string, limiter *APILimiter, opts ...ClientOption) (SearchProvider, error) {
+	client, err := NewPerplexityClient(apiKey, opts...)
+	if err != nil {
+		return nil, err
+	}
+	client.limiter = limiter
+	if config.BaseURL != "" {
+		client.baseURL = config.BaseURL
+	}
+
+	switch config.Type {
+	case ProviderPerplexity:
+		return client, nil
+	case ProviderOpenAICompatible:
+		client.logger = slog.Default().With("component", ProviderOpenAICompatible)
+		return &OpenAICompatibleClient{PerplexityClient: client, model: config.Model}, nil
+	default:
+		return nil, fmt.Errorf("unknown search provider: %s", config.Type)
+	}
+}
+
+// OpenAICompatibleClient answers searches with a plain chat completions API.
+// It shares the transport, error handling and response parsing of
+// PerplexityClient but sends only standard request fields, so search filters
+// such as search_mode and sources are not applied, and answers carry
+// citations only if the backend returns them in the Perplexity format.
+type OpenAICompatibleClient struct {
+	*PerplexityClient
+	model string
+}
+
+func (c *OpenAICompatibleClient) Search(ctx context.Context, req SearchRequest) (*SearchResult, error) {
+	if err := req.Validate(); err != nil {
+		return nil, fmt.Errorf("invalid request: %w", err)
+	}
+
+	sonarReq := c.searchToAPIRequest(req)
+	apiReq := APIChatRequest{
+		Model:       c.model,
+		Messages:    sonarReq.Messages,
+		MaxTokens:   sonarReq.MaxTokens,
+		Temperature: sonarReq.Temperature,
+		TopP:        sonarReq.TopP,
+		// top_k is not part of the OpenAI API
+		FrequencyPenalty: sonarReq.FrequencyPenalty,
+		PresencePenalty:  sonarReq.PresencePenalty,
+	}
+	apiResp, err := c.makeRequest(ctx, apiReq)
+	if err != nil {
+		return nil, err
+	}
+
+	result := c.apiToSearchResult(*apiResp)
+	return &result, nil
+}
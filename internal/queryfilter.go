@@ -0,0 +1,278 @@
+package internal
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"maps"
+	"regexp"
+	"slices"
+	"strings"
+	"sync"
+)
+
+// Actions of the outbound query filter
+const (
+	QueryFilterOff    = "off"
+	QueryFilterRedact = "redact"
+	QueryFilterReject = "reject"
+)
+
+// QueryFilterActions lists the valid QUERY_FILTER values
+var QueryFilterActions = []string{QueryFilterOff, QueryFilterRedact, QueryFilterReject}
+
+// builtinQueryPatterns are the patterns QUERY_FILTER_PATTERNS can name. valid,
+// when set, rules out matches that only look like the data, such as numbers
+// failing the card checksum.
+var builtinQueryPatterns = map[string]struct {
+	pattern *regexp.Regexp
+	valid   func(string) bool
+}{
+	"email":       {pattern: regexp.MustCompile(`[A-Za-z0-9._%+-]+@[A-Za-z0-9.-]+\.[A-Za-z]{2,}`)},
+	"phone":       {pattern: regexp.MustCompile(`\+\d{1,3}(?:[\s.-]?\(?\d{1,4}\)?){2,5}|\(?\b\d{3}\)?[\s.-]\d{3}[\s.-]\d{4}\b`)},
+	"credit_card": {pattern: regexp.MustCompile(`\b(?:\d[ -]?){12,18}\d\b`), valid: luhnValid},
+}
+
+// QueryFilterPatterns lists the built-in pattern names, all applied by default
+var QueryFilterPatterns = slices.Sorted(maps.Keys(builtinQueryPatterns))
+
+// ErrQueryBlocked is returned for API requests the outbound filter rejected
+var ErrQueryBlocked = errors.New("query blocked by the outbound filter")
+
+// QueryBlockedError names the patterns a rejected request matched
+type QueryBlockedError struct {
+	Patterns []string
+}
+
+func (e *QueryBlockedError) Error() string {
+	return fmt.Sprintf("%s: it contains %s", ErrQueryBlocked, strings.Join(e.Patterns, ", "))
+}
+
+func (e *QueryBlockedError) Is(target error) bool {
+	return target == ErrQueryBlocked
+}
+
+// QueryFilterConfig scans the queries, system prompts and conversation turns
+// sent to the API for personal data, and redacts or rejects requests that
+// contain it
+type QueryFilterConfig struct {
+	// Action is off, redact or reject
+	Action string
+	// Patterns names the built-in patterns applied
+	Patterns []string
+	// Custom maps the names of operator-defined patterns to their regular expressions
+	Custom map[string]string
+}
+
+func (f QueryFilterConfig) Validate() error {
+	if !slices.Contains(QueryFilterActions, f.Action) {
+		return fmt.Errorf("invalid query filter action %q: must be %q, %q or %q", f.Action, QueryFilterOff, QueryFilterRedact, QueryFilterReject)
+	}
+	for _, name := range f.Patterns {
+		if _, ok := builtinQueryPatterns[name]; !ok {
+			return fmt.Errorf("unknown query filter pattern %q: must be one of %s", name, strings.Join(QueryFilterPatterns, ", "))
+		}
+	}
+	for name, expr := range f.Custom {
+		if _, err := compileFilterPattern(expr); err != nil {
+			return fmt.Errorf("invalid query filter pattern %q: %w", name, err)
+		}
+	}
+	return nil
+}
+
+// filterPatterns caches compiled operator-defined patterns, of the query filter
+// and response redactions, which are read from the live configuration on
+// every request
+var filterPatterns sync.Map
+
+func compileFilterPattern(expr string) (*regexp.Regexp, error) {
+	if cached, ok := filterPatterns.Load(expr); ok {
+		return cached.(*regexp.Regexp), nil
+	}
+	pattern, err := regexp.Compile(expr)
+	if err != nil {
+		return nil, err
+	}
+	filterPatterns.Store(expr, pattern)
+	return pattern, nil
+}
+
+// Scan replaces the matches of every pattern in text with the pattern's name
+// in brackets and returns the names of the patterns that matched
+func (f QueryFilterConfig) Scan(text string) (string, []string) {
+	var matched []string
+	replace := func(name string, pattern *regexp.Regexp, valid func(string) bool) {
+		found := false
+		text = pattern.ReplaceAllStringFunc(text, func(match string) string {
+			if valid != nil && !valid(match) {
+				return match
+			}
+			found = true
+			return "[" + name + "]"
+		})
+		if found {
+			matched = append(matched, name)
+		}
+	}
+
+	for _, name := range f.Patterns {
+		builtin := builtinQueryPatterns[name]
+		replace(name, builtin.pattern, builtin.valid)
+	}
+	for _, name := range slices.Sorted(maps.Keys(f.Custom)) {
+		// Validate has compiled every custom pattern already
+		if pattern, err := compileFilterPattern(f.Custom[name]); err == nil {
+			replace(name, pattern, nil)
+		}
+	}
+	return text, matched
+}
+
+// luhnValid reports whether the digits of s pass the payment card checksum
+func luhnValid(s string) bool {
+	sum, double := 0, false
+	for i := len(s) - 1; i >= 0; i-- {
+		if s[i] < '0' || s[i] > '9' {
+			continue
+		}
+		digit := int(s[i] - '0')
+		if double {
+			if digit *= 2; digit > 9 {
+				digit -= 9
+			}
+		}
+		sum += digit
+		double = !double
+	}
+	return sum%10 == 0
+}
+
+// filteredProvider applies the live query filter to every request before it
+// reaches the wrapped provider
+type filteredProvider struct {
+	SearchProvider
+	live *LiveConfig
+}
+
+// NewFilteredProvider wraps provider so searches and raw requests pass the
+// outbound query filter configured in live. Rejected requests fail with a
+// *QueryBlockedError without being sent.
+func NewFilteredProvider(provider SearchProvider, live *LiveConfig) SearchProvider {
+	return &filteredProvider{SearchProvider: provider, live: live}
+}
+
+func (p *filteredProvider) Search(ctx context.Context, req SearchRequest) (*SearchResult, error) {
+	filter := p.live.Get().QueryFilter
+	if filter.Action == QueryFilterOff {
+		return p.SearchProvider.Search(ctx, req)
+	}
+
+	var matched []string
+	scan := func(text string) string {
+		text, names := filter.Scan(text)
+		matched = append(matched, names...)
+		return text
+	}
+	req.Query = scan(req.Query)
+	req.SystemPrompt = scan(req.SystemPrompt)
+	if len(req.ContextMessages) > 0 {
+		messages := make([]Message, len(req.ContextMessages))
+		for i, msg := range req.ContextMessages {
+			messages[i] = Message{Role: msg.Role, Content: scan(msg.Content)}
+		}
+		req.ContextMessages = messages
+	}
+
+	if err := p.check(ctx, filter, matched); err != nil {
+		return nil, err
+	}
+	return p.SearchProvider.Search(ctx, req)
+}
+
+func (p *filteredProvider) RawCompletion(ctx context.Context, model string, body []byte) ([]byte, error) {
+	filter := p.live.Get().QueryFilter
+	if filter.Action == QueryFilterOff {
+		return p.SearchProvider.RawCompletion(ctx, model, body)
+	}
+
+	// Scan the text of every message, leaving the rest of the body untouched
+	var request map[string]any
+	if err := json.Unmarshal(body, &request); err != nil {
+		return nil, fmt.Errorf("invalid raw request body: %w", err)
+	}
+	messages, _ := request["messages"].([]any)
+	var matched []string
+	scan := func(text string) string {
+		text, names := filter.Scan(text)
+		matched = append(matched, names...)
+		return text
+	}
+	for i, raw := range messages {
+		msg, ok := raw.(map[string]any)
+		if !ok {
+			continue
+		}
+		if err := scanRawContent(msg, scan); err != nil {
+			return nil, fmt.Errorf("messages[%d]: %w", i, err)
+		}
+	}
+
+	if err := p.check(ctx, filter, matched); err != nil {
+		return nil, err
+	}
+	if len(matched) > 0 {
+		redacted, err := json.Marshal(request)
+		if err != nil {
+			return nil, fmt.Errorf("failed to encode redacted body: %w", err)
+		}
+		body = redacted
+	}
+	return p.SearchProvider.RawCompletion(ctx, model, body)
+}
+
+// scanRawContent passes the content of a raw request message to scan: a
+// string, or the text of each part of an array of content parts. Content the
+// filter cannot read is refused rather than sent unscanned.
+func scanRawContent(msg map[string]any, scan func(string) string) error {
+	switch content := msg["content"].(type) {
+	case nil:
+	case string:
+		msg["content"] = scan(content)
+	case []any:
+		for i, raw := range content {
+			part, ok := raw.(map[string]any)
+			if !ok {
+				return fmt.Errorf("content[%d] cannot be checked by the query filter: expected an object", i)
+			}
+			switch text := part["text"].(type) {
+			case nil:
+			case string:
+				part["text"] = scan(text)
+			default:
+				return fmt.Errorf("content[%d] cannot be checked by the query filter: text must be a string", i)
+			}
+		}
+	default:
+		return fmt.Errorf("content cannot be checked by the query filter: expected a string or an array of parts")
+	}
+	return nil
+}
+
+// check logs a request that matched the filter and returns the error that
+// rejects it, if the filter rejects such requests
+func (p *filteredProvider) check(ctx context.Context, filter QueryFilterConfig, matched []string) error {
+	if len(matched) == 0 {
+		return nil
+	}
+	slices.Sort(matched)
+	matched = slices.Compact(matched)
+	if filter.Action == QueryFilterReject {
+		slog.Default().WarnContext(ctx, "Request blocked by the outbound query filter", "patterns", matched)
+		return &QueryBlockedError{Patterns: matched}
+	}
+	slog.Default().InfoContext(ctx, "Request redacted by the outbound query filter", "patterns", matched)
+	return nil
+}
@@ -0,0 +1,128 @@
+package internal
+
+import (
+	"context"
+	"encoding/json"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestQueryFilterScan(t *testing.T) {
+	filter := QueryFilterConfig{
+		Action:   QueryFilterRedact,
+		Patterns: QueryFilterPatterns,
+		Custom:   map[string]string{"ticket": `\bOPS-\d+\b`},
+	}
+	tests := []struct {
+		name    string
+		text    string
+		want    string
+		matched []string
+	}{
+		{"clean", "What is new in Go?", "What is new in Go?", nil},
+		{"email", "Write to jane.doe@example.com today", "Write to [email] today", []string{"email"}},
+		{"phone", "Call +1 415 555 0100 or (415) 555-0199", "Call [phone] or [phone]", []string{"phone"}},
+		{"valid card", "Card 4111 1111 1111 1111 declined", "Card [credit_card] declined", []string{"credit_card"}},
+		{"failed checksum", "Order 4111 1111 1111 1112 shipped", "Order 4111 1111 1111 1112 shipped", nil},
+		{"custom", "Status of OPS-1234?", "Status of [ticket]?", []string{"ticket"}},
+		{"several", "OPS-7 from a@b.io", "[ticket] from [email]", []string{"email", "ticket"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			text, matched := filter.Scan(tt.text)
+			require.Equal(t, tt.want, text)
+			require.Equal(t, tt.matched, matched)
+		})
+	}
+}
+
+func TestLuhnValid(t *testing.T) {
+	require.True(t, luhnValid("4111111111111111"))
+	require.True(t, luhnValid("5500-0000-0000-0004"))
+	require.False(t, luhnValid("4111111111111112"))
+}
+
+func TestQueryFilterValidate(t *testing.T) {
+	require.NoError(t, QueryFilterConfig{Action: QueryFilterOff}.Validate())
+	require.ErrorContains(t, QueryFilterConfig{Action: "block"}.Validate(), "invalid query filter action")
+	require.ErrorContains(t, QueryFilterConfig{Action: QueryFilterRedact, Patterns: []string{"ssn"}}.Validate(), "unknown query filter pattern")
+	require.ErrorContains(t, QueryFilterConfig{Action: QueryFilterRedact, Custom: map[string]string{"bad": "("}}.Validate(), `invalid query filter pattern "bad"`)
+}
+
+func filteredStub(action string) (*stubProvider, SearchProvider) {
+	stub := &stubProvider{
+		search: func(ctx context.Context, req SearchRequest) (*SearchResult, error) {
+			data, _ := json.Marshal(req)
+			return &SearchResult{Content: string(data)}, nil
+		},
+		raw: []byte(`{}`),
+	}
+	config := &Config{QueryFilter: QueryFilterConfig{Action: action, Patterns: QueryFilterPatterns}}
+	return stub, NewFilteredProvider(stub, NewLiveConfig(config))
+}
+
+func TestFilteredProviderSearch(t *testing.T) {
+	req := SearchRequest{
+		Query:           "Who owns jane@example.com?",
+		SystemPrompt:    "Reply to +44 20 7946 0958",
+		ContextMessages: []Message{{Role: "user", Content: "card 4111111111111111"}, {Role: "assistant", Content: "ok"}},
+	}
+
+	_, redact := filteredStub(QueryFilterRedact)
+	result, err := redact.Search(context.Background(), req)
+	require.NoError(t, err)
+	var sent SearchRequest
+	require.NoError(t, json.Unmarshal([]byte(result.Content), &sent))
+	require.Equal(t, "Who owns [email]?", sent.Query)
+	require.Equal(t, "Reply to [phone]", sent.SystemPrompt)
+	require.Equal(t, "card [credit_card]", sent.ContextMessages[0].Content)
+	require.Equal(t, "card 4111111111111111", req.ContextMessages[0].Content, "the caller's request is not modified")
+
+	_, reject := filteredStub(QueryFilterReject)
+	_, err = reject.Search(context.Background(), req)
+	require.ErrorIs(t, err, ErrQueryBlocked)
+	require.EqualError(t, err, "query blocked by the outbound filter: it contains credit_card, email, phone")
+
+	_, off := filteredStub(QueryFilterOff)
+	result, err = off.Search(context.Background(), req)
+	require.NoError(t, err)
+	require.Contains(t, result.Content, "jane@example.com")
+}
+
+func TestFilteredProviderRawCompletion(t *testing.T) {
+	body := `{"model":"sonar","messages":[` +
+		`{"role":"system","content":"Mail jane@example.com"},` +
+		`{"role":"user","content":[{"type":"text","text":"Call +1 415 555 0100"},{"type":"image_url","image_url":{"url":"https://example.com/a.png"}}]}]}`
+
+	stub, redact := filteredStub(QueryFilterRedact)
+	_, err := redact.RawCompletion(context.Background(), "sonar", []byte(body))
+	require.NoError(t, err)
+	var sent map[string]any
+	require.NoError(t, json.Unmarshal(stub.sent, &sent))
+	messages := sent["messages"].([]any)
+	require.Equal(t, "Mail [email]", messages[0].(map[string]any)["content"])
+	parts := messages[1].(map[string]any)["content"].([]any)
+	require.Equal(t, "Call [phone]", parts[0].(map[string]any)["text"])
+	require.Equal(t, "https://example.com/a.png", parts[1].(map[string]any)["image_url"].(map[string]any)["url"])
+
+	stub, reject := filteredStub(QueryFilterReject)
+	stub.sent = nil
+	_, err = reject.RawCompletion(context.Background(), "sonar", []byte(`{"messages":[{"role":"user","content":[{"type":"text","text":"jane@example.com"}]}]}`))
+	require.ErrorIs(t, err, ErrQueryBlocked)
+	require.Nil(t, stub.sent)
+
+	// Clean bodies are sent byte for byte; content the filter cannot read is refused
+	clean := []byte(`{"messages": [{"role":"user","content":[{"type":"text","text":"hello"}]}]}`)
+	_, err = reject.RawCompletion(context.Background(), "sonar", clean)
+	require.NoError(t, err)
+	require.Equal(t, clean, stub.sent)
+	for _, unreadable := range []string{
+		`{"messages":[{"role":"user","content":{"text":"jane@example.com"}}]}`,
+		`{"messages":[{"role":"user","content":["jane@example.com"]}]}`,
+		`{"messages":[{"role":"user","content":[{"type":"text","text":["jane@example.com"]}]}]}`,
+	} {
+		_, err = redact.RawCompletion(context.Background(), "sonar", []byte(unreadable))
+		require.ErrorContains(t, err, "cannot be checked by the query filter", unreadable)
+	}
+}
@@ -0,0 +1,161 @@
+package internal
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"math"
+	"net"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/mark3labs/mcp-go/mcp"
+	"github.com/mark3labs/mcp-go/server"
+)
+
+// ErrRateLimited is returned for tool calls refused by a per-client limit
+var ErrRateLimited = errors.New("rate limited")
+
+// maxRateLimitClients bounds the clients tracked before idle ones are dropped
+const maxRateLimitClients = 10000
+
+type clientIdentityKey struct{}
+
+// HTTPClientIdentity returns the HTTP context function that attaches the
+// identity rate limits and the audit log apply to: the verified client
+// certificate's name under mutual TLS, the bearer token when it is one of the
+// AuthTokens currently configured in live, otherwise the remote IP. Unverified tokens are ignored, since a
+// client could send a new one with every request to get a fresh bucket.
+// Tokens are hashed so they never reach logs or memory dumps in clear.
+func HTTPClientIdentity(live *LiveConfig) server.HTTPContextFunc {
+	return func(ctx context.Context, r *http.Request) context.Context {
+		authTokens := live.Get().AuthTokens
+		if r.TLS != nil && len(r.TLS.VerifiedChains) > 0 {
+			return context.WithValue(ctx, clientIdentityKey{}, "cert:"+certificateIdentity(r.TLS.VerifiedChains[0][0]))
+		}
+		if len(authTokens) > 0 && validBearerToken(r, authTokens) {
+			token := strings.TrimPrefix(r.Header.Get("Authorization"), "Bearer ")
+			sum := sha256.Sum256([]byte(token))
+			return context.WithValue(ctx, clientIdentityKey{}, "token:"+hex.EncodeToString(sum[:8]))
+		}
+		host, _, err := net.SplitHostPort(r.RemoteAddr)
+		if err != nil {
+			host = r.RemoteAddr
+		}
+		return context.WithValue(ctx, clientIdentityKey{}, "ip:"+host)
+	}
+}
+
+func clientIdentity(ctx context.Context) string {
+	identity, _ := ctx.Value(clientIdentityKey{}).(string)
+	return identity
+}
+
+// rateLimitEntry is one client's token bucket and concurrent call count
+type rateLimitEntry struct {
+	tokens  float64
+	updated time.Time
+	active  int
+}
+
+// RateLimiter limits tool calls per HTTP client to a number per minute and a
+// number in flight at once, so one misbehaving agent can't starve the others.
+// Limits are read from the live configuration on every call; calls without a
+// client identity, such as those over stdio, are not limited.
+type RateLimiter struct {
+	live *LiveConfig
+
+	mu      sync.Mutex
+	clients map[string]*rateLimitEntry
+}
+
+func NewRateLimiter(live *LiveConfig) *RateLimiter {
+	return &RateLimiter{
+		live:    live,
+		clients: make(map[string]*rateLimitEntry),
+	}
+}
+
+// Middleware refuses calls over either limit with an error result. Its
+// _meta.error has the rate_limited type of upstream 429s and, for the
+// per-minute limit, the wait before a retry in retry_after_seconds.
+func (l *RateLimiter) Middleware() server.ToolHandlerMiddleware {
+	return func(next server.ToolHandlerFunc) server.ToolHandlerFunc {
+		return func(ctx context.Context, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+			identity := clientIdentity(ctx)
+			if identity == "" {
+				return next(ctx, request)
+			}
+
+			config := l.live.Get()
+			retryAfter, err := l.acquire(identity, config.RateLimitPerMinute, config.RateLimitConcurrent, time.Now())
+			if err != nil {
+				details := &APIErrorDetails{
+					Type:              APIErrorRateLimited,
+					Retryable:         true,
+					RetryAfterSeconds: int(math.Ceil(retryAfter.Seconds())),
+				}
+				return apiErrorResult(nil, fmt.Errorf("Call rejected: %w", err), details), nil
+			}
+			defer l.release(identity)
+
+			return next(ctx, request)
+		}
+	}
+}
+
+// acquire takes a call slot of identity, or returns ErrRateLimited with the
+// wait before a retry, which is 0 when the wait is for a call to finish
+func (l *RateLimiter) acquire(identity string, perMinute, concurrent int, now time.Time) (time.Duration, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	entry, ok := l.clients[identity]
+	if !ok {
+		if len(l.clients) >= maxRateLimitClients {
+			l.dropIdle(now)
+		}
+		entry = &rateLimitEntry{tokens: float64(perMinute), updated: now}
+		l.clients[identity] = entry
+	}
+
+	if concurrent > 0 && entry.active >= concurrent {
+		return 0, fmt.Errorf("%w: %d concurrent calls allowed, retry when one finishes", ErrRateLimited, concurrent)
+	}
+	if perMinute > 0 {
+		// Refill the bucket at perMinute tokens per minute, up to perMinute
+		rate := float64(perMinute) / time.Minute.Seconds()
+		entry.tokens = math.Min(float64(perMinute), entry.tokens+now.Sub(entry.updated).Seconds()*rate)
+		entry.updated = now
+		if entry.tokens < 1 {
+			retryAfter := math.Ceil((1 - entry.tokens) / rate)
+			return time.Duration(retryAfter) * time.Second, fmt.Errorf("%w: %d calls per minute allowed, retry after %.0fs", ErrRateLimited, perMinute, retryAfter)
+		}
+		entry.tokens--
+	}
+	entry.active++
+	return 0, nil
+}
+
+func (l *RateLimiter) release(identity string) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if entry, ok := l.clients[identity]; ok {
+		entry.active--
+	}
+}
+
+// dropIdle forgets clients with no calls in flight for a minute, whose bucket
+// has refilled so their state is the same as a new client's
+func (l *RateLimiter) dropIdle(now time.Time) {
+	for identity, entry := range l.clients {
+		if entry.active == 0 && now.Sub(entry.updated) >= time.Minute {
+			delete(l.clients, identity)
+		}
+	}
+}
@@ -0,0 +1,70 @@
+package internal
+
+import (
+	"context"
+	"fmt"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/mark3labs/mcp-go/mcp"
+	"github.com/stretchr/testify/require"
+)
+
+func identityOf(authTokens []string, token string) string {
+	r := httptest.NewRequest("POST", "/mcp", nil)
+	r.RemoteAddr = "203.0.113.7:51234"
+	if token != "" {
+		r.Header.Set("Authorization", "Bearer "+token)
+	}
+	return clientIdentity(HTTPClientIdentity(NewLiveConfig(&Config{AuthTokens: authTokens}))(context.Background(), r))
+}
+
+func TestHTTPClientIdentityIgnoresUnverifiedTokens(t *testing.T) {
+	require.Equal(t, "ip:203.0.113.7", identityOf(nil, "random-1"))
+	require.Equal(t, "ip:203.0.113.7", identityOf(nil, "random-2"))
+	require.Equal(t, "ip:203.0.113.7", identityOf([]string{"secret"}, "wrong"))
+
+	identity := identityOf([]string{"secret", "other"}, "secret")
+	require.True(t, strings.HasPrefix(identity, "token:"), identity)
+	require.NotContains(t, identity, "secret")
+	require.NotEqual(t, identity, identityOf([]string{"secret", "other"}, "other"))
+}
+
+func TestRateLimiterRotatingUnverifiedTokensShareBucket(t *testing.T) {
+	limiter := NewRateLimiter(NewLiveConfig(&Config{}))
+	now := time.Now()
+
+	for i := range 3 {
+		identity := identityOf(nil, fmt.Sprintf("rotated-%d", i))
+		_, err := limiter.acquire(identity, 2, 0, now)
+		if i < 2 {
+			require.NoError(t, err)
+			limiter.release(identity)
+			continue
+		}
+		require.ErrorIs(t, err, ErrRateLimited)
+	}
+}
+
+func TestRateLimiterMiddlewareReturnsRetryAfter(t *testing.T) {
+	limiter := NewRateLimiter(NewLiveConfig(&Config{RateLimitPerMinute: 1}))
+	handler := limiter.Middleware()(func(ctx context.Context, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+		return mcp.NewToolResultText("answer"), nil
+	})
+	ctx := withIdentity("ip:203.0.113.7")
+
+	result, err := handler(ctx, mcp.CallToolRequest{})
+	require.NoError(t, err)
+	require.False(t, result.IsError)
+
+	result, err = handler(ctx, mcp.CallToolRequest{})
+	require.NoError(t, err)
+	require.True(t, result.IsError)
+	require.Contains(t, result.Content[0].(mcp.TextContent).Text, "Call rejected: rate limited")
+	details := result.Meta.AdditionalFields["error"].(*APIErrorDetails)
+	require.Equal(t, APIErrorRateLimited, details.Type)
+	require.True(t, details.Retryable)
+	require.InDelta(t, 60, details.RetryAfterSeconds, 1)
+}
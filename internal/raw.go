@@ -0,0 +1,175 @@
+package internal
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+
+	"github.com/mark3labs/mcp-go/mcp"
+)
+
+// MaxRawRequestBytes is the largest request body perplexity_raw forwards
+const MaxRawRequestBytes = 64 * 1024
+
+// CreateRawTool creates the perplexity_raw tool for use with mcp-go
+func CreateRawTool() mcp.Tool {
+	return mcp.Tool{
+		Name:        "perplexity_raw",
+		Description: "Send a request body as is to the Perplexity /chat/completions API and return the raw JSON response, for API features the other tools do not expose yet. The API key is added by the server; the model must be allowed on this server and streaming is not supported.",
+		InputSchema: mcp.ToolInputSchema{
+			Type: "object",
+			Properties: map[string]any{
+				"body": map[string]any{
+					"type":        "object",
+					"description": "The chat completions request, e.g. {\"model\": \"sonar\", \"messages\": [{\"role\": \"user\", \"content\": \"...\"}]}. A JSON string is accepted as well.",
+				},
+			},
+			Required: []string{"body"},
+		},
+		OutputSchema: rawOutputSchema(),
+	}
+}
+
+// RawHandler creates the handler function for the perplexity_raw tool. Calls
+// count against budgets and usage like searches but are not stored as results.
+func RawHandler(client SearchProvider, live *LiveConfig, usage *UsageTracker) func(ctx context.Context, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+	return func(ctx context.Context, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+		config := live.Get()
+
+		body, model, err := parseRawBody(request.GetArguments()["body"])
+		if err == nil {
+			err = config.CheckModel(model)
+		}
+		if err != nil {
+			return &mcp.CallToolResult{
+				Content: []mcp.Content{
+					mcp.TextContent{
+						Type: "text",
+						Text: fmt.Sprintf("Invalid raw request: %s", err.Error()),
+					},
+				},
+				IsError: true,
+			}, err
+		}
+
+		if _, err := config.Budgets.Check(usage); err != nil {
+			return &mcp.CallToolResult{
+				Content: []mcp.Content{
+					mcp.TextContent{
+						Type: "text",
+						Text: fmt.Sprintf("Raw request failed: %s", err.Error()),
+					},
+				},
+				IsError: true,
+			}, err
+		}
+
+		timeout, limit := config.TimeoutFor("perplexity_raw", model)
+		respBody, err := callWithTimeout(ctx, timeout, limit, func(callCtx context.Context) ([]byte, error) {
+			return client.RawCompletion(callCtx, model, body)
+		})
+		if err != nil {
+			return &mcp.CallToolResult{
+				Content: []mcp.Content{
+					mcp.TextContent{
+						Type: "text",
+						Text: fmt.Sprintf("Raw request failed: %s", err.Error()),
+					},
+				},
+				IsError: true,
+				Result:  mcp.Result{Meta: errorMeta(err)},
+			}, err
+		}
+
+		// Usage is read from the standard fields; anything else passes through untouched
+		var apiResp APIChatResponse
+		var data map[string]any
+		if err := json.Unmarshal(respBody, &data); err != nil {
+			return &mcp.CallToolResult{
+				Content: []mcp.Content{
+					mcp.TextContent{
+						Type: "text",
+						Text: fmt.Sprintf("Raw request failed: response is not a JSON object: %s", err.Error()),
+					},
+				},
+				IsError: true,
+			}, err
+		}
+		_ = json.Unmarshal(respBody, &apiResp)
+		result := &SearchResult{
+			ID:    apiResp.ID,
+			Model: apiResp.Model,
+			Usage: Usage{
+				PromptTokens:     apiResp.Usage.PromptTokens,
+				CompletionTokens: apiResp.Usage.CompletionTokens,
+				TotalTokens:      apiResp.Usage.TotalTokens,
+			},
+		}
+		usage.Record(config.ModelPrices, "perplexity_raw", "", result)
+		budgetWarnings, _ := config.Budgets.Check(usage)
+
+		// Answers leave the server redacted like those of every other tool
+		if len(config.ResponseRedactions) > 0 {
+			config.ResponseRedactions.applyRaw(data)
+			if respBody, err = json.Marshal(data); err != nil {
+				return &mcp.CallToolResult{
+					Content: []mcp.Content{
+						mcp.TextContent{
+							Type: "text",
+							Text: fmt.Sprintf("Raw request failed: %s", err.Error()),
+						},
+					},
+					IsError: true,
+				}, err
+			}
+		}
+
+		return &mcp.CallToolResult{
+			Result: mcp.Result{Meta: withBudgetWarnings(resultMeta(config.ModelPrices, result), budgetWarnings)},
+			Content: []mcp.Content{
+				mcp.TextContent{
+					Type: "text",
+					Text: string(respBody),
+				},
+			},
+			StructuredContent: data,
+		}, nil
+	}
+}
+
+// parseRawBody validates a perplexity_raw body given as an object or a JSON
+// string and returns it encoded together with its model
+func parseRawBody(arg any) ([]byte, string, error) {
+	var body []byte
+	switch value := arg.(type) {
+	case nil:
+		return nil, "", fmt.Errorf("body is required")
+	case string:
+		body = []byte(value)
+	default:
+		encoded, err := json.Marshal(value)
+		if err != nil {
+			return nil, "", fmt.Errorf("body must be a JSON object: %w", err)
+		}
+		body = encoded
+	}
+	if len(body) > MaxRawRequestBytes {
+		return nil, "", fmt.Errorf("body too large (%d bytes, max %d)", len(body), MaxRawRequestBytes)
+	}
+
+	var fields map[string]json.RawMessage
+	if err := json.Unmarshal(body, &fields); err != nil || fields == nil {
+		return nil, "", fmt.Errorf("body must be a JSON object")
+	}
+	var model string
+	if err := json.Unmarshal(fields["model"], &model); err != nil || model == "" {
+		return nil, "", fmt.Errorf("body must name a model")
+	}
+	var stream bool
+	if raw, ok := fields["stream"]; ok {
+		if err := json.Unmarshal(raw, &stream); err != nil || stream {
+			return nil, "", fmt.Errorf("streaming is not supported")
+		}
+	}
+	return body, model, nil
+}
@@ -0,0 +1,89 @@
+package internal
+
+import (
+	"context"
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/mark3labs/mcp-go/mcp"
+	"github.com/stretchr/testify/require"
+)
+
+// stubProvider answers searches with search and raw requests with raw,
+// recording the last raw request body in sent, and reports rateLimit
+type stubProvider struct {
+	search    func(ctx context.Context, req SearchRequest) (*SearchResult, error)
+	raw       []byte
+	sent      []byte
+	rateLimit *RateLimitStatus
+}
+
+func (p *stubProvider) Search(ctx context.Context, req SearchRequest) (*SearchResult, error) {
+	return p.search(ctx, req)
+}
+
+func (p *stubProvider) RawCompletion(ctx context.Context, model string, body []byte) ([]byte, error) {
+	p.sent = body
+	return p.raw, nil
+}
+
+func (p *stubProvider) RateLimitStatus() *RateLimitStatus { return p.rateLimit }
+
+func (p *stubProvider) VerifyCitations(ctx context.Context, citations []Citation) []Citation {
+	return citations
+}
+
+func (p *stubProvider) SetAPIKey(apiKey string) {}
+
+func (p *stubProvider) UseProxy(proxyURL string) (*url.URL, error) { return nil, nil }
+
+func TestRawHandlerAppliesResponseRedactions(t *testing.T) {
+	client := &stubProvider{raw: []byte(`{
+		"id": "r1",
+		"model": "sonar",
+		"usage": {"prompt_tokens": 1, "completion_tokens": 2, "total_tokens": 3},
+		"choices": [
+			{"index": 0, "message": {"role": "assistant", "content": "Ask ops at db1.corp.internal"}},
+			{"index": 1, "message": {"role": "assistant", "content": "db2.corp.internal is down"}}
+		],
+		"search_results": [{"title": "db1.corp.internal status", "snippet": "see db1.corp.internal", "url": "https://status.example.com"}],
+		"custom": "db3.corp.internal"
+	}`)}
+	config := &Config{
+		RequestTimeout:     time.Second,
+		ResponseRedactions: RedactionRules{{Name: "hosts", Pattern: `\w+\.corp\.internal`, Replacement: "[host]"}},
+	}
+	handler := RawHandler(client, NewLiveConfig(config), NewUsageTracker())
+
+	var request mcp.CallToolRequest
+	request.Params.Arguments = map[string]any{"body": map[string]any{"model": "sonar", "messages": []any{}}}
+	result, err := handler(context.Background(), request)
+	require.NoError(t, err)
+	require.False(t, result.IsError)
+
+	text := result.Content[0].(mcp.TextContent).Text
+	require.NotContains(t, text, "db1.corp.internal")
+	require.NotContains(t, text, "db2.corp.internal")
+	require.Contains(t, text, "Ask ops at [host]")
+	require.Contains(t, text, `"db3.corp.internal"`, "fields other than answers pass through")
+
+	data := result.StructuredContent.(map[string]any)
+	choices := data["choices"].([]any)
+	require.Equal(t, "[host] is down", choices[1].(map[string]any)["message"].(map[string]any)["content"])
+	searchResult := data["search_results"].([]any)[0].(map[string]any)
+	require.Equal(t, "[host] status", searchResult["title"])
+	require.Equal(t, "see [host]", searchResult["snippet"])
+}
+
+func TestRawHandlerWithoutRedactionsPassesBodyThrough(t *testing.T) {
+	body := `{"id":"r1","model":"sonar",  "choices":[{"message":{"content":"db1.corp.internal"}}]}`
+	client := &stubProvider{raw: []byte(body)}
+	handler := RawHandler(client, NewLiveConfig(&Config{RequestTimeout: time.Second}), NewUsageTracker())
+
+	var request mcp.CallToolRequest
+	request.Params.Arguments = map[string]any{"body": map[string]any{"model": "sonar"}}
+	result, err := handler(context.Background(), request)
+	require.NoError(t, err)
+	require.Equal(t, body, result.Content[0].(mcp.TextContent).Text)
+}
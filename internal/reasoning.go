@@ -0,0 +1,51 @@
+package internal
+
+import (
+	"regexp"
+	"strings"
+)
+
+// Reasoning output modes select what happens to the <think> trace of
+// sonar-reasoning answers
+const (
+	// ReasoningStrip drops the trace from tool results
+	ReasoningStrip = "strip"
+	// ReasoningSeparate returns the trace in its own content block and field
+	ReasoningSeparate = "separate"
+	// ReasoningKeep leaves the trace inline, as the API returned it
+	ReasoningKeep = "keep"
+)
+
+var ReasoningOutputModes = []string{ReasoningStrip, ReasoningSeparate, ReasoningKeep}
+
+// thinkBlockPattern matches a <think> block, or an opening tag left unclosed
+// when the answer ran out of tokens mid-thought
+var thinkBlockPattern = regexp.MustCompile(`(?s)<think>(.*?)(?:</think>|\z)`)
+
+// splitReasoning separates the <think> blocks of content from the answer
+func splitReasoning(content string) (answer, reasoning string) {
+	var thoughts []string
+	answer = thinkBlockPattern.ReplaceAllStringFunc(content, func(block string) string {
+		thought := thinkBlockPattern.FindStringSubmatch(block)[1]
+		if thought = strings.TrimSpace(thought); thought != "" {
+			thoughts = append(thoughts, thought)
+		}
+		return ""
+	})
+	return strings.TrimSpace(answer), strings.Join(thoughts, "\n\n")
+}
+
+// withReasoningOutput returns result as tools show it under mode. Stored
+// results keep the trace in Reasoning; the returned copy is never stored.
+func withReasoningOutput(result *SearchResult, mode string) *SearchResult {
+	if result.Reasoning == "" || mode == ReasoningSeparate {
+		return result
+	}
+
+	shown := *result
+	shown.Reasoning = ""
+	if mode == ReasoningKeep {
+		shown.Content = "<think>\n" + result.Reasoning + "\n</think>\n\n" + result.Content
+	}
+	return &shown
+}
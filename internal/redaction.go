@@ -0,0 +1,106 @@
+package internal
+
+import (
+	"fmt"
+	"slices"
+)
+
+// DefaultRedactionReplacement replaces the matches of rules without their own
+const DefaultRedactionReplacement = "[redacted]"
+
+// RedactionRule rewrites the matches of Pattern in returned answers, such as
+// internal hostnames or employee names. Replacement may refer to capture
+// groups as $1 or ${name}.
+type RedactionRule struct {
+	Name        string `json:"name" yaml:"name"`
+	Pattern     string `json:"pattern" yaml:"pattern"`
+	Replacement string `json:"replacement,omitempty" yaml:"replacement"`
+}
+
+// RedactionRules are applied in order to the answer text, reasoning trace and
+// source titles of results before tools return them
+type RedactionRules []RedactionRule
+
+func (r RedactionRules) Validate() error {
+	for i, rule := range r {
+		if rule.Name == "" {
+			return fmt.Errorf("response_redactions[%d] has no name", i)
+		}
+		if rule.Pattern == "" {
+			return fmt.Errorf("response redaction %q has no pattern", rule.Name)
+		}
+		if _, err := compileFilterPattern(rule.Pattern); err != nil {
+			return fmt.Errorf("invalid response redaction %q: %w", rule.Name, err)
+		}
+	}
+	return nil
+}
+
+// Redact returns text with every rule applied
+func (r RedactionRules) Redact(text string) string {
+	for _, rule := range r {
+		// Validate has compiled every pattern already
+		pattern, err := compileFilterPattern(rule.Pattern)
+		if err != nil {
+			continue
+		}
+		replacement := rule.Replacement
+		if replacement == "" {
+			replacement = DefaultRedactionReplacement
+		}
+		text = pattern.ReplaceAllString(text, replacement)
+	}
+	return text
+}
+
+// apply returns a copy of result with its text redacted, or result itself when
+// there are no rules. Stored results are never redacted, so changing the rules
+// by a reload also applies to answers already stored.
+func (r RedactionRules) apply(result *SearchResult) *SearchResult {
+	if len(r) == 0 || result == nil {
+		return result
+	}
+
+	shown := *result
+	shown.Content = r.Redact(result.Content)
+	shown.Reasoning = r.Redact(result.Reasoning)
+	shown.Citations = slices.Clone(result.Citations)
+	for i := range shown.Citations {
+		shown.Citations[i].Title = r.Redact(shown.Citations[i].Title)
+	}
+	shown.Sources = slices.Clone(result.Sources)
+	for i := range shown.Sources {
+		shown.Sources[i].Title = r.Redact(shown.Sources[i].Title)
+		shown.Sources[i].Snippet = r.Redact(shown.Sources[i].Snippet)
+	}
+	return &shown
+}
+
+// applyRaw redacts a chat completions response decoded as JSON in place: the
+// message content of every choice and the titles and snippets of its search
+// results. Other fields pass through untouched.
+func (r RedactionRules) applyRaw(data map[string]any) {
+	choices, _ := data["choices"].([]any)
+	for _, choice := range choices {
+		choice, _ := choice.(map[string]any)
+		message, _ := choice["message"].(map[string]any)
+		if content, ok := message["content"].(string); ok {
+			message["content"] = r.Redact(content)
+		}
+	}
+	searchResults, _ := data["search_results"].([]any)
+	for _, searchResult := range searchResults {
+		searchResult, _ := searchResult.(map[string]any)
+		for _, key := range []string{"title", "snippet"} {
+			if text, ok := searchResult[key].(string); ok {
+				searchResult[key] = r.Redact(text)
+			}
+		}
+	}
+}
+
+// shownResult returns result as tools show it: the reasoning trace handled as
+// ReasoningOutput selects, then the response redaction rules applied
+func (c *Config) shownResult(result *SearchResult) *SearchResult {
+	return c.ResponseRedactions.apply(withReasoningOutput(result, c.ReasoningOutput))
+}
@@ -0,0 +1,101 @@
+package internal
+
+import (
+	"context"
+	"testing"
+
+	"github.com/mark3labs/mcp-go/mcp"
+	"github.com/stretchr/testify/require"
+)
+
+// hostRedactions replace internal hostnames with [host]
+var hostRedactions = RedactionRules{{Name: "hosts", Pattern: `\w+\.corp\.internal`, Replacement: "[host]"}}
+
+// internalAnswer mentions internal hosts in every redacted field
+func internalAnswer(ctx context.Context, req SearchRequest) (*SearchResult, error) {
+	return &SearchResult{
+		ID:        "res_redact",
+		Model:     req.Model,
+		Content:   "Ask ops at db1.corp.internal [1]",
+		Reasoning: "db2.corp.internal was mentioned",
+		Citations: []Citation{{Number: 1, URL: "https://status.example.com", Title: "db1.corp.internal status"}},
+		Sources:   []Source{{URL: "https://status.example.com", Title: "Status of db3.corp.internal", Snippet: "db3.corp.internal is up"}},
+	}, nil
+}
+
+func TestRedactionRulesRedact(t *testing.T) {
+	rules := RedactionRules{
+		{Name: "hosts", Pattern: `(\w+)\.corp\.internal`, Replacement: "$1.example"},
+		{Name: "names", Pattern: `(?i)jane doe`},
+	}
+	require.NoError(t, rules.Validate())
+	require.Equal(t, "Ask Jane at db1.example, not [redacted]", rules.Redact("Ask Jane at db1.corp.internal, not JANE DOE"))
+	require.Equal(t, "unchanged", RedactionRules(nil).Redact("unchanged"))
+
+	require.EqualError(t, RedactionRules{{Pattern: "x"}}.Validate(), "response_redactions[0] has no name")
+	require.EqualError(t, RedactionRules{{Name: "empty"}}.Validate(), `response redaction "empty" has no pattern`)
+	require.ErrorContains(t, RedactionRules{{Name: "broken", Pattern: "("}}.Validate(), `invalid response redaction "broken"`)
+}
+
+func TestSearchHandlerAppliesResponseRedactions(t *testing.T) {
+	for _, format := range []string{OutputFormatJSON, OutputFormatMarkdown} {
+		t.Run(format, func(t *testing.T) {
+			config := reloadableConfig(t)
+			config.ReasoningOutput = ReasoningSeparate
+			config.ResponseRedactions = hostRedactions
+			results := NewResultStore(10)
+			handler := PerplexitySearchHandler(&stubProvider{search: internalAnswer}, NewLiveConfig(config), results, NewSessionManager(0, 0), NewQualitySampler(0), NewUsageTracker())
+
+			var request mcp.CallToolRequest
+			request.Params.Arguments = map[string]any{"query": "who runs the database?", "output_format": format}
+			result, err := handler(context.Background(), request)
+			require.NoError(t, err)
+			require.False(t, result.IsError)
+
+			for _, block := range result.Content {
+				text := block.(mcp.TextContent).Text
+				require.NotContains(t, text, "corp.internal")
+			}
+			text := result.Content[0].(mcp.TextContent).Text
+			require.Contains(t, text, "Ask ops at [host]")
+			require.Contains(t, text, "[host] status")
+
+			data := result.StructuredContent.(map[string]any)
+			require.Equal(t, "Ask ops at [host] [1]", data["content"])
+			require.Equal(t, "[host] was mentioned", data["reasoning"])
+			require.Equal(t, "[host] status", data["citations"].([]Citation)[0].Title)
+			require.Equal(t, Source{URL: "https://status.example.com", Title: "Status of [host]", Snippet: "[host] is up"}, data["sources"].([]Source)[0])
+
+			stored, ok := results.Get("res_redact", "")
+			require.True(t, ok)
+			require.Equal(t, "Ask ops at db1.corp.internal [1]", stored.Content, "stored results keep the answer as received")
+			require.Equal(t, "db1.corp.internal status", stored.Citations[0].Title)
+		})
+	}
+}
+
+func TestGetSectionRedactsStoredResults(t *testing.T) {
+	config := reloadableConfig(t)
+	config.ResponseRedactions = hostRedactions
+	live := NewLiveConfig(config)
+	results := NewResultStore(10)
+	stored, _ := internalAnswer(context.Background(), SearchRequest{Model: DeepResearchModel})
+	results.Put(context.Background(), stored)
+	handler := GetSectionHandler(results, live)
+
+	var request mcp.CallToolRequest
+	request.Params.Arguments = map[string]any{"result_id": "res_redact", "section": 0}
+	result, err := handler(context.Background(), request)
+	require.NoError(t, err)
+	require.Equal(t, "Ask ops at [host] [1]", result.StructuredContent.(map[string]any)["content"])
+	require.Equal(t, "Ask ops at db1.corp.internal [1]", stored.Content, "the stored result is not modified")
+
+	// Rules changed by a reload apply to answers stored before it
+	next := reloadableConfig(t)
+	next.ResponseRedactions = RedactionRules{{Name: "ops", Pattern: `\bops\b`}}
+	_, err = live.Reload(next)
+	require.NoError(t, err)
+	result, err = handler(context.Background(), request)
+	require.NoError(t, err)
+	require.Equal(t, "Ask [redacted] at db1.corp.internal [1]", result.StructuredContent.(map[string]any)["content"])
+}
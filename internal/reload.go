@@ -0,0 +1,178 @@
+package internal
+
+import (
+	"maps"
+	"sync"
+	"sync/atomic"
+)
+
+// LiveConfig holds the active configuration and allows it to be replaced while
+// the server is running. Handlers read it per call through Get so a reload
+// never interrupts in-flight requests or open MCP sessions.
+type LiveConfig struct {
+	current atomic.Pointer[Config]
+
+	// mu serializes changes so a reload and a tool toggle never overwrite
+	// each other; toggles holds the tools enabled or disabled at runtime
+	mu      sync.Mutex
+	toggles map[string]bool
+}
+
+func NewLiveConfig(config *Config) *LiveConfig {
+	live := &LiveConfig{}
+	live.current.Store(config)
+	return live
+}
+
+// Get returns the active configuration. The returned value must not be modified.
+func (l *LiveConfig) Get() *Config {
+	return l.current.Load()
+}
+
+// Reload validates next and makes it the active configuration. Settings that
+// only take effect at startup are carried over from the active configuration;
+// the names of those that differ in next are returned so callers can warn
+// about them. Tools enabled or disabled through SetToolEnabled keep their
+// state. On error the active configuration is left unchanged.
+func (l *LiveConfig) Reload(next *Config) ([]string, error) {
+	if err := next.Validate(); err != nil {
+		return nil, err
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	active := l.Get()
+	updated := *next
+	var ignored []string
+
+	if next.PerplexityAPIKeyFile != active.PerplexityAPIKeyFile || next.PerplexitySecretARN != active.PerplexitySecretARN ||
+		next.Vault != active.Vault || next.SecretRefreshInterval != active.SecretRefreshInterval || next.PerplexityAPIKey != active.PerplexityAPIKey {
+		ignored = append(ignored, "api key source")
+	}
+	// Reloads never swap the key; secret providers rotate it on their own schedule
+	updated.PerplexityAPIKey, updated.PerplexityAPIKeyFile, updated.PerplexitySecretARN, updated.SecretRefreshInterval =
+		active.PerplexityAPIKey, active.PerplexityAPIKeyFile, active.PerplexitySecretARN, active.SecretRefreshInterval
+	updated.Vault = active.Vault
+
+	if next.Transport != active.Transport || next.Addr() != active.Addr() ||
+		next.TLSCertFile != active.TLSCertFile || next.TLSKeyFile != active.TLSKeyFile || next.TLSClientCAFile != active.TLSClientCAFile ||
+		next.HTTPLimits != active.HTTPLimits {
+		ignored = append(ignored, "transport")
+		updated.Transport, updated.Host, updated.Port = active.Transport, active.Host, active.Port
+		updated.TLSCertFile, updated.TLSKeyFile, updated.TLSClientCAFile = active.TLSCertFile, active.TLSKeyFile, active.TLSClientCAFile
+		updated.HTTPLimits = active.HTTPLimits
+	}
+	if next.Provider != active.Provider {
+		ignored = append(ignored, "search provider")
+		updated.Provider = active.Provider
+	}
+	if next.APIConnectionPool != active.APIConnectionPool {
+		ignored = append(ignored, "API connection pool")
+		updated.APIConnectionPool = active.APIConnectionPool
+	}
+	if next.APIRetryPolicy != active.APIRetryPolicy {
+		ignored = append(ignored, "API retry policy")
+		updated.APIRetryPolicy = active.APIRetryPolicy
+	}
+	if next.MaxResponseBytes != active.MaxResponseBytes {
+		ignored = append(ignored, "max response bytes")
+		updated.MaxResponseBytes = active.MaxResponseBytes
+	}
+	if next.ProxyURL != active.ProxyURL {
+		ignored = append(ignored, "proxy")
+		updated.ProxyURL = active.ProxyURL
+	}
+	if next.StoragePath != active.StoragePath {
+		ignored = append(ignored, "storage path")
+		updated.StoragePath = active.StoragePath
+	}
+	if next.ResultRetention != active.ResultRetention {
+		ignored = append(ignored, "result retention")
+		updated.ResultRetention = active.ResultRetention
+	}
+	if next.PluginDir != active.PluginDir {
+		ignored = append(ignored, "plugin directory")
+		updated.PluginDir = active.PluginDir
+	}
+	if next.AuditLogPath != active.AuditLogPath {
+		ignored = append(ignored, "audit log path")
+		updated.AuditLogPath = active.AuditLogPath
+	}
+	if next.LogOutput != active.LogOutput || next.LogFile != active.LogFile || next.LogSyslog != active.LogSyslog {
+		ignored = append(ignored, "log output")
+		updated.LogOutput, updated.LogFile, updated.LogSyslog = active.LogOutput, active.LogFile, active.LogSyslog
+	}
+	if next.StatsD != active.StatsD {
+		ignored = append(ignored, "StatsD")
+		updated.StatsD = active.StatsD
+	}
+	if next.Sentry != active.Sentry {
+		ignored = append(ignored, "Sentry")
+		updated.Sentry = active.Sentry
+	}
+	if next.LogFormat != active.LogFormat {
+		ignored = append(ignored, "log format")
+		updated.LogFormat = active.LogFormat
+	}
+	// Tokens can be rotated and revoked, but removing them all would open
+	// the HTTP endpoint to anyone
+	if len(next.AuthTokens) == 0 && len(active.AuthTokens) > 0 {
+		ignored = append(ignored, "auth tokens")
+		updated.AuthTokens = active.AuthTokens
+	}
+	if next.AdminAddr != active.AdminAddr || next.AdminToken != active.AdminToken {
+		ignored = append(ignored, "admin API")
+		updated.AdminAddr, updated.AdminToken = active.AdminAddr, active.AdminToken
+	}
+	if next.SessionTTL != active.SessionTTL || next.SessionMaxHistory != active.SessionMaxHistory {
+		ignored = append(ignored, "session limits")
+		updated.SessionTTL, updated.SessionMaxHistory = active.SessionTTL, active.SessionMaxHistory
+	}
+	if next.JobTTL != active.JobTTL || next.MaxJobs != active.MaxJobs {
+		ignored = append(ignored, "job limits")
+		updated.JobTTL, updated.MaxJobs = active.JobTTL, active.MaxJobs
+	}
+
+	if len(l.toggles) > 0 {
+		updated.DisabledTools = maps.Clone(next.DisabledTools)
+		if updated.DisabledTools == nil {
+			updated.DisabledTools = make(map[string]bool)
+		}
+		for name, enabled := range l.toggles {
+			setToolDisabled(updated.DisabledTools, name, !enabled)
+		}
+	}
+
+	l.current.Store(&updated)
+	return ignored, nil
+}
+
+// SetToolEnabled enables or disables the named tool in a copy of the active
+// configuration, makes the copy active and returns it. The change lasts until
+// the server restarts; reloads keep it.
+func (l *LiveConfig) SetToolEnabled(name string, enabled bool) *Config {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.toggles == nil {
+		l.toggles = make(map[string]bool)
+	}
+	l.toggles[name] = enabled
+
+	active := l.Get()
+	updated := *active
+	updated.DisabledTools = maps.Clone(active.DisabledTools)
+	if updated.DisabledTools == nil {
+		updated.DisabledTools = make(map[string]bool)
+	}
+	setToolDisabled(updated.DisabledTools, name, !enabled)
+	l.current.Store(&updated)
+	return &updated
+}
+
+func setToolDisabled(disabled map[string]bool, name string, off bool) {
+	if off {
+		disabled[name] = true
+	} else {
+		delete(disabled, name)
+	}
+}
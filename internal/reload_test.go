@@ -0,0 +1,72 @@
+package internal
+
+import (
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func reloadableConfig(t *testing.T) *Config {
+	t.Setenv("PERPLEXITY_API_KEY", "test-key")
+	config, err := LoadConfig("")
+	require.NoError(t, err)
+	return config
+}
+
+func TestReloadKeepsRuntimeToolToggles(t *testing.T) {
+	start := reloadableConfig(t)
+	start.DisabledTools = map[string]bool{"perplexity_raw": true}
+	live := NewLiveConfig(start)
+
+	live.SetToolEnabled("perplexity_raw", true)
+	live.SetToolEnabled("perplexity_search", false)
+
+	next := reloadableConfig(t)
+	next.DisabledTools = map[string]bool{"perplexity_raw": true, "perplexity_reason": true}
+	_, err := live.Reload(next)
+	require.NoError(t, err)
+
+	config := live.Get()
+	require.True(t, config.ToolEnabled("perplexity_raw"))
+	require.False(t, config.ToolEnabled("perplexity_search"))
+	require.False(t, config.ToolEnabled("perplexity_reason"), "untoggled tools follow the file")
+	require.True(t, next.DisabledTools["perplexity_raw"], "the reloaded config is not modified")
+}
+
+func TestReloadConcurrentWithToolToggle(t *testing.T) {
+	live := NewLiveConfig(reloadableConfig(t))
+	next := reloadableConfig(t)
+
+	var wg sync.WaitGroup
+	for i := range 50 {
+		wg.Add(2)
+		go func() {
+			defer wg.Done()
+			_, err := live.Reload(next)
+			require.NoError(t, err)
+		}()
+		go func() {
+			defer wg.Done()
+			live.SetToolEnabled("tool-"+string(rune('a'+i%26)), false)
+		}()
+	}
+	wg.Wait()
+
+	for i := range 26 {
+		require.False(t, live.Get().ToolEnabled("tool-"+string(rune('a'+i))))
+	}
+}
+
+func TestShutdownWaitCoversLongestTimeout(t *testing.T) {
+	config := reloadableConfig(t)
+	require.Equal(t, DefaultDeepResearchTimeout, config.ShutdownWait())
+
+	config.ToolTimeouts = map[string]time.Duration{"perplexity_research_workflow": 20 * time.Minute}
+	require.Equal(t, 20*time.Minute, config.ShutdownWait())
+
+	t.Setenv("SHUTDOWN_TIMEOUT_SECONDS", "45")
+	config = reloadableConfig(t)
+	require.Equal(t, 45*time.Second, config.ShutdownWait())
+}
@@ -0,0 +1,81 @@
+package internal
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"log/slog"
+	"time"
+
+	"github.com/mark3labs/mcp-go/mcp"
+	"github.com/mark3labs/mcp-go/server"
+)
+
+type requestIDKey struct{}
+
+// NewRequestID returns a random 16-character hex request ID
+func NewRequestID() string {
+	b := make([]byte, 8)
+	_, _ = rand.Read(b)
+	return hex.EncodeToString(b)
+}
+
+// WithRequestID attaches a request ID to ctx
+func WithRequestID(ctx context.Context, id string) context.Context {
+	return context.WithValue(ctx, requestIDKey{}, id)
+}
+
+// RequestIDFromContext returns the request ID attached to ctx, or ""
+func RequestIDFromContext(ctx context.Context) string {
+	id, _ := ctx.Value(requestIDKey{}).(string)
+	return id
+}
+
+// RequestIDMiddleware gives every tool call a request ID. The ID is attached to
+// the context for log lines further down, logged with the call's outcome, and
+// returned in the result's _meta.request_id or appended to the error, so users
+// can report problems with a traceable ID. Register it before other middleware
+// except PacingMiddleware.
+func RequestIDMiddleware(logger *slog.Logger, transport string) server.ToolHandlerMiddleware {
+	return func(next server.ToolHandlerFunc) server.ToolHandlerFunc {
+		return func(ctx context.Context, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+			id := NewRequestID()
+			ctx = WithRequestID(ctx, id)
+
+			start := time.Now()
+			result, err := next(ctx, request)
+
+			key := clientKey(ctx, transport)
+			status := "ok"
+			if err != nil || (result != nil && result.IsError) {
+				status = "error"
+			}
+			logger.InfoContext(ctx, "Tool call finished",
+				"tool", request.Params.Name,
+				"client", key.clientName+"/"+key.clientVersion,
+				"status", status,
+				"latency_ms", time.Since(start).Milliseconds())
+
+			if details := apiErrorDetails(err); details != nil {
+				// Return failed API calls as error results, which can carry the
+				// structured error and the request ID in _meta
+				result, err = apiErrorResult(result, err, details), nil
+			}
+			if err != nil {
+				// Error results are replaced by a JSON-RPC error, so carry the ID in the message
+				return result, fmt.Errorf("%w (request_id %s)", err, id)
+			}
+			if result != nil {
+				if result.Meta == nil {
+					result.Meta = &mcp.Meta{}
+				}
+				if result.Meta.AdditionalFields == nil {
+					result.Meta.AdditionalFields = map[string]any{}
+				}
+				result.Meta.AdditionalFields["request_id"] = id
+			}
+			return result, nil
+		}
+	}
+}
@@ -0,0 +1,72 @@
+package internal
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+// Defaults for retrying rate-limited API requests
+const (
+	DefaultAPIRateLimitRetries = 1
+	DefaultAPIMaxRetryWait     = 30 * time.Second
+)
+
+// RetryPolicy selects how the API client retries requests refused with HTTP
+// 429. A request is only retried when the API said how long to wait, and that
+// wait is within MaxWait and the request's deadline.
+type RetryPolicy struct {
+	// Retries bounds the retries of one request (0 disables them)
+	Retries int
+	// MaxWait is the longest wait before a retry; longer waits fail the call
+	// at once with the wait as its retry hint
+	MaxWait time.Duration
+}
+
+func (p RetryPolicy) Validate() error {
+	if p.Retries < 0 {
+		return fmt.Errorf("API rate limit retries must not be negative")
+	}
+	if p.MaxWait < 0 {
+		return fmt.Errorf("API max retry wait must not be negative")
+	}
+	return nil
+}
+
+// WithRetryPolicy sets how rate-limited requests are retried
+func WithRetryPolicy(policy RetryPolicy) ClientOption {
+	return func(c *PerplexityClient) {
+		c.retry = policy
+	}
+}
+
+// rateLimitWait returns how long a 429 response asks clients to wait: its
+// Retry-After header, or else the reset time of its rate-limit headers
+func rateLimitWait(header http.Header, now time.Time) time.Duration {
+	if wait := parseRetryAfter(header.Get("Retry-After"), now); wait > 0 {
+		return wait
+	}
+	return parseRateLimitReset(firstHeader(header, "X-RateLimit-Reset-Requests", "X-RateLimit-Reset"), now)
+}
+
+// parseRateLimitReset reads a rate-limit reset header, given as a duration
+// such as 1m30s, in seconds, or as a Unix time, and returns the time left
+// until the reset
+func parseRateLimitReset(value string, now time.Time) time.Duration {
+	if value == "" {
+		return 0
+	}
+	if wait, err := time.ParseDuration(value); err == nil {
+		return max(wait, 0)
+	}
+	seconds, err := strconv.ParseFloat(value, 64)
+	if err != nil || seconds <= 0 {
+		return 0
+	}
+	// Values this large are timestamps rather than waits
+	if seconds > 1e9 {
+		return max(time.Unix(int64(seconds), 0).Sub(now), 0)
+	}
+	return time.Duration(seconds * float64(time.Second))
+}
@@ -0,0 +1,59 @@
+package internal
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"strings"
+	"time"
+)
+
+// queryRewritePrompt asks for a cleaned-up search query; %s is today's date,
+// which relative dates are anchored to
+const queryRewritePrompt = `You rewrite search queries for a web search engine. Fix spelling, expand acronyms whose meaning is clear from the query, and replace relative dates such as "last year" or "this week" with absolute dates; today is %s. Keep the meaning, the language and any quoted phrases. Do not answer the query. Reply with only the rewritten query on one line, or the query unchanged if it needs no rewriting.`
+
+// QueryRewrite records the query sent in place of the one asked with rewrite_query
+type QueryRewrite struct {
+	Original  string `json:"original"`
+	Rewritten string `json:"rewritten"`
+	// Model and Usage are of the rewriting call
+	Model string `json:"model"`
+	Usage Usage  `json:"usage"`
+}
+
+// rewriteQuery has the default model rewrite req's query before it is searched,
+// with web search disabled, and records the call's usage as one of tool. The
+// original query is kept, and nil returned, when the rewrite fails or yields
+// nothing usable.
+func rewriteQuery(ctx context.Context, client SearchProvider, config *Config, usage *UsageTracker, tool string, req *SearchRequest) *QueryRewrite {
+	// The default model is usually the cheapest; fall back to the searching one
+	model := config.DefaultModel
+	if config.CheckModel(model) != nil {
+		model = req.Model
+	}
+	rewriteReq := SearchRequest{
+		Query:        req.Query,
+		Model:        model,
+		SystemPrompt: fmt.Sprintf(queryRewritePrompt, time.Now().Format("January 2, 2006")),
+		Options:      map[string]string{"disable_search": "true"},
+	}
+	result, err := searchWithModelFallback(ctx, client, config, tool, rewriteReq, nil)
+	if err != nil {
+		slog.Default().WarnContext(ctx, "Query rewrite failed, searching the original query", "tool", tool, "error", err)
+		return nil
+	}
+	usage.Record(config.ModelPrices, tool, req.SessionID, result)
+	result = withReasoningOutput(result, ReasoningStrip)
+
+	rewritten, _, _ := strings.Cut(strings.TrimSpace(result.Content), "\n")
+	rewritten = strings.Trim(strings.TrimSpace(rewritten), "\"'`")
+	if rewritten == "" || len(rewritten) > req.MaxQueryLength {
+		return nil
+	}
+	return &QueryRewrite{
+		Original:  req.Query,
+		Rewritten: rewritten,
+		Model:     result.Model,
+		Usage:     result.Usage,
+	}
+}
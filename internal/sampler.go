@@ -0,0 +1,140 @@
+package internal
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"math/rand/v2"
+	"regexp"
+	"sync"
+	"time"
+
+	"github.com/mark3labs/mcp-go/mcp"
+)
+
+// ReviewQueueURI is the resource URI of the sampled answers awaiting quality review
+const ReviewQueueURI = "perplexity://review-queue"
+
+// DefaultReviewQueueSize is the number of samples kept before the oldest are dropped
+const DefaultReviewQueueSize = 200
+
+// Patterns for personal data and secrets removed from sampled text
+var redactionPatterns = []struct {
+	pattern     *regexp.Regexp
+	replacement string
+}{
+	{regexp.MustCompile(`[A-Za-z0-9._%+-]+@[A-Za-z0-9.-]+\.[A-Za-z]{2,}`), "[email]"},
+	{regexp.MustCompile(`\b(?:pplx|sk)-[A-Za-z0-9_-]{8,}\b`), "[secret]"},
+	{regexp.MustCompile(`https?://[^\s/]+:[^\s@/]+@`), "https://[credentials]@"},
+	{regexp.MustCompile(`\+?\d[\d\s().-]{7,}\d`), "[number]"},
+}
+
+// redactText masks email addresses, API keys, URL credentials and long numbers
+// such as phone or card numbers
+func redactText(text string) string {
+	for _, r := range redactionPatterns {
+		text = r.pattern.ReplaceAllString(text, r.replacement)
+	}
+	return text
+}
+
+// ReviewSample is one redacted query/answer pair queued for quality review.
+// It carries no session, client or result identifiers.
+type ReviewSample struct {
+	Query     string     `json:"query"`
+	Answer    string     `json:"answer"`
+	Model     string     `json:"model"`
+	Citations []Citation `json:"citations,omitempty"`
+	Sampled   time.Time  `json:"sampled"`
+}
+
+// QualitySampler keeps a small random share of answered searches in a bounded
+// review queue so deployment owners can audit answer and citation quality.
+type QualitySampler struct {
+	mu      sync.Mutex
+	samples []ReviewSample
+	maxSize int
+	random  func() float64
+}
+
+func NewQualitySampler(maxSize int) *QualitySampler {
+	if maxSize <= 0 {
+		maxSize = DefaultReviewQueueSize
+	}
+	return &QualitySampler{
+		maxSize: maxSize,
+		random:  rand.Float64,
+	}
+}
+
+// Offer queues a redacted copy of the exchange with probability rate.
+// A rate of zero disables sampling.
+func (s *QualitySampler) Offer(rate float64, query string, result *SearchResult) {
+	if rate <= 0 || result == nil {
+		return
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.random() >= rate {
+		return
+	}
+
+	citations := make([]Citation, len(result.Citations))
+	for i, citation := range result.Citations {
+		citation.Title = redactText(citation.Title)
+		citations[i] = citation
+	}
+	s.samples = append(s.samples, ReviewSample{
+		Query:     redactText(query),
+		Answer:    redactText(result.Content),
+		Model:     result.Model,
+		Citations: citations,
+		Sampled:   time.Now().UTC().Truncate(time.Hour),
+	})
+	if len(s.samples) > s.maxSize {
+		s.samples = s.samples[len(s.samples)-s.maxSize:]
+	}
+}
+
+// Samples returns a copy of the queued samples, oldest first
+func (s *QualitySampler) Samples() []ReviewSample {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	samples := make([]ReviewSample, len(s.samples))
+	copy(samples, s.samples)
+	return samples
+}
+
+// CreateReviewQueueResource creates the perplexity://review-queue resource
+func CreateReviewQueueResource() mcp.Resource {
+	return mcp.NewResource(
+		ReviewQueueURI,
+		"Quality review queue",
+		mcp.WithResourceDescription("Redacted sample of recent query/answer pairs for auditing answer quality and citation validity"),
+		mcp.WithMIMEType("application/json"),
+	)
+}
+
+// ReviewQueueResourceHandler creates the resources/read handler for the review queue
+func ReviewQueueResourceHandler(sampler *QualitySampler, live *LiveConfig) func(ctx context.Context, request mcp.ReadResourceRequest) ([]mcp.ResourceContents, error) {
+	return func(ctx context.Context, request mcp.ReadResourceRequest) ([]mcp.ResourceContents, error) {
+		jsonBytes, err := json.MarshalIndent(map[string]any{
+			"sample_rate": live.Get().QualitySampleRate,
+			"samples":     sampler.Samples(),
+		}, "", "  ")
+		if err != nil {
+			return nil, fmt.Errorf("failed to marshal review queue: %w", err)
+		}
+
+		return []mcp.ResourceContents{
+			mcp.TextResourceContents{
+				URI:      request.Params.URI,
+				MIMEType: "application/json",
+				Text:     string(jsonBytes),
+			},
+		}, nil
+	}
+}
@@ -0,0 +1,84 @@
+package internal
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/mark3labs/mcp-go/mcp"
+	"github.com/mark3labs/mcp-go/server"
+)
+
+// SearchURIPrefix is the URI scheme of stored search results
+const SearchURIPrefix = "search://"
+
+// SearchURI returns the resource URI of the stored result with id
+func SearchURI(id string) string {
+	return SearchURIPrefix + id
+}
+
+// CreateSearchResourceTemplate creates the search://{id} resource template, which
+// also reads results that are no longer listed but remain in persistent storage
+func CreateSearchResourceTemplate() mcp.ResourceTemplate {
+	return mcp.NewResourceTemplate(
+		SearchURIPrefix+"{id}",
+		"Search result",
+		mcp.WithTemplateDescription("Full JSON of a stored search result, including citations, sources and annotations"),
+		mcp.WithTemplateMIMEType("application/json"),
+	)
+}
+
+// CreateSearchResource creates the listed resource of one stored result
+func CreateSearchResource(result *SearchResult) mcp.Resource {
+	return mcp.NewResource(
+		SearchURI(result.ID),
+		"Search result "+result.ID,
+		mcp.WithResourceDescription(fmt.Sprintf("%s answer from %s", result.Model, result.Created.UTC().Format(time.RFC3339))),
+		mcp.WithMIMEType("application/json"),
+	)
+}
+
+// SearchResourceHandler creates the resources/read handler for stored results
+func SearchResourceHandler(results *ResultStore, live *LiveConfig) func(ctx context.Context, request mcp.ReadResourceRequest) ([]mcp.ResourceContents, error) {
+	return func(ctx context.Context, request mcp.ReadResourceRequest) ([]mcp.ResourceContents, error) {
+		id := strings.TrimPrefix(request.Params.URI, SearchURIPrefix)
+		result, ok := results.Get(id, clientIdentity(ctx))
+		if !ok {
+			return nil, fmt.Errorf("result not found: %s", id)
+		}
+		result = live.Get().ResponseRedactions.apply(result)
+
+		jsonBytes, err := json.MarshalIndent(result, "", "  ")
+		if err != nil {
+			return nil, fmt.Errorf("failed to marshal result: %w", err)
+		}
+
+		return []mcp.ResourceContents{
+			mcp.TextResourceContents{
+				URI:      request.Params.URI,
+				MIMEType: "application/json",
+				Text:     string(jsonBytes),
+			},
+		}, nil
+	}
+}
+
+// ListSearchResources keeps the server's resource list in step with results:
+// each stored result is listed as a search:// resource until it is evicted
+func ListSearchResources(mcpServer *server.MCPServer, results *ResultStore, live *LiveConfig) {
+	handler := SearchResourceHandler(results, live)
+	results.OnChange(func(stored *SearchResult, evicted []string) {
+		if stored != nil {
+			mcpServer.AddResource(CreateSearchResource(stored), handler)
+		}
+		if len(evicted) > 0 {
+			uris := make([]string, len(evicted))
+			for i, id := range evicted {
+				uris[i] = SearchURI(id)
+			}
+			mcpServer.DeleteResources(uris...)
+		}
+	})
+}
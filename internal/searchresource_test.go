@@ -0,0 +1,53 @@
+package internal
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/mark3labs/mcp-go/mcp"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSearchResultsOnlyVisibleToTheirOwner(t *testing.T) {
+	results := NewResultStore(10)
+	live := NewLiveConfig(&Config{})
+	req := SearchRequest{Query: "q", Model: "sonar"}
+	alice, mallory := withIdentity("token:alice"), withIdentity("ip:198.51.100.9")
+	results.PutAnswer(alice, req, &SearchResult{ID: "res_1", Model: "sonar", Content: "## Findings\nSecret plans", Created: time.Now()})
+
+	uri := mcp.ReadResourceRequest{Params: mcp.ReadResourceParams{URI: SearchURI("res_1")}}
+	page := mcp.ReadResourceRequest{Params: mcp.ReadResourceParams{URI: SearchURI("res_1") + "/content", Arguments: map[string]any{"id": "res_1"}}}
+	section := jobRequest("", "")
+	section.Params.Arguments = map[string]any{"result_id": "res_1"}
+	annotate := jobRequest("", "")
+	annotate.Params.Arguments = map[string]any{"result_id": "res_1", "rating": 5}
+
+	// Another client can neither read, page, section nor annotate the result
+	_, err := SearchResourceHandler(results, live)(mallory, uri)
+	require.ErrorContains(t, err, "result not found")
+	_, err = ContentPageHandler(results, live)(mallory, page)
+	require.ErrorContains(t, err, "result not found")
+	for _, handler := range []func(context.Context, mcp.CallToolRequest) (*mcp.CallToolResult, error){
+		GetSectionHandler(results, live),
+		AnnotateHandler(results, NewRequestStats()),
+	} {
+		result, err := handler(mallory, section)
+		require.ErrorContains(t, err, "result not found")
+		require.True(t, result.IsError)
+	}
+	_, ok := results.Latest(queryKey(req), "ip:198.51.100.9")
+	require.False(t, ok)
+
+	// The owner still can
+	contents, err := SearchResourceHandler(results, live)(alice, uri)
+	require.NoError(t, err)
+	require.Contains(t, contents[0].(mcp.TextResourceContents).Text, "Secret plans")
+	_, err = ContentPageHandler(results, live)(alice, page)
+	require.NoError(t, err)
+	result, err := AnnotateHandler(results, NewRequestStats())(alice, annotate)
+	require.NoError(t, err)
+	require.False(t, result.IsError)
+	_, ok = results.Latest(queryKey(req), "token:alice")
+	require.True(t, ok)
+}
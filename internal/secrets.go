@@ -0,0 +1,78 @@
+package internal
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"time"
+)
+
+// DefaultSecretRefreshInterval is how often an external API key source is re-read for rotation
+const DefaultSecretRefreshInterval = 30 * time.Second
+
+// secretFetchTimeout bounds a single fetch from a secret provider
+const secretFetchTimeout = 10 * time.Second
+
+// SecretProvider supplies the Perplexity API key from an external secret store
+type SecretProvider interface {
+	// APIKey fetches the current key
+	APIKey(ctx context.Context) (string, error)
+	// Source describes where the key is read from, for logs
+	Source() string
+}
+
+// NewSecretProvider returns the provider configured in config, or nil when the
+// API key is given directly
+func NewSecretProvider(ctx context.Context, config *Config) (SecretProvider, error) {
+	switch {
+	case config.PerplexityAPIKeyFile != "":
+		return NewFileSecretProvider(config.PerplexityAPIKeyFile), nil
+	case config.PerplexitySecretARN != "":
+		return NewAWSSecretProvider(ctx, config.PerplexitySecretARN)
+	case config.Vault.SecretPath != "":
+		return NewVaultSecretProvider(config.Vault)
+	default:
+		return nil, nil
+	}
+}
+
+// FetchAPIKey reads the key from provider, bounded by a fetch timeout
+func FetchAPIKey(ctx context.Context, provider SecretProvider) (string, error) {
+	ctx, cancel := context.WithTimeout(ctx, secretFetchTimeout)
+	defer cancel()
+
+	apiKey, err := provider.APIKey(ctx)
+	if err != nil {
+		return "", fmt.Errorf("failed to fetch API key from %s: %w", provider.Source(), err)
+	}
+	if apiKey == "" {
+		return "", fmt.Errorf("API key from %s is empty", provider.Source())
+	}
+	return apiKey, nil
+}
+
+// WatchSecret re-reads the key from provider every interval until ctx is
+// cancelled and hands the client any key that differs from current. Failed
+// fetches keep the current key.
+func WatchSecret(ctx context.Context, provider SecretProvider, interval time.Duration, client SearchProvider, current string, logger *slog.Logger) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			apiKey, err := FetchAPIKey(ctx, provider)
+			if err != nil {
+				logger.Warn("Keeping current API key", "error", err)
+				continue
+			}
+			if apiKey != current {
+				client.SetAPIKey(apiKey)
+				current = apiKey
+				logger.Info("API key reloaded", "source", provider.Source())
+			}
+		}
+	}
+}
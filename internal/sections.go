@@ -0,0 +1,84 @@
+package internal
+
+import (
+	"strings"
+)
+
+// DeepResearchModel is the model whose long-form reports are split into sections
+const DeepResearchModel = "sonar-deep-research"
+
+// Section is a heading-delimited part of an answer
+type Section struct {
+	Index   int    `json:"index"`
+	Title   string `json:"title"`
+	Level   int    `json:"level"`
+	Content string `json:"content,omitempty"`
+}
+
+// splitSections splits markdown content into sections at ATX headings (# Title).
+// Text before the first heading becomes an "Introduction" section. Headings inside
+// fenced code blocks are ignored.
+func splitSections(content string) []Section {
+	var sections []Section
+	current := Section{Title: "Introduction"}
+	var body []string
+	inFence := false
+
+	flush := func() {
+		text := strings.TrimSpace(strings.Join(body, "\n"))
+		if text != "" || current.Level > 0 {
+			current.Index = len(sections)
+			current.Content = text
+			sections = append(sections, current)
+		}
+		body = nil
+	}
+
+	for _, line := range strings.Split(content, "\n") {
+		trimmed := strings.TrimSpace(line)
+		if strings.HasPrefix(trimmed, "```") {
+			inFence = !inFence
+		}
+
+		if level, title, ok := parseHeading(trimmed); ok && !inFence {
+			flush()
+			current = Section{Title: title, Level: level}
+			continue
+		}
+		body = append(body, line)
+	}
+	flush()
+
+	return sections
+}
+
+// parseHeading reports whether line is a markdown ATX heading and returns its level and title
+func parseHeading(line string) (int, string, bool) {
+	level := 0
+	for level < len(line) && line[level] == '#' {
+		level++
+	}
+	if level == 0 || level > 6 || level >= len(line) || line[level] != ' ' {
+		return 0, "", false
+	}
+
+	title := strings.TrimSpace(line[level:])
+	// Drop an optional closing sequence such as "## Title ##"
+	if closing := strings.TrimRight(title, "#"); closing != title && strings.HasSuffix(closing, " ") {
+		title = strings.TrimSpace(closing)
+	}
+	if title == "" {
+		return 0, "", false
+	}
+	return level, title, true
+}
+
+// tableOfContents returns sections without their content
+func tableOfContents(sections []Section) []Section {
+	toc := make([]Section, len(sections))
+	for i, section := range sections {
+		section.Content = ""
+		toc[i] = section
+	}
+	return toc
+}
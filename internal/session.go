@@ -0,0 +1,230 @@
+package internal
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+	"unicode/utf8"
+)
+
+// Session defaults used when not configured
+const (
+	DefaultSessionTTL        = 30 * time.Minute
+	DefaultSessionMaxHistory = 20
+	MaxSessions              = 1000
+	MaxNotebookEntries       = 200
+)
+
+// truncatedTurnMarker ends a session turn cut to MaxMessageLength
+const truncatedTurnMarker = "\n\n[truncated]"
+
+var sessionIDPattern = regexp.MustCompile(`^[A-Za-z0-9._-]{1,128}$`)
+
+func validateSessionID(id string) error {
+	if !sessionIDPattern.MatchString(id) {
+		return fmt.Errorf("invalid session_id: must be 1-128 characters of letters, digits, '.', '_' or '-'")
+	}
+	return nil
+}
+
+type session struct {
+	messages []Message
+	notebook []NotebookEntry
+	lastUsed time.Time
+}
+
+// NotebookEntry is one answered question recorded in a session's notebook
+type NotebookEntry struct {
+	Query     string     `json:"query"`
+	Answer    string     `json:"answer"`
+	Model     string     `json:"model"`
+	Citations []Citation `json:"citations,omitempty"`
+	Created   time.Time  `json:"created"`
+}
+
+// SessionManager stores conversation history server-side keyed by session ID.
+// Sessions expire after ttl of inactivity and keep at most maxHistory messages,
+// each cut to fit the limits of context messages.
+type SessionManager struct {
+	mu         sync.Mutex
+	sessions   map[string]*session
+	ttl        time.Duration
+	maxHistory int
+	now        func() time.Time
+	storage    *Storage
+}
+
+func NewSessionManager(ttl time.Duration, maxHistory int) *SessionManager {
+	if ttl <= 0 {
+		ttl = DefaultSessionTTL
+	}
+	if maxHistory <= 0 {
+		maxHistory = DefaultSessionMaxHistory
+	}
+	maxHistory = min(maxHistory, MaxContextMessages)
+	return &SessionManager{
+		sessions:   make(map[string]*session),
+		ttl:        ttl,
+		maxHistory: maxHistory,
+		now:        time.Now,
+	}
+}
+
+// UseStorage restores unexpired sessions from storage and persists every later change
+func (m *SessionManager) UseStorage(storage *Storage) error {
+	records, err := storage.loadSessions()
+	if err != nil {
+		return err
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.storage = storage
+	for id, record := range records {
+		for i := range record.Messages {
+			record.Messages[i].Content = sessionTurn(record.Messages[i].Content)
+		}
+		m.sessions[id] = &session{
+			messages: record.Messages,
+			notebook: record.Notebook,
+			lastUsed: record.LastUsed,
+		}
+	}
+	m.evictExpired()
+	for len(m.sessions) > MaxSessions {
+		m.evictOldest()
+	}
+	return nil
+}
+
+// History returns a copy of the stored messages for id, or nil for an unknown session
+func (m *SessionManager) History(id string) []Message {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.evictExpired()
+
+	s, ok := m.sessions[id]
+	if !ok {
+		return nil
+	}
+	s.lastUsed = m.now()
+
+	history := make([]Message, len(s.messages))
+	copy(history, s.messages)
+	return history
+}
+
+// Notebook returns a copy of the notebook entries for id and whether the session exists
+func (m *SessionManager) Notebook(id string) ([]NotebookEntry, bool) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.evictExpired()
+
+	s, ok := m.sessions[id]
+	if !ok {
+		return nil, false
+	}
+
+	entries := make([]NotebookEntry, len(s.notebook))
+	copy(entries, s.notebook)
+	return entries, true
+}
+
+// Append records a completed user/assistant exchange, creating the session if needed
+func (m *SessionManager) Append(id, query string, result *SearchResult) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.evictExpired()
+
+	s, ok := m.sessions[id]
+	if !ok {
+		if len(m.sessions) >= MaxSessions {
+			m.evictOldest()
+		}
+		s = &session{}
+		m.sessions[id] = s
+	}
+
+	s.messages = append(s.messages,
+		Message{Role: "user", Content: sessionTurn(query)},
+		Message{Role: "assistant", Content: sessionTurn(result.Content)},
+	)
+	// Drop whole exchanges so history always starts with a user turn
+	for len(s.messages) > m.maxHistory && len(s.messages) >= 2 {
+		s.messages = s.messages[2:]
+	}
+
+	s.notebook = append(s.notebook, NotebookEntry{
+		Query:     query,
+		Answer:    result.Content,
+		Model:     result.Model,
+		Citations: result.Citations,
+		Created:   m.now(),
+	})
+	if len(s.notebook) > MaxNotebookEntries {
+		s.notebook = s.notebook[len(s.notebook)-MaxNotebookEntries:]
+	}
+	s.lastUsed = m.now()
+
+	if m.storage != nil {
+		record := sessionRecord{Messages: s.messages, Notebook: s.notebook, LastUsed: s.lastUsed}
+		if err := m.storage.saveSession(id, record); err != nil {
+			m.storage.logger.Warn("Failed to persist session", "session_id", id, "error", err)
+		}
+	}
+}
+
+// sessionTurn returns content as it is kept in session history: cut to
+// MaxMessageLength bytes, and never empty, so the history always passes
+// validation when sent as context messages
+func sessionTurn(content string) string {
+	if strings.TrimSpace(content) == "" {
+		return "(no answer)"
+	}
+	if len(content) <= MaxMessageLength {
+		return content
+	}
+	cut := MaxMessageLength - len(truncatedTurnMarker)
+	for cut > 0 && !utf8.RuneStart(content[cut]) {
+		cut--
+	}
+	return content[:cut] + truncatedTurnMarker
+}
+
+// evictExpired removes sessions idle for longer than the TTL. Callers must hold m.mu.
+func (m *SessionManager) evictExpired() {
+	cutoff := m.now().Add(-m.ttl)
+	for id, s := range m.sessions {
+		if s.lastUsed.Before(cutoff) {
+			m.remove(id)
+		}
+	}
+}
+
+// evictOldest removes the least recently used session. Callers must hold m.mu.
+func (m *SessionManager) evictOldest() {
+	var oldestID string
+	var oldest time.Time
+	for id, s := range m.sessions {
+		if oldestID == "" || s.lastUsed.Before(oldest) {
+			oldestID, oldest = id, s.lastUsed
+		}
+	}
+	m.remove(oldestID)
+}
+
+// remove drops a session from memory and storage. Callers must hold m.mu.
+func (m *SessionManager) remove(id string) {
+	delete(m.sessions, id)
+	if m.storage != nil {
+		if err := m.storage.deleteSession(id); err != nil {
+			m.storage.logger.Warn("Failed to delete session", "session_id", id, "error", err)
+		}
+	}
+}
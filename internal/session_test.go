@@ -0,0 +1,44 @@
+package internal
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestSessionHistoryStaysValidContext(t *testing.T) {
+	sessions := NewSessionManager(time.Hour, 500)
+	long := strings.Repeat("é", MaxMessageLength)
+	for range 80 {
+		sessions.Append("s1", "next question", &SearchResult{Content: long})
+	}
+	sessions.Append("s1", "sources only", &SearchResult{})
+
+	history := sessions.History("s1")
+	require.Len(t, history, MaxContextMessages)
+	require.NoError(t, validateContextMessages(history))
+	require.True(t, strings.HasSuffix(history[1].Content, truncatedTurnMarker))
+	require.True(t, strings.HasPrefix(history[1].Content, strings.Repeat("é", 100)))
+
+	// The history can be sent with the next query of the session
+	req := SearchRequest{Query: "follow-up", Model: "sonar", ContextMessages: history}
+	require.NoError(t, req.Validate())
+}
+
+func TestSessionMaxHistoryValidated(t *testing.T) {
+	for _, tt := range []struct {
+		history int
+		ok      bool
+	}{{1, false}, {2, true}, {MaxContextMessages, true}, {MaxContextMessages + 2, false}} {
+		config := reloadableConfig(t)
+		config.SessionMaxHistory = tt.history
+		err := config.Validate()
+		if tt.ok {
+			require.NoError(t, err, tt.history)
+		} else {
+			require.ErrorContains(t, err, "session max history must be between 2 and 100", tt.history)
+		}
+	}
+}
@@ -0,0 +1,230 @@
+package internal
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/mark3labs/mcp-go/mcp"
+	"github.com/mark3labs/mcp-go/server"
+)
+
+// StatsURI is the resource URI of the request statistics snapshot
+const StatsURI = "perplexity://stats"
+
+// Transport names used to segment statistics
+const (
+	TransportStdio = "stdio"
+	TransportHTTP  = "http"
+)
+
+type statsKey struct {
+	transport     string
+	clientName    string
+	clientVersion string
+}
+
+type callCounters struct {
+	calls            int64
+	errors           int64
+	toolTimeouts     int64
+	upstreamTimeouts int64
+	latency          time.Duration
+}
+
+// RequestStats counts tool calls and errors segmented by transport and by the
+// client name/version reported at initialize.
+type RequestStats struct {
+	mu       sync.Mutex
+	counters map[statsKey]*callCounters
+	feedback FeedbackStats
+	started  time.Time
+}
+
+// ClientStats is the snapshot of one transport/client combination. Tool timeouts
+// are calls cut off by REQUEST_TIMEOUT_SECONDS; upstream timeouts are calls the
+// Perplexity API reported as timed out.
+type ClientStats struct {
+	Transport        string  `json:"transport"`
+	ClientName       string  `json:"client_name"`
+	ClientVersion    string  `json:"client_version"`
+	Calls            int64   `json:"calls"`
+	Errors           int64   `json:"errors"`
+	ToolTimeouts     int64   `json:"tool_timeouts"`
+	UpstreamTimeouts int64   `json:"upstream_timeouts"`
+	AvgLatencyMs     float64 `json:"avg_latency_ms"`
+}
+
+// TransportStats aggregates all clients of one transport
+type TransportStats struct {
+	Calls            int64 `json:"calls"`
+	Errors           int64 `json:"errors"`
+	ToolTimeouts     int64 `json:"tool_timeouts"`
+	UpstreamTimeouts int64 `json:"upstream_timeouts"`
+}
+
+// FeedbackStats summarizes annotations recorded since startup
+type FeedbackStats struct {
+	Annotations        int64   `json:"annotations"`
+	Rated              int64   `json:"rated"`
+	AvgRating          float64 `json:"avg_rating"`
+	IncorrectCitations int64   `json:"incorrect_citations"`
+	ratingSum          int64
+}
+
+// StatsSnapshot is the point-in-time view exposed to operators
+type StatsSnapshot struct {
+	StartedAt   time.Time                 `json:"started_at"`
+	ByTransport map[string]TransportStats `json:"by_transport"`
+	ByClient    []ClientStats             `json:"by_client"`
+	Feedback    FeedbackStats             `json:"feedback"`
+	Usage       UsageTotals               `json:"usage"`
+	APICalls    APICallStats              `json:"api_calls"`
+}
+
+func NewRequestStats() *RequestStats {
+	return &RequestStats{
+		counters: make(map[statsKey]*callCounters),
+		started:  time.Now(),
+	}
+}
+
+// Middleware records every tool call served over transport
+func (s *RequestStats) Middleware(transport string) server.ToolHandlerMiddleware {
+	return func(next server.ToolHandlerFunc) server.ToolHandlerFunc {
+		return func(ctx context.Context, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+			start := time.Now()
+			result, err := next(ctx, request)
+			s.record(clientKey(ctx, transport), time.Since(start), result, err)
+			return result, err
+		}
+	}
+}
+
+// clientKey identifies the calling client from its MCP session
+func clientKey(ctx context.Context, transport string) statsKey {
+	key := statsKey{transport: transport, clientName: "unknown", clientVersion: "unknown"}
+	if session, ok := server.ClientSessionFromContext(ctx).(server.SessionWithClientInfo); ok {
+		info := session.GetClientInfo()
+		if info.Name != "" {
+			key.clientName = info.Name
+		}
+		if info.Version != "" {
+			key.clientVersion = info.Version
+		}
+	}
+	return key
+}
+
+func (s *RequestStats) record(key statsKey, latency time.Duration, result *mcp.CallToolResult, err error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	counters, ok := s.counters[key]
+	if !ok {
+		counters = &callCounters{}
+		s.counters[key] = counters
+	}
+	counters.calls++
+	counters.latency += latency
+	if err != nil || (result != nil && result.IsError) {
+		counters.errors++
+	}
+
+	var timeoutErr *TimeoutError
+	if errors.As(err, &timeoutErr) {
+		switch timeoutErr.Kind {
+		case TimeoutKindTool:
+			counters.toolTimeouts++
+		case TimeoutKindUpstream:
+			counters.upstreamTimeouts++
+		}
+	}
+}
+
+// RecordAnnotation adds one piece of result feedback to the totals
+func (s *RequestStats) RecordAnnotation(annotation Annotation) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.feedback.Annotations++
+	s.feedback.IncorrectCitations += int64(len(annotation.IncorrectCitations))
+	if annotation.Rating > 0 {
+		s.feedback.Rated++
+		s.feedback.ratingSum += int64(annotation.Rating)
+		s.feedback.AvgRating = float64(s.feedback.ratingSum) / float64(s.feedback.Rated)
+	}
+}
+
+// Snapshot returns the current statistics
+func (s *RequestStats) Snapshot() StatsSnapshot {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	snapshot := StatsSnapshot{
+		StartedAt:   s.started,
+		ByTransport: make(map[string]TransportStats),
+		ByClient:    make([]ClientStats, 0, len(s.counters)),
+		Feedback:    s.feedback,
+	}
+	for key, counters := range s.counters {
+		transport := snapshot.ByTransport[key.transport]
+		transport.Calls += counters.calls
+		transport.Errors += counters.errors
+		transport.ToolTimeouts += counters.toolTimeouts
+		transport.UpstreamTimeouts += counters.upstreamTimeouts
+		snapshot.ByTransport[key.transport] = transport
+
+		snapshot.ByClient = append(snapshot.ByClient, ClientStats{
+			Transport:        key.transport,
+			ClientName:       key.clientName,
+			ClientVersion:    key.clientVersion,
+			Calls:            counters.calls,
+			Errors:           counters.errors,
+			ToolTimeouts:     counters.toolTimeouts,
+			UpstreamTimeouts: counters.upstreamTimeouts,
+			AvgLatencyMs:     float64(counters.latency.Milliseconds()) / float64(counters.calls),
+		})
+	}
+	sort.Slice(snapshot.ByClient, func(i, j int) bool {
+		return snapshot.ByClient[i].Calls > snapshot.ByClient[j].Calls
+	})
+
+	return snapshot
+}
+
+// CreateStatsResource creates the perplexity://stats resource
+func CreateStatsResource() mcp.Resource {
+	return mcp.NewResource(
+		StatsURI,
+		"Request statistics",
+		mcp.WithResourceDescription("Tool call and error counts by transport and client, plus result feedback, usage totals and upstream queueing"),
+		mcp.WithMIMEType("application/json"),
+	)
+}
+
+// StatsResourceHandler creates the resources/read handler for request statistics
+func StatsResourceHandler(stats *RequestStats, usage *UsageTracker, limiter *APILimiter) func(ctx context.Context, request mcp.ReadResourceRequest) ([]mcp.ResourceContents, error) {
+	return func(ctx context.Context, request mcp.ReadResourceRequest) ([]mcp.ResourceContents, error) {
+		snapshot := stats.Snapshot()
+		snapshot.Usage = usage.Summary().Total
+		snapshot.APICalls = limiter.Stats()
+
+		jsonBytes, err := json.MarshalIndent(snapshot, "", "  ")
+		if err != nil {
+			return nil, fmt.Errorf("failed to marshal request statistics: %w", err)
+		}
+
+		return []mcp.ResourceContents{
+			mcp.TextResourceContents{
+				URI:      request.Params.URI,
+				MIMEType: "application/json",
+				Text:     string(jsonBytes),
+			},
+		}, nil
+	}
+}
@@ -0,0 +1,248 @@
+package internal
+
+import (
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"strconv"
+	"time"
+
+	bolt "go.etcd.io/bbolt"
+)
+
+// StorageSchemaVersion is the on-disk layout version written by this build
+const StorageSchemaVersion = 1
+
+var (
+	metaBucket     = []byte("meta")
+	sessionsBucket = []byte("sessions")
+	resultsBucket  = []byte("results")
+	jobsBucket     = []byte("jobs")
+	usageBucket    = []byte("usage")
+
+	schemaVersionKey = []byte("schema_version")
+)
+
+// Storage persists conversation sessions, search results, research jobs and
+// daily usage totals in a bbolt file so they survive restarts.
+type Storage struct {
+	db     *bolt.DB
+	logger *slog.Logger
+}
+
+// sessionRecord is the persisted form of a conversation session
+type sessionRecord struct {
+	Messages []Message       `json:"messages"`
+	Notebook []NotebookEntry `json:"notebook"`
+	LastUsed time.Time       `json:"last_used"`
+}
+
+// jobRecord is the persisted form of a research job, with the request to send
+// again if the job was still running when the server stopped
+type jobRecord struct {
+	Job     Job           `json:"job"`
+	Request SearchRequest `json:"request"`
+	Result  *SearchResult `json:"result,omitempty"`
+}
+
+// OpenStorage opens (or creates) the database at path and migrates it to the current schema
+func OpenStorage(path string) (*Storage, error) {
+	db, err := bolt.Open(path, 0600, &bolt.Options{Timeout: time.Second})
+	if err != nil {
+		return nil, fmt.Errorf("failed to open storage %s: %w", path, err)
+	}
+
+	s := &Storage{
+		db:     db,
+		logger: slog.Default().With("component", "storage"),
+	}
+	if err := s.migrate(); err != nil {
+		_ = db.Close()
+		return nil, err
+	}
+	return s, nil
+}
+
+// migrate creates missing buckets and refuses files written by a newer schema
+func (s *Storage) migrate() error {
+	return s.db.Update(func(tx *bolt.Tx) error {
+		meta, err := tx.CreateBucketIfNotExists(metaBucket)
+		if err != nil {
+			return fmt.Errorf("failed to create meta bucket: %w", err)
+		}
+
+		version := 0
+		if raw := meta.Get(schemaVersionKey); raw != nil {
+			if version, err = strconv.Atoi(string(raw)); err != nil {
+				return fmt.Errorf("invalid storage schema version %q", raw)
+			}
+		}
+		if version > StorageSchemaVersion {
+			return fmt.Errorf("storage schema version %d is newer than supported version %d", version, StorageSchemaVersion)
+		}
+
+		for _, name := range [][]byte{sessionsBucket, resultsBucket, jobsBucket, usageBucket} {
+			if _, err := tx.CreateBucketIfNotExists(name); err != nil {
+				return fmt.Errorf("failed to create %s bucket: %w", name, err)
+			}
+		}
+
+		return meta.Put(schemaVersionKey, []byte(strconv.Itoa(StorageSchemaVersion)))
+	})
+}
+
+func (s *Storage) Close() error {
+	return s.db.Close()
+}
+
+func (s *Storage) put(bucket []byte, key string, value any) error {
+	data, err := json.Marshal(value)
+	if err != nil {
+		return fmt.Errorf("failed to marshal %s record: %w", bucket, err)
+	}
+	return s.db.Update(func(tx *bolt.Tx) error {
+		return tx.Bucket(bucket).Put([]byte(key), data)
+	})
+}
+
+func (s *Storage) get(bucket []byte, key string, value any) (bool, error) {
+	var data []byte
+	err := s.db.View(func(tx *bolt.Tx) error {
+		if raw := tx.Bucket(bucket).Get([]byte(key)); raw != nil {
+			data = append([]byte(nil), raw...)
+		}
+		return nil
+	})
+	if err != nil || data == nil {
+		return false, err
+	}
+	if err := json.Unmarshal(data, value); err != nil {
+		return false, fmt.Errorf("failed to unmarshal %s record: %w", bucket, err)
+	}
+	return true, nil
+}
+
+func (s *Storage) delete(bucket []byte, key string) error {
+	return s.db.Update(func(tx *bolt.Tx) error {
+		return tx.Bucket(bucket).Delete([]byte(key))
+	})
+}
+
+// SaveResult persists a search result keyed by its ID
+func (s *Storage) SaveResult(result *SearchResult) error {
+	return s.put(resultsBucket, result.ID, result)
+}
+
+// LoadResult returns the persisted result with id, or nil if none exists
+func (s *Storage) LoadResult(id string) (*SearchResult, error) {
+	var result SearchResult
+	found, err := s.get(resultsBucket, id, &result)
+	if err != nil || !found {
+		return nil, err
+	}
+	return &result, nil
+}
+
+// pruneResults deletes the persisted results created before cutoff and
+// returns how many it deleted
+func (s *Storage) pruneResults(cutoff time.Time) (int, error) {
+	pruned := 0
+	err := s.db.Update(func(tx *bolt.Tx) error {
+		bucket := tx.Bucket(resultsBucket)
+		var expired [][]byte
+		err := bucket.ForEach(func(k, v []byte) error {
+			var record struct {
+				Created time.Time `json:"created"`
+			}
+			// Undecodable records are kept; LoadResult reports them
+			if json.Unmarshal(v, &record) == nil && record.Created.Before(cutoff) {
+				expired = append(expired, append([]byte(nil), k...))
+			}
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+		for _, k := range expired {
+			if err := bucket.Delete(k); err != nil {
+				return err
+			}
+		}
+		pruned = len(expired)
+		return nil
+	})
+	return pruned, err
+}
+
+func (s *Storage) saveSession(id string, record sessionRecord) error {
+	return s.put(sessionsBucket, id, record)
+}
+
+func (s *Storage) deleteSession(id string) error {
+	return s.delete(sessionsBucket, id)
+}
+
+// loadSessions returns every persisted session keyed by ID
+func (s *Storage) loadSessions() (map[string]sessionRecord, error) {
+	records := make(map[string]sessionRecord)
+	err := s.db.View(func(tx *bolt.Tx) error {
+		return tx.Bucket(sessionsBucket).ForEach(func(k, v []byte) error {
+			var record sessionRecord
+			if err := json.Unmarshal(v, &record); err != nil {
+				return fmt.Errorf("failed to unmarshal session %s: %w", k, err)
+			}
+			records[string(k)] = record
+			return nil
+		})
+	})
+	return records, err
+}
+
+func (s *Storage) saveJob(record jobRecord) error {
+	return s.put(jobsBucket, record.Job.ID, record)
+}
+
+func (s *Storage) deleteJob(id string) error {
+	return s.delete(jobsBucket, id)
+}
+
+// loadJobs returns every persisted research job
+func (s *Storage) loadJobs() ([]jobRecord, error) {
+	var records []jobRecord
+	err := s.db.View(func(tx *bolt.Tx) error {
+		return tx.Bucket(jobsBucket).ForEach(func(k, v []byte) error {
+			var record jobRecord
+			if err := json.Unmarshal(v, &record); err != nil {
+				return fmt.Errorf("failed to unmarshal job %s: %w", k, err)
+			}
+			records = append(records, record)
+			return nil
+		})
+	})
+	return records, err
+}
+
+// saveUsageDay persists the usage totals of a UTC day such as 2024-05-01
+func (s *Storage) saveUsageDay(day string, totals UsageTotals) error {
+	return s.put(usageBucket, day, totals)
+}
+
+func (s *Storage) deleteUsageDay(day string) error {
+	return s.delete(usageBucket, day)
+}
+
+// loadUsageDays returns the persisted usage totals keyed by UTC day
+func (s *Storage) loadUsageDays() (map[string]UsageTotals, error) {
+	days := make(map[string]UsageTotals)
+	err := s.db.View(func(tx *bolt.Tx) error {
+		return tx.Bucket(usageBucket).ForEach(func(k, v []byte) error {
+			var totals UsageTotals
+			if err := json.Unmarshal(v, &totals); err != nil {
+				return fmt.Errorf("failed to unmarshal usage of %s: %w", k, err)
+			}
+			days[string(k)] = totals
+			return nil
+		})
+	})
+	return days, err
+}
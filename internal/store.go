@@ -0,0 +1,255 @@
+package internal
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// DefaultResultStoreSize is the number of results kept before the oldest are evicted
+const DefaultResultStoreSize = 100
+
+// DefaultResultRetention is how long persisted results are kept
+const DefaultResultRetention = 30 * 24 * time.Hour
+
+// resultPruneInterval is how often writes prune expired persisted results
+const resultPruneInterval = time.Hour
+
+// ResultStore keeps a bounded number of recent search results in memory so
+// follow-up calls can refer to them by result ID without re-querying the API.
+type ResultStore struct {
+	mu      sync.RWMutex
+	results map[string]*SearchResult
+	order   []string
+	maxSize int
+	storage *Storage
+	// retention is how long persisted results are kept; lastPrune is when
+	// expired ones were last deleted
+	retention time.Duration
+	lastPrune time.Time
+	now       func() time.Time
+	// latest maps a queryKey to the ID of the newest answer to that request;
+	// keyOf is its reverse so evicted results drop out of the index
+	latest map[string]string
+	keyOf  map[string]string
+	// onChange is told about each stored result and the IDs it evicted
+	onChange func(stored *SearchResult, evicted []string)
+
+	hits   atomic.Int64
+	misses atomic.Int64
+}
+
+// CacheStats counts result lookups served from the store
+type CacheStats struct {
+	Hits    int64   `json:"hits"`
+	Misses  int64   `json:"misses"`
+	HitRate float64 `json:"hit_rate"`
+}
+
+func NewResultStore(maxSize int) *ResultStore {
+	if maxSize <= 0 {
+		maxSize = DefaultResultStoreSize
+	}
+	return &ResultStore{
+		results: make(map[string]*SearchResult),
+		maxSize: maxSize,
+		latest:  make(map[string]string),
+		keyOf:   make(map[string]string),
+		now:     time.Now,
+	}
+}
+
+// UseStorage persists stored results so lookups survive restarts. Results
+// evicted from memory remain readable from storage until they are older than
+// retention; expired results are deleted now and then hourly as results are
+// stored.
+func (s *ResultStore) UseStorage(storage *Storage, retention time.Duration) {
+	if retention <= 0 {
+		retention = DefaultResultRetention
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.storage = storage
+	s.retention = retention
+	s.prune()
+}
+
+// prune deletes persisted results older than the retention. Callers must hold s.mu.
+func (s *ResultStore) prune() {
+	s.lastPrune = s.now()
+	pruned, err := s.storage.pruneResults(s.lastPrune.Add(-s.retention))
+	if err != nil {
+		s.storage.logger.Warn("Failed to prune expired results", "error", err)
+	} else if pruned > 0 {
+		s.storage.logger.Info("Pruned expired results", "results", pruned)
+	}
+}
+
+// OnChange registers fn to be called after each Put with the stored result
+// and the IDs of results evicted from memory to make room for it
+func (s *ResultStore) OnChange(fn func(stored *SearchResult, evicted []string)) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.onChange = fn
+}
+
+// Put stores result, owned by the client identity of ctx, evicting the oldest
+// entry once the store is full
+func (s *ResultStore) Put(ctx context.Context, result *SearchResult) {
+	if result == nil || result.ID == "" {
+		return
+	}
+	result.Owner = clientIdentity(ctx)
+
+	evicted, onChange := s.put(result)
+	if onChange != nil {
+		onChange(result, evicted)
+	}
+}
+
+func (s *ResultStore) put(result *SearchResult) ([]string, func(*SearchResult, []string)) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.storage != nil {
+		if err := s.storage.SaveResult(result); err != nil {
+			s.storage.logger.Warn("Failed to persist result", "result_id", result.ID, "error", err)
+		}
+		if s.now().Sub(s.lastPrune) >= resultPruneInterval {
+			s.prune()
+		}
+	}
+
+	if _, exists := s.results[result.ID]; !exists {
+		s.order = append(s.order, result.ID)
+	}
+	s.results[result.ID] = result
+
+	var evictedIDs []string
+	for len(s.order) > s.maxSize {
+		evicted := s.order[0]
+		evictedIDs = append(evictedIDs, evicted)
+		delete(s.results, evicted)
+		if key, ok := s.keyOf[evicted]; ok {
+			if s.latest[key] == evicted {
+				delete(s.latest, key)
+			}
+			delete(s.keyOf, evicted)
+		}
+		s.order = s.order[1:]
+	}
+	return evictedIDs, s.onChange
+}
+
+// PutAnswer stores result as the newest answer to req, making it available
+// to the stale fallback for identical requests of the same client
+func (s *ResultStore) PutAnswer(ctx context.Context, req SearchRequest, result *SearchResult) {
+	if result == nil || result.ID == "" {
+		return
+	}
+	key := queryKey(req)
+
+	s.mu.Lock()
+	s.latest[key] = result.ID
+	s.keyOf[result.ID] = key
+	s.mu.Unlock()
+
+	s.Put(ctx, result)
+}
+
+// Latest returns the newest stored answer of owner for a queryKey
+func (s *ResultStore) Latest(key, owner string) (*SearchResult, bool) {
+	s.mu.RLock()
+	id, ok := s.latest[key]
+	s.mu.RUnlock()
+
+	if !ok {
+		return nil, false
+	}
+	return s.Get(id, owner)
+}
+
+// Get returns the stored result with id, unless it is unknown or not owned by
+// owner. Results of other clients are reported as unknown.
+func (s *ResultStore) Get(id, owner string) (*SearchResult, bool) {
+	result, ok := s.get(id)
+	ok = ok && result.Owner == owner
+	if ok {
+		s.hits.Add(1)
+	} else {
+		s.misses.Add(1)
+	}
+	return result, ok
+}
+
+func (s *ResultStore) get(id string) (*SearchResult, bool) {
+	s.mu.RLock()
+	result, ok := s.results[id]
+	storage := s.storage
+	s.mu.RUnlock()
+
+	if ok || storage == nil {
+		return result, ok
+	}
+
+	result, err := storage.LoadResult(id)
+	if err != nil {
+		storage.logger.Warn("Failed to load result", "result_id", id, "error", err)
+		return nil, false
+	}
+	return result, result != nil
+}
+
+// CacheStats returns the number of lookups that found or missed a stored result
+func (s *ResultStore) CacheStats() CacheStats {
+	stats := CacheStats{Hits: s.hits.Load(), Misses: s.misses.Load()}
+	if lookups := stats.Hits + stats.Misses; lookups > 0 {
+		stats.HitRate = float64(stats.Hits) / float64(lookups)
+	}
+	return stats
+}
+
+// Annotate validates annotation and attaches it to the stored result with id
+// of owner, persisting the updated record when storage is configured.
+func (s *ResultStore) Annotate(id, owner string, annotation Annotation) (*SearchResult, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	result, inMemory := s.results[id]
+	if !inMemory && s.storage != nil {
+		loaded, err := s.storage.LoadResult(id)
+		if err != nil {
+			return nil, fmt.Errorf("failed to load result %s: %w", id, err)
+		}
+		result = loaded
+	}
+	if result == nil || result.Owner != owner {
+		return nil, fmt.Errorf("result not found: %s", id)
+	}
+
+	if err := annotation.Validate(result); err != nil {
+		return nil, err
+	}
+	if len(result.Annotations) >= MaxAnnotationsPerItem {
+		return nil, fmt.Errorf("result %s already has the maximum of %d annotations", id, MaxAnnotationsPerItem)
+	}
+
+	// Copy so readers holding the previous result never observe the change
+	updated := *result
+	updated.Annotations = append(append([]Annotation(nil), result.Annotations...), annotation)
+
+	if s.storage != nil {
+		if err := s.storage.SaveResult(&updated); err != nil {
+			return nil, fmt.Errorf("failed to persist annotation: %w", err)
+		}
+	}
+	if inMemory {
+		s.results[id] = &updated
+	}
+	return &updated, nil
+}
@@ -0,0 +1,40 @@
+package internal
+
+import (
+	"context"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestResultStorePrunesExpiredResults(t *testing.T) {
+	storage, err := OpenStorage(filepath.Join(t.TempDir(), "history.db"))
+	require.NoError(t, err)
+	defer func() { _ = storage.Close() }()
+
+	now := time.Now()
+	require.NoError(t, storage.SaveResult(&SearchResult{ID: "old", Created: now.Add(-40 * 24 * time.Hour)}))
+	require.NoError(t, storage.SaveResult(&SearchResult{ID: "recent", Created: now.Add(-24 * time.Hour)}))
+
+	// Expired results are deleted at startup
+	results := NewResultStore(1)
+	results.UseStorage(storage, 30*24*time.Hour)
+	_, ok := results.Get("old", "")
+	require.False(t, ok)
+	_, ok = results.Get("recent", "")
+	require.True(t, ok)
+
+	// and by writes once the prune interval has passed
+	results.Put(context.Background(), &SearchResult{ID: "first", Created: now})
+	results.mu.Lock()
+	results.now = func() time.Time { return now.Add(30*24*time.Hour + resultPruneInterval) }
+	results.mu.Unlock()
+	results.Put(context.Background(), &SearchResult{ID: "second", Created: now.Add(2 * time.Hour)})
+
+	for id, kept := range map[string]bool{"recent": false, "first": false, "second": true} {
+		_, ok := results.Get(id, "")
+		require.Equal(t, kept, ok, id)
+	}
+}
@@ -0,0 +1,321 @@
+package internal
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"maps"
+	"strings"
+
+	"github.com/mark3labs/mcp-go/mcp"
+)
+
+// Bounds of the target length of perplexity_summarize, in words
+const (
+	DefaultSummaryWords = 150
+	MinSummaryWords     = 25
+	MaxSummaryWords     = 1000
+)
+
+// summarySystemPrompt asks the second model call to condense the findings
+// without searching again; %d is the target length in words
+const summarySystemPrompt = `You write executive summaries. Condense the research findings the user provided into at most %d words for a busy decision maker: lead with the bottom line, then the key facts and figures, then open questions or risks. Use only the findings, keep their [n] citation markers on the statements they support, and do not add a title.`
+
+// SummaryPipeline is the outcome of perplexity_summarize: the search answer and
+// its condensed summary
+type SummaryPipeline struct {
+	Search  *SearchResult
+	Summary *SearchResult
+	// Usage adds up the tokens of both steps
+	Usage Usage
+}
+
+// CreateSummarizeTool creates the perplexity_summarize tool for use with mcp-go
+func CreateSummarizeTool(config *Config) mcp.Tool {
+	tool := mcp.Tool{
+		Name:        "perplexity_summarize",
+		Description: "Search, then condense the answer and its sources into an executive summary of a target length. Returns the summary with the citations it relies on; the full answer stays available as a search:// resource.",
+		InputSchema: mcp.ToolInputSchema{
+			Type: "object",
+			Properties: map[string]any{
+				"query": map[string]any{
+					"type":        "string",
+					"description": "The topic or question to research",
+					"minLength":   1,
+					"maxLength":   config.MaxQueryLength,
+				},
+				"target_words": map[string]any{
+					"type":        "integer",
+					"description": fmt.Sprintf("Maximum length of the summary in words (optional, defaults to %d)", DefaultSummaryWords),
+					"minimum":     MinSummaryWords,
+					"maximum":     MaxSummaryWords,
+					"default":     DefaultSummaryWords,
+				},
+				"model": map[string]any{
+					"type":        "string",
+					"description": fmt.Sprintf("The Sonar model that searches (optional, defaults to '%s')", config.DefaultModelFor("perplexity_summarize")),
+					"enum":        config.Models(),
+				},
+				"search_mode": map[string]any{
+					"type":        "string",
+					"description": "The search mode to use (optional, defaults to 'web')",
+					"enum":        SearchModes,
+				},
+				"date_range": map[string]any{
+					"type":        "string",
+					"description": "Filter search results by date range (optional)",
+					"enum":        DateRanges,
+				},
+				"sources": map[string]any{
+					"type":        "array",
+					"description": fmt.Sprintf("Limit search to specific domains (optional, max %d)", config.MaxDomainFilters),
+					"items": map[string]any{
+						"type": "string",
+					},
+					"maxItems": config.MaxDomainFilters,
+				},
+				"exclude_sources": map[string]any{
+					"type":        "array",
+					"description": fmt.Sprintf("Domains to leave out of the search (optional; at most %d together with sources)", config.MaxDomainFilters),
+					"items": map[string]any{
+						"type": "string",
+					},
+					"maxItems": config.MaxDomainFilters,
+				},
+				"output_format": map[string]any{
+					"type":        "string",
+					"description": "Format of the returned result (optional, defaults to 'json')",
+					"enum":        []string{OutputFormatJSON, OutputFormatMarkdown},
+					"default":     OutputFormatJSON,
+				},
+			},
+			Required: []string{"query"},
+		},
+		OutputSchema: summarizeOutputSchema(),
+	}
+	relaxModelSchema(&tool, config)
+	// summary_model takes the same models as model
+	summaryModel := maps.Clone(tool.InputSchema.Properties["model"].(map[string]any))
+	summaryModel["description"] = "The model that writes the summary (optional, defaults to model)"
+	tool.InputSchema.Properties["summary_model"] = summaryModel
+	return tool
+}
+
+// SummarizeHandler creates the handler function for the perplexity_summarize tool
+func SummarizeHandler(client SearchProvider, live *LiveConfig, results *ResultStore, usage *UsageTracker) func(ctx context.Context, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+	return func(ctx context.Context, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+		config := live.Get()
+
+		req, summaryModel, targetWords, err := parseSummarizeRequest(request, config)
+		if err != nil {
+			return summarizeError(err), err
+		}
+
+		// Refuse new API calls once a hard budget limit is reached
+		if _, err := config.Budgets.Check(usage); err != nil {
+			return summarizeError(err), err
+		}
+
+		progress := newProgressReporter(ctx, request)
+		pipeline, err := runSummaryPipeline(ctx, client, config, results, usage, *req, summaryModel, targetWords, progress)
+		if err != nil {
+			return summarizeError(err), err
+		}
+		budgetWarnings, _ := config.Budgets.Check(usage)
+
+		data := summaryData(pipeline, targetWords)
+		var content string
+		if req.OutputFormat == OutputFormatMarkdown {
+			content = formatSummary(pipeline)
+		} else {
+			jsonBytes, err := json.MarshalIndent(data, "", "  ")
+			if err != nil {
+				err = fmt.Errorf("failed to marshal summary: %w", err)
+				return summarizeError(err), err
+			}
+			content = string(jsonBytes)
+		}
+
+		// Report the tokens and cost of both steps, not only the summary's
+		meta := resultMeta(config.ModelPrices, pipeline.Summary, pipeline.Search, pipeline.Summary)
+		return &mcp.CallToolResult{
+			Content: []mcp.Content{
+				mcp.TextContent{
+					Type: "text",
+					Text: content,
+				},
+			},
+			StructuredContent: data,
+			IsError:           false,
+			Result:            mcp.Result{Meta: withBudgetWarnings(meta, budgetWarnings)},
+		}, nil
+	}
+}
+
+// runSummaryPipeline searches for req, then has summaryModel condense the
+// answer into targetWords words with search disabled. Both answers are stored
+// and their usage recorded; the search answer is kept when the summary fails.
+func runSummaryPipeline(ctx context.Context, client SearchProvider, config *Config, results *ResultStore, usage *UsageTracker, req SearchRequest, summaryModel string, targetWords int, progress *progressReporter) (*SummaryPipeline, error) {
+	search, err := searchWithModelFallback(ctx, client, config, "perplexity_summarize", req, progress)
+	if err != nil {
+		return nil, fmt.Errorf("search step: %w", err)
+	}
+	progress.reportResult(search)
+	results.PutAnswer(ctx, req, search)
+	usage.Record(config.ModelPrices, "perplexity_summarize", "", search)
+
+	// A hard limit reached by the search stops the pipeline before the summary
+	if _, err := config.Budgets.Check(usage); err != nil {
+		return nil, fmt.Errorf("summary step: %w (the search answer is at %s)", err, SearchURI(search.ID))
+	}
+
+	summaryReq := SearchRequest{
+		Query:        "Write the executive summary.",
+		Model:        summaryModel,
+		SystemPrompt: fmt.Sprintf(summarySystemPrompt, targetWords),
+		ContextMessages: []Message{
+			{Role: "user", Content: summarySource(search)},
+			{Role: "assistant", Content: "I will condense these findings."},
+		},
+		Options: map[string]string{"disable_search": "true"},
+	}
+	progress.report("summarizing")
+	summary, err := searchWithModelFallback(ctx, client, config, "perplexity_summarize", summaryReq, progress)
+	if err != nil {
+		return nil, fmt.Errorf("summary step: %w (the search answer is at %s)", err, SearchURI(search.ID))
+	}
+	// The summary cites the search answer's sources
+	summary.Citations = search.Citations
+	results.PutAnswer(ctx, summaryReq, summary)
+	usage.Record(config.ModelPrices, "perplexity_summarize", "", summary)
+
+	return &SummaryPipeline{
+		Search:  config.shownResult(search),
+		Summary: config.shownResult(summary),
+		Usage:   addUsage(search.Usage, summary.Usage),
+	}, nil
+}
+
+// summarySource is the search answer and its numbered sources as given to the
+// summary step, cut to the length of a context message
+func summarySource(search *SearchResult) string {
+	var b strings.Builder
+	b.WriteString("Research findings:\n\n")
+	b.WriteString(search.Content)
+	if len(search.Citations) > 0 {
+		b.WriteString("\n\nSources:\n")
+		for _, citation := range search.Citations {
+			fmt.Fprintf(&b, "[%d] %s\n", citation.Number, strings.TrimSpace(citation.Title+" "+citation.URL))
+		}
+	}
+	source := b.String()
+	if len(source) > MaxMessageLength {
+		source = strings.ToValidUTF8(source[:MaxMessageLength], "")
+	}
+	return source
+}
+
+// summaryData is the JSON result of perplexity_summarize, also returned as
+// structuredContent
+func summaryData(pipeline *SummaryPipeline, targetWords int) map[string]any {
+	search, summary := pipeline.Search, pipeline.Summary
+	response := map[string]any{
+		"id":           summary.ID,
+		"resource_uri": SearchURI(summary.ID),
+		"model":        summary.Model,
+		"content":      summary.Content,
+		"word_count":   len(strings.Fields(summary.Content)),
+		"target_words": targetWords,
+		"usage":        pipeline.Usage,
+		"created":      summary.Created,
+		"search": map[string]any{
+			"id":           search.ID,
+			"resource_uri": SearchURI(search.ID),
+			"model":        search.Model,
+			"usage":        search.Usage,
+		},
+		"summary_usage": summary.Usage,
+	}
+	if len(summary.Citations) > 0 {
+		response["citations"] = summary.Citations
+	}
+	if summary.Reasoning != "" {
+		response["reasoning"] = summary.Reasoning
+	}
+	if summary.RequestedModel != "" {
+		response["requested_model"] = summary.RequestedModel
+	}
+	return response
+}
+
+// formatSummary renders the summary as markdown with its sources
+func formatSummary(pipeline *SummaryPipeline) string {
+	var b strings.Builder
+	b.WriteString(pipeline.Summary.Content)
+	if citations := pipeline.Summary.Citations; len(citations) > 0 {
+		b.WriteString("\n\n## Sources\n\n")
+		for _, citation := range citations {
+			fmt.Fprintf(&b, "%d. [%s](%s)%s\n", citation.Number, citationTitle(citation), citation.URL, citationIdentifiers(citation))
+		}
+	}
+	fmt.Fprintf(&b, "\n_Full answer: %s_\n", SearchURI(pipeline.Search.ID))
+	return strings.TrimSpace(b.String())
+}
+
+func summarizeError(err error) *mcp.CallToolResult {
+	return &mcp.CallToolResult{
+		Content: []mcp.Content{
+			mcp.TextContent{
+				Type: "text",
+				Text: fmt.Sprintf("Summary failed: %s", err.Error()),
+			},
+		},
+		IsError: true,
+		Result:  mcp.Result{Meta: errorMeta(err)},
+	}
+}
+
+// parseSummarizeRequest builds the search request of the first step and
+// returns the model and target length of the summary
+func parseSummarizeRequest(request mcp.CallToolRequest, config *Config) (*SearchRequest, string, int, error) {
+	query, err := request.RequireString("query")
+	if err != nil {
+		return nil, "", 0, fmt.Errorf("query must be a string")
+	}
+	targetWords := DefaultSummaryWords
+	words, err := integerArgument(request, "target_words")
+	if err != nil {
+		return nil, "", 0, err
+	}
+	if words != nil {
+		if *words < MinSummaryWords || *words > MaxSummaryWords {
+			return nil, "", 0, fmt.Errorf("invalid target_words: %d (must be between %d and %d)", *words, MinSummaryWords, MaxSummaryWords)
+		}
+		targetWords = *words
+	}
+
+	req := &SearchRequest{
+		Query:          query,
+		Model:          request.GetString("model", ""),
+		SearchMode:     request.GetString("search_mode", ""),
+		DateRange:      request.GetString("date_range", ""),
+		Sources:        request.GetStringSlice("sources", nil),
+		ExcludeSources: request.GetStringSlice("exclude_sources", nil),
+		OutputFormat:   request.GetString("output_format", ""),
+	}
+	config.applyToolDefaults("perplexity_summarize", req)
+	req.MaxQueryLength = config.MaxQueryLength
+	req.MaxDomainFilters = config.MaxDomainFilters
+	if err := config.CheckModel(req.Model); err != nil {
+		return nil, "", 0, err
+	}
+	if err := req.Validate(); err != nil {
+		return nil, "", 0, err
+	}
+
+	summaryModel := request.GetString("summary_model", req.Model)
+	if err := config.CheckModel(summaryModel); err != nil {
+		return nil, "", 0, err
+	}
+	return req, summaryModel, targetWords, nil
+}
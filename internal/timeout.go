@@ -0,0 +1,93 @@
+package internal
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/mark3labs/mcp-go/mcp"
+)
+
+// Timeout kinds distinguish which side of a call ran out of time
+const (
+	// TimeoutKindTool means this server's request timeout fired before the API answered
+	TimeoutKindTool = "tool"
+	// TimeoutKindUpstream means the Perplexity API itself reported a timeout
+	TimeoutKindUpstream = "upstream"
+)
+
+// statusGatewayTimeoutCloudflare is the Cloudflare status for an origin that did not respond in time
+const statusGatewayTimeoutCloudflare = 524
+
+// TimeoutError reports a timed-out API call together with the limit that fired,
+// so users know whether to raise REQUEST_TIMEOUT_SECONDS or retry later.
+type TimeoutError struct {
+	Kind string
+	// Limit names the limit that fired, e.g. the REQUEST_TIMEOUT_SECONDS setting
+	Limit string
+	// Value is the configured limit for tool timeouts
+	Value time.Duration
+	// StatusCode is the HTTP status of upstream timeouts
+	StatusCode int
+}
+
+func (e *TimeoutError) Error() string {
+	if e.Kind == TimeoutKindUpstream {
+		return fmt.Sprintf("upstream timeout: Perplexity API returned HTTP %d", e.StatusCode)
+	}
+	return fmt.Sprintf("tool timeout: %s (%s) elapsed before the Perplexity API responded", e.Limit, e.Value)
+}
+
+// isUpstreamTimeoutStatus reports whether an API status code means the upstream timed out
+func isUpstreamTimeoutStatus(statusCode int) bool {
+	switch statusCode {
+	case http.StatusRequestTimeout, http.StatusGatewayTimeout, statusGatewayTimeoutCloudflare:
+		return true
+	}
+	return false
+}
+
+// DefaultDeepResearchTimeout is the default request timeout of
+// sonar-deep-research, whose reports take minutes to write
+const DefaultDeepResearchTimeout = 10 * time.Minute
+
+// searchWithTimeout runs a search bounded by timeout and attributes a deadline
+// that fires to limit, the setting timeout comes from
+func searchWithTimeout(ctx context.Context, client SearchProvider, req SearchRequest, timeout time.Duration, limit string) (*SearchResult, error) {
+	return callWithTimeout(ctx, timeout, limit, func(callCtx context.Context) (*SearchResult, error) {
+		return client.Search(callCtx, req)
+	})
+}
+
+// callWithTimeout runs an API call bounded by timeout and attributes a
+// deadline that fires to limit, the setting timeout comes from
+func callWithTimeout[T any](ctx context.Context, timeout time.Duration, limit string, call func(context.Context) (T, error)) (T, error) {
+	callCtx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	result, err := call(callCtx)
+	var timeoutErr *TimeoutError
+	if errors.As(err, &timeoutErr) && timeoutErr.Kind == TimeoutKindTool && ctx.Err() == nil {
+		timeoutErr.Limit, timeoutErr.Value = limit, timeout
+	}
+	return result, err
+}
+
+// errorMeta describes a timeout in an error result's _meta, or returns nil for other errors
+func errorMeta(err error) *mcp.Meta {
+	var timeoutErr *TimeoutError
+	if !errors.As(err, &timeoutErr) {
+		return nil
+	}
+
+	timeout := map[string]any{"kind": timeoutErr.Kind}
+	if timeoutErr.Kind == TimeoutKindUpstream {
+		timeout["status_code"] = timeoutErr.StatusCode
+	} else {
+		timeout["limit"] = timeoutErr.Limit
+		timeout["limit_seconds"] = timeoutErr.Value.Seconds()
+	}
+	return &mcp.Meta{AdditionalFields: map[string]any{"timeout": timeout}}
+}
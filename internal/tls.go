@@ -0,0 +1,132 @@
+package internal
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"log/slog"
+	"os"
+	"sync/atomic"
+	"time"
+)
+
+// CertReloader serves a TLS certificate from a certificate and key file pair
+// and picks up renewed files without a restart. Like key files, the pair is
+// polled rather than watched so Kubernetes secret volume updates are seen.
+type CertReloader struct {
+	certFile string
+	keyFile  string
+
+	cert    atomic.Pointer[tls.Certificate]
+	modTime time.Time
+}
+
+// NewCertReloader loads the certificate pair, failing if it cannot be used
+func NewCertReloader(certFile, keyFile string) (*CertReloader, error) {
+	r := &CertReloader{certFile: certFile, keyFile: keyFile}
+	if _, err := r.reload(); err != nil {
+		return nil, err
+	}
+	return r, nil
+}
+
+// TLSConfig returns a server TLS configuration serving the current certificate
+func (r *CertReloader) TLSConfig() *tls.Config {
+	return &tls.Config{
+		MinVersion: tls.VersionTLS12,
+		GetCertificate: func(*tls.ClientHelloInfo) (*tls.Certificate, error) {
+			return r.cert.Load(), nil
+		},
+	}
+}
+
+// RequireClientCerts makes config demand a client certificate signed by one
+// of the PEM certificates in caFile, for mutual TLS
+func RequireClientCerts(config *tls.Config, caFile string) error {
+	data, err := os.ReadFile(caFile)
+	if err != nil {
+		return fmt.Errorf("failed to read client CA file: %w", err)
+	}
+	pool := x509.NewCertPool()
+	if !pool.AppendCertsFromPEM(data) {
+		return fmt.Errorf("no certificates found in client CA file %s", caFile)
+	}
+	config.ClientCAs = pool
+	config.ClientAuth = tls.RequireAndVerifyClientCert
+	return nil
+}
+
+// certificateIdentity names the client of a verified certificate: its common
+// name, or its first DNS, URI or email SAN when the CN is empty
+func certificateIdentity(cert *x509.Certificate) string {
+	switch {
+	case cert.Subject.CommonName != "":
+		return cert.Subject.CommonName
+	case len(cert.DNSNames) > 0:
+		return cert.DNSNames[0]
+	case len(cert.URIs) > 0:
+		return cert.URIs[0].String()
+	case len(cert.EmailAddresses) > 0:
+		return cert.EmailAddresses[0]
+	default:
+		return cert.SerialNumber.String()
+	}
+}
+
+// Watch re-reads the pair every interval until ctx is cancelled. A pair that
+// fails to load, e.g. while only one file has been replaced, keeps the current
+// certificate in use.
+func (r *CertReloader) Watch(ctx context.Context, interval time.Duration, logger *slog.Logger) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			reloaded, err := r.reload()
+			if err != nil {
+				logger.Warn("Keeping current TLS certificate", "error", err)
+				continue
+			}
+			if reloaded {
+				logger.Info("TLS certificate reloaded", "cert_file", r.certFile)
+			}
+		}
+	}
+}
+
+// reload loads the pair if either file changed since the last successful load
+func (r *CertReloader) reload() (bool, error) {
+	modTime, err := r.latestModTime()
+	if err != nil {
+		return false, err
+	}
+	if r.cert.Load() != nil && modTime.Equal(r.modTime) {
+		return false, nil
+	}
+
+	cert, err := tls.LoadX509KeyPair(r.certFile, r.keyFile)
+	if err != nil {
+		return false, fmt.Errorf("failed to load TLS certificate: %w", err)
+	}
+	r.cert.Store(&cert)
+	r.modTime = modTime
+	return true, nil
+}
+
+func (r *CertReloader) latestModTime() (time.Time, error) {
+	var latest time.Time
+	for _, path := range []string{r.certFile, r.keyFile} {
+		info, err := os.Stat(path)
+		if err != nil {
+			return time.Time{}, fmt.Errorf("failed to read TLS file: %w", err)
+		}
+		if info.ModTime().After(latest) {
+			latest = info.ModTime()
+		}
+	}
+	return latest, nil
+}
@@ -0,0 +1,235 @@
+package internal
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+// testCert is a certificate with its key, in PEM as written to files
+type testCert struct {
+	cert    *x509.Certificate
+	key     *ecdsa.PrivateKey
+	certPEM []byte
+	keyPEM  []byte
+}
+
+// newTestCert issues template, signed by parent or self-signed when parent is nil
+func newTestCert(t *testing.T, template *x509.Certificate, parent *testCert) *testCert {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+	if template.SerialNumber == nil {
+		template.SerialNumber = big.NewInt(time.Now().UnixNano())
+	}
+	template.NotBefore = time.Now().Add(-time.Hour)
+	template.NotAfter = time.Now().Add(time.Hour)
+
+	signer, signerKey := template, key
+	if parent != nil {
+		signer, signerKey = parent.cert, parent.key
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, signer, &key.PublicKey, signerKey)
+	require.NoError(t, err)
+	cert, err := x509.ParseCertificate(der)
+	require.NoError(t, err)
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	require.NoError(t, err)
+	return &testCert{
+		cert:    cert,
+		key:     key,
+		certPEM: pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}),
+		keyPEM:  pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER}),
+	}
+}
+
+// writeFile writes data to path and sets its modification time to modTime
+func writeFile(t *testing.T, path string, data []byte, modTime time.Time) {
+	t.Helper()
+	require.NoError(t, os.WriteFile(path, data, 0o600))
+	require.NoError(t, os.Chtimes(path, modTime, modTime))
+}
+
+// servedCommonName returns the common name of the certificate r serves
+func servedCommonName(t *testing.T, r *CertReloader) string {
+	t.Helper()
+	cert, err := r.TLSConfig().GetCertificate(&tls.ClientHelloInfo{})
+	require.NoError(t, err)
+	leaf, err := x509.ParseCertificate(cert.Certificate[0])
+	require.NoError(t, err)
+	return leaf.Subject.CommonName
+}
+
+func TestCertReloaderReloadsChangedPair(t *testing.T) {
+	dir := t.TempDir()
+	certFile, keyFile := filepath.Join(dir, "tls.crt"), filepath.Join(dir, "tls.key")
+	start := time.Now().Add(-time.Minute)
+	first := newTestCert(t, &x509.Certificate{Subject: pkix.Name{CommonName: "first"}}, nil)
+	writeFile(t, certFile, first.certPEM, start)
+	writeFile(t, keyFile, first.keyPEM, start)
+
+	r, err := NewCertReloader(certFile, keyFile)
+	require.NoError(t, err)
+	require.Equal(t, "first", servedCommonName(t, r))
+
+	reloaded, err := r.reload()
+	require.NoError(t, err)
+	require.False(t, reloaded, "unchanged files are not loaded again")
+
+	second := newTestCert(t, &x509.Certificate{Subject: pkix.Name{CommonName: "second"}}, nil)
+	writeFile(t, certFile, second.certPEM, start.Add(time.Second))
+	writeFile(t, keyFile, second.keyPEM, start.Add(time.Second))
+	reloaded, err = r.reload()
+	require.NoError(t, err)
+	require.True(t, reloaded)
+	require.Equal(t, "second", servedCommonName(t, r))
+}
+
+func TestCertReloaderKeepsCertificateWhilePairIsHalfWritten(t *testing.T) {
+	dir := t.TempDir()
+	certFile, keyFile := filepath.Join(dir, "tls.crt"), filepath.Join(dir, "tls.key")
+	start := time.Now().Add(-time.Minute)
+	first := newTestCert(t, &x509.Certificate{Subject: pkix.Name{CommonName: "first"}}, nil)
+	writeFile(t, certFile, first.certPEM, start)
+	writeFile(t, keyFile, first.keyPEM, start)
+
+	r, err := NewCertReloader(certFile, keyFile)
+	require.NoError(t, err)
+
+	// Only the certificate has been replaced so far
+	second := newTestCert(t, &x509.Certificate{Subject: pkix.Name{CommonName: "second"}}, nil)
+	writeFile(t, certFile, second.certPEM, start.Add(time.Second))
+	reloaded, err := r.reload()
+	require.ErrorContains(t, err, "failed to load TLS certificate")
+	require.False(t, reloaded)
+	require.Equal(t, "first", servedCommonName(t, r))
+
+	// A truncated key is no better
+	writeFile(t, keyFile, second.keyPEM[:len(second.keyPEM)/2], start.Add(2*time.Second))
+	_, err = r.reload()
+	require.Error(t, err)
+	require.Equal(t, "first", servedCommonName(t, r))
+
+	// The pair is used once the key is complete
+	writeFile(t, keyFile, second.keyPEM, start.Add(3*time.Second))
+	reloaded, err = r.reload()
+	require.NoError(t, err)
+	require.True(t, reloaded)
+	require.Equal(t, "second", servedCommonName(t, r))
+
+	// A missing file keeps the current certificate as well
+	require.NoError(t, os.Remove(keyFile))
+	_, err = r.reload()
+	require.ErrorContains(t, err, "failed to read TLS file")
+	require.Equal(t, "second", servedCommonName(t, r))
+}
+
+func TestNewCertReloaderRejectsUnusablePair(t *testing.T) {
+	dir := t.TempDir()
+	certFile, keyFile := filepath.Join(dir, "tls.crt"), filepath.Join(dir, "tls.key")
+	first := newTestCert(t, &x509.Certificate{Subject: pkix.Name{CommonName: "first"}}, nil)
+	other := newTestCert(t, &x509.Certificate{Subject: pkix.Name{CommonName: "other"}}, nil)
+	writeFile(t, certFile, first.certPEM, time.Now())
+	writeFile(t, keyFile, other.keyPEM, time.Now())
+
+	_, err := NewCertReloader(certFile, keyFile)
+	require.ErrorContains(t, err, "failed to load TLS certificate")
+}
+
+func TestRequireClientCerts(t *testing.T) {
+	dir := t.TempDir()
+	ca := newTestCert(t, &x509.Certificate{Subject: pkix.Name{CommonName: "clients CA"}, IsCA: true, BasicConstraintsValid: true, KeyUsage: x509.KeyUsageCertSign}, nil)
+	caFile := filepath.Join(dir, "ca.crt")
+	writeFile(t, caFile, ca.certPEM, time.Now())
+
+	require.ErrorContains(t, RequireClientCerts(&tls.Config{}, filepath.Join(dir, "missing.crt")), "failed to read client CA file")
+	writeFile(t, filepath.Join(dir, "empty.crt"), []byte("not a certificate"), time.Now())
+	require.ErrorContains(t, RequireClientCerts(&tls.Config{}, filepath.Join(dir, "empty.crt")), "no certificates found in client CA file")
+
+	var identity string
+	server := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		identity = clientIdentity(HTTPClientIdentity(NewLiveConfig(&Config{}))(context.Background(), r))
+	}))
+	server.TLS = &tls.Config{}
+	require.NoError(t, RequireClientCerts(server.TLS, caFile))
+	require.Equal(t, tls.RequireAndVerifyClientCert, server.TLS.ClientAuth)
+	server.StartTLS()
+	defer server.Close()
+
+	get := func(cert *testCert) error {
+		transport := server.Client().Transport.(*http.Transport).Clone()
+		if cert != nil {
+			transport.TLSClientConfig.Certificates = []tls.Certificate{{Certificate: [][]byte{cert.cert.Raw}, PrivateKey: cert.key}}
+		}
+		resp, err := (&http.Client{Transport: transport}).Get(server.URL)
+		if err != nil {
+			return err
+		}
+		return resp.Body.Close()
+	}
+
+	require.Error(t, get(nil), "clients without a certificate are refused")
+	stranger := newTestCert(t, &x509.Certificate{Subject: pkix.Name{CommonName: "stranger"}, ExtKeyUsage: []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth}}, nil)
+	require.Error(t, get(stranger), "certificates from another CA are refused")
+
+	client := newTestCert(t, &x509.Certificate{Subject: pkix.Name{CommonName: "reporting-bot"}, ExtKeyUsage: []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth}}, ca)
+	require.NoError(t, get(client))
+	require.Equal(t, "cert:reporting-bot", identity)
+}
+
+func TestCertificateIdentity(t *testing.T) {
+	uri, err := url.Parse("spiffe://example.com/reporting")
+	require.NoError(t, err)
+
+	tests := []struct {
+		name string
+		cert x509.Certificate
+		want string
+	}{
+		{
+			name: "common name first",
+			cert: x509.Certificate{Subject: pkix.Name{CommonName: "bot"}, DNSNames: []string{"bot.example.com"}, URIs: []*url.URL{uri}, EmailAddresses: []string{"bot@example.com"}},
+			want: "bot",
+		},
+		{
+			name: "then the first DNS name",
+			cert: x509.Certificate{DNSNames: []string{"bot.example.com", "other.example.com"}, URIs: []*url.URL{uri}, EmailAddresses: []string{"bot@example.com"}},
+			want: "bot.example.com",
+		},
+		{
+			name: "then the first URI",
+			cert: x509.Certificate{URIs: []*url.URL{uri}, EmailAddresses: []string{"bot@example.com"}},
+			want: "spiffe://example.com/reporting",
+		},
+		{
+			name: "then the first email address",
+			cert: x509.Certificate{EmailAddresses: []string{"bot@example.com", "other@example.com"}},
+			want: "bot@example.com",
+		},
+		{
+			name: "otherwise the serial number",
+			cert: x509.Certificate{SerialNumber: big.NewInt(4242)},
+			want: "4242",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			require.Equal(t, tt.want, certificateIdentity(&tt.cert))
+		})
+	}
+}
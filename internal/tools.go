@@ -4,14 +4,16 @@ import (
 	"context"
 	"encoding/json"
 	"fmt"
+	"math"
 	"strconv"
+	"strings"
 
 	"github.com/mark3labs/mcp-go/mcp"
 )
 
 // CreatePerplexitySearchTool creates the perplexity_search tool for use with mcp-go
-func CreatePerplexitySearchTool(client *PerplexityClient) mcp.Tool {
-	return mcp.Tool{
+func CreatePerplexitySearchTool(client SearchProvider, config *Config) mcp.Tool {
+	tool := mcp.Tool{
 		Name:        "perplexity_search",
 		Description: "Search for information using Perplexity AI Sonar models. Provides real-time web search with citations and sources, supporting academic search, news search, and domain filtering.",
 		InputSchema: mcp.ToolInputSchema{
@@ -21,24 +23,47 @@ func CreatePerplexitySearchTool(client *PerplexityClient) mcp.Tool {
 					"type":        "string",
 					"description": "The search query to execute",
 					"minLength":   1,
-					"maxLength":   10000,
+					"maxLength":   config.MaxQueryLength,
 				},
-				"model": map[string]any{
+				"session_id": map[string]any{
 					"type":        "string",
-					"description": "The Sonar model to use for search (optional, defaults to 'sonar')",
-					"enum": []string{
-						"sonar",
-						"sonar-pro",
-						"sonar-reasoning",
-						"sonar-reasoning-pro",
-						"sonar-deep-research",
+					"description": "Continue a server-side conversation; prior turns of the session are sent with the query and this exchange is added to it (optional, cannot be combined with context_messages)",
+					"pattern":     "^[A-Za-z0-9._-]{1,128}$",
+				},
+				"system_prompt": map[string]any{
+					"type":        "string",
+					"description": "Instructions that steer the tone, language, and formatting of the answer (optional)",
+					"maxLength":   config.MaxQueryLength,
+				},
+				"context_messages": map[string]any{
+					"type":        "array",
+					"description": "Prior conversation turns for follow-up questions, alternating user/assistant and ending with assistant (optional)",
+					"items": map[string]any{
+						"type": "object",
+						"properties": map[string]any{
+							"role": map[string]any{
+								"type": "string",
+								"enum": []string{"user", "assistant"},
+							},
+							"content": map[string]any{
+								"type":      "string",
+								"maxLength": MaxMessageLength,
+							},
+						},
+						"required": []string{"role", "content"},
 					},
-					"default": "sonar",
+					"maxItems": MaxContextMessages,
+				},
+				"model": map[string]any{
+					"type":        "string",
+					"description": fmt.Sprintf("The Sonar model to use for search (optional, defaults to '%s')", config.DefaultModelFor("perplexity_search")),
+					"enum":        config.Models(),
+					"default":     config.DefaultModelFor("perplexity_search"),
 				},
 				"search_mode": map[string]any{
 					"type":        "string",
 					"description": "The search mode to use (optional, defaults to 'web')",
-					"enum":        []string{"web", "academic", "news"},
+					"enum":        SearchModes,
 					"default":     "web",
 				},
 				"max_tokens": map[string]any{
@@ -47,37 +72,195 @@ func CreatePerplexitySearchTool(client *PerplexityClient) mcp.Tool {
 					"minimum":     1,
 					"maximum":     128000,
 				},
+				"temperature": map[string]any{
+					"type":        "number",
+					"description": "Sampling temperature; higher values give more varied answers (optional)",
+					"minimum":     0,
+					"maximum":     MaxTemperature,
+				},
+				"top_p": map[string]any{
+					"type":        "number",
+					"description": "Nucleus sampling: only tokens within this cumulative probability are considered (optional)",
+					"minimum":     0,
+					"maximum":     1,
+				},
+				"top_k": map[string]any{
+					"type":        "integer",
+					"description": "Only the k most likely tokens are considered; 0 disables the limit (optional)",
+					"minimum":     0,
+					"maximum":     MaxTopK,
+				},
+				"frequency_penalty": map[string]any{
+					"type":        "number",
+					"description": "Penalizes tokens by how often they already appeared, reducing repetition (optional)",
+					"minimum":     -MaxPenalty,
+					"maximum":     MaxPenalty,
+				},
+				"presence_penalty": map[string]any{
+					"type":        "number",
+					"description": "Penalizes tokens that already appeared, encouraging new topics (optional)",
+					"minimum":     -MaxPenalty,
+					"maximum":     MaxPenalty,
+				},
+				"reasoning_effort": map[string]any{
+					"type":        "string",
+					"description": "How hard sonar-deep-research works on the answer: 'low' is faster and cheaper, 'high' searches and reasons more (optional, ignored by other models)",
+					"enum":        ReasoningEfforts,
+				},
 				"date_range": map[string]any{
 					"type":        "string",
 					"description": "Filter search results by date range (optional)",
-					"enum":        []string{"day", "week", "month", "year"},
+					"enum":        DateRanges,
 				},
 				"sources": map[string]any{
 					"type":        "array",
-					"description": "Limit search to specific domains (optional, max 10)",
+					"description": fmt.Sprintf("Limit search to specific domains (optional, max %d)", config.MaxDomainFilters),
+					"items": map[string]any{
+						"type": "string",
+					},
+					"maxItems": config.MaxDomainFilters,
+				},
+				"exclude_sources": map[string]any{
+					"type":        "array",
+					"description": fmt.Sprintf("Domains to leave out of the search (optional; at most %d together with sources)", config.MaxDomainFilters),
 					"items": map[string]any{
 						"type": "string",
 					},
-					"maxItems": 10,
+					"maxItems": config.MaxDomainFilters,
 				},
 				"options": map[string]any{
 					"type":        "object",
-					"description": "Additional search options (optional)",
+					"description": "Additional search options, e.g. disable_search (optional). temperature and top_p are still accepted here but have their own arguments.",
 					"additionalProperties": map[string]any{
 						"type": "string",
 					},
 				},
+				"output_format": map[string]any{
+					"type":        "string",
+					"description": "Format of the returned result (optional, defaults to 'json')",
+					"enum":        []string{OutputFormatJSON, OutputFormatMarkdown},
+					"default":     OutputFormatJSON,
+				},
+				"user_location": map[string]any{
+					"type":        "object",
+					"description": "Approximate user location for geo-relevant results (optional)",
+					"properties": map[string]any{
+						"country": map[string]any{
+							"type":        "string",
+							"description": "Two-letter ISO country code",
+							"minLength":   2,
+							"maxLength":   2,
+						},
+						"region": map[string]any{
+							"type":        "string",
+							"description": "Region or state",
+						},
+						"city": map[string]any{
+							"type":        "string",
+							"description": "City name",
+						},
+						"latitude": map[string]any{
+							"type":    "number",
+							"minimum": -90,
+							"maximum": 90,
+						},
+						"longitude": map[string]any{
+							"type":    "number",
+							"minimum": -180,
+							"maximum": 180,
+						},
+					},
+					"additionalProperties": false,
+				},
+				"sources_only": map[string]any{
+					"type":        "boolean",
+					"description": "Return only the ranked citations and sources with snippets, without the synthesized answer (optional)",
+					"default":     false,
+				},
+				"max_response_chars": map[string]any{
+					"type":        "integer",
+					"description": "Truncate the answer to this many characters; the rest is readable from the continuation resource URI returned with it (optional)",
+					"minimum":     MinResponseChars,
+				},
+				"verify_citations": map[string]any{
+					"type":        "boolean",
+					"description": "Check every citation URL and mark unreachable ones, adding a few seconds to the call (optional)",
+					"default":     false,
+				},
+				"rewrite_query": map[string]any{
+					"type":        "boolean",
+					"description": "Have a model fix spelling, expand acronyms and anchor relative dates in the query before searching, at the cost of an extra call; the original and rewritten queries are returned (optional)",
+					"default":     false,
+				},
+				"citation_style": map[string]any{
+					"type":        "string",
+					"description": "Render inline [n] markers as links to the citation URLs or as markdown footnotes (optional, markdown output only)",
+					"enum":        CitationStyles,
+				},
+				"link_citations": map[string]any{
+					"type":        "boolean",
+					"description": "Same as citation_style 'links' (optional, markdown output only)",
+					"default":     false,
+				},
+				"return_images": map[string]any{
+					"type":        "boolean",
+					"description": "Return images related to the answer with their source pages (optional)",
+					"default":     false,
+				},
+				"image_domain_filter": map[string]any{
+					"type":        "array",
+					"description": fmt.Sprintf("Only return images from these domains; prefix a domain with '-' to exclude it (optional, requires return_images, max %d)", config.MaxDomainFilters),
+					"items": map[string]any{
+						"type": "string",
+					},
+					"maxItems": config.MaxDomainFilters,
+				},
+				"image_format_filter": map[string]any{
+					"type":        "array",
+					"description": "Only return images in these file formats, e.g. svg or png (optional, requires return_images)",
+					"items": map[string]any{
+						"type": "string",
+					},
+					"maxItems": MaxImageFormatFilters,
+				},
 			},
 			Required: []string{"query"},
 		},
+		OutputSchema: searchOutputSchema(),
+	}
+	relaxModelSchema(&tool, config)
+	return tool
+}
+
+// relaxModelSchema replaces the model enum of tool with the model name pattern
+// when unknown models are forwarded and no allow list bounds them, so clients
+// that validate arguments can send models released after this build
+func relaxModelSchema(tool *mcp.Tool, config *Config) {
+	if !config.AllowUnknownModels || len(config.AllowedModels) > 0 {
+		return
+	}
+	if model, ok := tool.InputSchema.Properties["model"].(map[string]any); ok {
+		delete(model, "enum")
+		model["pattern"] = modelNamePattern.String()
+		model["examples"] = config.Models()
 	}
 }
 
 // PerplexitySearchHandler creates the handler function for the perplexity_search tool
-func PerplexitySearchHandler(client *PerplexityClient) func(ctx context.Context, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+func PerplexitySearchHandler(client SearchProvider, live *LiveConfig, results *ResultStore, sessions *SessionManager, sampler *QualitySampler, usage *UsageTracker) func(ctx context.Context, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+	return searchHandler("perplexity_search", parseSearchRequestFromMCP, client, live, results, sessions, sampler, usage)
+}
+
+// searchHandler creates the handler of a search tool named name, whose
+// arguments parse turns into a search request. Preset tools share it with
+// perplexity_search, so their calls are stored, counted and degraded alike.
+func searchHandler(name string, parse func(mcp.CallToolRequest) (*SearchRequest, error), client SearchProvider, live *LiveConfig, results *ResultStore, sessions *SessionManager, sampler *QualitySampler, usage *UsageTracker) func(ctx context.Context, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
 	return func(ctx context.Context, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+		// Read the configuration once per call so a reload never changes it mid-request
+		config := live.Get()
+
 		// Parse the search request
-		req, err := parseSearchRequestFromMCP(request)
+		req, err := parse(request)
 		if err != nil {
 			return &mcp.CallToolResult{
 				Content: []mcp.Content{
@@ -90,9 +273,69 @@ func PerplexitySearchHandler(client *PerplexityClient) func(ctx context.Context,
 			}, err
 		}
 
-		// Execute search using the Perplexity client
-		result, err := client.Search(ctx, *req)
+		// Assemble the conversation from server-side session history
+		if req.SessionID != "" {
+			req.ContextMessages = sessions.History(req.SessionID)
+		}
+
+		config.applyToolDefaults(name, req)
+		req.MaxQueryLength = config.MaxQueryLength
+		req.MaxDomainFilters = config.MaxDomainFilters
+		if err := config.CheckModel(req.Model); err != nil {
+			return &mcp.CallToolResult{
+				Content: []mcp.Content{
+					mcp.TextContent{
+						Type: "text",
+						Text: fmt.Sprintf("Invalid search request: %s", err.Error()),
+					},
+				},
+				IsError: true,
+			}, err
+		}
+
+		// Refuse new API calls once a hard budget limit is reached
+		if _, err := config.Budgets.Check(usage); err != nil {
+			return &mcp.CallToolResult{
+				Content: []mcp.Content{
+					mcp.TextContent{
+						Type: "text",
+						Text: fmt.Sprintf("Search failed: %s", err.Error()),
+					},
+				},
+				IsError: true,
+			}, err
+		}
+
+		// Execute search using the Perplexity client, reporting progress to
+		// clients that asked for it with a progressToken
+		progress := newProgressReporter(ctx, request)
+
+		// Search a rewritten query if asked; the answer is still stored and kept
+		// in the session under the original one
+		sent := *req
+		var rewrite *QueryRewrite
+		if req.RewriteQuery {
+			progress.report("rewriting query")
+			if rewrite = rewriteQuery(ctx, client, config, usage, name, req); rewrite != nil {
+				sent.Query = rewrite.Rewritten
+			}
+		}
+
+		result, err := searchWithModelFallback(ctx, client, config, name, sent, progress)
 		if err != nil {
+			// Degrade as configured unless the caller itself gave up
+			if ctx.Err() == nil {
+				if degraded := degradedResult(ctx, config, name, results, *req, err, func(stale *SearchResult) (string, any, error) {
+					stale = config.shownResult(stale)
+					if req.MaxResponseChars > 0 {
+						stale = truncateResult(stale, req.MaxResponseChars)
+					}
+					content, err := formatSearchResult(stale, req)
+					return content, searchResultData(stale, req), err
+				}); degraded != nil {
+					return degraded, nil
+				}
+			}
 			return &mcp.CallToolResult{
 				Content: []mcp.Content{
 					mcp.TextContent{
@@ -101,11 +344,38 @@ func PerplexitySearchHandler(client *PerplexityClient) func(ctx context.Context,
 					},
 				},
 				IsError: true,
+				Result:  mcp.Result{Meta: errorMeta(err)},
 			}, err
 		}
 
+		progress.reportResult(result)
+		result.QueryRewrite = rewrite
+
+		if req.VerifyCitations && len(result.Citations) > 0 {
+			progress.report(fmt.Sprintf("verifying %d citations", len(result.Citations)))
+			result.Citations = client.VerifyCitations(ctx, result.Citations)
+		}
+		if req.IdentifyPapers {
+			result.Citations = identifyPapers(result.Citations)
+		}
+
+		if req.SessionID != "" {
+			sessions.Append(req.SessionID, req.Query, result)
+			result.SessionID = req.SessionID
+		}
+		results.PutAnswer(ctx, *req, result)
+		usage.Record(config.ModelPrices, name, req.SessionID, result)
+		budgetWarnings, _ := config.Budgets.Check(usage)
+		sampler.Offer(config.QualitySampleRate, req.Query, result)
+
+		// Return a long answer in part; the stored result keeps all of it
+		result = config.shownResult(result)
+		if req.MaxResponseChars > 0 {
+			result = truncateResult(result, req.MaxResponseChars)
+		}
+
 		// Format the result
-		content, err := formatSearchResultForMCP(result)
+		content, err := formatSearchResult(result, req)
 		if err != nil {
 			return &mcp.CallToolResult{
 				Content: []mcp.Content{
@@ -118,18 +388,55 @@ func PerplexitySearchHandler(client *PerplexityClient) func(ctx context.Context,
 			}, err
 		}
 
-		return &mcp.CallToolResult{
-			Content: []mcp.Content{
-				mcp.TextContent{
-					Type: "text",
-					Text: content,
-				},
+		blocks := []mcp.Content{
+			mcp.TextContent{
+				Type: "text",
+				Text: content,
 			},
-			IsError: false,
+		}
+		// JSON results carry the reasoning trace as a field; markdown gets its own block
+		if result.Reasoning != "" && req.OutputFormat == OutputFormatMarkdown {
+			blocks = append(blocks, mcp.TextContent{
+				Type: "text",
+				Text: "## Reasoning\n\n" + result.Reasoning,
+			})
+		}
+
+		return &mcp.CallToolResult{
+			Result:            mcp.Result{Meta: withBudgetWarnings(resultMeta(config.ModelPrices, result), budgetWarnings)},
+			Content:           blocks,
+			StructuredContent: searchResultData(result, req),
+			IsError:           false,
 		}, nil
 	}
 }
 
+// resultMeta builds the _meta attached to tool results so callers can budget
+// themselves. result is the answer returned, if any; calls, when given, are all
+// the answers behind it, whose tokens and cost are reported instead of result's.
+// PacingMiddleware adds the remaining budgets and rate-limit headroom.
+func resultMeta(prices map[string]ModelPrice, result *SearchResult, calls ...*SearchResult) *mcp.Meta {
+	fields := map[string]any{}
+	if len(calls) == 0 && result != nil {
+		calls = []*SearchResult{result}
+	}
+	if len(calls) > 0 {
+		usageMeta(fields, prices, calls)
+	}
+	if result != nil {
+		if result.RequestedModel != "" {
+			fields["model_fallback"] = map[string]any{"requested_model": result.RequestedModel, "model": result.Model}
+		}
+		if result.QueryRewrite != nil {
+			fields["query_rewrite"] = result.QueryRewrite
+		}
+	}
+	if len(fields) == 0 {
+		return nil
+	}
+	return &mcp.Meta{AdditionalFields: fields}
+}
+
 // parseSearchRequestFromMCP converts mcp.CallToolRequest to internal SearchRequest
 func parseSearchRequestFromMCP(request mcp.CallToolRequest) (*SearchRequest, error) {
 	query, err := request.RequireString("query")
@@ -141,6 +448,11 @@ func parseSearchRequestFromMCP(request mcp.CallToolRequest) (*SearchRequest, err
 		Query: query,
 	}
 
+	// Optional system_prompt parameter
+	if systemPrompt := request.GetString("system_prompt", ""); systemPrompt != "" {
+		req.SystemPrompt = systemPrompt
+	}
+
 	// Optional model parameter
 	if model := request.GetString("model", ""); model != "" {
 		req.Model = model
@@ -151,13 +463,33 @@ func parseSearchRequestFromMCP(request mcp.CallToolRequest) (*SearchRequest, err
 		req.SearchMode = searchMode
 	}
 
+	// Optional reasoning_effort parameter
+	req.ReasoningEffort = request.GetString("reasoning_effort", "")
+
 	// Optional max_tokens parameter
-	if maxTokensStr := request.GetString("max_tokens", ""); maxTokensStr != "" {
-		if maxTokens, err := strconv.Atoi(maxTokensStr); err == nil {
-			req.MaxTokens = maxTokens
-		} else {
-			return nil, fmt.Errorf("max_tokens must be a valid number")
-		}
+	maxTokens, err := integerArgument(request, "max_tokens")
+	if err != nil {
+		return nil, err
+	}
+	if maxTokens != nil {
+		req.MaxTokens = *maxTokens
+	}
+
+	// Optional sampling parameters
+	if req.Temperature, err = numberArgument(request, "temperature"); err != nil {
+		return nil, err
+	}
+	if req.TopP, err = numberArgument(request, "top_p"); err != nil {
+		return nil, err
+	}
+	if req.TopK, err = integerArgument(request, "top_k"); err != nil {
+		return nil, err
+	}
+	if req.FrequencyPenalty, err = numberArgument(request, "frequency_penalty"); err != nil {
+		return nil, err
+	}
+	if req.PresencePenalty, err = numberArgument(request, "presence_penalty"); err != nil {
+		return nil, err
 	}
 
 	// Optional date_range parameter
@@ -169,6 +501,9 @@ func parseSearchRequestFromMCP(request mcp.CallToolRequest) (*SearchRequest, err
 	if sources := request.GetStringSlice("sources", nil); sources != nil {
 		req.Sources = sources
 	}
+	if excluded := request.GetStringSlice("exclude_sources", nil); excluded != nil {
+		req.ExcludeSources = excluded
+	}
 
 	// Optional options parameter - use BindArguments for complex objects
 	var optionsMap map[string]string
@@ -193,31 +528,378 @@ func parseSearchRequestFromMCP(request mcp.CallToolRequest) (*SearchRequest, err
 		req.Options = optionsMap
 	}
 
+	// temperature and top_p were options before they became arguments; the
+	// arguments win when both are given
+	for key, value := range req.Options {
+		var target **float64
+		switch strings.ToLower(key) {
+		case "temperature":
+			target = &req.Temperature
+		case "top_p":
+			target = &req.TopP
+		default:
+			continue
+		}
+		if *target != nil {
+			continue
+		}
+		number, err := strconv.ParseFloat(value, 64)
+		if err != nil {
+			return nil, fmt.Errorf("option '%s' must be a number", key)
+		}
+		*target = &number
+	}
+
+	// Optional output_format parameter
+	if outputFormat := request.GetString("output_format", ""); outputFormat != "" {
+		req.OutputFormat = outputFormat
+	}
+
+	// Optional citation_style parameter; link_citations predates it and means "links"
+	req.CitationStyle = request.GetString("citation_style", "")
+	if request.GetBool("link_citations", false) {
+		if req.CitationStyle != "" && req.CitationStyle != CitationStyleLinks {
+			return nil, fmt.Errorf("link_citations conflicts with citation_style '%s'", req.CitationStyle)
+		}
+		req.CitationStyle = CitationStyleLinks
+	}
+
+	// Optional sources_only parameter
+	req.SourcesOnly = request.GetBool("sources_only", false)
+
+	// Optional verify_citations parameter
+	req.VerifyCitations = request.GetBool("verify_citations", false)
+
+	// Optional rewrite_query parameter
+	req.RewriteQuery = request.GetBool("rewrite_query", false)
+
+	// Optional image parameters
+	req.ReturnImages = request.GetBool("return_images", false)
+	req.ImageDomainFilter = request.GetStringSlice("image_domain_filter", nil)
+	req.ImageFormatFilter = request.GetStringSlice("image_format_filter", nil)
+
+	// Optional max_response_chars parameter
+	req.MaxResponseChars = request.GetInt("max_response_chars", 0)
+
+	// Optional user_location parameter
+	if args := request.GetArguments(); args != nil {
+		if locationRaw, exists := args["user_location"]; exists {
+			location, err := parseUserLocation(locationRaw)
+			if err != nil {
+				return nil, err
+			}
+			req.UserLocation = location
+		}
+	}
+
+	// Optional context_messages parameter
+	if args := request.GetArguments(); args != nil {
+		if messagesRaw, exists := args["context_messages"]; exists {
+			messages, err := parseContextMessages(messagesRaw)
+			if err != nil {
+				return nil, err
+			}
+			req.ContextMessages = messages
+		}
+	}
+
+	// Optional session_id parameter
+	if sessionID := request.GetString("session_id", ""); sessionID != "" {
+		if len(req.ContextMessages) > 0 {
+			return nil, fmt.Errorf("session_id cannot be combined with context_messages")
+		}
+		req.SessionID = sessionID
+	}
+
 	return req, nil
 }
 
+// parseUserLocation converts the user_location argument object to UserLocation
+func parseUserLocation(raw any) (*UserLocation, error) {
+	data, ok := raw.(map[string]any)
+	if !ok {
+		return nil, fmt.Errorf("user_location must be an object")
+	}
+
+	location := &UserLocation{}
+	for key, value := range data {
+		switch key {
+		case "country", "region", "city":
+			strValue, ok := value.(string)
+			if !ok {
+				return nil, fmt.Errorf("user_location %s must be a string", key)
+			}
+			switch key {
+			case "country":
+				location.Country = strings.ToUpper(strValue)
+			case "region":
+				location.Region = strValue
+			case "city":
+				location.City = strValue
+			}
+		case "latitude", "longitude":
+			numValue, ok := value.(float64)
+			if !ok {
+				return nil, fmt.Errorf("user_location %s must be a number", key)
+			}
+			if key == "latitude" {
+				location.Latitude = &numValue
+			} else {
+				location.Longitude = &numValue
+			}
+		default:
+			return nil, fmt.Errorf("unknown user_location field '%s'", key)
+		}
+	}
+
+	return location, nil
+}
+
+// numberArgument returns the number argument key, or nil when it is absent.
+// Numbers sent as strings are accepted from clients that stringify arguments.
+func numberArgument(request mcp.CallToolRequest, key string) (*float64, error) {
+	value, exists := request.GetArguments()[key]
+	if !exists || value == nil {
+		return nil, nil
+	}
+	switch v := value.(type) {
+	case float64:
+		return &v, nil
+	case int:
+		number := float64(v)
+		return &number, nil
+	case string:
+		if number, err := strconv.ParseFloat(v, 64); err == nil {
+			return &number, nil
+		}
+	}
+	return nil, fmt.Errorf("%s must be a number", key)
+}
+
+// integerArgument returns the integer argument key, or nil when it is absent
+func integerArgument(request mcp.CallToolRequest, key string) (*int, error) {
+	number, err := numberArgument(request, key)
+	if err != nil || number == nil {
+		return nil, err
+	}
+	if *number != math.Trunc(*number) || math.Abs(*number) > math.MaxInt32 {
+		return nil, fmt.Errorf("%s must be an integer", key)
+	}
+	integer := int(*number)
+	return &integer, nil
+}
+
+// parseContextMessages converts the context_messages argument array to Messages
+func parseContextMessages(raw any) ([]Message, error) {
+	items, ok := raw.([]any)
+	if !ok {
+		return nil, fmt.Errorf("context_messages must be an array")
+	}
+
+	messages := make([]Message, 0, len(items))
+	for i, item := range items {
+		data, ok := item.(map[string]any)
+		if !ok {
+			return nil, fmt.Errorf("context_messages[%d] must be an object", i)
+		}
+		role, ok := data["role"].(string)
+		if !ok {
+			return nil, fmt.Errorf("context_messages[%d] role must be a string", i)
+		}
+		content, ok := data["content"].(string)
+		if !ok {
+			return nil, fmt.Errorf("context_messages[%d] content must be a string", i)
+		}
+		messages = append(messages, Message{Role: role, Content: content})
+	}
+
+	return messages, nil
+}
+
+// formatSearchResult renders result in the output format requested by req
+func formatSearchResult(result *SearchResult, req *SearchRequest) (string, error) {
+	if req.OutputFormat == OutputFormatMarkdown {
+		return formatSearchResultAsMarkdown(result, req), nil
+	}
+	return formatSearchResultForMCP(result, req)
+}
+
 // formatSearchResultForMCP formats SearchResult as JSON string for MCP response
-func formatSearchResultForMCP(result *SearchResult) (string, error) {
+func formatSearchResultForMCP(result *SearchResult, req *SearchRequest) (string, error) {
+	jsonBytes, err := json.MarshalIndent(searchResultData(result, req), "", "  ")
+	if err != nil {
+		return "", fmt.Errorf("failed to marshal search result: %w", err)
+	}
+
+	return string(jsonBytes), nil
+}
+
+// searchResultData is the JSON result of perplexity_search, also returned as
+// structuredContent whatever the output format
+func searchResultData(result *SearchResult, req *SearchRequest) map[string]any {
 	response := map[string]any{
-		"id":      result.ID,
-		"content": result.Content,
-		"model":   result.Model,
-		"usage":   result.Usage,
-		"created": result.Created,
+		"id":           result.ID,
+		"resource_uri": SearchURI(result.ID),
+		"model":        result.Model,
+		"usage":        result.Usage,
+		"created":      result.Created,
+	}
+
+	if req.SourcesOnly {
+		response["sources_only"] = true
+	} else {
+		response["content"] = result.Content
+	}
+
+	if result.SessionID != "" {
+		response["session_id"] = result.SessionID
+	}
+
+	if result.Stale {
+		response["stale"] = true
+	}
+
+	if result.Truncation != nil {
+		response["truncation"] = result.Truncation
+	}
+
+	if result.Reasoning != "" {
+		response["reasoning"] = result.Reasoning
+	}
+
+	if result.RequestedModel != "" {
+		response["requested_model"] = result.RequestedModel
+	}
+
+	if result.QueryRewrite != nil {
+		response["query_rewrite"] = result.QueryRewrite
 	}
 
 	if len(result.Citations) > 0 {
 		response["citations"] = result.Citations
 	}
 
+	if len(result.CitationMap) > 0 {
+		response["citation_map"] = result.CitationMap
+	}
+
 	if len(result.Sources) > 0 {
 		response["sources"] = result.Sources
 	}
 
-	jsonBytes, err := json.MarshalIndent(response, "", "  ")
+	if len(result.Images) > 0 {
+		response["images"] = result.Images
+	}
+
+	if result.Model == DeepResearchModel && !req.SourcesOnly {
+		if sections := splitSections(result.Content); len(sections) > 1 {
+			response["sections"] = tableOfContents(sections)
+		}
+	}
+
+	return response
+}
+
+// CreateGetSectionTool creates the perplexity_get_section tool for use with mcp-go
+func CreateGetSectionTool() mcp.Tool {
+	return mcp.Tool{
+		Name:        "perplexity_get_section",
+		Description: "Retrieve one section of a previous deep research report by result ID and section index, or the report's table of contents when no section is given.",
+		InputSchema: mcp.ToolInputSchema{
+			Type: "object",
+			Properties: map[string]any{
+				"result_id": map[string]any{
+					"type":        "string",
+					"description": "The id of a previous perplexity_search result",
+					"minLength":   1,
+				},
+				"section": map[string]any{
+					"type":        "integer",
+					"description": "Index of the section to retrieve (optional, omit for the table of contents)",
+					"minimum":     0,
+				},
+			},
+			Required: []string{"result_id"},
+		},
+		OutputSchema: getSectionOutputSchema(),
+	}
+}
+
+// GetSectionHandler creates the handler function for the perplexity_get_section tool
+func GetSectionHandler(results *ResultStore, live *LiveConfig) func(ctx context.Context, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+	return func(ctx context.Context, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+		content, data, err := getResultSection(results, live.Get().ResponseRedactions, clientIdentity(ctx), request)
+		if err != nil {
+			return &mcp.CallToolResult{
+				Content: []mcp.Content{
+					mcp.TextContent{
+						Type: "text",
+						Text: fmt.Sprintf("Failed to get section: %s", err.Error()),
+					},
+				},
+				IsError: true,
+			}, err
+		}
+
+		return &mcp.CallToolResult{
+			Content: []mcp.Content{
+				mcp.TextContent{
+					Type: "text",
+					Text: content,
+				},
+			},
+			StructuredContent: data,
+			IsError:           false,
+		}, nil
+	}
+}
+
+// getResultSection looks up the requested section, or the table of contents, of
+// a stored result of owner. It returns the text to show and the same as structured data.
+func getResultSection(results *ResultStore, redactions RedactionRules, owner string, request mcp.CallToolRequest) (string, map[string]any, error) {
+	resultID, err := request.RequireString("result_id")
 	if err != nil {
-		return "", fmt.Errorf("failed to marshal search result: %w", err)
+		return "", nil, fmt.Errorf("result_id must be a string")
 	}
 
-	return string(jsonBytes), nil
+	result, ok := results.Get(resultID, owner)
+	if !ok {
+		return "", nil, fmt.Errorf("result not found: %s", resultID)
+	}
+	result = redactions.apply(result)
+	sections := splitSections(result.Content)
+
+	args := request.GetArguments()
+	if _, exists := args["section"]; !exists {
+		data := map[string]any{
+			"result_id": result.ID,
+			"sections":  tableOfContents(sections),
+		}
+		jsonBytes, err := json.MarshalIndent(data, "", "  ")
+		if err != nil {
+			return "", nil, fmt.Errorf("failed to marshal table of contents: %w", err)
+		}
+		return string(jsonBytes), data, nil
+	}
+
+	index, err := request.RequireInt("section")
+	if err != nil {
+		return "", nil, fmt.Errorf("section must be an integer")
+	}
+	if index < 0 || index >= len(sections) {
+		return "", nil, fmt.Errorf("section %d out of range (result has %d sections)", index, len(sections))
+	}
+
+	section := sections[index]
+	data := map[string]any{
+		"result_id": result.ID,
+		"section":   index,
+		"title":     section.Title,
+		"level":     section.Level,
+		"content":   section.Content,
+	}
+	if section.Level == 0 {
+		return section.Content, data, nil
+	}
+	return strings.Repeat("#", section.Level) + " " + section.Title + "\n\n" + section.Content, data, nil
 }
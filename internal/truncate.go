@@ -0,0 +1,141 @@
+package internal
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/mark3labs/mcp-go/mcp"
+)
+
+// MinResponseChars is the smallest max_response_chars accepted, so a page
+// always holds a useful amount of text
+const MinResponseChars = 500
+
+// Truncation describes an answer cut short by max_response_chars. Character
+// counts and offsets are in Unicode code points of the answer content.
+type Truncation struct {
+	TotalChars    int `json:"total_chars"`
+	ReturnedChars int `json:"returned_chars"`
+	// ContinuationURI reads the rest of the answer one page at a time
+	ContinuationURI string `json:"continuation_uri"`
+}
+
+// ContentPageURI returns the resource URI of the page of a stored answer
+// starting at offset and at most limit characters long
+func ContentPageURI(id string, offset, limit int) string {
+	return fmt.Sprintf("%s%s/content?offset=%d&limit=%d", SearchURIPrefix, id, offset, limit)
+}
+
+// truncateResult returns result with its answer cut to maxChars, marked with
+// Truncation, or result itself when the answer fits. The stored result keeps
+// the full answer, so the returned copy is never stored.
+func truncateResult(result *SearchResult, maxChars int) *SearchResult {
+	page, next := contentPage(result.Content, 0, maxChars)
+	if next == 0 {
+		return result
+	}
+
+	truncated := *result
+	truncated.Content = page
+	truncated.Truncation = &Truncation{
+		TotalChars:      utf8.RuneCountInString(result.Content),
+		ReturnedChars:   next,
+		ContinuationURI: ContentPageURI(result.ID, next, maxChars),
+	}
+	return &truncated
+}
+
+// contentPage returns up to limit characters of content from offset and the
+// offset of the following page, 0 when the page reaches the end. Pages end at
+// a paragraph, line or word break when one falls in their second half.
+func contentPage(content string, offset, limit int) (string, int) {
+	runes := []rune(content)
+	if offset >= len(runes) {
+		return "", 0
+	}
+	if limit <= 0 || offset+limit >= len(runes) {
+		return string(runes[offset:]), 0
+	}
+
+	page := string(runes[offset : offset+limit])
+	for _, sep := range []string{"\n\n", "\n", " "} {
+		if cut := strings.LastIndex(page, sep); cut >= len(page)/2 {
+			page = page[:cut+len(sep)]
+			break
+		}
+	}
+	return page, offset + utf8.RuneCountInString(page)
+}
+
+// CreateContentPageTemplate creates the search://{id}/content resource template
+// that serves a stored answer in pages, continuing truncated results
+func CreateContentPageTemplate() mcp.ResourceTemplate {
+	return mcp.NewResourceTemplate(
+		SearchURIPrefix+"{id}/content{?offset,limit}",
+		"Search answer page",
+		mcp.WithTemplateDescription("Answer text of a stored search result from offset, at most limit characters; _meta.next_uri reads the following page"),
+		mcp.WithTemplateMIMEType("text/markdown"),
+	)
+}
+
+// ContentPageHandler creates the resources/read handler for answer pages
+func ContentPageHandler(results *ResultStore, live *LiveConfig) func(ctx context.Context, request mcp.ReadResourceRequest) ([]mcp.ResourceContents, error) {
+	return func(ctx context.Context, request mcp.ReadResourceRequest) ([]mcp.ResourceContents, error) {
+		id := templateArgument(request, "id")
+		result, ok := results.Get(id, clientIdentity(ctx))
+		if !ok {
+			return nil, fmt.Errorf("result not found: %s", id)
+		}
+		// Page the redacted answer, so offsets match what perplexity_search returned
+		result = live.Get().ResponseRedactions.apply(result)
+
+		offset, limit := 0, 0
+		for name, value := range map[string]*int{"offset": &offset, "limit": &limit} {
+			if raw := templateArgument(request, name); raw != "" {
+				n, err := strconv.Atoi(raw)
+				if err != nil || n < 0 {
+					return nil, fmt.Errorf("%s must be a non-negative integer", name)
+				}
+				*value = n
+			}
+		}
+		if limit > 0 && limit < MinResponseChars {
+			return nil, fmt.Errorf("limit must be at least %d", MinResponseChars)
+		}
+
+		page, next := contentPage(result.Content, offset, limit)
+		meta := map[string]any{
+			"offset":      offset,
+			"total_chars": utf8.RuneCountInString(result.Content),
+		}
+		if next > 0 {
+			meta["next_uri"] = ContentPageURI(id, next, limit)
+			page += fmt.Sprintf("\n\n_Continued at %s_", ContentPageURI(id, next, limit))
+		}
+
+		return []mcp.ResourceContents{
+			mcp.TextResourceContents{
+				Meta:     &mcp.Meta{AdditionalFields: meta},
+				URI:      request.Params.URI,
+				MIMEType: "text/markdown",
+				Text:     page,
+			},
+		}, nil
+	}
+}
+
+// templateArgument returns a variable matched from a resource template URI
+func templateArgument(request mcp.ReadResourceRequest, name string) string {
+	switch value := request.Params.Arguments[name].(type) {
+	case string:
+		return value
+	case []string:
+		if len(value) > 0 {
+			return value[0]
+		}
+	}
+	return ""
+}
@@ -3,31 +3,282 @@ package internal
 import (
 	"encoding/json"
 	"fmt"
+	"slices"
 	"strings"
 	"time"
 )
 
+// SonarModels lists the models accepted by the Perplexity API
+var SonarModels = []string{
+	"sonar",
+	"sonar-pro",
+	"sonar-reasoning",
+	"sonar-reasoning-pro",
+	"sonar-deep-research",
+}
+
+// Search modes with a preset tool of their own
+const (
+	SearchModeAcademic = "academic"
+	SearchModeNews     = "news"
+	// SearchModeSEC searches SEC EDGAR filings such as 10-K, 10-Q and 8-K reports
+	SearchModeSEC = "sec"
+)
+
+// SearchModes lists the search modes accepted by the Perplexity API
+var SearchModes = []string{"web", SearchModeAcademic, SearchModeNews, SearchModeSEC}
+
+// DateRanges lists the date_range values, sent to the API as its search
+// recency filter
+var DateRanges = []string{"day", "week", "month", "year"}
+
+// ReasoningEfforts lists the reasoning_effort levels of sonar-deep-research,
+// trading cost and latency for depth
+var ReasoningEfforts = []string{"low", "medium", "high"}
+
 // Core request and response types
 type SearchRequest struct {
-	Query      string            `json:"query"`
-	Model      string            `json:"model,omitempty"`
-	SearchMode string            `json:"search_mode,omitempty"`
-	MaxTokens  int               `json:"max_tokens,omitempty"`
-	DateRange  string            `json:"date_range,omitempty"`
-	Sources    []string          `json:"sources,omitempty"`
-	Options    map[string]string `json:"options,omitempty"`
+	Query         string            `json:"query"`
+	Model         string            `json:"model,omitempty"`
+	SearchMode    string            `json:"search_mode,omitempty"`
+	MaxTokens     int               `json:"max_tokens,omitempty"`
+	DateRange     string            `json:"date_range,omitempty"`
+	Sources       []string          `json:"sources,omitempty"`
+	Options       map[string]string `json:"options,omitempty"`
+	OutputFormat  string            `json:"output_format,omitempty"`
+	CitationStyle string            `json:"citation_style,omitempty"`
+	UserLocation  *UserLocation     `json:"user_location,omitempty"`
+	SystemPrompt  string            `json:"system_prompt,omitempty"`
+	// ExcludeSources are domains left out of the search
+	ExcludeSources []string `json:"exclude_sources,omitempty"`
+	// ContextMessages are prior conversation turns sent ahead of the query
+	ContextMessages []Message `json:"context_messages,omitempty"`
+	// SessionID selects server-side conversation history instead of ContextMessages
+	SessionID string `json:"session_id,omitempty"`
+	// SourcesOnly returns citations and sources without the synthesized answer
+	SourcesOnly bool `json:"sources_only,omitempty"`
+	// VerifyCitations checks that every citation URL is reachable before returning
+	VerifyCitations bool `json:"verify_citations,omitempty"`
+	// RewriteQuery has the query cleaned up by a model call before it is searched
+	RewriteQuery bool `json:"rewrite_query,omitempty"`
+	// IdentifyPapers sets the DOI and arXiv ID of citations whose URL contains one
+	IdentifyPapers bool `json:"-"`
+	// MaxResponseChars truncates the returned answer, which stays readable in full
+	// as a resource (0 returns it whole)
+	MaxResponseChars int `json:"max_response_chars,omitempty"`
+	// MaxQueryLength bounds Query and SystemPrompt; the server sets it from
+	// MAX_QUERY_LENGTH (0 applies DefaultMaxQueryLength)
+	MaxQueryLength int `json:"-"`
+	// MaxDomainFilters bounds the domains of sources and exclude_sources
+	// together; the server sets it from MAX_DOMAIN_FILTERS (0 applies
+	// DefaultMaxDomainFilters)
+	MaxDomainFilters int `json:"-"`
+
+	// Sampling parameters passed to the model; nil leaves the API default
+	Temperature      *float64 `json:"temperature,omitempty"`
+	TopP             *float64 `json:"top_p,omitempty"`
+	TopK             *int     `json:"top_k,omitempty"`
+	FrequencyPenalty *float64 `json:"frequency_penalty,omitempty"`
+	PresencePenalty  *float64 `json:"presence_penalty,omitempty"`
+
+	// ReasoningEffort is sent to sonar-deep-research only; other models,
+	// including a fallback model, answer without it
+	ReasoningEffort string `json:"reasoning_effort,omitempty"`
+
+	// ReturnImages asks for images with the answer, limited to the domains
+	// of ImageDomainFilter ("-" excludes one) and the file extensions of
+	// ImageFormatFilter
+	ReturnImages      bool     `json:"return_images,omitempty"`
+	ImageDomainFilter []string `json:"image_domain_filter,omitempty"`
+	ImageFormatFilter []string `json:"image_format_filter,omitempty"`
+}
+
+// Upper bounds of the sampling parameters accepted by the API. Penalties
+// range from -MaxPenalty to MaxPenalty.
+const (
+	MaxTemperature = 2.0
+	MaxTopK        = 2048
+	MaxPenalty     = 2.0
+)
+
+// DefaultMaxQueryLength is the longest query and system prompt accepted
+// unless MAX_QUERY_LENGTH sets another limit
+const DefaultMaxQueryLength = 10000
+
+// DefaultMaxDomainFilters bounds the domains of search_domain_filter, included
+// with sources and excluded with exclude_sources, unless MAX_DOMAIN_FILTERS
+// sets another limit
+const DefaultMaxDomainFilters = 10
+
+// Limits on conversation context carried with a search request
+const (
+	MaxContextMessages = 100
+	MaxMessageLength   = 50000
+)
+
+// Message is a prior user or assistant turn in a conversation
+type Message struct {
+	Role    string `json:"role"`
+	Content string `json:"content"`
+}
+
+// validateContextMessages checks that prior turns alternate user/assistant,
+// starting with the user and ending with the assistant, so the query can
+// follow as the next user turn.
+func validateContextMessages(messages []Message) error {
+	if len(messages) > MaxContextMessages {
+		return fmt.Errorf("too many context_messages: %d > %d", len(messages), MaxContextMessages)
+	}
+	for i, msg := range messages {
+		expected := "user"
+		if i%2 == 1 {
+			expected = "assistant"
+		}
+		if msg.Role != expected {
+			return fmt.Errorf("context_messages[%d] must have role '%s', got '%s'", i, expected, msg.Role)
+		}
+		if strings.TrimSpace(msg.Content) == "" {
+			return fmt.Errorf("context_messages[%d] content cannot be empty", i)
+		}
+		if len(msg.Content) > MaxMessageLength {
+			return fmt.Errorf("context_messages[%d] too long: %d > %d", i, len(msg.Content), MaxMessageLength)
+		}
+	}
+	if len(messages)%2 == 1 {
+		return fmt.Errorf("context_messages must end with an assistant turn")
+	}
+	return nil
 }
 
+// UserLocation is an approximate user location used to geolocate search results
+type UserLocation struct {
+	Country   string   `json:"country,omitempty"`
+	Region    string   `json:"region,omitempty"`
+	City      string   `json:"city,omitempty"`
+	Latitude  *float64 `json:"latitude,omitempty"`
+	Longitude *float64 `json:"longitude,omitempty"`
+}
+
+func (l *UserLocation) Validate() error {
+	if l.Country == "" && l.Region == "" && l.City == "" && l.Latitude == nil && l.Longitude == nil {
+		return fmt.Errorf("user_location must not be empty")
+	}
+	if l.Country != "" && len(l.Country) != 2 {
+		return fmt.Errorf("user_location country must be a two-letter ISO code: %s", l.Country)
+	}
+	if (l.Latitude == nil) != (l.Longitude == nil) {
+		return fmt.Errorf("user_location latitude and longitude must be set together")
+	}
+	if l.Latitude != nil && (*l.Latitude < -90 || *l.Latitude > 90) {
+		return fmt.Errorf("invalid user_location latitude: %g", *l.Latitude)
+	}
+	if l.Longitude != nil && (*l.Longitude < -180 || *l.Longitude > 180) {
+		return fmt.Errorf("invalid user_location longitude: %g", *l.Longitude)
+	}
+	return nil
+}
+
+// Supported output formats for tool results
+const (
+	OutputFormatJSON     = "json"
+	OutputFormatMarkdown = "markdown"
+)
+
+// Citation styles for markdown answers: inline [n] markers become links to the
+// citation URL, or markdown footnotes defined in place of the citation list
+const (
+	CitationStyleLinks     = "links"
+	CitationStyleFootnotes = "footnotes"
+)
+
+var CitationStyles = []string{CitationStyleLinks, CitationStyleFootnotes}
+
 func (r *SearchRequest) Validate() error {
 	if strings.TrimSpace(r.Query) == "" {
 		return fmt.Errorf("query cannot be empty")
 	}
-	if len(r.Query) > 10000 {
-		return fmt.Errorf("query too long: %d > 10000", len(r.Query))
+	maxLength := r.MaxQueryLength
+	if maxLength <= 0 {
+		maxLength = DefaultMaxQueryLength
+	}
+	if len(r.Query) > maxLength {
+		return fmt.Errorf("query too long: %d > %d", len(r.Query), maxLength)
+	}
+	if len(r.SystemPrompt) > maxLength {
+		return fmt.Errorf("system_prompt too long: %d > %d", len(r.SystemPrompt), maxLength)
+	}
+	if r.SearchMode != "" && !slices.Contains(SearchModes, r.SearchMode) {
+		return fmt.Errorf("invalid search_mode: %s", r.SearchMode)
+	}
+	if r.DateRange != "" && !slices.Contains(DateRanges, r.DateRange) {
+		return fmt.Errorf("invalid date_range: %s", r.DateRange)
+	}
+	if _, err := r.domainFilter(); err != nil {
+		return err
+	}
+	if _, _, err := r.imageFilters(); err != nil {
+		return err
 	}
 	if r.MaxTokens < 0 || r.MaxTokens > 128000 {
 		return fmt.Errorf("invalid max_tokens: %d", r.MaxTokens)
 	}
+	if err := r.validateSampling(); err != nil {
+		return err
+	}
+	if r.ReasoningEffort != "" && !slices.Contains(ReasoningEfforts, r.ReasoningEffort) {
+		return fmt.Errorf("invalid reasoning_effort: %s", r.ReasoningEffort)
+	}
+	switch r.OutputFormat {
+	case "", OutputFormatJSON, OutputFormatMarkdown:
+	default:
+		return fmt.Errorf("invalid output_format: %s", r.OutputFormat)
+	}
+	if r.CitationStyle != "" {
+		if !slices.Contains(CitationStyles, r.CitationStyle) {
+			return fmt.Errorf("invalid citation_style: %s", r.CitationStyle)
+		}
+		if r.OutputFormat != OutputFormatMarkdown {
+			return fmt.Errorf("citation_style requires output_format 'markdown'")
+		}
+		if r.SourcesOnly {
+			return fmt.Errorf("citation_style cannot be combined with sources_only")
+		}
+	}
+	if r.MaxResponseChars != 0 && r.MaxResponseChars < MinResponseChars {
+		return fmt.Errorf("invalid max_response_chars: %d (minimum %d)", r.MaxResponseChars, MinResponseChars)
+	}
+	if r.UserLocation != nil {
+		if err := r.UserLocation.Validate(); err != nil {
+			return err
+		}
+	}
+	if err := validateContextMessages(r.ContextMessages); err != nil {
+		return err
+	}
+	if r.SessionID != "" {
+		if err := validateSessionID(r.SessionID); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (r *SearchRequest) validateSampling() error {
+	if r.Temperature != nil && (*r.Temperature < 0 || *r.Temperature > MaxTemperature) {
+		return fmt.Errorf("invalid temperature: %g (must be between 0 and %g)", *r.Temperature, MaxTemperature)
+	}
+	if r.TopP != nil && (*r.TopP < 0 || *r.TopP > 1) {
+		return fmt.Errorf("invalid top_p: %g (must be between 0 and 1)", *r.TopP)
+	}
+	if r.TopK != nil && (*r.TopK < 0 || *r.TopK > MaxTopK) {
+		return fmt.Errorf("invalid top_k: %d (must be between 0 and %d)", *r.TopK, MaxTopK)
+	}
+	if r.FrequencyPenalty != nil && (*r.FrequencyPenalty < -MaxPenalty || *r.FrequencyPenalty > MaxPenalty) {
+		return fmt.Errorf("invalid frequency_penalty: %g (must be between %g and %g)", *r.FrequencyPenalty, -MaxPenalty, MaxPenalty)
+	}
+	if r.PresencePenalty != nil && (*r.PresencePenalty < -MaxPenalty || *r.PresencePenalty > MaxPenalty) {
+		return fmt.Errorf("invalid presence_penalty: %g (must be between %g and %g)", *r.PresencePenalty, -MaxPenalty, MaxPenalty)
+	}
 	return nil
 }
 
@@ -39,6 +290,27 @@ type SearchResult struct {
 	Citations []Citation `json:"citations,omitempty"`
 	Sources   []Source   `json:"sources,omitempty"`
 	Created   time.Time  `json:"created"`
+	SessionID string     `json:"session_id,omitempty"`
+	// CitationMap maps the citation numbers returned by the API to their number
+	// after duplicates were merged, for the numbers that changed
+	CitationMap map[int]int `json:"citation_map,omitempty"`
+	// Reasoning is the <think> trace of reasoning models, kept out of Content
+	Reasoning string `json:"reasoning,omitempty"`
+	// RequestedModel is the model asked for when a fallback model answered instead
+	RequestedModel string `json:"requested_model,omitempty"`
+	// Annotations holds human feedback recorded with perplexity_annotate
+	Annotations []Annotation `json:"annotations,omitempty"`
+	// Stale marks a cached answer returned because the API was unavailable; it is never stored
+	Stale bool `json:"stale,omitempty"`
+	// Truncation marks a returned answer cut short by max_response_chars; it is never stored
+	Truncation *Truncation `json:"truncation,omitempty"`
+	// QueryRewrite holds the query searched in place of the one asked, with rewrite_query
+	QueryRewrite *QueryRewrite `json:"query_rewrite,omitempty"`
+	// Images are returned with return_images
+	Images []Image `json:"images,omitempty"`
+	// Owner is the identity of the HTTP client whose call produced the result,
+	// which alone may read it (empty over stdio)
+	Owner string `json:"owner,omitempty"`
 }
 
 type Usage struct {
@@ -51,6 +323,16 @@ type Citation struct {
 	Number int    `json:"number"`
 	URL    string `json:"url"`
 	Title  string `json:"title"`
+	// OriginalURL is the URL as returned by the API when normalization changed it
+	OriginalURL string `json:"original_url,omitempty"`
+	// Reachable and Status are set when the link was checked with verify_citations;
+	// Status is 0 when the link could not be fetched at all
+	Reachable *bool `json:"reachable,omitempty"`
+	Status    int   `json:"status,omitempty"`
+	// DOI and ArXivID identify the paper a citation links to, when requested
+	// and found in its URL
+	DOI     string `json:"doi,omitempty"`
+	ArXivID string `json:"arxiv_id,omitempty"`
 }
 
 type Source struct {
@@ -59,6 +341,14 @@ type Source struct {
 	Snippet string `json:"snippet"`
 }
 
+// RateLimitStatus is the upstream rate-limit headroom reported by the most recent API response
+type RateLimitStatus struct {
+	Limit            int       `json:"limit"`
+	Remaining        int       `json:"remaining"`
+	RemainingPercent float64   `json:"remaining_percent"`
+	UpdatedAt        time.Time `json:"updated_at"`
+}
+
 // MCP-related types
 type ToolInfo struct {
 	Name        string         `json:"name"`
@@ -80,16 +370,28 @@ type APIMessage struct {
 }
 
 type APIChatRequest struct {
-	Model              string       `json:"model"`
-	Messages           []APIMessage `json:"messages"`
-	MaxTokens          *int         `json:"max_tokens,omitempty"`
-	Temperature        *float64     `json:"temperature,omitempty"`
-	TopP               *float64     `json:"top_p,omitempty"`
-	Stream             bool         `json:"stream"`
-	SearchMode         string       `json:"search_mode,omitempty"`
-	SearchDomainFilter []string     `json:"search_domain_filter,omitempty"`
-	DisableSearch      *bool        `json:"disable_search,omitempty"`
-	ReasoningEffort    string       `json:"reasoning_effort,omitempty"`
+	Model               string               `json:"model"`
+	Messages            []APIMessage         `json:"messages"`
+	MaxTokens           *int                 `json:"max_tokens,omitempty"`
+	Temperature         *float64             `json:"temperature,omitempty"`
+	TopP                *float64             `json:"top_p,omitempty"`
+	TopK                *int                 `json:"top_k,omitempty"`
+	FrequencyPenalty    *float64             `json:"frequency_penalty,omitempty"`
+	PresencePenalty     *float64             `json:"presence_penalty,omitempty"`
+	Stream              bool                 `json:"stream"`
+	SearchMode          string               `json:"search_mode,omitempty"`
+	SearchDomainFilter  []string             `json:"search_domain_filter,omitempty"`
+	SearchRecencyFilter string               `json:"search_recency_filter,omitempty"`
+	DisableSearch       *bool                `json:"disable_search,omitempty"`
+	ReasoningEffort     string               `json:"reasoning_effort,omitempty"`
+	WebSearchOptions    *APIWebSearchOptions `json:"web_search_options,omitempty"`
+	ReturnImages        bool                 `json:"return_images,omitempty"`
+	ImageDomainFilter   []string             `json:"image_domain_filter,omitempty"`
+	ImageFormatFilter   []string             `json:"image_format_filter,omitempty"`
+}
+
+type APIWebSearchOptions struct {
+	UserLocation *UserLocation `json:"user_location,omitempty"`
 }
 
 type APIChoice struct {
@@ -113,6 +415,9 @@ type APIChatResponse struct {
 	Usage     APIUsage        `json:"usage"`
 	Citations json.RawMessage `json:"citations,omitempty"`
 	Sources   []Source        `json:"sources,omitempty"`
+	// SearchResults are the ranked pages the answer was grounded on
+	SearchResults []Source `json:"search_results,omitempty"`
+	Images        []Image  `json:"images,omitempty"`
 }
 
 func (r *APIChatResponse) GetContent() string {
@@ -0,0 +1,390 @@
+package internal
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"math"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/mark3labs/mcp-go/mcp"
+)
+
+// UsageURI is the resource URI of the token and cost usage summary
+const UsageURI = "perplexity://usage"
+
+// Bounds on the usage breakdowns kept in memory
+const (
+	MaxUsageSessions = 1000
+	MaxUsageDays     = 90
+)
+
+// ModelPrice is the price of one model in US dollars
+type ModelPrice struct {
+	InputPerMillion  float64 `json:"input_per_million" yaml:"input_per_million"`
+	OutputPerMillion float64 `json:"output_per_million" yaml:"output_per_million"`
+	PerRequest       float64 `json:"per_request" yaml:"per_request"`
+}
+
+// DefaultModelPrices are list prices used for cost estimates unless overridden
+// in the config file. Request fees assume low search context.
+var DefaultModelPrices = map[string]ModelPrice{
+	"sonar":               {InputPerMillion: 1, OutputPerMillion: 1, PerRequest: 0.005},
+	"sonar-pro":           {InputPerMillion: 3, OutputPerMillion: 15, PerRequest: 0.006},
+	"sonar-reasoning":     {InputPerMillion: 1, OutputPerMillion: 5, PerRequest: 0.005},
+	"sonar-reasoning-pro": {InputPerMillion: 2, OutputPerMillion: 8, PerRequest: 0.006},
+	"sonar-deep-research": {InputPerMillion: 2, OutputPerMillion: 8, PerRequest: 0.005},
+}
+
+// Cost estimates the dollar cost of one request with usage
+func (p ModelPrice) Cost(usage Usage) float64 {
+	return float64(usage.PromptTokens)*p.InputPerMillion/1e6 +
+		float64(usage.CompletionTokens)*p.OutputPerMillion/1e6 +
+		p.PerRequest
+}
+
+// usageMeta sets the _meta fields describing the API calls behind a tool
+// result: their added up usage, estimated cost_usd including query rewrites,
+// the model of the last answer, and whether the answer is cached rather than
+// fresh. calls may contain nil entries for failed calls.
+func usageMeta(fields map[string]any, prices map[string]ModelPrice, calls []*SearchResult) {
+	var total Usage
+	cost, cached := 0.0, false
+	for _, call := range calls {
+		if call == nil {
+			continue
+		}
+		fields["model"] = call.Model
+		// A stale answer was served from the result store without an API call
+		if call.Stale {
+			cached = true
+			continue
+		}
+		total = addUsage(total, call.Usage)
+		cost += prices[call.Model].Cost(call.Usage)
+		if rewrite := call.QueryRewrite; rewrite != nil {
+			total = addUsage(total, rewrite.Usage)
+			cost += prices[rewrite.Model].Cost(rewrite.Usage)
+		}
+	}
+	fields["usage"] = total
+	// Rounded to millionths of a dollar, the precision of the list prices
+	fields["cost_usd"] = math.Round(cost*1e6) / 1e6
+	fields["cached"] = cached
+}
+
+// UsageTotals accumulates token counts and estimated cost
+type UsageTotals struct {
+	Calls            int64   `json:"calls"`
+	PromptTokens     int64   `json:"prompt_tokens"`
+	CompletionTokens int64   `json:"completion_tokens"`
+	TotalTokens      int64   `json:"total_tokens"`
+	CostUSD          float64 `json:"cost_usd"`
+}
+
+func (t *UsageTotals) add(usage Usage, cost float64) {
+	t.Calls++
+	t.PromptTokens += int64(usage.PromptTokens)
+	t.CompletionTokens += int64(usage.CompletionTokens)
+	t.TotalTokens += int64(usage.TotalTokens)
+	t.CostUSD += cost
+}
+
+// UsageSummary is the point-in-time usage view exposed to operators
+type UsageSummary struct {
+	Since     time.Time              `json:"since"`
+	Total     UsageTotals            `json:"total"`
+	ByModel   map[string]UsageTotals `json:"by_model"`
+	ByTool    map[string]UsageTotals `json:"by_tool"`
+	BySession map[string]UsageTotals `json:"by_session"`
+	ByDay     map[string]UsageTotals `json:"by_day"`
+}
+
+// UsageTracker attributes the tokens and estimated cost of every answered API
+// call to its model, tool, session and UTC day. Session and day breakdowns are
+// bounded; the oldest entries are dropped first. Only the daily totals, which
+// budgets are checked against, are persisted.
+type UsageTracker struct {
+	mu        sync.Mutex
+	total     UsageTotals
+	byModel   map[string]*UsageTotals
+	byTool    map[string]*UsageTotals
+	bySession map[string]*UsageTotals
+	sessions  []string
+	byDay     map[string]*UsageTotals
+	days      []string
+	started   time.Time
+	storage   *Storage
+}
+
+func NewUsageTracker() *UsageTracker {
+	return &UsageTracker{
+		byModel:   make(map[string]*UsageTotals),
+		byTool:    make(map[string]*UsageTotals),
+		bySession: make(map[string]*UsageTotals),
+		byDay:     make(map[string]*UsageTotals),
+		started:   time.Now(),
+	}
+}
+
+// UseStorage restores the daily totals from storage and persists every later
+// change, so daily and monthly budgets hold across restarts
+func (u *UsageTracker) UseStorage(storage *Storage) error {
+	days, err := storage.loadUsageDays()
+	if err != nil {
+		return err
+	}
+
+	u.mu.Lock()
+	defer u.mu.Unlock()
+
+	u.storage = storage
+	for day, totals := range days {
+		if entry, ok := u.byDay[day]; ok {
+			entry.Calls += totals.Calls
+			entry.PromptTokens += totals.PromptTokens
+			entry.CompletionTokens += totals.CompletionTokens
+			entry.TotalTokens += totals.TotalTokens
+			entry.CostUSD += totals.CostUSD
+			continue
+		}
+		u.byDay[day] = &totals
+		u.days = append(u.days, day)
+	}
+	// Days are ISO dates, so they sort chronologically
+	slices.Sort(u.days)
+	for len(u.days) > MaxUsageDays {
+		u.removeDay(u.days[0])
+	}
+	return nil
+}
+
+// removeDay drops the oldest day from memory and storage. Callers must hold u.mu.
+func (u *UsageTracker) removeDay(day string) {
+	delete(u.byDay, day)
+	u.days = u.days[1:]
+	if u.storage != nil {
+		if err := u.storage.deleteUsageDay(day); err != nil {
+			u.storage.logger.Warn("Failed to delete usage", "day", day, "error", err)
+		}
+	}
+}
+
+// Record adds the usage of result, answered for tool within sessionID (may be
+// empty), priced with prices
+func (u *UsageTracker) Record(prices map[string]ModelPrice, tool, sessionID string, result *SearchResult) {
+	if result == nil {
+		return
+	}
+	cost := prices[result.Model].Cost(result.Usage)
+	day := time.Now().UTC().Format(time.DateOnly)
+
+	u.mu.Lock()
+	defer u.mu.Unlock()
+
+	u.total.add(result.Usage, cost)
+	usageEntry(u.byModel, result.Model).add(result.Usage, cost)
+	usageEntry(u.byTool, tool).add(result.Usage, cost)
+
+	if sessionID != "" {
+		if _, ok := u.bySession[sessionID]; !ok {
+			u.sessions = append(u.sessions, sessionID)
+			if len(u.sessions) > MaxUsageSessions {
+				delete(u.bySession, u.sessions[0])
+				u.sessions = u.sessions[1:]
+			}
+		}
+		usageEntry(u.bySession, sessionID).add(result.Usage, cost)
+	}
+
+	if _, ok := u.byDay[day]; !ok {
+		u.days = append(u.days, day)
+		if len(u.days) > MaxUsageDays {
+			u.removeDay(u.days[0])
+		}
+	}
+	entry := usageEntry(u.byDay, day)
+	entry.add(result.Usage, cost)
+	if u.storage != nil {
+		if err := u.storage.saveUsageDay(day, *entry); err != nil {
+			u.storage.logger.Warn("Failed to persist usage", "day", day, "error", err)
+		}
+	}
+}
+
+func usageEntry(totals map[string]*UsageTotals, key string) *UsageTotals {
+	entry, ok := totals[key]
+	if !ok {
+		entry = &UsageTotals{}
+		totals[key] = entry
+	}
+	return entry
+}
+
+// Summary returns a copy of the accumulated usage
+func (u *UsageTracker) Summary() UsageSummary {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+
+	return UsageSummary{
+		Since:     u.started,
+		Total:     u.total,
+		ByModel:   copyUsage(u.byModel),
+		ByTool:    copyUsage(u.byTool),
+		BySession: copyUsage(u.bySession),
+		ByDay:     copyUsage(u.byDay),
+	}
+}
+
+func copyUsage(totals map[string]*UsageTotals) map[string]UsageTotals {
+	copied := make(map[string]UsageTotals, len(totals))
+	for key, entry := range totals {
+		copied[key] = *entry
+	}
+	return copied
+}
+
+// CurrentPeriods returns the usage of the UTC day and month containing now
+func (u *UsageTracker) CurrentPeriods(now time.Time) (day, month UsageTotals) {
+	today := now.UTC().Format(time.DateOnly)
+	thisMonth := today[:len("2006-01")]
+
+	u.mu.Lock()
+	defer u.mu.Unlock()
+
+	for key, entry := range u.byDay {
+		if key == today {
+			day = *entry
+		}
+		if strings.HasPrefix(key, thisMonth) {
+			month.Calls += entry.Calls
+			month.PromptTokens += entry.PromptTokens
+			month.CompletionTokens += entry.CompletionTokens
+			month.TotalTokens += entry.TotalTokens
+			month.CostUSD += entry.CostUSD
+		}
+	}
+	return day, month
+}
+
+// Session returns the usage accumulated by sessionID
+func (u *UsageTracker) Session(sessionID string) (UsageTotals, bool) {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+
+	entry, ok := u.bySession[sessionID]
+	if !ok {
+		return UsageTotals{}, false
+	}
+	return *entry, true
+}
+
+// CreateUsageTool creates the perplexity_usage tool for use with mcp-go
+func CreateUsageTool() mcp.Tool {
+	return mcp.Tool{
+		Name:        "perplexity_usage",
+		Description: "Report token usage and estimated cost accumulated by this server, broken down by model and tool, with call counts and the result cache hit rate. Pass a session_id to include that session's usage.",
+		InputSchema: mcp.ToolInputSchema{
+			Type: "object",
+			Properties: map[string]any{
+				"session_id": map[string]any{
+					"type":        "string",
+					"description": "Session to report usage for (optional)",
+					"pattern":     "^[A-Za-z0-9._-]{1,128}$",
+				},
+			},
+		},
+		OutputSchema: usageOutputSchema(),
+	}
+}
+
+// UsageHandler creates the handler function for the perplexity_usage tool
+func UsageHandler(usage *UsageTracker, results *ResultStore) func(ctx context.Context, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+	return func(ctx context.Context, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+		content, data, err := usageReport(usage, results, request)
+		if err != nil {
+			return &mcp.CallToolResult{
+				Content: []mcp.Content{
+					mcp.TextContent{
+						Type: "text",
+						Text: fmt.Sprintf("Failed to report usage: %s", err.Error()),
+					},
+				},
+				IsError: true,
+			}, err
+		}
+
+		return &mcp.CallToolResult{
+			Content: []mcp.Content{
+				mcp.TextContent{
+					Type: "text",
+					Text: content,
+				},
+			},
+			StructuredContent: data,
+			IsError:           false,
+		}, nil
+	}
+}
+
+func usageReport(usage *UsageTracker, results *ResultStore, request mcp.CallToolRequest) (string, map[string]any, error) {
+	summary := usage.Summary()
+	response := map[string]any{
+		"server": map[string]any{
+			"since":    summary.Since,
+			"total":    summary.Total,
+			"by_model": summary.ByModel,
+			"by_tool":  summary.ByTool,
+		},
+		"result_cache": results.CacheStats(),
+	}
+
+	if sessionID := request.GetString("session_id", ""); sessionID != "" {
+		if err := validateSessionID(sessionID); err != nil {
+			return "", nil, err
+		}
+		// A session without answered calls yet reports zero usage
+		totals, _ := usage.Session(sessionID)
+		response["session"] = map[string]any{
+			"session_id": sessionID,
+			"total":      totals,
+		}
+	}
+
+	jsonBytes, err := json.MarshalIndent(response, "", "  ")
+	if err != nil {
+		return "", nil, fmt.Errorf("failed to marshal usage report: %w", err)
+	}
+	return string(jsonBytes), response, nil
+}
+
+// CreateUsageResource creates the perplexity://usage resource
+func CreateUsageResource() mcp.Resource {
+	return mcp.NewResource(
+		UsageURI,
+		"Usage and cost",
+		mcp.WithResourceDescription("Token usage and estimated cost by model, tool, session and day"),
+		mcp.WithMIMEType("application/json"),
+	)
+}
+
+// UsageResourceHandler creates the resources/read handler for the usage summary
+func UsageResourceHandler(usage *UsageTracker) func(ctx context.Context, request mcp.ReadResourceRequest) ([]mcp.ResourceContents, error) {
+	return func(ctx context.Context, request mcp.ReadResourceRequest) ([]mcp.ResourceContents, error) {
+		jsonBytes, err := json.MarshalIndent(usage.Summary(), "", "  ")
+		if err != nil {
+			return nil, fmt.Errorf("failed to marshal usage summary: %w", err)
+		}
+
+		return []mcp.ResourceContents{
+			mcp.TextResourceContents{
+				URI:      request.Params.URI,
+				MIMEType: "application/json",
+				Text:     string(jsonBytes),
+			},
+		}, nil
+	}
+}
@@ -0,0 +1,65 @@
+package internal
+
+import (
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestUsageTrackerPersistsDailyTotals(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "history.db")
+	prices := map[string]ModelPrice{"sonar": {InputPerMillion: 1, OutputPerMillion: 1}}
+	result := &SearchResult{Model: "sonar", Usage: Usage{PromptTokens: 400000, CompletionTokens: 600000, TotalTokens: 1000000}}
+
+	storage, err := OpenStorage(path)
+	require.NoError(t, err)
+	usage := NewUsageTracker()
+	require.NoError(t, usage.UseStorage(storage))
+	usage.Record(prices, "perplexity_search", "", result)
+	usage.Record(prices, "perplexity_search", "", result)
+	require.NoError(t, storage.Close())
+
+	// A restarted server still sees the day's spend, and its hard budget
+	storage, err = OpenStorage(path)
+	require.NoError(t, err)
+	defer func() { _ = storage.Close() }()
+	restarted := NewUsageTracker()
+	require.NoError(t, restarted.UseStorage(storage))
+
+	day, month := restarted.CurrentPeriods(time.Now())
+	require.Equal(t, int64(2), day.Calls)
+	require.Equal(t, int64(2000000), day.TotalTokens)
+	require.InDelta(t, 2.0, day.CostUSD, 1e-9)
+	require.Equal(t, day, month)
+
+	budgets := Budgets{DailyUSD: BudgetLimit{Hard: 1.5}}
+	_, err = budgets.Check(restarted)
+	require.ErrorIs(t, err, ErrBudgetExceeded)
+
+	restarted.Record(prices, "perplexity_search", "", result)
+	day, _ = restarted.CurrentPeriods(time.Now())
+	require.Equal(t, int64(3), day.Calls)
+}
+
+func TestUsageTrackerDropsDaysBeyondLimit(t *testing.T) {
+	storage, err := OpenStorage(filepath.Join(t.TempDir(), "history.db"))
+	require.NoError(t, err)
+	defer func() { _ = storage.Close() }()
+
+	start := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	for i := range MaxUsageDays + 5 {
+		day := start.AddDate(0, 0, i).Format(time.DateOnly)
+		require.NoError(t, storage.saveUsageDay(day, UsageTotals{Calls: 1}))
+	}
+
+	usage := NewUsageTracker()
+	require.NoError(t, usage.UseStorage(storage))
+	require.Len(t, usage.Summary().ByDay, MaxUsageDays)
+	require.NotContains(t, usage.Summary().ByDay, "2024-01-01")
+
+	days, err := storage.loadUsageDays()
+	require.NoError(t, err)
+	require.Len(t, days, MaxUsageDays)
+}
@@ -0,0 +1,286 @@
+package internal
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Vault authentication methods
+const (
+	VaultAuthToken      = "token"
+	VaultAuthKubernetes = "kubernetes"
+)
+
+// Vault defaults used when not configured
+const (
+	DefaultVaultSecretField         = "api_key"
+	DefaultVaultKubernetesMount     = "kubernetes"
+	DefaultVaultKubernetesTokenPath = "/var/run/secrets/kubernetes.io/serviceaccount/token"
+	maxVaultResponseSize            = 1024 * 1024
+)
+
+// VaultConfig locates the API key in HashiCorp Vault and says how to authenticate
+type VaultConfig struct {
+	Addr      string
+	Token     string
+	Namespace string
+	// SecretPath is the API path of the secret, e.g. "secret/data/perplexity" for KV v2
+	SecretPath          string
+	SecretField         string
+	AuthMethod          string
+	KubernetesRole      string
+	KubernetesMount     string
+	KubernetesTokenPath string
+}
+
+// VaultSecretProvider reads the API key from a Vault KV secret. Its token is
+// renewed once half of its TTL has passed; Kubernetes auth logs in again when
+// renewal is not possible.
+type VaultSecretProvider struct {
+	config     VaultConfig
+	httpClient *http.Client
+
+	mu          sync.Mutex
+	token       string
+	renewable   bool
+	issued      time.Time
+	ttl         time.Duration
+	lookedUpTTL bool
+}
+
+// vaultResponse is the common envelope of Vault API responses
+type vaultResponse struct {
+	Data json.RawMessage `json:"data"`
+	Auth *struct {
+		ClientToken   string `json:"client_token"`
+		LeaseDuration int    `json:"lease_duration"`
+		Renewable     bool   `json:"renewable"`
+	} `json:"auth"`
+	Errors []string `json:"errors"`
+}
+
+func NewVaultSecretProvider(config VaultConfig) (*VaultSecretProvider, error) {
+	if config.Addr == "" {
+		return nil, fmt.Errorf("VAULT_ADDR is required for the Vault secret provider")
+	}
+	if config.SecretField == "" {
+		config.SecretField = DefaultVaultSecretField
+	}
+	if config.KubernetesMount == "" {
+		config.KubernetesMount = DefaultVaultKubernetesMount
+	}
+	if config.KubernetesTokenPath == "" {
+		config.KubernetesTokenPath = DefaultVaultKubernetesTokenPath
+	}
+
+	switch config.AuthMethod {
+	case VaultAuthToken:
+		if config.Token == "" {
+			return nil, fmt.Errorf("VAULT_TOKEN is required for Vault token auth")
+		}
+	case VaultAuthKubernetes:
+		if config.KubernetesRole == "" {
+			return nil, fmt.Errorf("VAULT_K8S_ROLE is required for Vault Kubernetes auth")
+		}
+	default:
+		return nil, fmt.Errorf("invalid Vault auth method %q: must be %q or %q", config.AuthMethod, VaultAuthToken, VaultAuthKubernetes)
+	}
+
+	p := &VaultSecretProvider{
+		config:     config,
+		httpClient: &http.Client{Timeout: secretFetchTimeout},
+		issued:     time.Now(),
+	}
+	if config.AuthMethod == VaultAuthToken {
+		p.token = config.Token
+	}
+	return p, nil
+}
+
+// APIKey reads the configured field of the secret, authenticating or renewing first if needed.
+// KV v2 responses nest the fields under data.data; KV v1 responses use data directly.
+func (p *VaultSecretProvider) APIKey(ctx context.Context) (string, error) {
+	token, err := p.ensureToken(ctx)
+	if err != nil {
+		return "", err
+	}
+
+	resp, err := p.do(ctx, http.MethodGet, p.config.SecretPath, token, nil)
+	if err != nil {
+		return "", err
+	}
+
+	var data map[string]any
+	if err := json.Unmarshal(resp.Data, &data); err != nil {
+		return "", fmt.Errorf("failed to parse Vault secret: %w", err)
+	}
+	if nested, ok := data["data"].(map[string]any); ok {
+		data = nested
+	}
+	value, ok := data[p.config.SecretField].(string)
+	if !ok {
+		return "", fmt.Errorf("Vault secret %s has no string field %q", p.config.SecretPath, p.config.SecretField)
+	}
+	return strings.TrimSpace(value), nil
+}
+
+func (p *VaultSecretProvider) Source() string {
+	return "vault:" + p.config.SecretPath
+}
+
+// ensureToken returns a usable token, logging in or renewing the current one as needed
+func (p *VaultSecretProvider) ensureToken(ctx context.Context) (string, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	switch {
+	case p.config.AuthMethod == VaultAuthKubernetes && p.token == "":
+		if err := p.login(ctx); err != nil {
+			return "", err
+		}
+	case p.config.AuthMethod == VaultAuthToken && !p.lookedUpTTL:
+		// Learn the TTL of a supplied token once so it can be renewed in time
+		if err := p.lookupSelf(ctx); err != nil {
+			return "", err
+		}
+		p.lookedUpTTL = true
+	}
+
+	if p.ttl > 0 && time.Since(p.issued) >= p.ttl/2 {
+		if err := p.refreshToken(ctx); err != nil {
+			return "", err
+		}
+	}
+	return p.token, nil
+}
+
+// refreshToken renews the token lease, falling back to a fresh Kubernetes login.
+// A non-renewable supplied token is used until it expires. Callers must hold p.mu.
+func (p *VaultSecretProvider) refreshToken(ctx context.Context) error {
+	if p.renewable {
+		err := p.renewSelf(ctx)
+		if err == nil || p.config.AuthMethod == VaultAuthToken {
+			return err
+		}
+	}
+	if p.config.AuthMethod == VaultAuthKubernetes {
+		return p.login(ctx)
+	}
+	return nil
+}
+
+// login authenticates with the pod's service account token
+func (p *VaultSecretProvider) login(ctx context.Context) error {
+	jwt, err := os.ReadFile(p.config.KubernetesTokenPath)
+	if err != nil {
+		return fmt.Errorf("failed to read Kubernetes service account token: %w", err)
+	}
+
+	resp, err := p.do(ctx, http.MethodPost, "auth/"+p.config.KubernetesMount+"/login", "", map[string]string{
+		"role": p.config.KubernetesRole,
+		"jwt":  strings.TrimSpace(string(jwt)),
+	})
+	if err != nil {
+		return fmt.Errorf("Vault Kubernetes login failed: %w", err)
+	}
+	return p.useAuth(resp)
+}
+
+func (p *VaultSecretProvider) renewSelf(ctx context.Context) error {
+	resp, err := p.do(ctx, http.MethodPost, "auth/token/renew-self", p.token, map[string]string{})
+	if err != nil {
+		return fmt.Errorf("Vault token renewal failed: %w", err)
+	}
+	return p.useAuth(resp)
+}
+
+func (p *VaultSecretProvider) lookupSelf(ctx context.Context) error {
+	resp, err := p.do(ctx, http.MethodGet, "auth/token/lookup-self", p.token, nil)
+	if err != nil {
+		return fmt.Errorf("Vault token lookup failed: %w", err)
+	}
+
+	var data struct {
+		TTL       int  `json:"ttl"`
+		Renewable bool `json:"renewable"`
+	}
+	if err := json.Unmarshal(resp.Data, &data); err != nil {
+		return fmt.Errorf("failed to parse Vault token lookup: %w", err)
+	}
+	p.ttl = time.Duration(data.TTL) * time.Second
+	p.renewable = data.Renewable
+	p.issued = time.Now()
+	return nil
+}
+
+// useAuth records the token returned by a login or renewal. Callers must hold p.mu.
+func (p *VaultSecretProvider) useAuth(resp *vaultResponse) error {
+	if resp.Auth == nil || resp.Auth.ClientToken == "" {
+		return fmt.Errorf("Vault response contained no token")
+	}
+	p.token = resp.Auth.ClientToken
+	p.ttl = time.Duration(resp.Auth.LeaseDuration) * time.Second
+	p.renewable = resp.Auth.Renewable
+	p.issued = time.Now()
+	return nil
+}
+
+// do calls the Vault HTTP API at /v1/path
+func (p *VaultSecretProvider) do(ctx context.Context, method, path, token string, body any) (*vaultResponse, error) {
+	var reqBody io.Reader
+	if body != nil {
+		data, err := json.Marshal(body)
+		if err != nil {
+			return nil, fmt.Errorf("failed to marshal Vault request: %w", err)
+		}
+		reqBody = bytes.NewReader(data)
+	}
+
+	url := strings.TrimRight(p.config.Addr, "/") + "/v1/" + strings.TrimLeft(path, "/")
+	httpReq, err := http.NewRequestWithContext(ctx, method, url, reqBody)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create Vault request: %w", err)
+	}
+	if token != "" {
+		httpReq.Header.Set("X-Vault-Token", token)
+	}
+	if p.config.Namespace != "" {
+		httpReq.Header.Set("X-Vault-Namespace", p.config.Namespace)
+	}
+	if body != nil {
+		httpReq.Header.Set("Content-Type", "application/json")
+	}
+
+	resp, err := p.httpClient.Do(httpReq)
+	if err != nil {
+		return nil, fmt.Errorf("Vault request failed: %w", err)
+	}
+	defer resp.Body.Close()
+
+	respBody, err := io.ReadAll(io.LimitReader(resp.Body, maxVaultResponseSize))
+	if err != nil {
+		return nil, fmt.Errorf("failed to read Vault response: %w", err)
+	}
+
+	var vaultResp vaultResponse
+	if len(respBody) > 0 {
+		if err := json.Unmarshal(respBody, &vaultResp); err != nil {
+			return nil, fmt.Errorf("failed to parse Vault response: %w", err)
+		}
+	}
+	if resp.StatusCode != http.StatusOK {
+		if len(vaultResp.Errors) > 0 {
+			return nil, fmt.Errorf("Vault returned %d: %s", resp.StatusCode, strings.Join(vaultResp.Errors, "; "))
+		}
+		return nil, fmt.Errorf("Vault returned %d", resp.StatusCode)
+	}
+	return &vaultResp, nil
+}
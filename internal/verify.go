@@ -0,0 +1,76 @@
+package internal
+
+import (
+	"context"
+	"net/http"
+	"net/url"
+	"sync"
+	"time"
+)
+
+// Limits of citation link checks, kept small so verification adds seconds at most
+const (
+	citationCheckTimeout     = 5 * time.Second
+	citationCheckConcurrency = 4
+)
+
+// VerifyCitations checks that each citation URL still resolves and returns the
+// citations annotated with Reachable and the HTTP status. Links are checked
+// with HEAD requests, falling back to GET for servers that refuse HEAD, at most
+// citationCheckConcurrency at a time through the client's proxy settings.
+func (c *PerplexityClient) VerifyCitations(ctx context.Context, citations []Citation) []Citation {
+	checker := &http.Client{
+		Transport: c.httpClient.Transport,
+		Timeout:   citationCheckTimeout,
+	}
+
+	verified := make([]Citation, len(citations))
+	copy(verified, citations)
+
+	var wg sync.WaitGroup
+	slots := make(chan struct{}, citationCheckConcurrency)
+	for i := range verified {
+		wg.Add(1)
+		go func(citation *Citation) {
+			defer wg.Done()
+			slots <- struct{}{}
+			defer func() { <-slots }()
+
+			status := checkLink(ctx, checker, citation.URL)
+			reachable := status > 0 && status < http.StatusBadRequest
+			citation.Reachable = &reachable
+			citation.Status = status
+		}(&verified[i])
+	}
+	wg.Wait()
+
+	return verified
+}
+
+// checkLink returns the final HTTP status of rawURL, or 0 when it could not be
+// fetched at all
+func checkLink(ctx context.Context, client *http.Client, rawURL string) int {
+	u, err := url.Parse(rawURL)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") {
+		return 0
+	}
+
+	status := 0
+	for _, method := range []string{http.MethodHead, http.MethodGet} {
+		req, err := http.NewRequestWithContext(ctx, method, rawURL, nil)
+		if err != nil {
+			return 0
+		}
+		resp, err := client.Do(req)
+		if err != nil {
+			return 0
+		}
+		resp.Body.Close()
+
+		status = resp.StatusCode
+		if status != http.StatusMethodNotAllowed && status != http.StatusNotImplemented {
+			break
+		}
+	}
+	return status
+}
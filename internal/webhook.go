@@ -0,0 +1,195 @@
+package internal
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net"
+	"net/http"
+	"net/netip"
+	"net/url"
+	"slices"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/passingbreeze-bonfire/perplexity-mcp-golang/pkg/signing"
+)
+
+// Limits of webhook deliveries. A failed delivery is retried after
+// webhookRetryDelay, doubling for each further attempt.
+const (
+	webhookAttempts   = 5
+	webhookRetryDelay = time.Second
+	webhookTimeout    = 10 * time.Second
+)
+
+// MaxCallbackURLLength bounds the callback_url of research jobs
+const MaxCallbackURLLength = 2048
+
+// WebhookConfig configures the callbacks sent when research jobs finish
+type WebhookConfig struct {
+	// Secret signs every delivery; callbacks are refused while it is empty
+	Secret string
+	// AllowedHosts are the hosts callback URLs may go to; callbacks are
+	// refused while it is empty
+	AllowedHosts []string
+	// AllowPrivateNetworks lets callbacks connect to loopback and private
+	// addresses, for receivers inside the server's network
+	AllowPrivateNetworks bool
+}
+
+// CheckURL returns an error if raw may not be used as a callback URL
+func (w WebhookConfig) CheckURL(raw string) error {
+	if w.Secret == "" {
+		return fmt.Errorf("callback_url requires WEBHOOK_SECRET to be set on the server")
+	}
+	if len(raw) > MaxCallbackURLLength {
+		return fmt.Errorf("callback_url too long: %d > %d", len(raw), MaxCallbackURLLength)
+	}
+	u, err := url.Parse(raw)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return fmt.Errorf("invalid callback_url: must be an absolute http or https URL")
+	}
+	allowed := func(host string) bool { return strings.EqualFold(host, u.Hostname()) }
+	if len(w.AllowedHosts) == 0 {
+		return fmt.Errorf("callback_url requires WEBHOOK_ALLOWED_HOSTS to be set on the server")
+	}
+	if !slices.ContainsFunc(w.AllowedHosts, allowed) {
+		return fmt.Errorf("callback_url host %s is not allowed", u.Hostname())
+	}
+	return nil
+}
+
+// webhookPayload is the body POSTed to a job's callback URL
+type webhookPayload struct {
+	// Event is job.completed, job.failed or job.cancelled
+	Event string         `json:"event"`
+	Job   map[string]any `json:"job"`
+}
+
+// WebhookSender POSTs finished research jobs to their callback URL, signed with
+// pkg/signing so receivers can verify them. The secret is read from the live
+// configuration at each attempt, so a reload rotates it.
+type WebhookSender struct {
+	live   *LiveConfig
+	client *http.Client
+	logger *slog.Logger
+}
+
+func NewWebhookSender(live *LiveConfig) *WebhookSender {
+	return &WebhookSender{
+		live: live,
+		client: &http.Client{
+			Timeout: webhookTimeout,
+			// Check the address actually dialed, so an allowed host whose DNS
+			// later points inside the network cannot be used to reach it
+			Transport: &http.Transport{
+				DialContext:         (&net.Dialer{Timeout: webhookTimeout, Control: webhookDialControl(live)}).DialContext,
+				TLSHandshakeTimeout: webhookTimeout,
+			},
+			// A redirect could lead past WEBHOOK_ALLOWED_HOSTS
+			CheckRedirect: func(*http.Request, []*http.Request) error {
+				return http.ErrUseLastResponse
+			},
+		},
+		logger: slog.Default().With("component", "webhook"),
+	}
+}
+
+// errCallbackAddressBlocked fails deliveries to addresses webhookDialControl refuses
+var errCallbackAddressBlocked = errors.New("callback address is not allowed")
+
+// webhookDialControl refuses connections to link-local addresses, such as
+// cloud metadata endpoints, and unless AllowPrivateNetworks is set to loopback
+// and private addresses
+func webhookDialControl(live *LiveConfig) func(network, address string, conn syscall.RawConn) error {
+	return func(network, address string, conn syscall.RawConn) error {
+		host, _, err := net.SplitHostPort(address)
+		if err != nil {
+			return err
+		}
+		ip, err := netip.ParseAddr(host)
+		if err != nil {
+			return fmt.Errorf("invalid callback address %s", address)
+		}
+		ip = ip.Unmap()
+		if ip.IsLinkLocalUnicast() || ip.IsLinkLocalMulticast() || ip.IsInterfaceLocalMulticast() || ip.IsMulticast() || ip.IsUnspecified() {
+			return fmt.Errorf("%w: %s", errCallbackAddressBlocked, ip)
+		}
+		if (ip.IsLoopback() || ip.IsPrivate()) && !live.Get().Webhooks.AllowPrivateNetworks {
+			return fmt.Errorf("%w: %s is private, see WEBHOOK_ALLOW_PRIVATE_NETWORKS", errCallbackAddressBlocked, ip)
+		}
+		return nil
+	}
+}
+
+// Deliver sends job to its callback URL in the background, if it has one
+func (s *WebhookSender) Deliver(job Job) {
+	if job.CallbackURL == "" {
+		return
+	}
+	body, err := json.Marshal(webhookPayload{Event: "job." + job.Status, Job: jobData(job)})
+	if err != nil {
+		s.logger.Warn("Failed to marshal webhook", "job_id", job.ID, "error", err)
+		return
+	}
+	go s.send(job.ID, job.CallbackURL, body)
+}
+
+// send POSTs body to callbackURL, retrying network errors, 429 and 5xx
+// responses with exponential backoff
+func (s *WebhookSender) send(jobID, callbackURL string, body []byte) {
+	delay := webhookRetryDelay
+	for attempt := 1; ; attempt++ {
+		retry, err := s.post(callbackURL, body)
+		if err == nil {
+			s.logger.Info("Webhook delivered", "job_id", jobID, "attempt", attempt)
+			return
+		}
+		if !retry || attempt == webhookAttempts {
+			s.logger.Warn("Webhook delivery failed", "job_id", jobID, "attempts", attempt, "error", err)
+			return
+		}
+		time.Sleep(delay)
+		delay *= 2
+	}
+}
+
+// post makes one delivery attempt and reports whether a failure is worth retrying
+func (s *WebhookSender) post(callbackURL string, body []byte) (bool, error) {
+	secret := s.live.Get().Webhooks.Secret
+	if secret == "" {
+		return false, fmt.Errorf("WEBHOOK_SECRET is no longer set")
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), webhookTimeout)
+	defer cancel()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, callbackURL, bytes.NewReader(body))
+	if err != nil {
+		return false, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("User-Agent", ServerName+"/"+ServerVersion)
+	// Each attempt is signed anew so retries stay within the receiver's tolerance
+	req.Header.Set(signing.Header, signing.Sign([]byte(secret), time.Now(), body))
+
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return !errors.Is(err, errCallbackAddressBlocked), err
+	}
+	_ = resp.Body.Close()
+
+	switch {
+	case resp.StatusCode < 300:
+		return false, nil
+	case resp.StatusCode == http.StatusTooManyRequests || resp.StatusCode >= 500:
+		return true, fmt.Errorf("callback returned HTTP %d", resp.StatusCode)
+	default:
+		return false, fmt.Errorf("callback returned HTTP %d", resp.StatusCode)
+	}
+}
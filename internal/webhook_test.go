@@ -0,0 +1,74 @@
+package internal
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestWebhookCheckURLEmptyAllowlistDeniesAll(t *testing.T) {
+	config := WebhookConfig{Secret: "s"}
+	for _, raw := range []string{
+		"https://example.com/hook",
+		"http://127.0.0.1:8080/hook",
+		"http://169.254.169.254/latest/meta-data/",
+		"http://10.0.0.5/hook",
+	} {
+		require.ErrorContains(t, config.CheckURL(raw), "WEBHOOK_ALLOWED_HOSTS", raw)
+	}
+
+	config.AllowedHosts = []string{"hooks.example.com"}
+	require.NoError(t, config.CheckURL("https://HOOKS.example.com/done"))
+	require.ErrorContains(t, config.CheckURL("https://example.com/hook"), "not allowed")
+}
+
+func TestWebhookDialControlRejectsInternalAddresses(t *testing.T) {
+	control := webhookDialControl(NewLiveConfig(&Config{}))
+
+	for _, address := range []string{
+		"127.0.0.1:80",
+		"[::1]:80",
+		"10.1.2.3:443",
+		"192.168.0.10:80",
+		"[fd00::1]:80",
+		"169.254.169.254:80",
+		"[fe80::1]:80",
+		"0.0.0.0:80",
+		"[::ffff:127.0.0.1]:80",
+	} {
+		require.ErrorIs(t, control("tcp", address, nil), errCallbackAddressBlocked, address)
+	}
+	require.NoError(t, control("tcp", "93.184.216.34:443", nil))
+
+	// Opting in reaches private receivers, never link-local metadata endpoints
+	control = webhookDialControl(NewLiveConfig(&Config{Webhooks: WebhookConfig{AllowPrivateNetworks: true}}))
+	require.NoError(t, control("tcp", "127.0.0.1:80", nil))
+	require.NoError(t, control("tcp", "10.1.2.3:443", nil))
+	require.Error(t, control("tcp", "169.254.169.254:80", nil))
+}
+
+func TestWebhookSenderDoesNotDialLoopback(t *testing.T) {
+	var hits int
+	receiver := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		hits++
+	}))
+	defer receiver.Close()
+
+	config := &Config{Webhooks: WebhookConfig{Secret: "s", AllowedHosts: []string{"127.0.0.1"}}}
+	require.NoError(t, config.Webhooks.CheckURL(receiver.URL))
+
+	// An allowed host that resolves to loopback is still refused when dialed
+	sender := NewWebhookSender(NewLiveConfig(config))
+	retry, err := sender.post(receiver.URL, []byte(`{}`))
+	require.ErrorIs(t, err, errCallbackAddressBlocked)
+	require.False(t, retry)
+	require.Zero(t, hits)
+
+	config.Webhooks.AllowPrivateNetworks = true
+	sender = NewWebhookSender(NewLiveConfig(config))
+	_, err = sender.post(receiver.URL, []byte(`{}`))
+	require.NoError(t, err)
+	require.Equal(t, 1, hits)
+}
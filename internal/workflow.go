@@ -0,0 +1,576 @@
+package internal
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"maps"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/mark3labs/mcp-go/mcp"
+)
+
+// Bounds of the sub-questions a research workflow is decomposed into
+const (
+	DefaultWorkflowSubQuestions = 4
+	MinWorkflowSubQuestions     = 2
+	MaxWorkflowSubQuestions     = 8
+)
+
+// workflowPlanPrompt asks the planning call for the sub-questions of a
+// research request; %d is their maximum number
+const workflowPlanPrompt = `You plan web research. Break the user's research request into at most %d self-contained sub-questions that can each be answered by one web search and together cover the request. Do not answer them. Reply with only a JSON array of strings.`
+
+// workflowSynthesisPrompt asks the synthesis call for the final report
+const workflowSynthesisPrompt = `You write research reports. Answer the user's research request from the findings provided, which were researched as separate sub-questions. Open with a short summary, organize the report in "## " sections, reconcile findings that conflict and say so where they do, and end with a "## Open questions" section when the findings leave gaps. Use only the findings, and cite them with their [n] markers, which refer to the numbered sources.`
+
+// ResearchWorkflow is the outcome of perplexity_research_workflow
+type ResearchWorkflow struct {
+	// SubQuestions are the planned sub-questions, with the answer or error of each
+	SubQuestions []string
+	Answers      []*SearchResult
+	Errors       []error
+	// Plan is the answer of the planning call
+	Plan *SearchResult
+	// Report is the synthesized report, citing Citations
+	Report    *SearchResult
+	Citations []Citation
+	// PlanUsage, SearchUsage and SynthesisUsage add up the tokens of each step
+	PlanUsage      Usage
+	SearchUsage    Usage
+	SynthesisUsage Usage
+	// Partial is set when the time budget expired before the synthesis, and
+	// Report holds the sub-question answers researched in time
+	Partial bool
+}
+
+// workflowOptions are the arguments of a research workflow beyond its search request
+type workflowOptions struct {
+	// SynthesisModel plans the sub-questions and writes the report
+	SynthesisModel  string
+	MaxSubQuestions int
+	// Concurrency is the number of sub-questions searched at once
+	Concurrency int
+	// Budget bounds the whole workflow; zero leaves it unbounded
+	Budget time.Duration
+}
+
+// CreateResearchWorkflowTool creates the perplexity_research_workflow tool for use with mcp-go
+func CreateResearchWorkflowTool(config *Config) mcp.Tool {
+	tool := mcp.Tool{
+		Name:        "perplexity_research_workflow",
+		Description: "Research a broad question in several steps: plan sub-questions, search each one independently in parallel, then synthesize a report with the merged citations of all searches. A deep research mode built on the faster Sonar models.",
+		InputSchema: mcp.ToolInputSchema{
+			Type: "object",
+			Properties: map[string]any{
+				"query": map[string]any{
+					"type":        "string",
+					"description": "The research request",
+					"minLength":   1,
+					"maxLength":   config.MaxQueryLength,
+				},
+				"max_sub_questions": map[string]any{
+					"type":        "integer",
+					"description": fmt.Sprintf("Maximum number of sub-questions to research (optional, defaults to %d)", DefaultWorkflowSubQuestions),
+					"minimum":     MinWorkflowSubQuestions,
+					"maximum":     MaxWorkflowSubQuestions,
+					"default":     DefaultWorkflowSubQuestions,
+				},
+				"model": map[string]any{
+					"type":        "string",
+					"description": fmt.Sprintf("The Sonar model that searches the sub-questions (optional, defaults to '%s')", config.DefaultModelFor("perplexity_research_workflow")),
+					"enum":        config.Models(),
+				},
+				"search_mode": map[string]any{
+					"type":        "string",
+					"description": "The search mode to use (optional, defaults to 'web')",
+					"enum":        SearchModes,
+				},
+				"date_range": map[string]any{
+					"type":        "string",
+					"description": "Filter search results by date range (optional)",
+					"enum":        DateRanges,
+				},
+				"sources": map[string]any{
+					"type":        "array",
+					"description": fmt.Sprintf("Limit search to specific domains (optional, max %d)", config.MaxDomainFilters),
+					"items": map[string]any{
+						"type": "string",
+					},
+					"maxItems": config.MaxDomainFilters,
+				},
+				"exclude_sources": map[string]any{
+					"type":        "array",
+					"description": fmt.Sprintf("Domains to leave out of the search (optional; at most %d together with sources)", config.MaxDomainFilters),
+					"items": map[string]any{
+						"type": "string",
+					},
+					"maxItems": config.MaxDomainFilters,
+				},
+				"output_format": map[string]any{
+					"type":        "string",
+					"description": "Format of the returned result (optional, defaults to 'json')",
+					"enum":        []string{OutputFormatJSON, OutputFormatMarkdown},
+					"default":     OutputFormatJSON,
+				},
+				"concurrency": map[string]any{
+					"type":        "integer",
+					"description": fmt.Sprintf("Sub-questions to search at once (optional, defaults to and at most %d)", config.BatchConcurrency),
+					"minimum":     1,
+					"maximum":     config.BatchConcurrency,
+				},
+				"budget_seconds": map[string]any{
+					"type":        "integer",
+					"description": "Time limit of the whole workflow (optional). When it expires, the answers researched so far are returned with partial=true instead of a report.",
+					"minimum":     1,
+				},
+			},
+			Required: []string{"query"},
+		},
+		OutputSchema: researchWorkflowOutputSchema(),
+	}
+	relaxModelSchema(&tool, config)
+	// synthesis_model takes the same models as model
+	synthesisModel := maps.Clone(tool.InputSchema.Properties["model"].(map[string]any))
+	synthesisModel["description"] = "The model that plans the sub-questions and writes the report (optional, defaults to model)"
+	tool.InputSchema.Properties["synthesis_model"] = synthesisModel
+	return tool
+}
+
+// ResearchWorkflowHandler creates the handler function for the perplexity_research_workflow tool
+func ResearchWorkflowHandler(client SearchProvider, live *LiveConfig, results *ResultStore, usage *UsageTracker) func(ctx context.Context, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+	return func(ctx context.Context, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+		config := live.Get()
+
+		req, options, err := parseResearchWorkflowRequest(request, config)
+		if err != nil {
+			return researchWorkflowError(err), err
+		}
+
+		// Refuse new API calls once a hard budget limit is reached
+		if _, err := config.Budgets.Check(usage); err != nil {
+			return researchWorkflowError(err), err
+		}
+
+		progress := newProgressReporter(ctx, request)
+		workflow, err := runResearchWorkflow(ctx, client, config, results, usage, *req, options, progress)
+		if err != nil {
+			return researchWorkflowError(err), err
+		}
+		budgetWarnings, _ := config.Budgets.Check(usage)
+
+		data := researchWorkflowData(workflow)
+		var content string
+		if req.OutputFormat == OutputFormatMarkdown {
+			content = formatResearchWorkflow(workflow)
+		} else {
+			jsonBytes, err := json.MarshalIndent(data, "", "  ")
+			if err != nil {
+				err = fmt.Errorf("failed to marshal report: %w", err)
+				return researchWorkflowError(err), err
+			}
+			content = string(jsonBytes)
+		}
+
+		// Report the tokens and cost of every step, not only the synthesis
+		calls := append([]*SearchResult{workflow.Plan}, workflow.Answers...)
+		if !workflow.Partial {
+			calls = append(calls, workflow.Report)
+		}
+		meta := resultMeta(config.ModelPrices, workflow.Report, calls...)
+		return &mcp.CallToolResult{
+			Content: []mcp.Content{
+				mcp.TextContent{
+					Type: "text",
+					Text: content,
+				},
+			},
+			StructuredContent: data,
+			IsError:           false,
+			Result:            mcp.Result{Meta: withBudgetWarnings(meta, budgetWarnings)},
+		}, nil
+	}
+}
+
+// runResearchWorkflow plans sub-questions of req with the synthesis model,
+// searches them in parallel like perplexity_batch_search, and synthesizes the
+// answers into a report. It fails only when planning fails, no sub-question
+// could be answered, or the synthesis fails. When options.Budget expires
+// after a sub-question was answered, the answers so far are returned as a
+// partial workflow instead.
+func runResearchWorkflow(ctx context.Context, client SearchProvider, config *Config, results *ResultStore, usage *UsageTracker, req SearchRequest, options workflowOptions, progress *progressReporter) (*ResearchWorkflow, error) {
+	workflow := &ResearchWorkflow{}
+
+	stepCtx := ctx
+	if options.Budget > 0 {
+		var cancel context.CancelFunc
+		stepCtx, cancel = context.WithTimeout(ctx, options.Budget)
+		defer cancel()
+	}
+	budgetErr := fmt.Errorf("budget_seconds of %.0f expired", options.Budget.Seconds())
+	// expired reports whether err is a call cut short by the budget
+	expired := func(err error) bool {
+		var timeoutErr *TimeoutError
+		cut := errors.Is(err, context.DeadlineExceeded) || errors.As(err, &timeoutErr) && timeoutErr.Kind == TimeoutKindTool
+		return options.Budget > 0 && cut && stepCtx.Err() != nil && ctx.Err() == nil
+	}
+
+	progress.report("planning sub-questions")
+	plan, err := workflowCompletion(stepCtx, client, config, usage, SearchRequest{
+		Query:        req.Query,
+		Model:        options.SynthesisModel,
+		SystemPrompt: fmt.Sprintf(workflowPlanPrompt, options.MaxSubQuestions),
+	})
+	if expired(err) {
+		return nil, fmt.Errorf("planning step: %w", budgetErr)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("planning step: %w", err)
+	}
+	workflow.Plan, workflow.PlanUsage = plan, plan.Usage
+	workflow.SubQuestions = parseSubQuestions(plan.Content, options.MaxSubQuestions)
+	if len(workflow.SubQuestions) == 0 {
+		return nil, fmt.Errorf("planning step: no sub-questions in the plan")
+	}
+
+	reqs := make([]SearchRequest, len(workflow.SubQuestions))
+	for i, question := range workflow.SubQuestions {
+		reqs[i] = req
+		reqs[i].Query = question
+	}
+	workflow.Answers, workflow.Errors = searchAll(stepCtx, "perplexity_research_workflow", client, config, results, usage, reqs, options.Concurrency, progress)
+	var answered []*SearchResult
+	for i, answer := range workflow.Answers {
+		if answer != nil {
+			answered = append(answered, answer)
+			workflow.SearchUsage = addUsage(workflow.SearchUsage, answer.Usage)
+		} else if expired(workflow.Errors[i]) {
+			workflow.Errors[i] = budgetErr
+		}
+	}
+	if len(answered) == 0 {
+		return nil, fmt.Errorf("search step: every sub-question failed, the first with: %w", workflow.Errors[0])
+	}
+
+	if _, err := config.Budgets.Check(usage); err != nil {
+		return nil, fmt.Errorf("synthesis step: %w", err)
+	}
+	citations, contents := mergeCitations(answered)
+	if stepCtx.Err() != nil && ctx.Err() == nil {
+		return partialWorkflow(ctx, workflow, results, citations, contents, budgetErr), nil
+	}
+	progress.report(fmt.Sprintf("synthesizing %d answers", len(answered)))
+	report, err := workflowCompletion(stepCtx, client, config, usage, SearchRequest{
+		Query:        req.Query,
+		Model:        options.SynthesisModel,
+		SystemPrompt: workflowSynthesisPrompt,
+		ContextMessages: []Message{
+			{Role: "user", Content: workflowFindings(workflow.SubQuestions, workflow.Answers, contents, citations)},
+			{Role: "assistant", Content: "I will write the report from these findings."},
+		},
+	})
+	if expired(err) {
+		return partialWorkflow(ctx, workflow, results, citations, contents, budgetErr), nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("synthesis step: %w", err)
+	}
+	workflow.SynthesisUsage = report.Usage
+	report.Citations = citations
+	workflow.Report = config.shownResult(report)
+	workflow.Citations = workflow.Report.Citations
+	// The report is stored without a query key, as no search request produces it
+	results.Put(ctx, report)
+	return workflow, nil
+}
+
+// partialWorkflow completes a workflow whose budget expired before the
+// synthesis with a report of the answered sub-questions. citations and
+// contents are as merged for the synthesis.
+func partialWorkflow(ctx context.Context, workflow *ResearchWorkflow, results *ResultStore, citations []Citation, contents []string, budgetErr error) *ResearchWorkflow {
+	var b strings.Builder
+	fmt.Fprintf(&b, "No report was written: %s. These are the answers to the sub-questions researched in time.\n", budgetErr)
+	next := 0
+	var model string
+	for i, question := range workflow.SubQuestions {
+		if workflow.Answers[i] == nil {
+			continue
+		}
+		model = workflow.Answers[i].Model
+		fmt.Fprintf(&b, "\n## %s\n\n%s\n", question, contents[next])
+		next++
+	}
+
+	report := &SearchResult{
+		ID:        "partial_" + NewRequestID(),
+		Model:     model,
+		Content:   strings.TrimSpace(b.String()),
+		Citations: citations,
+		Created:   time.Now(),
+	}
+	results.Put(ctx, report)
+	workflow.Report, workflow.Citations, workflow.Partial = report, citations, true
+	return workflow
+}
+
+// workflowCompletion makes a planning or synthesis call, with web search
+// disabled, and records its usage
+func workflowCompletion(ctx context.Context, client SearchProvider, config *Config, usage *UsageTracker, req SearchRequest) (*SearchResult, error) {
+	req.Options = map[string]string{"disable_search": "true"}
+	result, err := searchWithModelFallback(ctx, client, config, "perplexity_research_workflow", req, nil)
+	if err != nil {
+		return nil, err
+	}
+	usage.Record(config.ModelPrices, "perplexity_research_workflow", "", result)
+	return withReasoningOutput(result, ReasoningStrip), nil
+}
+
+// parseSubQuestions reads the sub-questions of a plan, a JSON array of
+// strings, falling back to its list items when the model wrote a list
+func parseSubQuestions(plan string, maxSubQuestions int) []string {
+	var candidates []string
+	start, end := strings.Index(plan, "["), strings.LastIndex(plan, "]")
+	if start < 0 || end < start || json.Unmarshal([]byte(plan[start:end+1]), &candidates) != nil {
+		candidates = nil
+		for _, line := range strings.Split(plan, "\n") {
+			line = strings.TrimSpace(line)
+			if item := strings.TrimLeft(line, "-*•0123456789.) "); item != line {
+				candidates = append(candidates, item)
+			}
+		}
+	}
+
+	var questions []string
+	seen := make(map[string]bool)
+	for _, question := range candidates {
+		question = strings.TrimSpace(question)
+		if question == "" || seen[strings.ToLower(question)] {
+			continue
+		}
+		seen[strings.ToLower(question)] = true
+		questions = append(questions, question)
+		if len(questions) == maxSubQuestions {
+			break
+		}
+	}
+	return questions
+}
+
+// mergeCitations numbers the citations of answers in one list, citations to
+// the same page sharing a number, and returns the content of each answer with
+// its [n] markers rewritten to the merged numbers
+func mergeCitations(answers []*SearchResult) ([]Citation, []string) {
+	var merged []Citation
+	numbers := make(map[string]int)
+	contents := make([]string, len(answers))
+	for i, answer := range answers {
+		local := make(map[int]int, len(answer.Citations))
+		for _, citation := range answer.Citations {
+			number, ok := numbers[citation.URL]
+			if !ok {
+				number = len(merged) + 1
+				numbers[citation.URL] = number
+				merged = append(merged, citation)
+				merged[number-1].Number = number
+			}
+			local[citation.Number] = number
+		}
+		contents[i] = citationMarkerPattern.ReplaceAllStringFunc(answer.Content, func(marker string) string {
+			old, err := strconv.Atoi(marker[1 : len(marker)-1])
+			if number, ok := local[old]; err == nil && ok {
+				return "[" + strconv.Itoa(number) + "]"
+			}
+			return marker
+		})
+	}
+	return merged, contents
+}
+
+// workflowFindings is the numbered sources and the answer to each sub-question
+// as given to the synthesis call, cut to the length of a context message.
+// contents holds the rewritten content of the answered sub-questions in order.
+func workflowFindings(questions []string, answers []*SearchResult, contents []string, citations []Citation) string {
+	var b strings.Builder
+	b.WriteString("Sources:\n")
+	for _, citation := range citations {
+		fmt.Fprintf(&b, "[%d] %s\n", citation.Number, strings.TrimSpace(citation.Title+" "+citation.URL))
+	}
+	b.WriteString("\nFindings:\n")
+	next := 0
+	for i, question := range questions {
+		if answers[i] == nil {
+			continue
+		}
+		fmt.Fprintf(&b, "\n### %s\n\n%s\n", question, contents[next])
+		next++
+	}
+	findings := b.String()
+	if len(findings) > MaxMessageLength {
+		findings = strings.ToValidUTF8(findings[:MaxMessageLength], "")
+	}
+	return findings
+}
+
+// Usage adds up the tokens of every step of the workflow
+func (w *ResearchWorkflow) Usage() Usage {
+	return addUsage(addUsage(w.PlanUsage, w.SearchUsage), w.SynthesisUsage)
+}
+
+func addUsage(a, b Usage) Usage {
+	return Usage{
+		PromptTokens:     a.PromptTokens + b.PromptTokens,
+		CompletionTokens: a.CompletionTokens + b.CompletionTokens,
+		TotalTokens:      a.TotalTokens + b.TotalTokens,
+	}
+}
+
+// researchWorkflowData is the JSON result of perplexity_research_workflow, also
+// returned as structuredContent
+func researchWorkflowData(workflow *ResearchWorkflow) map[string]any {
+	report := workflow.Report
+	subQuestions := make([]map[string]any, len(workflow.SubQuestions))
+	for i, question := range workflow.SubQuestions {
+		item := map[string]any{"index": i, "question": question}
+		if answer := workflow.Answers[i]; answer != nil {
+			item["id"] = answer.ID
+			item["resource_uri"] = SearchURI(answer.ID)
+		} else {
+			item["error"] = workflow.Errors[i].Error()
+		}
+		subQuestions[i] = item
+	}
+
+	response := map[string]any{
+		"id":            report.ID,
+		"resource_uri":  SearchURI(report.ID),
+		"model":         report.Model,
+		"content":       report.Content,
+		"created":       report.Created,
+		"sub_questions": subQuestions,
+		"usage":         workflow.Usage(),
+		"step_usage": map[string]any{
+			"plan":      workflow.PlanUsage,
+			"search":    workflow.SearchUsage,
+			"synthesis": workflow.SynthesisUsage,
+		},
+	}
+	if len(workflow.Citations) > 0 {
+		response["citations"] = workflow.Citations
+	}
+	if report.Reasoning != "" {
+		response["reasoning"] = report.Reasoning
+	}
+	if report.RequestedModel != "" {
+		response["requested_model"] = report.RequestedModel
+	}
+	if workflow.Partial {
+		response["partial"] = true
+	}
+	return response
+}
+
+// formatResearchWorkflow renders the report as markdown with its sources and
+// sub-questions
+func formatResearchWorkflow(workflow *ResearchWorkflow) string {
+	var b strings.Builder
+	b.WriteString(workflow.Report.Content)
+	if len(workflow.Citations) > 0 {
+		b.WriteString("\n\n## Citations\n\n")
+		for _, citation := range workflow.Citations {
+			fmt.Fprintf(&b, "%d. [%s](%s)%s\n", citation.Number, citationTitle(citation), citation.URL, citationIdentifiers(citation))
+		}
+	}
+	b.WriteString("\n## Sub-questions\n\n")
+	for i, question := range workflow.SubQuestions {
+		if answer := workflow.Answers[i]; answer != nil {
+			fmt.Fprintf(&b, "- %s (%s)\n", question, SearchURI(answer.ID))
+		} else {
+			fmt.Fprintf(&b, "- %s (failed: %s)\n", question, workflow.Errors[i])
+		}
+	}
+	fmt.Fprintf(&b, "\n_Full result: %s_\n", SearchURI(workflow.Report.ID))
+	return strings.TrimSpace(b.String())
+}
+
+func researchWorkflowError(err error) *mcp.CallToolResult {
+	return &mcp.CallToolResult{
+		Content: []mcp.Content{
+			mcp.TextContent{
+				Type: "text",
+				Text: fmt.Sprintf("Research workflow failed: %s", err.Error()),
+			},
+		},
+		IsError: true,
+		Result:  mcp.Result{Meta: errorMeta(err)},
+	}
+}
+
+// parseResearchWorkflowRequest builds the search request shared by the
+// sub-questions and reads the workflow's own arguments
+func parseResearchWorkflowRequest(request mcp.CallToolRequest, config *Config) (*SearchRequest, workflowOptions, error) {
+	options := workflowOptions{MaxSubQuestions: DefaultWorkflowSubQuestions, Concurrency: config.BatchConcurrency}
+	query, err := request.RequireString("query")
+	if err != nil {
+		return nil, options, fmt.Errorf("query must be a string")
+	}
+	limit, err := integerArgument(request, "max_sub_questions")
+	if err != nil {
+		return nil, options, err
+	}
+	if limit != nil {
+		if *limit < MinWorkflowSubQuestions || *limit > MaxWorkflowSubQuestions {
+			return nil, options, fmt.Errorf("invalid max_sub_questions: %d (must be between %d and %d)", *limit, MinWorkflowSubQuestions, MaxWorkflowSubQuestions)
+		}
+		options.MaxSubQuestions = *limit
+	}
+	// Unlike perplexity_batch_search, a concurrency above the server's is an
+	// error, so a caller pacing itself learns the limit it is held to
+	concurrency, err := integerArgument(request, "concurrency")
+	if err != nil {
+		return nil, options, err
+	}
+	if concurrency != nil {
+		if *concurrency < 1 || *concurrency > config.BatchConcurrency {
+			return nil, options, fmt.Errorf("invalid concurrency: %d (must be between 1 and the server's BATCH_CONCURRENCY of %d)", *concurrency, config.BatchConcurrency)
+		}
+		options.Concurrency = *concurrency
+	}
+	budget, err := integerArgument(request, "budget_seconds")
+	if err != nil {
+		return nil, options, err
+	}
+	if budget != nil {
+		if *budget < 1 {
+			return nil, options, fmt.Errorf("budget_seconds must be at least 1")
+		}
+		options.Budget = time.Duration(*budget) * time.Second
+	}
+
+	req := &SearchRequest{
+		Query:          query,
+		Model:          request.GetString("model", ""),
+		SearchMode:     request.GetString("search_mode", ""),
+		DateRange:      request.GetString("date_range", ""),
+		Sources:        request.GetStringSlice("sources", nil),
+		ExcludeSources: request.GetStringSlice("exclude_sources", nil),
+		OutputFormat:   request.GetString("output_format", ""),
+	}
+	config.applyToolDefaults("perplexity_research_workflow", req)
+	req.MaxQueryLength = config.MaxQueryLength
+	req.MaxDomainFilters = config.MaxDomainFilters
+	if err := config.CheckModel(req.Model); err != nil {
+		return nil, options, err
+	}
+	if err := req.Validate(); err != nil {
+		return nil, options, err
+	}
+
+	options.SynthesisModel = request.GetString("synthesis_model", req.Model)
+	if err := config.CheckModel(options.SynthesisModel); err != nil {
+		return nil, options, err
+	}
+	return req, options, nil
+}
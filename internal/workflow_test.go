@@ -0,0 +1,78 @@
+package internal
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/mark3labs/mcp-go/mcp"
+	"github.com/stretchr/testify/require"
+)
+
+func TestResearchWorkflowConcurrency(t *testing.T) {
+	config := reloadableConfig(t)
+	config.BatchConcurrency = 3
+
+	for _, tc := range []struct {
+		name        string
+		concurrency any
+		want        int
+		err         string
+	}{
+		{name: "default", want: 3},
+		{name: "lower", concurrency: 1, want: 1},
+		{name: "server maximum", concurrency: 3, want: 3},
+		{name: "above server maximum", concurrency: 4, err: "invalid concurrency: 4 (must be between 1 and the server's BATCH_CONCURRENCY of 3)"},
+		{name: "zero", concurrency: 0, err: "invalid concurrency: 0"},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			var request mcp.CallToolRequest
+			request.Params.Arguments = map[string]any{"query": "heat pumps"}
+			if tc.concurrency != nil {
+				request.Params.Arguments.(map[string]any)["concurrency"] = tc.concurrency
+			}
+
+			_, options, err := parseResearchWorkflowRequest(request, config)
+			if tc.err != "" {
+				require.ErrorContains(t, err, tc.err)
+				return
+			}
+			require.NoError(t, err)
+			require.Equal(t, tc.want, options.Concurrency)
+		})
+	}
+}
+
+func TestResearchWorkflowReturnsPartialResultWhenBudgetExpires(t *testing.T) {
+	client := &stubProvider{search: func(ctx context.Context, req SearchRequest) (*SearchResult, error) {
+		switch {
+		case strings.HasPrefix(req.SystemPrompt, "You plan"):
+			return &SearchResult{ID: "plan", Model: req.Model, Content: `["fast question", "slow question"]`}, nil
+		case req.Query == "fast question":
+			return &SearchResult{
+				ID:        "fast",
+				Model:     req.Model,
+				Content:   "Heat pumps are spreading [1].",
+				Citations: []Citation{{Number: 1, URL: "https://example.com/heat"}},
+			}, nil
+		}
+		// The slow sub-question and the synthesis never finish in time
+		<-ctx.Done()
+		return nil, ctx.Err()
+	}}
+	handler := ResearchWorkflowHandler(client, NewLiveConfig(reloadableConfig(t)), NewResultStore(10), NewUsageTracker())
+
+	var request mcp.CallToolRequest
+	request.Params.Arguments = map[string]any{"query": "heat pumps", "budget_seconds": 1}
+	result, err := handler(context.Background(), request)
+	require.NoError(t, err)
+	require.False(t, result.IsError)
+
+	data := result.StructuredContent.(map[string]any)
+	require.Equal(t, true, data["partial"])
+	require.Contains(t, data["content"], "## fast question\n\nHeat pumps are spreading [1].")
+	require.Equal(t, "https://example.com/heat", data["citations"].([]Citation)[0].URL)
+	subQuestions := data["sub_questions"].([]map[string]any)
+	require.Equal(t, "fast", subQuestions[0]["id"])
+	require.Equal(t, "budget_seconds of 1 expired", subQuestions[1]["error"])
+}
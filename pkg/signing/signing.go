@@ -0,0 +1,102 @@
+// Package signing signs and verifies payloads sent by the Perplexity MCP server
+// to external systems, such as webhook deliveries and exported report manifests.
+//
+// A signature covers a Unix timestamp and the exact payload bytes using
+// HMAC-SHA256 with a shared secret, and is carried in a single header:
+//
+//	X-Perplexity-MCP-Signature: t=1700000000,v1=5257a869e7...
+//
+// Receivers should call Verify with the raw request body before parsing it.
+package signing
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Header is the HTTP header that carries the signature
+const Header = "X-Perplexity-MCP-Signature"
+
+// DefaultTolerance is the replay window: signatures older or newer than this are rejected
+const DefaultTolerance = 5 * time.Minute
+
+const schemeV1 = "v1"
+
+var (
+	ErrMissingSignature = errors.New("signing: missing signature")
+	ErrMalformed        = errors.New("signing: malformed signature header")
+	ErrExpired          = errors.New("signing: timestamp outside tolerance")
+	ErrMismatch         = errors.New("signing: signature mismatch")
+)
+
+// Sign returns the header value for payload signed with secret at timestamp
+func Sign(secret []byte, timestamp time.Time, payload []byte) string {
+	ts := timestamp.Unix()
+	return fmt.Sprintf("t=%d,%s=%s", ts, schemeV1, hex.EncodeToString(compute(secret, ts, payload)))
+}
+
+// Verify checks that header is a valid signature of payload under secret, made
+// within tolerance of now. A tolerance of zero uses DefaultTolerance. Several v1
+// signatures may be present, e.g. during secret rotation; any match is accepted.
+func Verify(secret []byte, header string, payload []byte, now time.Time, tolerance time.Duration) error {
+	if header == "" {
+		return ErrMissingSignature
+	}
+	if tolerance <= 0 {
+		tolerance = DefaultTolerance
+	}
+
+	var ts int64
+	var signatures [][]byte
+	for _, part := range strings.Split(header, ",") {
+		key, value, ok := strings.Cut(strings.TrimSpace(part), "=")
+		if !ok {
+			return ErrMalformed
+		}
+		switch key {
+		case "t":
+			parsed, err := strconv.ParseInt(value, 10, 64)
+			if err != nil {
+				return ErrMalformed
+			}
+			ts = parsed
+		case schemeV1:
+			signature, err := hex.DecodeString(value)
+			if err != nil {
+				return ErrMalformed
+			}
+			signatures = append(signatures, signature)
+		}
+	}
+	if ts == 0 || len(signatures) == 0 {
+		return ErrMalformed
+	}
+
+	age := now.Sub(time.Unix(ts, 0))
+	if age > tolerance || age < -tolerance {
+		return ErrExpired
+	}
+
+	expected := compute(secret, ts, payload)
+	for _, signature := range signatures {
+		if hmac.Equal(signature, expected) {
+			return nil
+		}
+	}
+	return ErrMismatch
+}
+
+// compute returns HMAC-SHA256 over "<timestamp>.<payload>"
+func compute(secret []byte, ts int64, payload []byte) []byte {
+	mac := hmac.New(sha256.New, secret)
+	mac.Write([]byte(strconv.FormatInt(ts, 10)))
+	mac.Write([]byte("."))
+	mac.Write(payload)
+	return mac.Sum(nil)
+}
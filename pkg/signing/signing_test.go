@@ -0,0 +1,34 @@
+package signing
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSignVerify(t *testing.T) {
+	secret := []byte("shared-secret")
+	payload := []byte(`{"event":"report.exported"}`)
+	now := time.Unix(1700000000, 0)
+	header := Sign(secret, now, payload)
+
+	assert.NoError(t, Verify(secret, header, payload, now.Add(time.Minute), 0))
+	assert.ErrorIs(t, Verify([]byte("other-secret"), header, payload, now, 0), ErrMismatch)
+	assert.ErrorIs(t, Verify(secret, header, []byte(`{"event":"tampered"}`), now, 0), ErrMismatch)
+	assert.ErrorIs(t, Verify(secret, header, payload, now.Add(DefaultTolerance+time.Second), 0), ErrExpired)
+	assert.ErrorIs(t, Verify(secret, "", payload, now, 0), ErrMissingSignature)
+	assert.ErrorIs(t, Verify(secret, "v1=zz", payload, now, 0), ErrMalformed)
+}
+
+func TestVerifyAcceptsAnyRotatedSignature(t *testing.T) {
+	payload := []byte("manifest")
+	now := time.Unix(1700000000, 0)
+	current := Sign([]byte("new"), now, payload)
+	previous := Sign([]byte("old"), now, payload)
+
+	header := current + "," + previous[strings.Index(previous, "v1="):]
+	assert.NoError(t, Verify([]byte("old"), header, payload, now, 0))
+	assert.NoError(t, Verify([]byte("new"), header, payload, now, 0))
+}